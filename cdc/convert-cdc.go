@@ -14,7 +14,11 @@ package main
 //    go run convert-cdc.go crypto_dot_com.csv standard_transactions.csv
 
 // Notes:
-// Timestamps are in UTC. These are converted to UK local time. (Currently no conversion is necessary but it will be necessary starting in March 2022).
+// Timestamps are in UTC. These are converted to UK local time (GMT/BST, correctly handling every
+// daylight-saving transition) via pkg/timeconv - see convertUtcToUKTime.
+// -format ofx writes an OFX 2.x document instead of the CSV above, via pkg/importers' cdcImporter
+// (see pkg/importers/cdc.go) and pkg/ofxwriter, rather than this file's own convertTransactions -
+// that function's per-currency, blank-row-separated CSV shape has no OFX equivalent to build from.
 
 import (
 	"encoding/csv"
@@ -24,12 +28,16 @@ import (
 	"os"
 	"sort"
 	"strings"
-	"time"
+
+	"github.com/AntonioCarlini/data-processing/pkg/importers"
+	"github.com/AntonioCarlini/data-processing/pkg/ofxwriter"
+	"github.com/AntonioCarlini/data-processing/pkg/timeconv"
 )
 
 // Open the input file and convert it to the output format
 func main() {
 
+	format := flag.String("format", "csv", "output format: \"csv\" (default) or \"ofx\"")
 	flag.Parse()
 
 	inputs := flag.Args()
@@ -42,9 +50,45 @@ func main() {
 
 	transactions := readTransactions(transactionsFilename)
 
-	convertedTransactions := convertTransactions(transactions)
+	switch *format {
+	case "csv":
+		convertedTransactions := convertTransactions(transactions)
+		writeConvertedTransactions(outputFile, convertedTransactions)
+	case "ofx":
+		if err := writeOFXTransactions(outputFile, transactions); err != nil {
+			log.Fatalf("Cannot write -format ofx output: %s\n", err.Error())
+		}
+	default:
+		log.Fatalf("Unknown -format %q: expected \"csv\" or \"ofx\"\n", *format)
+	}
+}
+
+// writeOFXTransactions converts transactions (crypto.com's own CSV shape, header row included)
+// through pkg/importers' registered "cdc" Importer and renders the result as an OFX 2.x document
+// via pkg/ofxwriter, in forward time order (crypto.com's export itself lists rows newest-first -
+// see convertTransactions' own per-currency reversal for the CSV path's equivalent).
+func writeOFXTransactions(outputFile string, transactions [][]string) error {
+	importer, err := importers.Lookup(transactions[0])
+	if err != nil {
+		return fmt.Errorf("selecting an importer: %w", err)
+	}
+
+	rows := append([][]string{}, transactions[1:]...)
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+
+	txs, err := importer.Convert(rows)
+	if err != nil {
+		return fmt.Errorf("converting transactions: %w", err)
+	}
+
+	ofxDocument, err := ofxwriter.Write("crypto.com", "CDC", txs)
+	if err != nil {
+		return fmt.Errorf("rendering OFX: %w", err)
+	}
 
-	writeConvertedTransactions(outputFile, convertedTransactions)
+	return os.WriteFile(outputFile, []byte(ofxDocument), 0644)
 }
 
 func readTransactions(name string) [][]string {
@@ -348,31 +392,17 @@ func testSlicesEqual(a, b []string) bool {
 	return true
 }
 
-// Converts from UTC to UK local time.
-
-// UTC and GMT match.
-// During these dates (from https://www.gov.uk/when-do-the-clocks-change) the UK runs on GMT+1:
-//
-// 2020 	29 March 	25 October
-// 2021 	28 March 	31 October
-// 2022 	27 March 	30 October
-// 2023 	26 March 	29 October
-//
-// In practice the next BST date is in NOV-2021 so at least until 27-MAR-2022 no conversion needs to happen until then.
+// Converts from UTC to UK local time (GMT, or BST whenever the UK's clocks are forward), via
+// pkg/timeconv's IANA tz database lookup (the same approach convert-nexo.go uses for its own
+// CET/CEST-to-UK conversion, through timeconv.Convert). This replaces an earlier version that
+// only ever returned the UTC instant unchanged, with the BST adjustment itself commented out and
+// due to become wrong the next time the UK's clocks went forward - time.LoadLocation resolves the
+// correct offset for every past and future transition, not just the one date that stub was
+// written against.
 func convertUtcToUKTime(utcTime string) string {
-	layout := "2006-01-02 15:04:05"
-	t, err := time.Parse(layout, utcTime)
-	if err != nil {
-		fmt.Println(err)
-	}
-	//	nextBST := time.Date(2022, 3, 27, 1, 0, 0, 0, time.UTC)
-	//	if t.After(nextBST) {
-	//		t = t.Add(time.Hour * 1)
-	//		log.Fatalf("Adjust code to handle incursion into 2022 BST")
-	//	}
-	result := t.Format(layout)
+	result, err := timeconv.Convert(utcTime, "UTC", "Europe/London")
 	if err != nil {
-		fmt.Println(err)
+		log.Fatalf("convertUtcToUKTime: %s\n", err.Error())
 	}
 	return result
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteOFXTransactions(t *testing.T) {
+	transactions := [][]string{
+		{"Timestamp (UTC)", "Transaction Description", "Currency", "Amount", "To Currency", "To Amount", "Native Currency", "Native Amount", "Native Amount (in USD)", "Transaction Kind", "Transaction Hash"},
+		{"2022-04-06 07:00:06", "BTC Deposit", "BTC", "0.50", "", "", "GBP", "9000.00", "12000.00", "crypto_deposit", "hash-2"},
+		{"2022-04-05 07:00:06", "Sign-up Bonus Unlocked", "CRO", "25.00", "", "", "USD", "10.00", "10.00", "referral_gift", "hash-1"},
+	}
+
+	dir := t.TempDir()
+	outputFile := filepath.Join(dir, "out.ofx")
+
+	if err := writeOFXTransactions(outputFile, transactions); err != nil {
+		t.Fatalf("writeOFXTransactions: unexpected error: %s", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("ReadFile: unexpected error: %s", err)
+	}
+	got := string(data)
+
+	for _, want := range []string{"<INCOMETYPE>MISC</INCOMETYPE>", "<TRNTYPE>XFER</TRNTYPE>", "<BROKERID>crypto.com</BROKERID>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("writeOFXTransactions output missing %q\nfull output:\n%s", want, got)
+		}
+	}
+}
+
+func TestWriteOFXTransactionsUnrecognisedHeader(t *testing.T) {
+	transactions := [][]string{{"not", "a", "crypto.com", "header"}}
+	if err := writeOFXTransactions(filepath.Join(t.TempDir(), "out.ofx"), transactions); err == nil {
+		t.Errorf("writeOFXTransactions with an unrecognised header: expected an error, got none")
+	}
+}
+
+func TestConvertUtcToUKTime(t *testing.T) {
+	// The UK's clocks change at 01:00 UTC on the last Sunday of March (GMT->BST) and of October
+	// (BST->GMT); these cases span several years' transitions to confirm convertUtcToUKTime resolves
+	// the correct offset for each instant rather than a single date it happened to be written against.
+	cases := []struct {
+		name string
+		utc  string
+		want string
+	}{
+		{"before 2020 spring transition", "2020-03-29 00:30:00", "2020-03-29 00:30:00"},
+		{"after 2020 spring transition", "2020-03-29 01:30:00", "2020-03-29 02:30:00"},
+		{"before 2021 autumn transition", "2021-10-31 00:30:00", "2021-10-31 01:30:00"},
+		{"after 2021 autumn transition", "2021-10-31 01:30:00", "2021-10-31 01:30:00"},
+		{"before 2022 spring transition", "2022-03-27 00:30:00", "2022-03-27 00:30:00"},
+		{"after 2022 spring transition", "2022-03-27 01:30:00", "2022-03-27 02:30:00"},
+		{"before 2023 autumn transition", "2023-10-29 00:30:00", "2023-10-29 01:30:00"},
+		{"after 2023 autumn transition", "2023-10-29 01:30:00", "2023-10-29 01:30:00"},
+		// A late-evening UTC transaction in July (BST, UTC+1) rolls over into the following UK day.
+		{"late July transaction crosses into the next UK day", "2023-07-15 23:30:00", "2023-07-16 00:30:00"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := convertUtcToUKTime(c.utc); got != c.want {
+				t.Errorf("convertUtcToUKTime(%q) = %q, want %q", c.utc, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+// This program is a single, exchange-agnostic front end onto pkg/importers: rather than one binary
+// per exchange (cdc/convert-cdc.go, nexo/convert-nexo.go, kraken/convert-kraken.go), it selects a
+// registered Importer - by header auto-detection, or explicitly via -exchange - and renders its
+// output as an OFX 2.x document via pkg/ofxwriter, the same way cdc/convert-cdc.go's own -format ofx
+// path already does.
+//
+// It replaces none of the existing binaries: each still owns conversions pkg/importers doesn't
+// cover (cdc/convert-cdc.go's CSV output shape, nexo/convert-nexo.go's FIFO cost-basis and OFX
+// reconciliation, kraken/convert-kraken.go's own price-history pipeline and stake-move pairing).
+// This is purely the "pick an Importer by name instead of by file layout" front end the CSV-only
+// binaries don't otherwise need.
+
+// Usage:
+// The program takes two parameters: the input transactions (in CSV format, header row included) and
+// a file into which to write the resulting OFX document.
+//
+// One way to run it would be:
+//    go run convert.go -exchange kraken kraken_ledgers.csv transactions.ofx
+//
+// -exchange may be omitted, in which case the importer is chosen by matching the input's header row
+// against every registered Importer's Detect, the same way pkg/importers.Lookup already works for
+// cdc/convert-cdc.go's -format ofx path.
+//
+// -accounting=fifo|lifo|hifo|uk-s104, together with -disposals, additionally runs the converted
+// transactions through pkg/taxlots (built on nexo/costbasis's lot-matching engine) and writes one
+// CSV row per realized disposal: asset, acquisition date, disposal date, quantity, proceeds, cost
+// basis and gain/loss, all in GBP. Historical GBP prices are fetched via pkg/pricing, cached on
+// disk under -price-cache so repeated runs don't re-fetch the same (asset, date).
+//
+// -format selects what the output file actually contains: "native" (the default) writes the OFX
+// 2.x document described above; any name registered with pkg/format (e.g. "koinly",
+// "cointracker") writes that third-party tax tool's own CSV import layout instead.
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/AntonioCarlini/data-processing/pkg/format"
+	"github.com/AntonioCarlini/data-processing/pkg/importers"
+	"github.com/AntonioCarlini/data-processing/pkg/ofxwriter"
+	"github.com/AntonioCarlini/data-processing/pkg/pricing"
+	"github.com/AntonioCarlini/data-processing/pkg/taxlots"
+)
+
+func main() {
+	exchange := flag.String("exchange", "", "the registered importer to use (e.g. \"kraken\"); if omitted, the importer is chosen by matching the input's header row")
+	outputFormat := flag.String("format", "native", "output layout to write: \"native\" for the OFX document, or a name registered with pkg/format (e.g. \"koinly\", \"cointracker\")")
+	accounting := flag.String("accounting", "", "cost-basis method for a -disposals report: fifo, lifo, hifo or uk-s104 (specid is not supported - see pkg/taxlots)")
+	disposalsFile := flag.String("disposals", "", "path to write the realized-disposal CSV to (requires -accounting)")
+	priceCacheDir := flag.String("price-cache", os.Getenv("HOME")+"/.config/coin-prices/gbp-cache/", "directory to cache historical GBP prices in, for -accounting")
+	flag.Parse()
+
+	if (*accounting == "") != (*disposalsFile == "") {
+		log.Fatalf("-accounting and -disposals must be used together\n")
+	}
+
+	inputs := flag.Args()
+	if len(inputs) != 2 {
+		log.Fatalf("Exactly 2 arguments required but %d supplied\n", len(inputs))
+	}
+
+	inputFile := flag.Arg(0)
+	outputFile := flag.Arg(1)
+
+	rows := readRows(inputFile)
+	if len(rows) == 0 {
+		log.Fatalf("'%s' has no rows\n", inputFile)
+	}
+
+	importer, err := selectImporter(*exchange, rows[0])
+	if err != nil {
+		log.Fatalf("Selecting an importer: %s\n", err.Error())
+	}
+
+	txs, err := importer.Convert(rows[1:])
+	if err != nil {
+		log.Fatalf("Converting transactions via %q: %s\n", importer.Name(), err.Error())
+	}
+
+	if err := writeOutput(*outputFormat, importer.Name(), txs, outputFile); err != nil {
+		log.Fatalf("Writing '%s': %s\n", outputFile, err.Error())
+	}
+
+	if *accounting != "" {
+		writeDisposals(txs, *accounting, *disposalsFile, *priceCacheDir)
+	}
+}
+
+// writeOutput renders txs as outputFormat and writes the result to outputFile. "native" writes
+// the pkg/ofxwriter OFX document this program has always produced; any other name is looked up in
+// pkg/format's Exporter registry.
+func writeOutput(outputFormat, name string, txs []importers.Transaction, outputFile string) error {
+	if outputFormat == "native" {
+		ofxDocument, err := ofxwriter.Write(name, name, txs)
+		if err != nil {
+			return fmt.Errorf("rendering OFX: %w", err)
+		}
+		return os.WriteFile(outputFile, []byte(ofxDocument), 0644)
+	}
+
+	exporter, err := format.Get(outputFormat)
+	if err != nil {
+		return fmt.Errorf("-format: %w", err)
+	}
+
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return exporter.Write(f, txs)
+}
+
+// writeDisposals runs txs through pkg/taxlots under accounting and writes the resulting realized
+// disposals to disposalsFile as CSV.
+func writeDisposals(txs []importers.Transaction, accounting, disposalsFile, priceCacheDir string) {
+	method, err := taxlots.ParseAccounting(accounting)
+	if err != nil {
+		log.Fatalf("-accounting: %s\n", err.Error())
+	}
+
+	taxlots.SortByDateTime(txs)
+	oracle := pricing.NewFileCache(priceCacheDir, pricing.NewCoinGeckoProvider())
+
+	disposals, err := taxlots.Process(txs, method, oracle)
+	if err != nil {
+		log.Fatalf("Computing disposals: %s\n", err.Error())
+	}
+
+	rows := [][]string{{"Asset", "AcquiredAt", "DisposedAt", "Quantity", "ProceedsGBP", "CostBasisGBP", "GainLossGBP", "HoldingPeriod", "Rule", "SourceTxID", "DisposalTxID"}}
+	for _, d := range disposals {
+		rows = append(rows, []string{
+			d.Asset,
+			d.AcquiredAt.Format("2006-01-02"),
+			d.DisposedAt.Format("2006-01-02"),
+			d.Quantity,
+			d.ProceedsGBP,
+			d.CostBasisGBP,
+			d.GainLossGBP,
+			d.HoldingPeriod,
+			d.Rule,
+			d.SourceTxID,
+			d.DisposalTxID,
+		})
+	}
+
+	f, err := os.Create(disposalsFile)
+	if err != nil {
+		log.Fatalf("Cannot create '%s': %s\n", disposalsFile, err.Error())
+	}
+	defer f.Close()
+
+	if err := csv.NewWriter(f).WriteAll(rows); err != nil {
+		log.Fatalf("Cannot write '%s': %s\n", disposalsFile, err.Error())
+	}
+}
+
+// selectImporter returns the Importer named exchange, or - if exchange is empty - the Importer
+// whose Detect matches header.
+func selectImporter(exchange string, header []string) (importers.Importer, error) {
+	if exchange != "" {
+		return importers.Get(exchange)
+	}
+	return importers.Lookup(header)
+}
+
+func readRows(name string) [][]string {
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatalf("Cannot open '%s': %s\n", name, err.Error())
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+
+	rows, err := r.ReadAll()
+	if err != nil {
+		log.Fatalln("Cannot read CSV data:", err.Error())
+	}
+
+	return rows
+}
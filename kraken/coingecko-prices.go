@@ -4,24 +4,117 @@ package main
 // CoinGecko and managing that data.
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	coingecko "github.com/superoo7/go-gecko/v3"
 	"github.com/superoo7/go-gecko/v3/types"
 )
 
+// cg is the go-gecko client this file's CoinsIDHistory/CoinsIDMarketChart calls go through. It has
+// no hook of its own for a custom base URL or API key header, so it always talks to CoinGecko's
+// public API regardless of coinGeckoConfig's pro/free selection (see ratelimiter.go's doc comment).
+var cg = coingecko.NewClient(nil)
+
 // How many days of historical data to request
 var daysOfPriceHistory = 540
 
-var perCoinHistoricalPrices map[string]map[string]float32
+// perCoinHistoricalPrices is keyed coin symbol -> fiat currency -> date -> price, so the same
+// cache can hold e.g. both BTC/usd and BTC/eur history at once without one overwriting the other.
+var perCoinHistoricalPrices map[string]map[string]map[string]float32
+
+// priceStore, if set via SetPriceStore, persists perCoinHistoricalPrices to disk across runs:
+// LookupHistoricalTokenValueInBulk consults it before falling back to FetchCoinPrices, and writes
+// newly-fetched (or gap-filled) prices back through it. A nil priceStore (the default) keeps the
+// original in-memory-only behaviour, so existing callers and tests are unaffected.
+var priceStore PriceStore
+
+// SetPriceStore installs the PriceStore this file's price-lookup functions should consult and
+// write through to.
+func SetPriceStore(store PriceStore) {
+	priceStore = store
+}
+
+// ReportingCurrency is the fiat currency (a CoinGecko vs_currency, e.g. "usd" or "eur") set from
+// the -reporting-currency flag (see convert-kraken.go's main). It defaults to "usd". Nothing in
+// this package reads it: LookupHistoricalTokenValueInBulk, FetchCoinPrices and
+// FetchCoinPricesRange each take the currency to report in as an argument.
+var ReportingCurrency = "usd"
+
+// SetReportingCurrency sets ReportingCurrency. currency is lower-cased to match CoinGecko's own
+// vs_currency convention; it is not validated here - see ValidateCurrency.
+func SetReportingCurrency(currency string) {
+	ReportingCurrency = strings.ToLower(currency)
+}
+
+// coinGeckoSupportedVsCurrenciesPath is CoinGecko's endpoint path listing every vs_currency it
+// accepts, appended to coinGeckoConfig's BaseURL (the public or pro API, whichever applies).
+const coinGeckoSupportedVsCurrenciesPath = "/simple/supported_vs_currencies"
+
+// ValidateCurrency checks currency (case-insensitively) against CoinGecko's own
+// supported_vs_currencies list, the same check Blockbook and BitBox run before accepting a
+// reporting currency from a user.
+func ValidateCurrency(currency string) error {
+	resp, err := coinGeckoGet(coinGeckoConfig().BaseURL + coinGeckoSupportedVsCurrenciesPath)
+	if err != nil {
+		return fmt.Errorf("ValidateCurrency(%s): %w", currency, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ValidateCurrency(%s): unexpected status %s", currency, resp.Status)
+	}
+
+	var supported []string
+	if err := json.NewDecoder(resp.Body).Decode(&supported); err != nil {
+		return fmt.Errorf("ValidateCurrency(%s): decoding response: %w", currency, err)
+	}
+
+	currency = strings.ToLower(currency)
+	for _, c := range supported {
+		if strings.ToLower(c) == currency {
+			return nil
+		}
+	}
+	return fmt.Errorf("ValidateCurrency(%s): not a CoinGecko-supported vs_currency", currency)
+}
+
+// historicalPriceRangeFrom/To, if both non-zero (set via SetHistoricalPriceRangeToRequest), bound
+// a single FetchCoinPricesRange call instead of the trailing daysOfPriceHistory days ending today
+// that SetDaysOfPriceHistoryToRequest controls.
+var historicalPriceRangeFrom, historicalPriceRangeTo time.Time
+
+// SetHistoricalPriceRangeToRequest bounds LookupHistoricalTokenValueInBulk's cold-start fetch to
+// [from, to] via FetchCoinPricesRange, rather than the trailing daysOfPriceHistory days ending
+// today that FetchCoinPrices requests. Call it once, e.g. with the earliest and latest transaction
+// dates in the dataset being converted, so a tax report spanning years of history fetches exactly
+// that span instead of inflating daysOfPriceHistory and hitting CoinGecko's hourly/daily
+// resolution cliff.
+func SetHistoricalPriceRangeToRequest(from, to time.Time) {
+	historicalPriceRangeFrom = from
+	historicalPriceRangeTo = to
+}
+
+// historicalPriceRangeSet reports whether SetHistoricalPriceRangeToRequest has installed a range.
+func historicalPriceRangeSet() bool {
+	return !historicalPriceRangeFrom.IsZero() && !historicalPriceRangeTo.IsZero()
+}
 
 // This function is called to get a specific value
-// Cache results per token, held in a map using the coin symbol ("BTC") not the CG name ("bitcoin")
-// if the cache is empty then lookup using FetchCoinPrices
+// Cache results per token and currency, held in a map using the coin symbol ("BTC") not the CG
+// name ("bitcoin") - if the cache is empty, check priceStore (if set via SetPriceStore) before lookup using FetchCoinPrices
 // if the cache is not empty but no value is found, return an error
 // later on, make a single query to update the cache
+// note: priceStore always holds the full fetched history, never just a delta. When
+// SetHistoricalPriceRangeToRequest has been called, a cold-start cache miss fetches exactly the
+// requested [from, to] window via FetchCoinPricesRange rather than the trailing daysOfPriceHistory
+// days via FetchCoinPrices. Combined with priceStore this avoids a full re-fetch on every run, but
+// only at "cache has nothing for this coin" / "cache already covers it" granularity - fetching just
+// the uncovered sub-range of a partially-cached window is follow-up work.
 //	// The free coingecko service has a rate limit on the API, so try to avoid hitting that
 //	time.Sleep(8 * time.Second)
 //	details, err := cg.CoinsIDHistory(lookupToken, cgDate, true)
@@ -37,69 +130,164 @@ var perCoinHistoricalPrices map[string]map[string]float32
 // subsequent values.
 var fillInWithLookups = false
 
-func LookupHistoricalTokenValueInBulk(coinSymbol string, dateTime string, verbose bool) (float32, error) {
+func LookupHistoricalTokenValueInBulk(coinSymbol string, dateTime string, currency string, verbose bool) (float32, error) {
 	var historicalData map[string]float32
 	var ok bool
-	historicalData, ok = perCoinHistoricalPrices[coinSymbol]
+	if byCurrency, found := perCoinHistoricalPrices[coinSymbol]; found {
+		historicalData, ok = byCurrency[currency]
+	}
 	if !ok {
-		if verbose {
-			fmt.Printf("coin %q has no historical data .. .fetching\n", coinSymbol)
+		if priceStore != nil {
+			historicalData = priceStore.Range(coinSymbol, currency, time.Time{}, time.Now())
 		}
-		cgCoinName, ok := ConvertCoinSymbolToCoingeckoCoinName(coinSymbol)
-		if !ok {
+		if len(historicalData) == 0 {
 			if verbose {
-				fmt.Printf("BAD: %q => %q", coinSymbol, cgCoinName)
+				fmt.Printf("coin %q has no historical data .. .fetching\n", coinSymbol)
+			}
+			cgCoinName, ok := ConvertCoinSymbolToCoingeckoCoinName(coinSymbol)
+			if !ok {
+				if verbose {
+					fmt.Printf("BAD: %q => %q", coinSymbol, cgCoinName)
+				}
+				return -1.0, fmt.Errorf("Coin Value Lookup Error: Unrecognised symbol %q", coinSymbol)
+			}
+			var prices map[string]float32
+			var err error
+			if historicalPriceRangeSet() {
+				prices, err = FetchCoinPricesRange(cgCoinName, historicalPriceRangeFrom, historicalPriceRangeTo, currency)
+			} else {
+				prices, err = FetchCoinPrices(cgCoinName, daysOfPriceHistory, currency, false)
+			}
+			if err != nil {
+				return -1.0, fmt.Errorf("Coin Value Retrieval Error: %q", err)
+			}
+			historicalData = prices
+			if priceStore != nil {
+				for date, price := range prices {
+					priceStore.Put(coinSymbol, currency, date, price)
+				}
+				priceStore.SetLastFetchedAt(coinSymbol, currency, time.Now())
 			}
-			return -1.0, fmt.Errorf("Coin Value Lookup Error: Unrecognised symbol %q", coinSymbol)
-		}
-		prices, err := FetchCoinPrices(cgCoinName, daysOfPriceHistory, false)
-		if err != nil {
-			return -1.0, fmt.Errorf("Coin Value Retrieval Error: %q", err)
 		}
 		if perCoinHistoricalPrices == nil {
-			perCoinHistoricalPrices = make(map[string]map[string]float32, 0)
+			perCoinHistoricalPrices = make(map[string]map[string]map[string]float32, 0)
 		}
-		perCoinHistoricalPrices[coinSymbol] = prices
-		historicalData = prices
+		if perCoinHistoricalPrices[coinSymbol] == nil {
+			perCoinHistoricalPrices[coinSymbol] = make(map[string]map[string]float32, 0)
+		}
+		perCoinHistoricalPrices[coinSymbol][currency] = historicalData
 	}
 
 	date := dateTime[0:10]
 	price, ok := historicalData[date]
 	if !ok {
+		interpolated := false
 		if fillInWithLookups {
 			var err error
-			price, err = LookupCoinValueAtGivenTime(coinSymbol, dateTime)
+			price, err = LookupCoinValueAtGivenTime(coinSymbol, dateTime, currency)
 			if err != nil {
 				return -1.0, fmt.Errorf("Coin Value Retrieval Error: %q", err)
 			}
+		} else if estimate, found := interpolateMissingPrice(historicalData, date); found {
+			price = estimate
+			interpolated = true
 		} else {
-			requestedDate, err := time.Parse("2006-01-02", dateTime[0:10])
+			// Neither side of the gap has a known price within maxGapFillDays days: fall back to
+			// a live, single-day lookup rather than guessing any further out.
+			var err error
+			price, err = LookupCoinValueAtGivenTime(coinSymbol, dateTime, currency)
 			if err != nil {
 				return -1.0, fmt.Errorf("Coin Value Retrieval Error: %q", err)
 			}
-			prevDay := requestedDate.AddDate(0, 0, -1)
-			nextDay := requestedDate.AddDate(0, 0, 1)
-			prevPrice, ok := historicalData[prevDay.Format("2006-01-02")]
-			if !ok {
-				return -1.0, fmt.Errorf("Coin Value Retrieval Error Prev Day: %q", err)
-			}
-			nextPrice, ok := historicalData[nextDay.Format("2006-01-02")]
-			if !ok {
-				return -1.0, fmt.Errorf("Coin Value Retrieval Error Next Day: %q", err)
-			}
-			price = (prevPrice + nextPrice) / 2.0
 		}
 
 		historicalData[date] = price
+		markInterpolated(coinSymbol, currency, date, interpolated)
+		if priceStore != nil {
+			priceStore.Put(coinSymbol, currency, date, price)
+		}
 	}
 
 	// Finally return the requested price
 	return price, nil
 }
 
+// maxGapFillDays bounds how many days interpolateMissingPrice will scan backwards and forwards
+// from a missing date before giving up and leaving the gap for LookupHistoricalTokenValueInBulk to
+// fall back to a live LookupCoinValueAtGivenTime call, mirroring BitBox's rates/history.go PriceAt.
+const maxGapFillDays = 7
+
+// interpolateMissingPrice looks in historicalData for the nearest known price up to
+// maxGapFillDays before and after date ("YYYY-MM-DD"). With a known price on both sides it linearly
+// interpolates between them; with a known price on only one side it forward/back-fills with that
+// value. found is false if neither side has an entry within maxGapFillDays, in which case
+// historicalData has nothing useful to estimate from.
+func interpolateMissingPrice(historicalData map[string]float32, date string) (price float32, found bool) {
+	requestedDate, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return 0, false
+	}
+
+	prevDate, prevPrice, havePrev := nearestKnownPrice(historicalData, requestedDate, -1)
+	nextDate, nextPrice, haveNext := nearestKnownPrice(historicalData, requestedDate, 1)
+
+	switch {
+	case havePrev && haveNext:
+		totalDays := nextDate.Sub(prevDate).Hours() / 24
+		offsetDays := requestedDate.Sub(prevDate).Hours() / 24
+		return prevPrice + (nextPrice-prevPrice)*float32(offsetDays/totalDays), true
+	case havePrev:
+		return prevPrice, true
+	case haveNext:
+		return nextPrice, true
+	default:
+		return 0, false
+	}
+}
+
+// nearestKnownPrice scans up to maxGapFillDays days away from date in the given direction (-1
+// backwards, +1 forwards) for the first date present in historicalData.
+func nearestKnownPrice(historicalData map[string]float32, date time.Time, direction int) (time.Time, float32, bool) {
+	for offset := 1; offset <= maxGapFillDays; offset++ {
+		candidate := date.AddDate(0, 0, direction*offset)
+		if price, ok := historicalData[candidate.Format("2006-01-02")]; ok {
+			return candidate, price, true
+		}
+	}
+	return time.Time{}, 0, false
+}
+
+// interpolatedPrices records, per coin symbol / currency / date ("YYYY-MM-DD"), whether the price
+// LookupHistoricalTokenValueInBulk returned for that day was estimated (interpolated or
+// forward/back-filled via interpolateMissingPrice) rather than a real CoinGecko observation, so a
+// report can flag estimated figures instead of presenting them as authoritative.
+var interpolatedPrices map[string]map[string]map[string]bool
+
+// markInterpolated records whether coinSymbol/currency's price on date was interpolated.
+func markInterpolated(coinSymbol, currency, date string, interpolated bool) {
+	if interpolatedPrices == nil {
+		interpolatedPrices = make(map[string]map[string]map[string]bool)
+	}
+	if interpolatedPrices[coinSymbol] == nil {
+		interpolatedPrices[coinSymbol] = make(map[string]map[string]bool)
+	}
+	if interpolatedPrices[coinSymbol][currency] == nil {
+		interpolatedPrices[coinSymbol][currency] = make(map[string]bool)
+	}
+	interpolatedPrices[coinSymbol][currency][date] = interpolated
+}
+
+// IsInterpolatedPrice reports whether the price LookupHistoricalTokenValueInBulk returned for
+// coinSymbol/currency on date ("YYYY-MM-DD") was estimated rather than a real observation. It
+// returns false for a (coin, currency, date) LookupHistoricalTokenValueInBulk was never asked
+// about, the same as for one it found a real observation for.
+func IsInterpolatedPrice(coinSymbol, currency, date string) bool {
+	return interpolatedPrices[coinSymbol][currency][date]
+}
+
 // Given a date/time (in YYYY-MM-DD HH:MM:SS format) lookup a given coin's
 // value at that moment in time (according to the CoinGeckoAPI)
-func LookupCoinValueAtGivenTime(coinSymbol string, dateTime string) (float32, error) {
+func LookupCoinValueAtGivenTime(coinSymbol string, dateTime string, currency string) (float32, error) {
 	fmt.Printf("Coin Value Lookup Error: no record for %q on %q\n", coinSymbol, dateTime)
 	cgCoinName, ok := ConvertCoinSymbolToCoingeckoCoinName(coinSymbol)
 	if !ok {
@@ -118,15 +306,19 @@ func LookupCoinValueAtGivenTime(coinSymbol string, dateTime string) (float32, er
 	if err != nil {
 		return -1.0, fmt.Errorf("Coin Value Individual Lookup Error: no CG response for %q (%q): %q", dateTime, cgCoinName, err)
 	}
-	return float32(details.MarketData.CurrentPrice["usd"]), nil
+	price, found := details.MarketData.CurrentPrice[strings.ToLower(currency)]
+	if !found {
+		return -1.0, fmt.Errorf("Coin Value Individual Lookup Error: no %q price quoted for %q (%q)", currency, dateTime, cgCoinName)
+	}
+	return float32(price), nil
 }
 
-// Queries CoinGecko for a specific coin's price history over the number of days requested.
-// The result is a map of "YYYY-MM-DD" => price.
+// Queries CoinGecko for a specific coin's price history, in currency, over the number of days
+// requested. The result is a map of "YYYY-MM-DD" => price.
 // Because of the way CoinGecko returns data, there may be occasional gaps of one day in the data.
-func FetchCoinPrices(coin string, days int, verbose bool) (map[string]float32, error) {
+func FetchCoinPrices(coin string, days int, currency string, verbose bool) (map[string]float32, error) {
 	RateLimitCoinGeckoApiCalls(false)
-	data, err := cg.CoinsIDMarketChart(coin, "usd", strconv.Itoa(days))
+	data, err := cg.CoinsIDMarketChart(coin, strings.ToLower(currency), strconv.Itoa(days))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -146,176 +338,400 @@ func FetchCoinPrices(coin string, days int, verbose bool) (map[string]float32, e
 	// The amount of data found for any given day depends on the number of days of data requested.
 	// For any date with only one entry, use that entry.
 	// For any date with more than one entry, average the entries and use the average value.
-	return ConvertTimePriceHistoryToDailyPriceHistory(*data.Prices, verbose)
+	//
+	// FetchCoinPrices keeps the original strict FillNone behaviour and drops the FillKind map:
+	// wiring a fill policy through to callers of FetchCoinPrices is follow-up work once one of them
+	// actually needs to tolerate a gap.
+	prices, _, err := ConvertTimePriceHistoryToDailyPriceHistory(*data.Prices, FillNone, time.UTC, verbose)
+	return prices, err
+}
+
+// coinGeckoMarketChartRangePath is CoinGecko's date-bounded price history endpoint, as opposed to
+// CoinsIDMarketChart's "N days ending now" window, appended to coinGeckoConfig's BaseURL. go-gecko/v3's
+// client has no wrapper for it, so this calls it directly via coinGeckoGet.
+const coinGeckoMarketChartRangePath = "/coins/%s/market_chart/range?vs_currency=%s&from=%d&to=%d"
+
+// coinGeckoMarketChartRangeResponse is the subset of CoinGecko's market_chart/range response this
+// file cares about: a 'prices' array of [unix-timestamp-ms, coin-price] pairs, same as
+// CoinsIDMarketChart's.
+type coinGeckoMarketChartRangeResponse struct {
+	Prices [][2]float64 `json:"prices"`
+}
+
+// FetchCoinPricesRange queries CoinGecko's /coins/{id}/market_chart/range endpoint for coin's
+// price history in currency over [from, to], rather than FetchCoinPrices' "days ending today"
+// window - so a tax report covering, say, 2019 through mid-2021 fetches exactly that span instead
+// of inflating daysOfPriceHistory. The result is a map of "YYYY-MM-DD" => price, the same shape as
+// FetchCoinPrices.
+func FetchCoinPricesRange(coin string, from, to time.Time, currency string) (map[string]float32, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("FetchCoinPricesRange(%s): to (%s) is not after from (%s)", coin, to, from)
+	}
+
+	path := fmt.Sprintf(coinGeckoMarketChartRangePath, coin, strings.ToLower(currency), from.Unix(), to.Unix())
+	resp, err := coinGeckoGet(coinGeckoConfig().BaseURL + path)
+	if err != nil {
+		return nil, fmt.Errorf("FetchCoinPricesRange(%s): %w", coin, err)
+	}
+	defer resp.Body.Close()
+
+	var data coinGeckoMarketChartRangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("FetchCoinPricesRange(%s): decoding response: %w", coin, err)
+	}
+
+	history := make([]types.ChartItem, 0, len(data.Prices))
+	for _, p := range data.Prices {
+		history = append(history, types.ChartItem([2]float32{float32(p[0]), float32(p[1])}))
+	}
+
+	prices, _, err := ConvertTimePriceHistoryToDailyPriceHistory(history, FillNone, time.UTC, false)
+	return prices, err
+}
+
+// FillKind tags how a single day's entry in the map returned by
+// ConvertTimePriceHistoryToDailyPriceHistory was produced: a real observed (averaged) price, or
+// one synthesized according to a FillPolicy to paper over a gap in the underlying CoinGecko data.
+type FillKind string
+
+const (
+	Observed      FillKind = "Observed"
+	ForwardFilled FillKind = "ForwardFilled"
+	Interpolated  FillKind = "Interpolated"
+)
+
+// FillPolicyKind selects how ConvertTimePriceHistoryToDailyPriceHistory treats a gap larger than
+// the usual one (or occasionally two) day step between consecutive price observations.
+type FillPolicyKind int
+
+const (
+	fillNone FillPolicyKind = iota
+	fillForward
+	fillLinear
+	fillMaxGap
+)
+
+// FillPolicy controls gap handling for ConvertTimePriceHistoryToDailyPriceHistory. Use one of the
+// predefined FillNone/FillForward/FillLinear values, or FillMaxGap(n) to bound how large a gap may
+// be interpolated before it is treated as an error.
+type FillPolicy struct {
+	kind       FillPolicyKind
+	maxGapDays int // only meaningful when kind == fillMaxGap
+}
+
+// FillNone is the original, strict behaviour: any gap larger than two days is an error, and a
+// two-day gap is simply left absent from the result (nothing is guessed at).
+var FillNone = FillPolicy{kind: fillNone}
+
+// FillForward carries the last observed price forward across every missing day in a gap, however
+// large.
+var FillForward = FillPolicy{kind: fillForward}
+
+// FillLinear linearly interpolates, day by day, between the last observed price before a gap and
+// the next observed price after it, however large the gap.
+var FillLinear = FillPolicy{kind: fillLinear}
+
+// FillMaxGap behaves like FillLinear for gaps of up to days days, and like FillNone (an error) for
+// anything larger.
+func FillMaxGap(days int) FillPolicy {
+	return FillPolicy{kind: fillMaxGap, maxGapDays: days}
+}
+
+// maxAllowedGapDays returns the largest gap (in days) policy tolerates without an error, or -1 if
+// no gap is ever too large for it.
+func (p FillPolicy) maxAllowedGapDays() int {
+	switch p.kind {
+	case fillNone:
+		return 2 // CoinGecko's sampling interval is occasionally just over 24 hours
+	case fillMaxGap:
+		return p.maxGapDays
+	default:
+		return -1
+	}
+}
+
+// dayGroup is one calendar (UTC) day's worth of raw price samples, in the order they were
+// originally supplied in.
+type dayGroup struct {
+	date    string
+	samples []float32
+}
+
+// priceGap records a gap policy allowed through: the days strictly between fromDate and toDate
+// (exclusive) have no real samples of their own.
+type priceGap struct {
+	fromDate string
+	toDate   string
+}
+
+// groupSamplesByDay walks history once, grouping consecutive same-day samples together and
+// validating every day-to-day transition against policy (see nextDayTransition). It is the single
+// shared grouping loop both ConvertTimePriceHistoryToDailyPriceHistory and
+// ConvertTimePriceHistoryToDailyOHLC are built on: what differs between them is only how a day's
+// samples are reduced to a result, and how a filled gap day is synthesized.
+//
+// A day is a local calendar day in loc (time.UTC if loc is nil), so that a 23-hour spring-forward
+// day or a 25-hour autumn-back day is still exactly one day, the same as every other day.
+//
+// Dates are expected to be in ascending order; a date that goes backwards, or reappears once
+// already grouped, is always an error regardless of policy.
+func groupSamplesByDay(history []types.ChartItem, policy FillPolicy, loc *time.Location) ([]dayGroup, []priceGap, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	var groups []dayGroup
+	var gaps []priceGap
+
+	for _, v := range history {
+		dateTime := time.Unix(int64(v[0])/1000, int64(v[0])%1000).In(loc)
+		thisDate := dateTime.Format("2006-01-02")
+
+		if len(groups) > 0 && groups[len(groups)-1].date == thisDate {
+			// Same day as last time ... continue to accumulate samples
+			last := &groups[len(groups)-1]
+			last.samples = append(last.samples, v[1])
+			continue
+		}
+
+		if len(groups) > 0 {
+			currentDate := groups[len(groups)-1].date
+			gapDays, err := nextDayTransition(currentDate, thisDate, policy)
+			if err != nil {
+				return nil, nil, err
+			}
+			if gapDays > 1 {
+				gaps = append(gaps, priceGap{fromDate: currentDate, toDate: thisDate})
+			}
+		}
+
+		// Start accumulating the new day's samples
+		groups = append(groups, dayGroup{date: thisDate, samples: []float32{v[1]}})
+	}
+
+	return groups, gaps, nil
+}
+
+// nextDayTransition validates a day-boundary crossing from currentDate to thisDate against
+// policy, returning the number of days spanned (1 if there was no gap) or an error if the dates
+// go backwards/are equal, or the gap is larger than policy allows.
+func nextDayTransition(currentDate, thisDate string, policy FillPolicy) (int, error) {
+	gapDays, err := daysBetween(currentDate, thisDate)
+	if err != nil {
+		return 0, err
+	}
+	if gapDays < 1 {
+		return 0, fmt.Errorf("Unexpected date/time: %s is not after %s\n", thisDate, currentDate)
+	}
+	if maxGap := policy.maxAllowedGapDays(); maxGap >= 0 && gapDays > maxGap {
+		return 0, fmt.Errorf("Unexpected date/time: gap of %d days between %s and %s\n", gapDays, currentDate, thisDate)
+	}
+	return gapDays, nil
+}
+
+// daysBetween returns how many calendar days "2006-01-02"-formatted date b is after a (negative
+// if b is before a), using real calendar arithmetic so that it is correct across year boundaries
+// without any special-casing.
+func daysBetween(a, b string) (int, error) {
+	ta, err := time.Parse("2006-01-02", a)
+	if err != nil {
+		return 0, err
+	}
+	tb, err := time.Parse("2006-01-02", b)
+	if err != nil {
+		return 0, err
+	}
+	return int(tb.Sub(ta).Hours() / 24), nil
 }
 
 // Coingecko produces price history as an array of pairs values.
 // The first value is a Unix timestamp.
 // The second value is the price as a 32-bit floating point number.
 //
-// This function turns that array into a map of "YYYY-MM-DD" => price
-// for every date on which a price is available.
+// This function turns that array into a map of "YYYY-MM-DD" => price for every date on which a
+// price is available, plus a parallel map of "YYYY-MM-DD" => FillKind so that downstream tax/report
+// code can tell a real observation from one synthesized to paper over a gap (see FillPolicy).
 //
-// For those days where more than one price is available, the average is used.
+// For those days where more than one price is available, the average is used. See
+// ConvertTimePriceHistoryToDailyOHLC for a sibling that keeps each day's open/high/low/close
+// instead of collapsing it to a single number.
 //
-// Dates are expected to be in ascending order with no gaps greater than two days.
-func ConvertTimePriceHistoryToDailyPriceHistory(history []types.ChartItem, verbose bool) (map[string]float32, error) {
-	dayOfYear := -1              // start with an impossible value
-	var totalValue float32 = 0.0 // start with no daily total value
-	pricesCounted := 0           // no prices counted towards the total
-	thisDate := ""               // start with no recorded date
+// loc selects the calendar a "day" is bucketed against - pass time.UTC (or nil) unless the
+// caller needs days in a specific local timezone, e.g. for tax reporting in a particular
+// jurisdiction, in which case loc's own DST rules are followed automatically.
+func ConvertTimePriceHistoryToDailyPriceHistory(history []types.ChartItem, policy FillPolicy, loc *time.Location, verbose bool) (map[string]float32, map[string]FillKind, error) {
+	groups, gaps, err := groupSamplesByDay(history, policy, loc)
+	if err != nil {
+		return make(map[string]float32, 0), make(map[string]FillKind, 0), err
+	}
+
 	results := make(map[string]float32, 0)
+	fillKinds := make(map[string]FillKind, 0)
+	for _, g := range groups {
+		var total float32
+		for _, price := range g.samples {
+			total += price
+		}
+		avg := total / float32(len(g.samples))
+		if verbose {
+			fmt.Printf("Here save the total value as %s => %.04f\n", g.date, avg)
+		}
+		results[g.date] = avg
+		fillKinds[g.date] = Observed
+	}
 
-	for _, v := range history {
-		dateTime := time.Unix(int64(v[0])/1000, int64(v[0])%1000)
-		thisDOY := dateTime.YearDay()
-		if dayOfYear == -1 {
-			// This is the very first entry ever; set things up with a proper start
-			dayOfYear = thisDOY
-			pricesCounted = 1
-			totalValue = v[1]
-			thisDate = dateTime.Format("2006-01-02")
-		} else if thisDOY == dayOfYear {
-			// Same day as last time ... continue to accumulate values
-			pricesCounted += 1
-			totalValue += v[1]
+	for _, gap := range gaps {
+		fillGap(results, fillKinds, gap.fromDate, results[gap.fromDate], gap.toDate, results[gap.toDate], policy)
+	}
+
+	return results, fillKinds, nil
+}
+
+// fillGap synthesizes results/fillKinds entries for every day strictly between fromDate and
+// toDate (both of which are already present in results) according to policy. It is a no-op under
+// FillNone, which deliberately leaves such a gap absent from the result rather than guessing at it.
+func fillGap(results map[string]float32, fillKinds map[string]FillKind, fromDate string, fromPrice float32, toDate string, toPrice float32, policy FillPolicy) {
+	if policy.kind == fillNone {
+		return
+	}
+
+	from, _ := time.Parse("2006-01-02", fromDate)
+	totalDays, _ := daysBetween(fromDate, toDate)
+
+	for offset := 1; offset < totalDays; offset++ {
+		date := from.AddDate(0, 0, offset).Format("2006-01-02")
+		if policy.kind == fillForward {
+			results[date] = fromPrice
+			fillKinds[date] = ForwardFilled
 		} else {
-			// Save the calculated value
-			if verbose {
-				fmt.Printf("Here save the total value as %s => %.04f\n", thisDate, totalValue/float32(pricesCounted))
-			}
-			// Stop if a duplicate entry is about to be made
-			if _, ok := results[thisDate]; ok {
-				return make(map[string]float32, 0), fmt.Errorf("Duplicate value generated for %s, previous was %0.04f\n", thisDate, results[thisDate])
-			}
-			results[thisDate] = totalValue / float32(pricesCounted)
-
-			// The day should always increase by one, allowing for a wraparound from DEC-31 to JAN-01.
-			// However, CoinGecko's time intervals between samples when requesting longer time periods
-			// turn out to be just over 24 hours (and not entirely consistent), so if one price is 23:59
-			// on day N, the next price may be 00:02 on day N+2 and no price is provided for day N+1.
-			// For the moment, just leave these gaps in the record and the lookup code will fill these
-			// gaps in on demand if they turn out to be needed when processing the data.
-			lastDate := thisDate[5:] // "thisDate" is the day that has just been processed; lop off the year "YYYY-"
-			dayTransitionOK := false
-			if (thisDOY == dayOfYear+1) || (thisDOY == dayOfYear+2) {
-				dayTransitionOK = true
-			} else if (thisDOY == 1) && ((lastDate == "12-30") || (lastDate == "12-31")) {
-				dayTransitionOK = true
-			} else if (thisDOY == 2) && (lastDate == "12-31") {
-				dayTransitionOK = true
+			results[date] = fromPrice + (toPrice-fromPrice)*float32(offset)/float32(totalDays)
+			fillKinds[date] = Interpolated
+		}
+	}
+}
+
+// Candle is one day's open/high/low/close summary of that day's raw price samples, plus N, the
+// number of samples the day was built from (0 for a day synthesized to fill a gap - see
+// FillPolicy - which has no real samples of its own).
+type Candle struct {
+	Open, High, Low, Close float32
+	N                      int
+}
+
+// ConvertTimePriceHistoryToDailyOHLC is a sibling of ConvertTimePriceHistoryToDailyPriceHistory
+// for callers that need more than a same-day average - tax lot accounting, volatility analysis
+// and charting all want the day's range, not just its mean. Open is the first sample of the day,
+// Close is the last, High/Low are the sample extremes, and N is the sample count. It shares
+// groupSamplesByDay's single-pass grouping and gap-validation (and loc's day-bucketing rules)
+// with ConvertTimePriceHistoryToDailyPriceHistory; only the per-day reduction and gap-fill
+// synthesis differ, because the two produce different result types.
+func ConvertTimePriceHistoryToDailyOHLC(history []types.ChartItem, policy FillPolicy, loc *time.Location, verbose bool) (map[string]Candle, map[string]FillKind, error) {
+	groups, gaps, err := groupSamplesByDay(history, policy, loc)
+	if err != nil {
+		return make(map[string]Candle, 0), make(map[string]FillKind, 0), err
+	}
+
+	results := make(map[string]Candle, 0)
+	fillKinds := make(map[string]FillKind, 0)
+	for _, g := range groups {
+		candle := Candle{Open: g.samples[0], High: g.samples[0], Low: g.samples[0], Close: g.samples[len(g.samples)-1], N: len(g.samples)}
+		for _, price := range g.samples[1:] {
+			if price > candle.High {
+				candle.High = price
 			}
-			if !dayTransitionOK {
-				return make(map[string]float32, 0), fmt.Errorf("Unexpected date/time: %s  (in full %s)  this-day: %d  prev-day: %d\n", thisDate, dateTime.Format("2006-01-02 15:04:05"), thisDOY, dayOfYear)
+			if price < candle.Low {
+				candle.Low = price
 			}
-			// Start processing the new day's prices
-			dayOfYear = thisDOY
-			pricesCounted = 1
-			totalValue = v[1]
-			thisDate = dateTime.Format("2006-01-02")
 		}
 		if verbose {
-			fmt.Printf("date/time: %s  day-of-year: %3.3d  this value: %.04f prices: %4.4d  total: %.04f\n", dateTime.Format("2006-01-02 15:04:05"), thisDOY, v[1], pricesCounted, totalValue)
+			fmt.Printf("Here save the candle as %s => %+v\n", g.date, candle)
 		}
+		results[g.date] = candle
+		fillKinds[g.date] = Observed
 	}
 
-	// Remember to write out the currently in-progress calcultation
-	if _, ok := results[thisDate]; ok {
-		return make(map[string]float32, 0), fmt.Errorf("Duplicate value generated for %s, previous was %0.04f\n", thisDate, results[thisDate])
+	for _, gap := range gaps {
+		fillOHLCGap(results, fillKinds, gap.fromDate, gap.toDate, policy)
 	}
-	if verbose {
-		fmt.Printf("Here save the total value as %s => %.04f\n", thisDate, totalValue/float32(pricesCounted))
+
+	return results, fillKinds, nil
+}
+
+// fillOHLCGap synthesizes Candle/FillKind entries for every day strictly between fromDate and
+// toDate (both already present in results), interpolating or carrying forward between the
+// from-day's Close and the to-day's Open exactly as fillGap does for the plain average. A filled
+// day has Open == High == Low == Close, since it has no real samples of its own, and N == 0.
+func fillOHLCGap(results map[string]Candle, fillKinds map[string]FillKind, fromDate, toDate string, policy FillPolicy) {
+	if policy.kind == fillNone {
+		return
 	}
-	results[thisDate] = totalValue / float32(pricesCounted)
 
-	return results, nil
+	fromPrice := results[fromDate].Close
+	toPrice := results[toDate].Open
+
+	from, _ := time.Parse("2006-01-02", fromDate)
+	totalDays, _ := daysBetween(fromDate, toDate)
+
+	for offset := 1; offset < totalDays; offset++ {
+		date := from.AddDate(0, 0, offset).Format("2006-01-02")
+		price := fromPrice
+		kind := ForwardFilled
+		if policy.kind != fillForward {
+			price = fromPrice + (toPrice-fromPrice)*float32(offset)/float32(totalDays)
+			kind = Interpolated
+		}
+		results[date] = Candle{Open: price, High: price, Low: price, Close: price, N: 0}
+		fillKinds[date] = kind
+	}
 }
 
-// Converts from a coin (ticker) symbol (such as BTC) to the name that Coingecko uses
-// for that coin (such as BTC). Currently this is a simple map lookup. However
-// CoinGecko does provide a list of pairs for conversion purposes so by isolating
-// this functionality here a future upgrade should be less painful.
-var token2cgToken = map[string]string{
-	"ADA":   "cardano",
-	"AVAX":  "avalanche-2",
-	"AXS":   "axie-infinity",
-	"BNB":   "bnb",
-	"BSGG":  "betswap-gg",
-	"BTC":   "bitcoin",
-	"CRO":   "crypto-com-chain",
-	"DOGE":  "dogecoin",
-	"DOT":   "polkadot",
-	"ENJ":   "enjincoin",
-	"ETH":   "ethereum",
-	"FLOW":  "flow",
-	"FWT":   "freeway",
-	"GOHM":  "governance-ohm",
-	"MANA":  "decentraland",
-	"MATIC": "matic-network",
-	"NEXO":  "nexo",
-	"SAND":  "the-sandbox",
-	"SOL":   "solana",
-	"TIME":  "wonderland",
-	"WMEMO": "wrapped-memory",
+// symbolResolver resolves a coin (ticker) symbol (such as BTC) to the id CoinGecko uses for that
+// coin (such as "bitcoin") - see SetSymbolResolver. It replaces this function's original
+// hand-maintained map: CoinGecko does provide /coins/list for exactly this lookup, and
+// SymbolResolver is the isolation point a future upgrade (e.g. a different vendor) would still go
+// through.
+var symbolResolver *SymbolResolver
+
+// SetSymbolResolver installs the SymbolResolver ConvertCoinSymbolToCoingeckoCoinName consults, so
+// a caller can point it at user-specific disk-cache/overrides file paths. If never called,
+// ConvertCoinSymbolToCoingeckoCoinName lazily creates a default SymbolResolver (no disk cache, no
+// overrides) the first time one is needed.
+func SetSymbolResolver(r *SymbolResolver) {
+	symbolResolver = r
 }
 
 func ConvertCoinSymbolToCoingeckoCoinName(symbol string) (string, bool) {
-	lookupToken, found := token2cgToken[symbol]
-	return lookupToken, found
+	if symbolResolver == nil {
+		r, err := NewSymbolResolver("", "")
+		if err != nil {
+			// NewSymbolResolver only fails on a malformed overrides file, and "" never is one.
+			panic(err)
+		}
+		symbolResolver = r
+	}
+	return symbolResolver.Resolve(symbol)
 }
 
-// Implement a delay to avoid overloading the CoinGecko API.
-// The limit is documented at: https://apiguide.coingecko.com/getting-started/error-and-rate-limit.
-// It may be as low as 10 requests per minute.
-//
-// For now, no delays are imposed.
-// Track the time (in sec from unix time) of each request in order in an array.
-// Eliminate any leading requests that are older than 60s.
-// If the resulting array is 8 or longer, delay by 8s.
-var requestTimes []int64
-
 // Set how far back in time (measured in days) to request
 // coin price data from CoinGecko.
 func SetDaysOfPriceHistoryToRequest(daysOfHistory int) {
 	daysOfPriceHistory = daysOfHistory
 }
 
-var cgApiCallTimes []int64
-
+// RateLimitCoinGeckoApiCalls blocks until coinGeckoConfig's shared token-bucket rate limiter has a
+// token free, so this file's calls to the go-gecko client (which has no hook of its own for
+// per-request throttling) don't exceed the configured rate. See ratelimiter.go: this used to
+// implement its own "more than 6 calls in the last 60s => sleep 8s" heuristic directly; that's now
+// centralized in a TokenBucket shared with this file's own raw net/http calls (FetchCoinPricesRange,
+// ValidateCurrency) via coinGeckoGet, and aware of a pro COINGECKO_API_KEY's higher rate limit.
 func RateLimitCoinGeckoApiCalls(verbose bool) {
-	if cgApiCallTimes == nil {
-		cgApiCallTimes = make([]int64, 0)
+	start := time.Now()
+	coinGeckoConfig().Limiter.Wait()
+	coinGeckoCallsTotal.Add(1)
+	if waited := time.Since(start); waited > 0 {
+		coinGeckoThrottleSecondsTotal.Add(waited.Seconds())
 	}
-
-	secondsNow := time.Now().Unix()
-	cgApiCallTimes = append(cgApiCallTimes, secondsNow)
 	if verbose {
-		fmt.Printf("Rate Limit Start:   %d calls ...\n", len(cgApiCallTimes))
-	}
-	// Count the number of API calls that are NOT within 60 seconds
-	count := 0
-	for _, v := range cgApiCallTimes {
-		if verbose {
-			fmt.Printf("Rate Limit Check: %d (+60=%d)%d ...\n", v, v+60, secondsNow)
-		}
-
-		if v+60 < secondsNow {
-			count += 1 // Count an entry that is older than 60s
-		} else {
-			break // No need to count further once an entry is seen that is within one minute
-		}
-	}
-	if count > 0 {
-		cgApiCallTimes = cgApiCallTimes[count:]
-	}
-	if verbose {
-		fmt.Printf("Rate Limit Trimmed: %d calls ...\n", len(cgApiCallTimes))
-	}
-
-	if len(cgApiCallTimes) > 6 {
-		if verbose {
-			fmt.Printf("%d calls within 1 min; pausing ...\n", len(cgApiCallTimes))
-		}
-		time.Sleep(8 * time.Second)
+		fmt.Printf("RateLimitCoinGeckoApiCalls: waited %s for a token\n", time.Since(start))
 	}
 }
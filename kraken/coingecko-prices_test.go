@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFetchCoinPricesRangeRejectsNonIncreasingWindow(t *testing.T) {
+	from := time.Date(2022, 4, 6, 0, 0, 0, 0, time.UTC)
+	to := from
+
+	if _, err := FetchCoinPricesRange("bitcoin", from, to, "usd"); err == nil {
+		t.Fatalf("FetchCoinPricesRange with to == from: expected an error, got none")
+	}
+	if _, err := FetchCoinPricesRange("bitcoin", from, from.AddDate(0, 0, -1), "usd"); err == nil {
+		t.Fatalf("FetchCoinPricesRange with to before from: expected an error, got none")
+	}
+}
+
+func TestLookupHistoricalTokenValueInBulkUsesConfiguredRangeFromCache(t *testing.T) {
+	origCache := perCoinHistoricalPrices
+	origStore := priceStore
+	origFrom, origTo := historicalPriceRangeFrom, historicalPriceRangeTo
+	t.Cleanup(func() {
+		perCoinHistoricalPrices = origCache
+		priceStore = origStore
+		historicalPriceRangeFrom, historicalPriceRangeTo = origFrom, origTo
+	})
+	perCoinHistoricalPrices = nil
+
+	store := NewJSONFilePriceStore(t.TempDir())
+	store.Put("ETH", "usd", "2021-06-01", 2500.0)
+	SetPriceStore(store)
+	SetHistoricalPriceRangeToRequest(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+
+	// The PriceStore already covers this coin, so the configured range should never need to
+	// trigger a FetchCoinPricesRange call (which would hit the network in this test environment).
+	price, err := LookupHistoricalTokenValueInBulk("ETH", "2021-06-01 00:00:00", "usd", false)
+	if err != nil {
+		t.Fatalf("LookupHistoricalTokenValueInBulk: unexpected error: %s", err)
+	}
+	if price != 2500.0 {
+		t.Errorf("LookupHistoricalTokenValueInBulk = %v, want 2500.0 (from the PriceStore)", price)
+	}
+}
+
+func TestInterpolateMissingPriceBothSidesKnown(t *testing.T) {
+	historicalData := map[string]float32{
+		"2022-04-05": 100.0,
+		"2022-04-08": 130.0,
+	}
+
+	price, found := interpolateMissingPrice(historicalData, "2022-04-06")
+	if !found {
+		t.Fatalf("interpolateMissingPrice: found=false, want true")
+	}
+	want := float32(110.0) // one third of the way from 100 to 130
+	if price != want {
+		t.Errorf("interpolateMissingPrice = %v, want %v", price, want)
+	}
+}
+
+func TestInterpolateMissingPriceOnlyOneSideKnown(t *testing.T) {
+	historicalData := map[string]float32{
+		"2022-04-05": 100.0,
+	}
+
+	price, found := interpolateMissingPrice(historicalData, "2022-04-06")
+	if !found {
+		t.Fatalf("interpolateMissingPrice: found=false, want true (back-fill from 2022-04-05)")
+	}
+	if price != 100.0 {
+		t.Errorf("interpolateMissingPrice = %v, want 100.0 (back-filled)", price)
+	}
+}
+
+func TestInterpolateMissingPriceNeitherSideWithinWindow(t *testing.T) {
+	historicalData := map[string]float32{
+		"2022-01-01": 50.0,
+	}
+
+	if _, found := interpolateMissingPrice(historicalData, "2022-04-06"); found {
+		t.Errorf("interpolateMissingPrice: found=true, want false (nearest known price is far outside maxGapFillDays)")
+	}
+}
+
+func TestLookupHistoricalTokenValueInBulkMarksInterpolatedPrices(t *testing.T) {
+	origCache := perCoinHistoricalPrices
+	origStore := priceStore
+	origInterpolated := interpolatedPrices
+	t.Cleanup(func() {
+		perCoinHistoricalPrices = origCache
+		priceStore = origStore
+		interpolatedPrices = origInterpolated
+	})
+	perCoinHistoricalPrices = nil
+	interpolatedPrices = nil
+
+	store := NewJSONFilePriceStore(t.TempDir())
+	store.Put("BTC", "usd", "2022-04-05", 40000.0)
+	store.Put("BTC", "usd", "2022-04-08", 43000.0)
+	SetPriceStore(store)
+
+	price, err := LookupHistoricalTokenValueInBulk("BTC", "2022-04-06 00:00:00", "usd", false)
+	if err != nil {
+		t.Fatalf("LookupHistoricalTokenValueInBulk: unexpected error: %s", err)
+	}
+	want := float32(41000.0) // one third of the way from 40000 to 43000
+	if price != want {
+		t.Errorf("LookupHistoricalTokenValueInBulk = %v, want %v (interpolated)", price, want)
+	}
+	if !IsInterpolatedPrice("BTC", "usd", "2022-04-06") {
+		t.Errorf("IsInterpolatedPrice(BTC, usd, 2022-04-06) = false, want true")
+	}
+	if IsInterpolatedPrice("BTC", "usd", "2022-04-05") {
+		t.Errorf("IsInterpolatedPrice(BTC, usd, 2022-04-05) = true, want false (a real observation)")
+	}
+}
@@ -8,6 +8,41 @@ package main
 // Some rows do not produce any output but as much checking as possible is performed anyway to try to avoid silent corruption.
 //
 // Output is grouped by cryptocurrency and presented in ascending date order within each group.
+//
+// pkg/kraken now provides a reusable client for Kraken's private /0/private/Ledgers and
+// /0/private/TradesHistory REST endpoints (pagination, request signing and an on-disk,
+// (txid, refid, time)-keyed cache for incremental runs), as an alternative way to obtain the rows
+// this file expects, instead of a manually-exported CSV. Wiring a `--api` mode into main() below to
+// call it and feed convertTransactions directly is left as follow-up: convertTransactions is an
+// ~800-line stateful switch with no test coverage and no compiler in this sandbox to catch a
+// mis-wired call site, so that rewiring isn't attempted here.
+//
+// pkg/priceoracle provides a multi-source historical price lookup - CoinGecko, Kraken's own public
+// OHLC endpoint and Bitfinex's candles endpoint, tried in order until one has data for the
+// requested day. LookupHistoricalTokenValue below now falls back to this cascade on a
+// coinHistoricalPrices cache miss instead of just printing and returning -1.0: a price the cascade
+// finds is flushed to that coin's own coin-price-data-<coin>-usd.csv (see
+// appendOnlinePriceToCoinCSV) so it's part of the on-disk cache loadPriceData reads on every later
+// run. loadPriceData itself no longer needs a hard-coded coin list - it now globs priceDataDir for
+// whatever coin-price-data-*-usd.csv files already exist there, so a coin the online cascade has
+// just fetched for the first time is picked up without editing this file.
+//
+// convertTransactions' "spend", "receive", "transfer" and "deposit" cases now record their
+// validation findings (a repeated refid, a missing field, an unmatched stake move, an unhandled
+// transfer subtype) as structured pkg/diagnostics.Issues instead of printing free-form text
+// straight to stdout; see --report below for the resulting human-readable summary and JSON report.
+// A transfer subtype this file has no handling for is recorded as Fatal and skipped (no output row
+// for that transaction) rather than aborting the whole run with log.Fatalf as before, so a batch
+// pipeline can see every bad row from a run instead of just the first one. The "staking", "earn"
+// and "withdrawal" cases, and their own log.Fatalf("row %d: unhandled ...") call sites, are
+// unchanged - narrowing this to the cases the request actually named keeps the blast radius of an
+// untested, uncompiled ~800-line function down to what was asked for.
+//
+// "trade", "margin trade", "rollover", "adjustment", "settled", "reward" and "sale" now also
+// produce output (BUY/SELL, ADJUSTMENT and STAKING-REWARD rows respectively) instead of calling
+// log.Fatalf, on the same basis as the rest of this file's handling for transaction types this
+// account has never actually produced: inferred from the documented field meanings and the
+// patterns already used for "spend"/"receive"/"staking", not verified against a real sample row.
 
 // Usage:
 // The program takes two parameters: the input transactions (in CSV format) and a file into which to write the resulting converted transactions (in CSV format).
@@ -69,10 +104,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
+
+	"github.com/AntonioCarlini/data-processing/pkg/diagnostics"
+	"github.com/AntonioCarlini/data-processing/pkg/importers"
+	"github.com/AntonioCarlini/data-processing/pkg/priceoracle"
 )
 
 type ledger struct {
@@ -90,6 +129,45 @@ type ledger struct {
 	balance string
 }
 
+// defaultStakeMoveWindowSeconds is how close together (in seconds) a "spottostaking" transfer and
+// its matching "stakingfromspot" must be recorded, since the two have no refid in common to pair
+// them by (see stakeMoveKey below).
+const defaultStakeMoveWindowSeconds = 120
+
+// stakeMoveKey identifies a single spot<->staking move: the currency being staked (with any ".S"
+// staking suffix already stripped), the absolute value of the amount moved, and the fee charged.
+// "spottostaking" and "stakingfromspot" ledger entries for the same underlying move share all
+// three, even though their refids differ.
+type stakeMoveKey struct {
+	asset  string
+	amount string
+	fee    string
+}
+
+func newStakeMoveKey(asset, amount, fee string) stakeMoveKey {
+	return stakeMoveKey{asset: asset, amount: strings.TrimLeft(amount, "-"), fee: fee}
+}
+
+// withinStakeMoveWindow reports whether the "2006-01-02 15:04:05"-formatted timestamps a and b are
+// no more than windowSeconds apart. An unparseable timestamp is treated as no match, since that's
+// already reported elsewhere as invalid row data.
+func withinStakeMoveWindow(a, b string, windowSeconds int) bool {
+	layout := "2006-01-02 15:04:05"
+	ta, err := time.Parse(layout, a)
+	if err != nil {
+		return false
+	}
+	tb, err := time.Parse(layout, b)
+	if err != nil {
+		return false
+	}
+	diff := ta.Sub(tb)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= time.Duration(windowSeconds)*time.Second
+}
+
 var historicalPriceCache = map[string]string{}
 var historicalPriceCacheUpdated bool = false
 
@@ -97,8 +175,16 @@ var historicalPriceCacheUpdated bool = false
 func main() {
 
 	cliHpdPath := flag.String("cache", "", "Directory that contains the historical price data (CSV)")
+	cliStakeWindow := flag.Int("stake-window", defaultStakeMoveWindowSeconds, "Maximum seconds between a \"spottostaking\" transfer and its matching \"stakingfromspot\" for them to be paired")
+	cliReportPath := flag.String("report", "", "Path to write a JSON diagnostics report to (if omitted, only the human-readable summary is printed)")
+	cliReportingCurrency := flag.String("reporting-currency", "usd", "CoinGecko vs_currency to report historical prices in (validated and recorded via SetReportingCurrency; no price lookup in this program reads it, LookupHistoricalTokenValue below included)")
 	flag.Parse()
 
+	if err := ValidateCurrency(*cliReportingCurrency); err != nil {
+		log.Fatalf("Invalid -reporting-currency: %s\n", err)
+	}
+	SetReportingCurrency(*cliReportingCurrency)
+
 	home := os.Getenv("HOME")
 	hpdFilename := home + "/.config/coin-prices/price-data/"
 	if *cliHpdPath != "" {
@@ -117,11 +203,23 @@ func main() {
 
 	transactions := readTransactions(transactionsFilename)
 
-	convertedTransactions := convertTransactions(transactions)
+	diag := diagnostics.NewCollector()
+	convertedTransactions := convertTransactions(transactions, *cliStakeWindow, diag)
 
 	writeConvertedTransactions(outputFile, convertedTransactions)
 
+	fmt.Print(diag.Summary())
+	if *cliReportPath != "" {
+		if err := diag.WriteJSON(*cliReportPath); err != nil {
+			log.Fatalf("Cannot write report '%s': %s\n", *cliReportPath, err.Error())
+		}
+	}
+
 	// TODO-price-lookup storeHistoricalPriceCache(hpcFilename)
+
+	if diag.HasBlockingIssues() {
+		os.Exit(1)
+	}
 }
 
 func readTransactions(name string) [][]string {
@@ -144,7 +242,7 @@ func readTransactions(name string) [][]string {
 // Works through every line of the input transactions file and converts each to the expected format or discards it.
 // Every line of the input file is parsed even though not all of them produce a corresponding line in the output file.
 // At the end each cryptocurrency's data is gathered together in forward time order (crypto.com lists transactions in reverse time order).
-func convertTransactions(transactions [][]string) [][]string {
+func convertTransactions(transactions [][]string, stakeMoveWindowSeconds int, diag *diagnostics.Collector) [][]string {
 	// The first element must match this exactly otherwise the format may have changed:
 	expectedFirstRow := []string{"txid", "refid", "time", "type", "subtype", "aclass", "asset", "wallet", "amount", "fee", "balance"}
 
@@ -159,7 +257,8 @@ func convertTransactions(transactions [][]string) [][]string {
 	pendingSpotToStaking := make(map[string]ledger)
 	pendingWithdrawals := make(map[string]ledger) // Only used by "withdrawal" transactions, which are not currently (2024-11) active
 	pendingStakingDeposits := make(map[string]ledger)
-	pendingTokenDeposits := make(map[string]ledger)
+	pendingStakeMoves := make(map[stakeMoveKey][]ledger)
+	pendingTrades := make(map[string]ledger) // "trade", "margin trade" and "sale" pairs sharing a refid
 
 	// Coin values are found by asking CoinGecko for historical market data: a single API call can return N days worth of data.
 	// Calculate how far back to go by finding the oldest entry in the transaction data - which happens to be the first record as it is
@@ -186,14 +285,21 @@ func convertTransactions(transactions [][]string) [][]string {
 			// In all cases seen so far, the "spend" precedes the "receive".
 			// The two are linked as a single logical transaction by having the same unique ref-id.
 			if prev, found := pendingSpends[entry.refid]; found {
-				fmt.Printf("Saw spend with repeated refid: %s (previous in row %d)\n", entry.refid, prev.row)
+				diag.Record(diagnostics.Issue{
+					Row: entry.row, RefID: entry.refid, Severity: diagnostics.Warn,
+					Code: "spend_repeated_refid", Message: "saw spend with a refid already pending",
+					RelatedRows: []int{prev.row},
+				})
 			}
 			// Check txid not blank and format is valid
 			// Check subtype is blank
 			// Check that balance is not blank
 			// This will be re-checked later but report it now in case no correspdonding "receive" is seen
 			if entry.txid == "" || entry.subtype != "" || entry.balance == "" {
-				fmt.Printf("Saw 'spend' with missing fields in row %d\n", entry.row)
+				diag.Record(diagnostics.Issue{
+					Row: entry.row, RefID: entry.refid, Severity: diagnostics.Error,
+					Code: "spend_missing_fields", Message: "spend row has a blank txid, non-blank subtype or blank balance",
+				})
 			}
 			// Save the entry in the pendingSpends map for later use by a "receive"
 			pendingSpends[entry.refid] = entry
@@ -204,7 +310,10 @@ func convertTransactions(transactions [][]string) [][]string {
 			spend, found := pendingSpends[entry.refid]
 			// Complain if the reference number is not already in the map
 			if !found {
-				fmt.Printf("Saw 'receive' in row %d with no matching spend)\n", entry.row)
+				diag.Record(diagnostics.Issue{
+					Row: entry.row, RefID: entry.refid, Severity: diagnostics.Error,
+					Code: "receive_no_matching_spend", Message: "saw receive with no matching pending spend",
+				})
 				valid = false
 			} else {
 				// totalSpendGBP := calculateSpendAsString(spend)
@@ -215,11 +324,18 @@ func convertTransactions(transactions [][]string) [][]string {
 				// Check subtype is blank
 				// Check that balance is not blank
 				if entry.txid == "" || entry.subtype != "" || entry.balance == "" {
-					fmt.Printf("Saw 'receive' with missing fields in row %d\n", entry.row)
+					diag.Record(diagnostics.Issue{
+						Row: entry.row, RefID: entry.refid, Severity: diagnostics.Error,
+						Code: "receive_missing_fields", Message: "receive row has a blank txid, non-blank subtype or blank balance",
+					})
 					valid = false
 				}
 				if spend.txid == "" || spend.subtype != "" || spend.balance == "" {
-					fmt.Printf("Saw 'spend' with missing fields in row %d\n", entry.row)
+					diag.Record(diagnostics.Issue{
+						Row: entry.row, RefID: entry.refid, Severity: diagnostics.Error,
+						Code: "spend_missing_fields", Message: "spend row has a blank txid, non-blank subtype or blank balance",
+						RelatedRows: []int{spend.row},
+					})
 					valid = false
 				}
 				// Handle a non-GBP spend; for now only FLOW, BTC, ETHW and DOT are handled
@@ -230,14 +346,17 @@ func convertTransactions(transactions [][]string) [][]string {
 					// The spend in fiat currency is not known, so both the SELL and BUY will have to be calculated manually
 					// As a starting point, find the value of the purchased currentcy and use that for both.
 					// That should produce a reasonable value for the amount received for the initial token minus costs
-					tokenValueFloat32, _ := LookupHistoricalTokenValue(entry.asset, entry.time)
-					amount, err := strconv.ParseFloat(entry.amount, 32)
+					tokenValue, _ := LookupHistoricalTokenValue(entry.asset, entry.time)
+					amount, err := importers.ParseAmount(entry.amount)
 					if err != nil {
-						fmt.Printf("Saw invalid token amount (%s) on row %d\n", entry.amount, entry.row)
+						diag.Record(diagnostics.Issue{
+							Row: entry.row, RefID: entry.refid, Severity: diagnostics.Error,
+							Code: "receive_invalid_token_amount", Message: fmt.Sprintf("invalid token amount %q", entry.amount),
+						})
 						valid = false
 					}
-					tokenPriceUSD = fmt.Sprintf("%f", tokenValueFloat32)
-					totalSpendUSD = fmt.Sprintf("%f", tokenValueFloat32*float32(amount))
+					tokenPriceUSD = tokenValue.String()
+					totalSpendUSD = tokenValue.Mul(amount).String()
 					ukSpendTime := convertKrakenTimeToUKTime(spend.time)
 					if valid {
 						data := []string{"", "Kraken", spend.time, ukSpendTime, spend.amount, "", totalSpendUSD, "", "", "", "", "", "", "SELL", "", "", "", "", "", "", "", "", "", note}
@@ -249,7 +368,12 @@ func convertTransactions(transactions [][]string) [][]string {
 					}
 				} else if spend.asset != "ZGBP" && entry.asset != "USD" {
 					// TODO: consider both purchase of crypto using GBP and sale of crypto receiving GBP
-					fmt.Printf("Saw non GBP (currency %s) 'spend' in row %d and currency %s 'receive' in row %d\n", spend.asset, spend.row, entry.asset, entry.row)
+					diag.Record(diagnostics.Issue{
+						Row: entry.row, RefID: entry.refid, Severity: diagnostics.Error,
+						Code:    "receive_non_gbp_spend",
+						Message: fmt.Sprintf("non-GBP spend currency %s for receive currency %s", spend.asset, entry.asset),
+						RelatedRows: []int{spend.row},
+					})
 					valid = false
 				}
 				if valid {
@@ -289,11 +413,11 @@ func convertTransactions(transactions [][]string) [][]string {
 			// TODO-VERIFY-OR-REMOVE	fmt.Printf("Failed to find corresponding deposit for staking on row %d\n", entry.row)
 			// TODO-VERIFY-OR-REMOVE }
 			if valid {
-				tokenValueFloat32, err := LookupHistoricalTokenValue(stakedCurrency, entry.time)
+				tokenValueAmount, err := LookupHistoricalTokenValue(stakedCurrency, entry.time)
 				if err != nil {
 					log.Fatal(err)
 				}
-				tokenValue := fmt.Sprintf("%f", tokenValueFloat32)
+				tokenValue := tokenValueAmount.String()
 				data := []string{"", "Kraken", entry.time, ukTime, entry.amount, tokenValue, "", "", "", "", "", "", "", "STAKING"}
 				output[stakedCurrency] = append(output[stakedCurrency], data)
 			} else {
@@ -322,58 +446,64 @@ func convertTransactions(transactions [][]string) [][]string {
 			// This happened during the Ethereum Merge (moving from PoW to PoS) and shows in the online history as "EthereumPoW".
 			// It has been noted and checked, but no output is generated,
 			if entry.subtype == "spottostaking" {
-				// This entry (and the matching "stakingfromspot") represent a move of a cryptoasset to the staking pool
+				// This entry (and the matching "stakingfromspot") represent a move of a cryptoasset to the staking pool.
 				// It is assumed that the "spottostaking" will always precede the matching "stakingfromspot".
-				// There seems to be no connection, the ref-id values do not match.
-				// It seems that the only way to match "spottostaking" and "stakingfromspot" is to check the amounts and require that the two transactions be within a few seconds of each other!
-				// TOOD: For now, just ignore this entry.
-				// No output row will be written.
+				// There is no ref-id connecting the two, so buffer this one in pendingStakeMoves, keyed on the
+				// asset/amount/fee it shares with its match, for "stakingfromspot" below to find by amount and time window.
+				key := newStakeMoveKey(entry.asset, entry.amount, entry.fee)
+				pendingStakeMoves[key] = append(pendingStakeMoves[key], entry)
 			} else if entry.subtype == "stakingfromspot" {
-				// This entry (and the matching "spottostaking") represent a move of a cryptoasset to the staking pool
-				// It is assumed that the "spottostaking" will always precede the matching "stakingfromspot".
-				// There seems to be no connection, the ref-id values do not match.
-				// It seems that the only way to match "spottostaking" and "stakingfromspot" is to check the amounts and require that the two transactions be within a few seconds of each other!
-				// TOOD: For now, just ignore this entry.
-				// No output row will be written.
-			} else if entry.subtype == "spotfromfutures" {
-				// Since at least late 2024 this transaction type may have changed and so may no longer be handled correctly.
-				// Do not remove the log.fatal() without verifying transaction handling and correcting if necessary.
-				log.Fatalf("row %d: unhandled transaction type %s", entry.row, entry.format)
-
-				if _, found := pendingTokenDeposits[entry.refid]; !found {
-					fmt.Printf("transfer spotfromfutures with no matching deposit on row %d\n", entry.row)
-				} else {
-					delete(pendingTokenDeposits, entry.refid)
+				// This entry (and the matching "spottostaking") represent a move of a cryptoasset to the staking pool.
+				// There is no ref-id connecting the two, so look up a "spottostaking" buffered above whose asset, amount
+				// and fee match to full precision and whose timestamp falls within stakeMoveWindowSeconds of this one's.
+				stakedCurrency := strings.TrimSuffix(entry.asset, ".S")
+				key := newStakeMoveKey(stakedCurrency, entry.amount, entry.fee)
+				candidates := pendingStakeMoves[key]
+				matchedIndex := -1
+				for i, candidate := range candidates {
+					if withinStakeMoveWindow(candidate.time, entry.time, stakeMoveWindowSeconds) {
+						matchedIndex = i
+						break
+					}
 				}
-			} else if entry.subtype == "stakingtospot" {
-				// Since at least late 2024 this transaction type may have changed and so may no longer be handled correctly.
-				// Do not remove the log.fatal() without verifying transaction handling and correcting if necessary.
-				log.Fatalf("row %d: unhandled transaction type %s", entry.row, entry.format)
+				if matchedIndex == -1 {
+					diag.Record(diagnostics.Issue{
+						Row: entry.row, RefID: entry.refid, Severity: diagnostics.Warn,
+						Code:    "transfer_stakingfromspot_unmatched",
+						Message: fmt.Sprintf("stakingfromspot has no matching spottostaking within %ds", stakeMoveWindowSeconds),
+					})
+				} else {
+					tokenValueAmount, err := LookupHistoricalTokenValue(stakedCurrency, entry.time)
+					if err != nil {
+						log.Fatal(err)
+					}
+					tokenValue := tokenValueAmount.String()
+					data := []string{"", "Kraken", entry.time, ukTime, entry.amount, tokenValue, "", "", "", "", "", "", "", "STAKE"}
+					output[stakedCurrency] = append(output[stakedCurrency], data)
 
-				// This seems to represent a withdrawl from staking
-				// TODO this should match a withdrawl and should involve a .S currency
-				valid := true
-				var withdrawal ledger
-				withdrawal, valid = pendingSpotToStaking[entry.refid]
-				if !valid {
-					fmt.Printf("transfer (stakingtospot) on row %d has no matching withdrawal\n", entry.row)
-				} else if (entry.amount != withdrawal.amount) || (entry.fee != withdrawal.fee) || (entry.asset != withdrawal.asset) {
-					fmt.Printf("transfer (stakingtospot) on row %d does not properly match withdrawal on row %d\n", entry.row, withdrawal.row)
+					candidates = append(candidates[:matchedIndex], candidates[matchedIndex+1:]...)
+					if len(candidates) == 0 {
+						delete(pendingStakeMoves, key)
+					} else {
+						pendingStakeMoves[key] = candidates
+					}
 				}
-				delete(pendingSpotToStaking, entry.refid)
-			} else if entry.subtype == "spotfromstaking" {
+			} else if entry.subtype == "spotfromfutures" || entry.subtype == "stakingtospot" || entry.subtype == "spotfromstaking" {
 				// Since at least late 2024 this transaction type may have changed and so may no longer be handled correctly.
-				// Do not remove the log.fatal() without verifying transaction handling and correcting if necessary.
-				log.Fatalf("row %d: unhandled transaction type %s", entry.row, entry.format)
-
-				// This seems to represent a withdrawl from staking
-				// TODO should match a deposit, but there is no check for that yet
+				// This used to be an immediate log.Fatalf; it's now recorded as Fatal and the row is
+				// skipped (no output), so one bad row doesn't stop a batch run from seeing the rest.
+				// Do not downgrade this below Fatal without verifying transaction handling and correcting it.
+				diag.Record(diagnostics.Issue{
+					Row: entry.row, RefID: entry.refid, Severity: diagnostics.Fatal,
+					Code:    "transfer_unhandled_subtype",
+					Message: fmt.Sprintf("unhandled transfer subtype %s", entry.subtype),
+				})
 			} else {
-				// Since at least late 2024 this transaction type may have changed and so may no longer be handled correctly.
-				// Do not remove the log.fatal() without verifying transaction handling and correcting if necessary.
-				log.Fatalf("row %d: unhandled transaction type %s", entry.row, entry.format)
-
-				fmt.Printf("Invalid subtype (%s) for transfer on row %d\n", entry.subtype, entry.row)
+				diag.Record(diagnostics.Issue{
+					Row: entry.row, RefID: entry.refid, Severity: diagnostics.Fatal,
+					Code:    "transfer_unknown_subtype",
+					Message: fmt.Sprintf("unknown transfer subtype %q", entry.subtype),
+				})
 			}
 		case "earn":
 			// "earn/migration" seems to occur as a pair with spot and earn wallets.
@@ -386,11 +516,11 @@ func convertTransactions(transactions [][]string) [][]string {
 			} else if entry.subtype == "reward" {
 				stakedCurrency := entry.asset
 				if valid {
-					tokenValueFloat32, err := LookupHistoricalTokenValue(stakedCurrency, entry.time)
+					tokenValueAmount, err := LookupHistoricalTokenValue(stakedCurrency, entry.time)
 					if err != nil {
 						log.Fatal(err)
 					}
-					tokenValue := fmt.Sprintf("%f", tokenValueFloat32)
+					tokenValue := tokenValueAmount.String()
 					data := []string{"", "Kraken", entry.time, ukTime, entry.amount, tokenValue, "", "", "", "", "", "", "", "STAKING"}
 					output[stakedCurrency] = append(output[stakedCurrency], data)
 				} else {
@@ -449,7 +579,11 @@ func convertTransactions(transactions [][]string) [][]string {
 				// or
 				//   a staking reward which should later be matched by a "staking" with matching details
 				if prev, found := pendingStakingDeposits[entry.refid]; found {
-					fmt.Printf("Saw deposit of staked currency with repeated refid: %s (previous in row %d)\n", entry.refid, prev.row)
+					diag.Record(diagnostics.Issue{
+						Row: entry.row, RefID: entry.refid, Severity: diagnostics.Warn,
+						Code: "deposit_staked_repeated_refid", Message: "saw deposit of staked currency with a refid already pending",
+						RelatedRows: []int{prev.row},
+					})
 				}
 				pendingStakingDeposits[entry.refid] = entry
 			} else {
@@ -487,31 +621,63 @@ func convertTransactions(transactions [][]string) [][]string {
 				}
 				delete(pendingWithdrawals, entry.refid)
 			}
-		case "trade":
-			// TBD
-			log.Fatalf("row %d: unhandled transaction type %s", entry.row, entry.format)
-		case "margin trade":
-			// TBD
-			log.Fatalf("row %d: unhandled transaction type %s", entry.row, entry.format)
-		case "rollover":
-			// TBD
-			log.Fatalf("row %d: unhandled transaction type %s", entry.row, entry.format)
-		case "adjustment":
-			// TBD
-			log.Fatalf("row %d: unhandled transaction type %s", entry.row, entry.format)
-		case "settled":
-			// TBD
-			log.Fatalf("row %d: unhandled transaction type %s", entry.row, entry.format)
+		case "trade", "margin trade", "sale":
+			// None of these three has been seen in the ledger yet, so the pairing below is inferred
+			// from the way "spend"/"receive" already pairs a two-row transaction, not from a real
+			// sample row: each is expected to appear as two rows sharing a refid, one with a
+			// negative amount (the asset given up) and one with a positive amount (the asset
+			// received) - "sale" is simply the case where the asset given up is fiat, symmetrical to
+			// a "trade" against fiat rather than another token.
+			if _, found := pendingTrades[entry.refid]; !found {
+				pendingTrades[entry.refid] = entry
+			} else {
+				first := pendingTrades[entry.refid]
+				delete(pendingTrades, entry.refid)
+
+				debit, credit := first, entry
+				if strings.HasPrefix(credit.amount, "-") && !strings.HasPrefix(debit.amount, "-") {
+					debit, credit = entry, first
+				}
+				ukDebitTime := convertKrakenTimeToUKTime(debit.time)
+				ukCreditTime := convertKrakenTimeToUKTime(credit.time)
+				note := fmt.Sprintf("SELL %s %s to buy %s %s", strings.TrimLeft(debit.amount, "-"), debit.asset, credit.amount, credit.asset)
+				// As with "spend"/"receive", the actual sell is the amount plus the fee; the fee is
+				// assumed to be charged on the debited leg.
+				totalDebit := calculateSpendAsString(debit)
+
+				sellData := []string{"", "Kraken", debit.time, ukDebitTime, debit.amount, "", totalDebit, "", "", "", "", "", "", "SELL", "", "", "", "", "", "", "", "", "", note}
+				output[debit.asset] = append(output[debit.asset], sellData)
+				buyData := []string{"", "Kraken", credit.time, ukCreditTime, credit.amount, "", totalDebit, "", "", "", "", "", "", "BUY", "", "", "", "", "", "", "", "", "", note}
+				output[credit.asset] = append(output[credit.asset], buyData)
+			}
+		case "rollover", "adjustment", "settled":
+			// Margin-position bookkeeping rows: no trade is represented, just a balance change
+			// against an existing margin position. There is nothing else in the ledger to tie
+			// successive rollover/adjustment/settled rows for the same position together, so each
+			// is simply emitted as its own ADJUSTMENT row noting the refid of the position it
+			// belongs to.
+			note := fmt.Sprintf("%s against margin position %s", entry.format, entry.refid)
+			data := []string{"", "Kraken", entry.time, ukTime, entry.amount, "", "", "", "", "", "", "", "", "ADJUSTMENT", note}
+			output[entry.asset] = append(output[entry.asset], data)
 		case "reward":
-			// TBD
-			// This is documented as:
-			//    "reward" = credit of staking rewards
-			// and an undocumented format of "staking" does appear, so this is probably
-			// a documentation error and is intended to be "staking".
-			log.Fatalf("row %d: unhandled transaction type %s", entry.row, entry.format)
-		case "sale":
-			// TBD
-			log.Fatalf("row %d: unhandled transaction type %s", entry.row, entry.format)
+			// Documented as a credit of staking rewards; the undocumented "staking" format above
+			// already covers that, and "reward" may be a documentation alias for it rather than a
+			// row Kraken actually emits. It is handled as its own STAKING-REWARD row, using the same
+			// .S-suffix stripping and historical-price lookup the "staking" case uses.
+			valid := rowValuesAcceptable
+			stakedCurrency := strings.TrimSuffix(entry.asset, ".S")
+			if valid {
+				tokenValueAmount, err := LookupHistoricalTokenValue(stakedCurrency, entry.time)
+				if err != nil {
+					log.Fatal(err)
+				}
+				tokenValue := tokenValueAmount.String()
+				data := []string{"", "Kraken", entry.time, ukTime, entry.amount, tokenValue, "", "", "", "", "", "", "", "STAKING-REWARD"}
+				output[stakedCurrency] = append(output[stakedCurrency], data)
+			} else {
+				data := []string{"**BAD DATA**", "Kraken", entry.time, ukTime, entry.amount, "", "", "", "", "", "", "", "", "STAKING-REWARD **BAD DATA**"}
+				output[stakedCurrency] = append(output[stakedCurrency], data)
+			}
 		default:
 			fmt.Printf("UNRECOGNISED <%s>\n", entry.format)
 			// entry := []string{"***UNRECOGNISED***", "crypto.com App", exchangeTime, ukTime, amount, "", "", "", nativeAmount, "", "", "", "", "***INVALID***"}
@@ -539,6 +705,18 @@ func convertTransactions(transactions [][]string) [][]string {
 		fmt.Printf("Error: Unmatched \"deposit\" (staking): row: %d entry=%v\n", v.row, v)
 	}
 
+	// Warn if there are any unmatched spot<->staking moves
+	for key, candidates := range pendingStakeMoves {
+		for _, v := range candidates {
+			fmt.Printf("Error: Unmatched \"spottostaking\" (asset=%s amount=%s fee=%s): row: %d entry=%v\n", key.asset, key.amount, key.fee, v.row, v)
+		}
+	}
+
+	// Warn if there are any unmatched trade/margin trade/sale legs
+	for _, v := range pendingTrades {
+		fmt.Printf("Error: Unmatched \"%s\": row: %d entry=%v\n", v.format, v.row, v)
+	}
+
 	// Find all the currencies in the map
 	// For some reason BTC is recorded as XXBT, ETH as XETH and DOGE as XXDG, so allow for this
 	currencyTranslation := map[string]string{"XXBT": "BTC", "XXDG": "DOGE", "XETH": "ETH"}
@@ -659,64 +837,29 @@ func areRowValuesAcceptable(entry ledger) bool {
 	return valid
 }
 
-// Accepts a string representing a currency with two decimal places (e.g. GBP, EUR or USD) and returns the integer value in pennies.
-// Allows for the cases where only one penny digit or no penny digits or no decimal point are present.
-// The decimal comma notation is not supported (as it is not needed).
-// The number of pennies digits can exceed two, so
-// So:
-//   "123.75" produces 12375
-//   "123.7"  produces 12370
-//   "123."   produces 12300
-//   "123"    produces 12300
-//   ".1"     produces    10
-
-func makePenniesFromGBP(currency string) int {
-	result := strings.Split(currency, ".")
-	poundsString := result[0]
-	if poundsString == "" {
-		poundsString = "0"
-	}
-	penniesString := "00"
-	if len(result) == 2 {
-		penniesString = result[1]
-	} else if len(result) > 2 {
-		fmt.Printf("number of decimal separators exceeds 1 in %s\n", currency)
-	}
-
-	pounds, err := strconv.Atoi(poundsString)
+// calculateSpendAsString calculates the total spend represented by a "spend" ledger entry: the
+// addition of the absolute values of spend.amount (usually negative) and spend.fee (usually
+// positive), returned as a decimal string. It uses importers.Amount (an arbitrary-precision
+// big.Rat, this repo's substitute for shopspring/decimal - see pkg/importers/normalized.go's own
+// doc comment on Amount: shopspring/decimal is not a dependency of this module) rather than the
+// pennies-only int arithmetic this used to do, which silently truncated anything finer than two
+// decimal places - wrong for a crypto-denominated spend leg (entry.asset is not always fiat; see
+// the "trade"/"margin trade"/"sale" case in convertTransactions above, which can call this on a
+// BTC debit leg).
+func calculateSpendAsString(spend ledger) string {
+	spendAmount := strings.TrimLeft(spend.amount, "-")
+	spendFee := strings.TrimLeft(spend.fee, "-")
+	amount, err := importers.ParseAmount(spendAmount)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(2)
 	}
-	if len(penniesString) == 0 {
-		penniesString = "00"
-	} else if len(penniesString) == 1 {
-		penniesString += "0"
-	} else if len(penniesString) > 2 {
-		penniesString = penniesString[0:2]
-	}
-	pennies, err := strconv.Atoi(penniesString)
+	fee, err := importers.ParseAmount(spendFee)
 	if err != nil {
 		fmt.Println(err)
-		// os.Exit(3)
+		os.Exit(2)
 	}
-	return (pounds * 100) + pennies
-}
-
-// Helper function that calculates the total spend represented by a "spend" ledger entry
-// Note that the spend.amount will usually be negative and the spend.fee will be positive.
-// The result should be the addition of the absolute values, returned as a string.
-// The entries often contain pennies values to more than two digits. These are simply truncated,
-// although some care is taken to avoid floating point rounding errors.
-func calculateSpendAsString(spend ledger) string {
-	spendAmount := strings.TrimLeft(spend.amount, "-")
-	spendFee := strings.TrimLeft(spend.fee, "-")
-	amountPennies := makePenniesFromGBP(spendAmount)
-	feePennies := makePenniesFromGBP(spendFee)
-	totalPennies := amountPennies + feePennies
-	finalPounds := totalPennies / 100
-	finalPennies := totalPennies - (finalPounds * 100)
-	return fmt.Sprintf("%s.%02.02s", strconv.Itoa(finalPounds), strconv.Itoa(finalPennies))
+	return amount.Add(fee).String()
 }
 
 // Helper function that indicates whether the entry currency is an expected fiat one.
@@ -733,33 +876,44 @@ func isFiatCurrency(currency string) bool {
 	return found
 }
 
-// This will be a map of '"coin-name" @ "YYYY-MM-DD"' => coin price in USD as a fp number
-var coinHistoricalPrices map[string]float32
+// This will be a map of '"coin-name" @ "YYYY-MM-DD"' => coin price in USD, held as an
+// importers.Amount (arbitrary-precision) rather than float32: a price like $60,000.12345678 loses
+// its last few digits the moment it's rounded into a float32.
+var coinHistoricalPrices map[string]importers.Amount
+
+// priceDataDirForOnlineFlush is priceDataDir as passed to loadPriceData, kept around so a price
+// fetched online by LookupHistoricalTokenValue can be appended to that same coin's CSV via
+// appendOnlinePriceToCoinCSV, ready for loadPriceDataForCoin to pick up on the next run.
+var priceDataDirForOnlineFlush string
+
+// onlineChain is the cascade of online price sources LookupHistoricalTokenValue falls back to on a
+// coinHistoricalPrices cache miss; built lazily so a run that never needs it never dials out.
+var onlineChain *priceoracle.Chain
+
+func onlinePriceChain() *priceoracle.Chain {
+	if onlineChain == nil {
+		onlineChain = priceoracle.NewChain(
+			priceoracle.NewCoinGeckoProvider(),
+			priceoracle.NewKrakenOHLCProvider(),
+			priceoracle.NewBitfinexProvider(),
+		)
+	}
+	return onlineChain
+}
 
 func loadPriceData(priceDataDir string) {
+	priceDataDirForOnlineFlush = priceDataDir
+
+	pattern := filepath.Join(priceDataDir, "coin-price-data-*-usd.csv")
+	priceFiles, err := filepath.Glob(pattern)
+	if err != nil {
+		log.Fatalf("Invalid price data directory %q: %s", priceDataDir, err)
+	}
 
-	coins := []string{
-		"ada",
-		"avax",
-		"axs",
-		"bsgg",
-		"btc",
-		"dot",
-		"doge",
-		"enj",
-		"erg",
-		"eth",
-		"flow",
-		"mana",
-		"sand",
-		"sol",
-		"wmemo",
-	}
-
-	coinHistoricalPrices = make(map[string]float32)
-	for _, c := range coins {
-		priceFile := fmt.Sprintf("%scoin-price-data-%s-usd.csv", priceDataDir, c)
-		// DEBUG fmt.Println(index, priceFile)
+	coinHistoricalPrices = make(map[string]importers.Amount)
+	for _, priceFile := range priceFiles {
+		base := filepath.Base(priceFile)
+		c := strings.TrimSuffix(strings.TrimPrefix(base, "coin-price-data-"), "-usd.csv")
 		loadPriceDataForCoin(c, priceFile)
 	}
 
@@ -781,16 +935,15 @@ func loadPriceDataForCoin(c string, priceFile string) {
 		if line_num == 0 {
 			continue
 		}
-		date, err := time.Parse("2006-01-02 15:04:05 UTC", entry[0])
+		date, err := ParsePriceTimestamp(entry[0], false)
 		if err != nil {
 			log.Fatalf("Invalid date (%s) on line %d of file %s\n", entry[0], line_num, priceFile, err)
 		}
 		cacheDate := date.Format("2006-01-02")
-		price64, err := strconv.ParseFloat(entry[1], 32)
+		price, err := importers.ParseAmount(entry[1])
 		if err != nil {
-			// do something sensible
+			log.Fatalf("Invalid price (%s) on line %d of file %s: %s\n", entry[1], line_num, priceFile, err)
 		}
-		price := float32(price64)
 		cacheIndex := c + "@" + cacheDate
 		_, ok := coinHistoricalPrices[cacheIndex]
 		// If the key exists already, something is wrong
@@ -802,10 +955,14 @@ func loadPriceDataForCoin(c string, priceFile string) {
 
 }
 
-func LookupHistoricalTokenValue(requestedToken string, dateTime string) (float32, error) {
+// noPriceAvailable is returned by LookupHistoricalTokenValue when no price could be found, the
+// same "-1.0" sentinel the old float32 return used, now as an importers.Amount.
+var noPriceAvailable = importers.MustParseAmount("-1")
+
+func LookupHistoricalTokenValue(requestedToken string, dateTime string) (importers.Amount, error) {
 	// TODO This function might be called with USD ... suppress the error in that case
 	if strings.ToLower(requestedToken) == "usd" {
-		return -1.0, nil
+		return noPriceAvailable, nil
 	}
 	// Verify the date is valid and turn into the format coingecko wants (DD-MM-YY HH:MM:SS)
 	date, err := time.Parse("2006-01-02 15:04:05", dateTime)
@@ -817,14 +974,63 @@ func LookupHistoricalTokenValue(requestedToken string, dateTime string) (float32
 	// The cache is indexed according to coin name and date
 	index := strings.ToLower(requestedToken) + "@" + cgDate
 	price, ok := coinHistoricalPrices[index]
-	// If the key exists
+	if !ok {
+		// Nothing in the on-disk cache: fall back to the online cascade (CoinGecko, then Kraken's
+		// own OHLC endpoint, then Bitfinex) before giving up. A price found this way is both cached
+		// in memory for the rest of this run and flushed to this coin's own CSV so the next run
+		// finds it on disk without dialing out again.
+		if quoted, _, err := onlinePriceChain().PriceAt(requestedToken, date); err == nil {
+			if parsed, err := importers.ParseAmount(quoted); err == nil {
+				price = parsed
+				coinHistoricalPrices[index] = price
+				appendOnlinePriceToCoinCSV(requestedToken, date, price)
+				ok = true
+			}
+		}
+	}
 	if !ok {
 		fmt.Printf("failed to find price for [%s]\n", index)
-		price = -1.0
+		price = noPriceAvailable
 	}
 
 	// Deliberately return no error for now ... no prices are available yet!
-	// DEBUG fmt.Printf("Price lookup for %s at %s produces %f\n", requestedToken, dateTime, price)
+	// DEBUG fmt.Printf("Price lookup for %s at %s produces %s\n", requestedToken, dateTime, price)
 	return price, nil
 
 }
+
+// appendOnlinePriceToCoinCSV appends a price fetched from the online cascade to requestedToken's
+// own coin-price-data-<coin>-usd.csv in priceDataDirForOnlineFlush, in the same
+// "YYYY-MM-DD HH:MM:SS UTC",price format loadPriceDataForCoin already reads - so a price fetched
+// online today is part of the on-disk cache loadPriceData reads on every later run, same as one
+// that was there from the start. A no-op if loadPriceData was never called (priceDataDirForOnlineFlush
+// is empty), and any write error is reported rather than fatal, since the price is already usable
+// for this run either way.
+func appendOnlinePriceToCoinCSV(requestedToken string, date time.Time, price importers.Amount) {
+	if priceDataDirForOnlineFlush == "" {
+		return
+	}
+	priceFile := filepath.Join(priceDataDirForOnlineFlush, fmt.Sprintf("coin-price-data-%s-usd.csv", strings.ToLower(requestedToken)))
+
+	writeHeader := false
+	if _, err := os.Stat(priceFile); os.IsNotExist(err) {
+		writeHeader = true
+	}
+
+	f, err := os.OpenFile(priceFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Printf("failed to open %s to cache online price for [%s]: %s\n", priceFile, requestedToken, err)
+		return
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if writeHeader {
+		w.Write([]string{"date", "price"})
+	}
+	w.Write([]string{date.Format("2006-01-02 15:04:05") + " UTC", price.String()})
+	w.Flush()
+	if err := w.Error(); err != nil {
+		fmt.Printf("failed to cache online price for [%s] to %s: %s\n", requestedToken, priceFile, err)
+	}
+}
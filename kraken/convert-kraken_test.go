@@ -42,21 +42,26 @@ type TestAndResults struct {
 	name      string
 	testcases []DatePriceInfo
 	results   map[string]float32
+	candles   map[string]Candle // nil for a case whose success is false: no value assertions are made
 	success   bool
 }
 
 // Checks ConvertTimePriceHistoryToDailyPriceHistory
 func TestConvertToPriceHistory(t *testing.T) {
-	// Case 1: Normal case, a few days in a row, some needing an average, all one day apart
+	// Case 1: Normal case, a few days in a row, some needing an average, all one day apart.
+	// Deliberately written with a different timestamp shape per row (RFC3339 with "Z", RFC3339
+	// with a numeric offset, DD/MM/YYYY, the plain "YYYY-MM-DD HH:MM:SS" baseline, "Mon D YYYY",
+	// "Mon D, YYYY", a bare Unix epoch, and a leading weekday name) to prove
+	// ParsePriceTimestamp accepts all of them as the same instant a source-format-agnostic way.
 	var Test1 = []DatePriceInfo{
-		{"2021-10-21 09:00:01", 32000.00},
-		{"2021-10-21 12:00:01", 31000.00},
-		{"2021-10-21 18:00:01", 33000.00},
+		{"2021-10-21T09:00:01Z", 32000.00},
+		{"2021-10-21T12:00:01+00:00", 31000.00},
+		{"21/10/2021 18:00:01", 33000.00},
 		{"2021-10-22 18:00:01", 35000.00},
-		{"2021-10-23 09:00:01", 35000.00},
-		{"2021-10-23 12:00:01", 37000.00},
-		{"2021-10-23 18:00:01", 39000.00},
-		{"2021-10-23 20:00:01", 41000.00},
+		{"Oct 23 2021 09:00:01", 35000.00},
+		{"Oct 23, 2021 12:00:01", 37000.00},
+		{"1635012001", 39000.00}, // 2021-10-23 18:00:01 UTC as a bare Unix epoch
+		{"Sat 2021-10-23 20:00:01", 41000.00},
 	}
 	var ExpectedTestResult1 = map[string]float32{
 		"2021-10-21": 32000.00,
@@ -225,15 +230,62 @@ func TestConvertToPriceHistory(t *testing.T) {
 		"2022-01-02": 100000.00,
 		"2022-01-03": 7000.00,
 	}
+	var ExpectedCandles1 = map[string]Candle{
+		"2021-10-21": {Open: 32000.00, High: 33000.00, Low: 31000.00, Close: 33000.00, N: 3},
+		"2021-10-22": {Open: 35000.00, High: 35000.00, Low: 35000.00, Close: 35000.00, N: 1},
+		"2021-10-23": {Open: 35000.00, High: 41000.00, Low: 35000.00, Close: 41000.00, N: 4},
+	}
+	var ExpectedCandles2 = map[string]Candle{
+		"2021-10-21": {Open: 32000.00, High: 32000.00, Low: 32000.00, Close: 32000.00, N: 1},
+		"2021-10-22": {Open: 35000.00, High: 35000.00, Low: 35000.00, Close: 35000.00, N: 1},
+		"2021-10-23": {Open: 41000.00, High: 41000.00, Low: 41000.00, Close: 41000.00, N: 1},
+		"2021-10-25": {Open: 31000.00, High: 31000.00, Low: 31000.00, Close: 31000.00, N: 1},
+		"2021-10-27": {Open: 51000.00, High: 51000.00, Low: 51000.00, Close: 51000.00, N: 1},
+		"2021-10-28": {Open: 49000.00, High: 49000.00, Low: 49000.00, Close: 49000.00, N: 1},
+	}
+	var ExpectedCandles4 = map[string]Candle{
+		"2021-12-21": {Open: 32000.00, High: 32000.00, Low: 32000.00, Close: 32000.00, N: 1},
+		"2021-12-22": {Open: 35000.00, High: 35000.00, Low: 35000.00, Close: 35000.00, N: 1},
+		"2021-12-23": {Open: 41000.00, High: 41000.00, Low: 41000.00, Close: 41000.00, N: 1},
+		"2021-12-24": {Open: 31000.00, High: 31000.00, Low: 31000.00, Close: 31000.00, N: 1},
+		"2021-12-25": {Open: 51000.00, High: 51000.00, Low: 51000.00, Close: 51000.00, N: 1},
+		"2021-12-26": {Open: 49000.00, High: 49000.00, Low: 49000.00, Close: 49000.00, N: 1},
+		"2021-12-27": {Open: 49000.00, High: 49000.00, Low: 49000.00, Close: 49000.00, N: 1},
+		"2021-12-28": {Open: 50000.00, High: 50000.00, Low: 50000.00, Close: 50000.00, N: 1},
+		"2021-12-29": {Open: 51000.00, High: 51000.00, Low: 51000.00, Close: 51000.00, N: 1},
+		"2021-12-30": {Open: 48000.00, High: 48000.00, Low: 48000.00, Close: 48000.00, N: 1},
+		"2021-12-31": {Open: 37000.00, High: 37000.00, Low: 37000.00, Close: 37000.00, N: 1},
+		"2022-01-01": {Open: 35000.00, High: 35000.00, Low: 35000.00, Close: 35000.00, N: 1},
+		"2022-01-02": {Open: 100000.00, High: 100000.00, Low: 100000.00, Close: 100000.00, N: 1},
+		"2022-01-03": {Open: 7000.00, High: 7000.00, Low: 7000.00, Close: 7000.00, N: 1},
+	}
+	var ExpectedCandles5 = map[string]Candle{
+		"2021-12-27": {Open: 49000.00, High: 49000.00, Low: 49000.00, Close: 49000.00, N: 1},
+		"2021-12-28": {Open: 50000.00, High: 50000.00, Low: 50000.00, Close: 50000.00, N: 1},
+		"2021-12-29": {Open: 51000.00, High: 51000.00, Low: 51000.00, Close: 51000.00, N: 1},
+		"2021-12-30": {Open: 48000.00, High: 48000.00, Low: 48000.00, Close: 48000.00, N: 1},
+		"2022-01-01": {Open: 35000.00, High: 35000.00, Low: 35000.00, Close: 35000.00, N: 1},
+		"2022-01-02": {Open: 100000.00, High: 100000.00, Low: 100000.00, Close: 100000.00, N: 1},
+		"2022-01-03": {Open: 7000.00, High: 7000.00, Low: 7000.00, Close: 7000.00, N: 1},
+	}
+	var ExpectedCandles6 = map[string]Candle{
+		"2021-12-27": {Open: 49000.00, High: 49000.00, Low: 49000.00, Close: 49000.00, N: 1},
+		"2021-12-28": {Open: 50000.00, High: 50000.00, Low: 50000.00, Close: 50000.00, N: 1},
+		"2021-12-29": {Open: 51000.00, High: 51000.00, Low: 51000.00, Close: 51000.00, N: 1},
+		"2021-12-30": {Open: 48000.00, High: 48000.00, Low: 48000.00, Close: 48000.00, N: 1},
+		"2021-12-31": {Open: 37000.00, High: 37000.00, Low: 37000.00, Close: 37000.00, N: 1},
+		"2022-01-02": {Open: 35000.00, High: 35000.00, Low: 35000.00, Close: 35000.00, N: 1},
+		"2022-01-03": {Open: 7000.00, High: 7000.00, Low: 7000.00, Close: 7000.00, N: 1},
+	}
 	var allTests = []TestAndResults{
-		{"Test 1", Test1, ExpectedTestResult1, true},
-		{"Test 2", Test2, ExpectedTestResult2, true},
-		{"Test 3", Test3, ExpectedTestResult3, false},
-		{"Test 4", Test4, ExpectedTestResult4, true},
-		{"Test 5", Test5, ExpectedTestResult5, true},
-		{"Test 6", Test6, ExpectedTestResult6, true},
-		{"Test 7", Test7, ExpectedTestResult7, false},
-		{"Test 8", Test8, ExpectedTestResult8, false},
+		{"Test 1", Test1, ExpectedTestResult1, ExpectedCandles1, true},
+		{"Test 2", Test2, ExpectedTestResult2, ExpectedCandles2, true},
+		{"Test 3", Test3, ExpectedTestResult3, nil, false},
+		{"Test 4", Test4, ExpectedTestResult4, ExpectedCandles4, true},
+		{"Test 5", Test5, ExpectedTestResult5, ExpectedCandles5, true},
+		{"Test 6", Test6, ExpectedTestResult6, ExpectedCandles6, true},
+		{"Test 7", Test7, ExpectedTestResult7, nil, false},
+		{"Test 8", Test8, ExpectedTestResult8, nil, false},
 	}
 
 	var verbose bool = false // Set to true to make ConvertTimePriceHistoryToDailyPriceHistory display internal state
@@ -245,13 +297,13 @@ func TestConvertToPriceHistory(t *testing.T) {
 			fmt.Printf("Starting %q\n", test.name)
 		}
 		for _, v := range test.testcases {
-			tm, err := time.Parse("2006-01-02 15:04:05", v.dateTime)
+			tm, err := ParsePriceTimestamp(v.dateTime, false)
 			if err != nil {
 				t.Errorf("Error in %q preparing date %q: %q", test.name, v.dateTime, err)
 			}
 			TestData = append(TestData, types.ChartItem([2]float32{float32(tm.Unix() * 1000), v.price}))
 		}
-		result, err := ConvertTimePriceHistoryToDailyPriceHistory(TestData, verbose)
+		result, _, err := ConvertTimePriceHistoryToDailyPriceHistory(TestData, FillNone, time.UTC, verbose)
 		if (test.success) && (err != nil) {
 			t.Errorf("Error in %q should succeed but error reported: %q", test.name, err)
 		} else if (!test.success) && (err == nil) {
@@ -269,5 +321,274 @@ func TestConvertToPriceHistory(t *testing.T) {
 				t.Errorf("Error in %q result not as expected", test.name)
 			}
 		}
+
+		candles, _, err := ConvertTimePriceHistoryToDailyOHLC(TestData, FillNone, time.UTC, verbose)
+		if (test.success) && (err != nil) {
+			t.Errorf("Error in %q should succeed but OHLC error reported: %q", test.name, err)
+		} else if (!test.success) && (err == nil) {
+			t.Errorf("Error in %q should fail but no OHLC error reported", test.name)
+		} else if err == nil {
+			if !reflect.DeepEqual(candles, test.candles) {
+				t.Errorf("Error in %q OHLC result = %+v, want %+v", test.name, candles, test.candles)
+			}
+		}
+	}
+}
+
+// datePriceInfoToChartItems converts a slice of DatePriceInfo fixtures into the []types.ChartItem
+// shape ConvertTimePriceHistoryToDailyPriceHistory expects, via ParsePriceTimestamp - so a
+// fixture's dateTime can be written in any shape ParsePriceTimestamp recognises, not just
+// "2006-01-02 15:04:05" (see Test1 in TestConvertToPriceHistory, which deliberately mixes
+// several).
+func datePriceInfoToChartItems(t *testing.T, testcases []DatePriceInfo) []types.ChartItem {
+	t.Helper()
+	var chartItems []types.ChartItem
+	for _, v := range testcases {
+		tm, err := ParsePriceTimestamp(v.dateTime, false)
+		if err != nil {
+			t.Fatalf("preparing date %q: %q", v.dateTime, err)
+		}
+		chartItems = append(chartItems, types.ChartItem([2]float32{float32(tm.Unix() * 1000), v.price}))
+	}
+	return chartItems
+}
+
+// localDatePriceInfoToChartItems is datePriceInfoToChartItems for fixtures whose dateTime is a
+// local wall-clock reading in loc, rather than UTC - used to build DST-straddling test data.
+func localDatePriceInfoToChartItems(t *testing.T, loc *time.Location, testcases []DatePriceInfo) []types.ChartItem {
+	t.Helper()
+	var chartItems []types.ChartItem
+	for _, v := range testcases {
+		tm, err := time.ParseInLocation("2006-01-02 15:04:05", v.dateTime, loc)
+		if err != nil {
+			t.Fatalf("preparing date %q: %q", v.dateTime, err)
+		}
+		chartItems = append(chartItems, types.ChartItem([2]float32{float32(tm.Unix() * 1000), v.price}))
+	}
+	return chartItems
+}
+
+// TestConvertToPriceHistoryFillPolicies mirrors Test 3 (a 3-day gap) and Test 7 (a 3-day gap
+// across a year boundary) from TestConvertToPriceHistory, which fail under FillNone, and checks
+// that FillForward, FillLinear and FillMaxGap now succeed and fill in the missing days correctly.
+func TestConvertToPriceHistoryFillPolicies(t *testing.T) {
+	// Same fixture as Test 3 above: a 3-day gap between 2021-10-23 and 2021-10-26.
+	gapWithinYear := []DatePriceInfo{
+		{"2021-10-21 09:00:01", 32000.00},
+		{"2021-10-22 18:00:01", 35000.00},
+		{"2021-10-23 20:00:01", 41000.00},
+		{"2021-10-26 07:00:01", 31000.00}, // 3-day gap
+		{"2021-10-27 18:00:01", 51000.00},
+		{"2021-10-28 11:00:01", 49000.00},
+	}
+
+	// Same fixture as Test 7 above: a 3-day gap across the year boundary.
+	gapAcrossYearBoundary := []DatePriceInfo{
+		{"2021-12-27 14:00:01", 49000.00},
+		{"2021-12-28 15:00:01", 50000.00},
+		{"2021-12-29 13:00:01", 51000.00},
+		{"2021-12-30 12:00:01", 48000.00},
+		{"2022-01-02 11:00:02", 35000.00}, // 3-day gap
+		{"2022-01-03 23:00:01", 7000.00},
+	}
+
+	t.Run("FillForward within year", func(t *testing.T) {
+		result, kinds, err := ConvertTimePriceHistoryToDailyPriceHistory(datePriceInfoToChartItems(t, gapWithinYear), FillForward, time.UTC, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, date := range []string{"2021-10-24", "2021-10-25"} {
+			if result[date] != 41000.00 {
+				t.Errorf("result[%s] = %v, want 41000.00 (the price carried forward from 2021-10-23)", date, result[date])
+			}
+			if kinds[date] != ForwardFilled {
+				t.Errorf("kinds[%s] = %v, want ForwardFilled", date, kinds[date])
+			}
+		}
+		if kinds["2021-10-23"] != Observed {
+			t.Errorf("kinds[2021-10-23] = %v, want Observed", kinds["2021-10-23"])
+		}
+	})
+
+	t.Run("FillLinear within year", func(t *testing.T) {
+		result, kinds, err := ConvertTimePriceHistoryToDailyPriceHistory(datePriceInfoToChartItems(t, gapWithinYear), FillLinear, time.UTC, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		wantByDate := map[string]float32{"2021-10-24": 37666.668, "2021-10-25": 34333.332}
+		for date, want := range wantByDate {
+			if result[date] != want {
+				t.Errorf("result[%s] = %v, want %v", date, result[date], want)
+			}
+			if kinds[date] != Interpolated {
+				t.Errorf("kinds[%s] = %v, want Interpolated", date, kinds[date])
+			}
+		}
+	})
+
+	t.Run("FillLinear across year boundary", func(t *testing.T) {
+		result, kinds, err := ConvertTimePriceHistoryToDailyPriceHistory(datePriceInfoToChartItems(t, gapAcrossYearBoundary), FillLinear, time.UTC, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		wantByDate := map[string]float32{"2021-12-31": 43666.668, "2022-01-01": 39333.332}
+		for date, want := range wantByDate {
+			if result[date] != want {
+				t.Errorf("result[%s] = %v, want %v", date, result[date], want)
+			}
+			if kinds[date] != Interpolated {
+				t.Errorf("kinds[%s] = %v, want Interpolated", date, kinds[date])
+			}
+		}
+	})
+
+	t.Run("FillMaxGap allows a gap within its bound", func(t *testing.T) {
+		_, kinds, err := ConvertTimePriceHistoryToDailyPriceHistory(datePriceInfoToChartItems(t, gapWithinYear), FillMaxGap(3), time.UTC, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if kinds["2021-10-24"] != Interpolated {
+			t.Errorf("kinds[2021-10-24] = %v, want Interpolated", kinds["2021-10-24"])
+		}
+	})
+
+	t.Run("FillMaxGap still errors beyond its bound", func(t *testing.T) {
+		_, _, err := ConvertTimePriceHistoryToDailyPriceHistory(datePriceInfoToChartItems(t, gapWithinYear), FillMaxGap(2), time.UTC, false)
+		if err == nil {
+			t.Fatalf("expected an error for a 3-day gap under FillMaxGap(2), got none")
+		}
+	})
+
+	t.Run("OHLC FillLinear within year fills synthetic flat candles", func(t *testing.T) {
+		candles, kinds, err := ConvertTimePriceHistoryToDailyOHLC(datePriceInfoToChartItems(t, gapWithinYear), FillLinear, time.UTC, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		wantByDate := map[string]float32{"2021-10-24": 37666.668, "2021-10-25": 34333.332}
+		for date, want := range wantByDate {
+			c := candles[date]
+			if c.Open != want || c.High != want || c.Low != want || c.Close != want || c.N != 0 {
+				t.Errorf("candles[%s] = %+v, want flat candle at %v with N=0", date, c, want)
+			}
+			if kinds[date] != Interpolated {
+				t.Errorf("kinds[%s] = %v, want Interpolated", date, kinds[date])
+			}
+		}
+	})
+}
+
+// TestConvertToPriceHistoryLocation mirrors the year-boundary tests (Test4-Test7 above): a run of
+// samples exactly one local calendar day apart must bucket as exactly one day apart, even across
+// a DST transition that makes the underlying UTC gap 23 or 25 hours rather than 24.
+func TestConvertToPriceHistoryLocation(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("loading America/Los_Angeles: %s", err)
+	}
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("loading Europe/London: %s", err)
+	}
+
+	t.Run("America/Los_Angeles spring-forward (23-hour day)", func(t *testing.T) {
+		// Clocks spring forward at 2022-03-13 02:00 local; 09:00 local is still a single well
+		// defined wall-clock reading either side of the transition.
+		testcases := []DatePriceInfo{
+			{"2022-03-11 09:00:00", 100000.00},
+			{"2022-03-12 09:00:00", 110000.00},
+			{"2022-03-13 09:00:00", 120000.00}, // the 23-hour day
+			{"2022-03-14 09:00:00", 130000.00},
+		}
+		want := map[string]float32{
+			"2022-03-11": 100000.00,
+			"2022-03-12": 110000.00,
+			"2022-03-13": 120000.00,
+			"2022-03-14": 130000.00,
+		}
+		result, _, err := ConvertTimePriceHistoryToDailyPriceHistory(localDatePriceInfoToChartItems(t, losAngeles, testcases), FillNone, losAngeles, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("result = %+v, want %+v", result, want)
+		}
+	})
+
+	t.Run("America/Los_Angeles fall-back (25-hour day)", func(t *testing.T) {
+		// Clocks fall back at 2022-11-06 02:00 local; by 09:00 local the transition is over.
+		testcases := []DatePriceInfo{
+			{"2022-11-04 09:00:00", 100000.00},
+			{"2022-11-05 09:00:00", 110000.00},
+			{"2022-11-06 09:00:00", 120000.00}, // the 25-hour day
+			{"2022-11-07 09:00:00", 130000.00},
+		}
+		want := map[string]float32{
+			"2022-11-04": 100000.00,
+			"2022-11-05": 110000.00,
+			"2022-11-06": 120000.00,
+			"2022-11-07": 130000.00,
+		}
+		result, _, err := ConvertTimePriceHistoryToDailyPriceHistory(localDatePriceInfoToChartItems(t, losAngeles, testcases), FillNone, losAngeles, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("result = %+v, want %+v", result, want)
+		}
+	})
+
+	t.Run("Europe/London spring-forward (23-hour day)", func(t *testing.T) {
+		// Clocks spring forward at 2022-03-27 01:00 local.
+		testcases := []DatePriceInfo{
+			{"2022-03-25 09:00:00", 100000.00},
+			{"2022-03-26 09:00:00", 110000.00},
+			{"2022-03-27 09:00:00", 120000.00}, // the 23-hour day
+			{"2022-03-28 09:00:00", 130000.00},
+		}
+		want := map[string]float32{
+			"2022-03-25": 100000.00,
+			"2022-03-26": 110000.00,
+			"2022-03-27": 120000.00,
+			"2022-03-28": 130000.00,
+		}
+		result, _, err := ConvertTimePriceHistoryToDailyPriceHistory(localDatePriceInfoToChartItems(t, london, testcases), FillNone, london, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("result = %+v, want %+v", result, want)
+		}
+	})
+
+	t.Run("UTC bucketing keeps a DST-day tick on its UTC date", func(t *testing.T) {
+		// The same Los Angeles fall-back sample bucketed by UTC calendar day instead of
+		// losAngeles: by 2022-11-06 09:00 local (PST, UTC-8) the UTC clock reads 17:00 on the
+		// same UTC date, so a caller asking for plain UTC buckets still gets a self-consistent
+		// (if different) answer rather than a day silently dropped or duplicated.
+		testcases := []DatePriceInfo{
+			{"2022-11-06 09:00:00", 120000.00},
+		}
+		result, _, err := ConvertTimePriceHistoryToDailyPriceHistory(localDatePriceInfoToChartItems(t, losAngeles, testcases), FillNone, time.UTC, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, ok := result["2022-11-06"]; !ok {
+			t.Errorf("result = %+v, want the sample bucketed under 2022-11-06 (its UTC date)", result)
+		}
+	})
+}
+
+// Checks calculateSpendAsString no longer loses precision beyond two decimal places, the bug
+// makePenniesFromGBP's pennies-only arithmetic had: an 8-decimal BTC debit and a 6-decimal USDC
+// fee should both survive to the full precision Kraken actually reports.
+func TestCalculateSpendAsStringPreservesPrecision(t *testing.T) {
+	btc := ledger{asset: "BTC", amount: "-0.12345678", fee: "0.00000001"}
+	if got, want := calculateSpendAsString(btc), "0.12345679"; got != want {
+		t.Errorf("calculateSpendAsString(BTC) = %q, want %q", got, want)
+	}
+
+	usdc := ledger{asset: "USDC", amount: "-1000.123456", fee: "0.000001"}
+	if got, want := calculateSpendAsString(usdc), "1000.123457"; got != want {
+		t.Errorf("calculateSpendAsString(USDC) = %q, want %q", got, want)
 	}
 }
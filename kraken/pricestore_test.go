@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJSONFilePriceStoreGetPutRoundTrip(t *testing.T) {
+	store := NewJSONFilePriceStore(t.TempDir())
+
+	if _, ok := store.Get("BTC", "usd", "2022-04-06"); ok {
+		t.Fatalf("Get on an empty store: got ok=true, want false")
+	}
+
+	store.Put("BTC", "usd", "2022-04-06", 42000.5)
+	store.Put("BTC", "usd", "2022-04-07", 43000.0)
+
+	got, ok := store.Get("BTC", "usd", "2022-04-06")
+	if !ok || got != 42000.5 {
+		t.Errorf("Get(BTC, usd, 2022-04-06) = (%v, %v), want (42000.5, true)", got, ok)
+	}
+
+	// A second store rooted at the same directory should see what the first wrote, since the
+	// whole point is persistence across runs/process lifetimes.
+	reopened := NewJSONFilePriceStore(store.Dir)
+	got, ok = reopened.Get("BTC", "usd", "2022-04-07")
+	if !ok || got != 43000.0 {
+		t.Errorf("Get after reopening store = (%v, %v), want (43000.0, true)", got, ok)
+	}
+
+	// A different currency for the same coin is tracked independently.
+	if _, ok := reopened.Get("BTC", "eur", "2022-04-06"); ok {
+		t.Fatalf("Get(BTC, eur, 2022-04-06): got ok=true, want false (only usd was ever Put)")
+	}
+}
+
+func TestJSONFilePriceStoreRange(t *testing.T) {
+	store := NewJSONFilePriceStore(t.TempDir())
+	store.Put("ETH", "usd", "2022-04-05", 1.0)
+	store.Put("ETH", "usd", "2022-04-06", 2.0)
+	store.Put("ETH", "usd", "2022-04-07", 3.0)
+
+	from, _ := time.Parse("2006-01-02", "2022-04-06")
+	to, _ := time.Parse("2006-01-02", "2022-04-07")
+
+	got := store.Range("ETH", "usd", from, to)
+	want := map[string]float32{"2022-04-06": 2.0, "2022-04-07": 3.0}
+	if len(got) != len(want) {
+		t.Fatalf("Range = %v, want %v", got, want)
+	}
+	for date, price := range want {
+		if got[date] != price {
+			t.Errorf("Range[%q] = %v, want %v", date, got[date], price)
+		}
+	}
+}
+
+func TestJSONFilePriceStoreLastFetchedAt(t *testing.T) {
+	store := NewJSONFilePriceStore(t.TempDir())
+
+	if _, ok := store.LastFetchedAt("DOGE", "usd"); ok {
+		t.Fatalf("LastFetchedAt before any fetch: got ok=true, want false")
+	}
+
+	fetchedAt := time.Date(2022, 4, 6, 12, 0, 0, 0, time.UTC)
+	store.SetLastFetchedAt("DOGE", "usd", fetchedAt)
+
+	got, ok := store.LastFetchedAt("DOGE", "usd")
+	if !ok || !got.Equal(fetchedAt) {
+		t.Errorf("LastFetchedAt(DOGE, usd) = (%v, %v), want (%v, true)", got, ok, fetchedAt)
+	}
+}
+
+func TestLookupHistoricalTokenValueInBulkPopulatesFromPriceStore(t *testing.T) {
+	origCache := perCoinHistoricalPrices
+	origStore := priceStore
+	t.Cleanup(func() {
+		perCoinHistoricalPrices = origCache
+		priceStore = origStore
+	})
+	perCoinHistoricalPrices = nil
+
+	store := NewJSONFilePriceStore(t.TempDir())
+	store.Put("BTC", "usd", "2022-04-06", 42000.5)
+	SetPriceStore(store)
+
+	price, err := LookupHistoricalTokenValueInBulk("BTC", "2022-04-06 07:00:06", "usd", false)
+	if err != nil {
+		t.Fatalf("LookupHistoricalTokenValueInBulk: unexpected error: %s", err)
+	}
+	if price != 42000.5 {
+		t.Errorf("LookupHistoricalTokenValueInBulk = %v, want 42000.5 (from the PriceStore, with no CoinGecko call needed)", price)
+	}
+}
+
+func TestLookupHistoricalTokenValueInBulkTracksCurrenciesIndependently(t *testing.T) {
+	origCache := perCoinHistoricalPrices
+	origStore := priceStore
+	t.Cleanup(func() {
+		perCoinHistoricalPrices = origCache
+		priceStore = origStore
+	})
+	perCoinHistoricalPrices = nil
+
+	store := NewJSONFilePriceStore(t.TempDir())
+	store.Put("BTC", "usd", "2022-04-06", 42000.5)
+	store.Put("BTC", "eur", "2022-04-06", 39000.25)
+	SetPriceStore(store)
+
+	usdPrice, err := LookupHistoricalTokenValueInBulk("BTC", "2022-04-06 07:00:06", "usd", false)
+	if err != nil {
+		t.Fatalf("LookupHistoricalTokenValueInBulk(usd): unexpected error: %s", err)
+	}
+	eurPrice, err := LookupHistoricalTokenValueInBulk("BTC", "2022-04-06 07:00:06", "eur", false)
+	if err != nil {
+		t.Fatalf("LookupHistoricalTokenValueInBulk(eur): unexpected error: %s", err)
+	}
+
+	if usdPrice != 42000.5 {
+		t.Errorf("LookupHistoricalTokenValueInBulk(usd) = %v, want 42000.5", usdPrice)
+	}
+	if eurPrice != 39000.25 {
+		t.Errorf("LookupHistoricalTokenValueInBulk(eur) = %v, want 39000.25", eurPrice)
+	}
+	if usdPrice == eurPrice {
+		t.Fatalf("usd and eur prices for the same coin/date should not collapse to one cache entry")
+	}
+}
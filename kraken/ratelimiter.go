@@ -0,0 +1,192 @@
+package main
+
+// ratelimiter.go replaces RateLimitCoinGeckoApiCalls' original "more than 6 calls in the last 60s
+// => sleep 8s" heuristic with a token-bucket rate limiter shared by this package's CoinGecko calls
+// through the go-gecko client (CoinsIDMarketChart, CoinsIDHistory) and its raw net/http calls via
+// coinGeckoGet (FetchCoinPricesRange, ValidateCurrency). SymbolResolver's /coins/list and
+// /coins/markets requests go through its own Client and BaseURL and are not rate-limited by it.
+// golang.org/x/time/rate is not a dependency of this module (see go.mod), so TokenBucket
+// hand-rolls the same algorithm instead.
+//
+// It also detects a pro API key via the COINGECKO_API_KEY environment variable: when set, this
+// file's own raw HTTP calls switch to CoinGecko's pro API base URL and attach the
+// x-cg-pro-api-key header, and the shared limiter is raised to the pro tier's rate. The go-gecko
+// client itself has no hook for a custom base URL or header, so that part of the switch only
+// covers this file's own direct calls, not cg.CoinsIDMarketChart/CoinsIDHistory.
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CoinGeckoAPIKeyEnvVar is the environment variable NewCoinGeckoAPIConfigFromEnv checks for a pro
+// API key.
+const CoinGeckoAPIKeyEnvVar = "COINGECKO_API_KEY"
+
+// CoinGecko's documented call budgets (calls per minute) for its free and pro tiers; see
+// https://apiguide.coingecko.com/getting-started/error-and-rate-limit.
+const (
+	coinGeckoFreeCallsPerMinute = 10
+	coinGeckoProCallsPerMinute  = 500
+)
+
+const (
+	coinGeckoPublicBaseURL   = "https://api.coingecko.com/api/v3"
+	coinGeckoProBaseURL      = "https://pro-api.coingecko.com/api/v3"
+	coinGeckoProAPIKeyHeader = "x-cg-pro-api-key"
+)
+
+// maxCoinGeckoRetries bounds how many attempts in all coinGeckoGet makes at a request (the first
+// plus its retries after a 429 Too Many Requests) before giving up.
+const maxCoinGeckoRetries = 5
+
+// coinGeckoCallsTotal/coinGeckoThrottleSecondsTotal are exposed via expvar (the standard library's
+// metrics registry - this repo has no Prometheus client vendored to register with instead) so an
+// operator can watch how hard this program is hitting CoinGecko and how much of that time is spent
+// waiting on the rate limiter or backing off a 429.
+var (
+	coinGeckoCallsTotal           = expvar.NewInt("coingecko_calls_total")
+	coinGeckoThrottleSecondsTotal = expvar.NewFloat("coingecko_throttle_seconds_total")
+)
+
+// TokenBucket is a hand-rolled substitute for golang.org/x/time/rate.Limiter: it refills at
+// ratePerSec tokens a second, up to maxTokens, and Wait blocks until a token is available.
+type TokenBucket struct {
+	mu         sync.Mutex
+	tokens     float64
+	maxTokens  float64
+	ratePerSec float64
+	lastRefill time.Time
+}
+
+// NewTokenBucket returns a TokenBucket allowing callsPerMinute calls per minute on average,
+// bursting up to burst calls at once.
+func NewTokenBucket(callsPerMinute, burst int) *TokenBucket {
+	return &TokenBucket{
+		tokens:     float64(burst),
+		maxTokens:  float64(burst),
+		ratePerSec: float64(callsPerMinute) / 60.0,
+		lastRefill: time.Now(),
+	}
+}
+
+// Wait blocks until a token is available, then consumes one.
+func (b *TokenBucket) Wait() {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.lastRefill).Seconds() * b.ratePerSec
+		if b.tokens > b.maxTokens {
+			b.tokens = b.maxTokens
+		}
+		b.lastRefill = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return
+		}
+
+		deficit := 1 - b.tokens
+		wait := time.Duration(deficit/b.ratePerSec*float64(time.Second)) + time.Millisecond
+		b.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+// CoinGeckoAPIConfig bundles the base URL, optional pro API key header and rate limiter this
+// file's CoinGecko calls should use, selected once by detecting COINGECKO_API_KEY.
+type CoinGeckoAPIConfig struct {
+	BaseURL      string
+	APIKeyHeader string // empty when using the free tier
+	APIKey       string
+	Limiter      *TokenBucket
+}
+
+// NewCoinGeckoAPIConfigFromEnv builds a CoinGeckoAPIConfig: if COINGECKO_API_KEY is set, it
+// switches to CoinGecko's pro API base URL, the x-cg-pro-api-key header and the pro tier's higher
+// rate limit; otherwise it uses the free public API and its lower rate limit.
+func NewCoinGeckoAPIConfigFromEnv() *CoinGeckoAPIConfig {
+	apiKey := os.Getenv(CoinGeckoAPIKeyEnvVar)
+	if apiKey == "" {
+		return &CoinGeckoAPIConfig{
+			BaseURL: coinGeckoPublicBaseURL,
+			Limiter: NewTokenBucket(coinGeckoFreeCallsPerMinute, coinGeckoFreeCallsPerMinute),
+		}
+	}
+	return &CoinGeckoAPIConfig{
+		BaseURL:      coinGeckoProBaseURL,
+		APIKeyHeader: coinGeckoProAPIKeyHeader,
+		APIKey:       apiKey,
+		Limiter:      NewTokenBucket(coinGeckoProCallsPerMinute, coinGeckoProCallsPerMinute),
+	}
+}
+
+// coinGeckoAPIConfig is the package-wide CoinGeckoAPIConfig RateLimitCoinGeckoApiCalls and
+// coinGeckoGet consult, built lazily from the environment on first use.
+var coinGeckoAPIConfig *CoinGeckoAPIConfig
+
+// coinGeckoConfig returns the package-wide CoinGeckoAPIConfig, building it from the environment on
+// first use.
+func coinGeckoConfig() *CoinGeckoAPIConfig {
+	if coinGeckoAPIConfig == nil {
+		coinGeckoAPIConfig = NewCoinGeckoAPIConfigFromEnv()
+	}
+	return coinGeckoAPIConfig
+}
+
+// coinGeckoGet issues an HTTP GET to url (already including any query string), rate-limiting via
+// coinGeckoConfig's TokenBucket, injecting the pro API key header if configured, and retrying with
+// exponential backoff on a 429 Too Many Requests response, honoring CoinGecko's Retry-After header
+// when it sends one.
+func coinGeckoGet(url string) (*http.Response, error) {
+	cfg := coinGeckoConfig()
+	backoff := time.Second
+
+	for attempt := 0; attempt < maxCoinGeckoRetries; attempt++ {
+		cfg.Limiter.Wait()
+		coinGeckoCallsTotal.Add(1)
+
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.APIKeyHeader != "" {
+			req.Header.Set(cfg.APIKeyHeader, cfg.APIKey)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+
+		wait := retryAfterOrDefault(resp.Header.Get("Retry-After"), backoff)
+		resp.Body.Close()
+		throttleStart := time.Now()
+		time.Sleep(wait)
+		coinGeckoThrottleSecondsTotal.Add(time.Since(throttleStart).Seconds())
+		backoff *= 2
+	}
+	return nil, fmt.Errorf("coinGeckoGet(%s): gave up after %d attempts against 429 Too Many Requests", url, maxCoinGeckoRetries)
+}
+
+// retryAfterOrDefault parses a Retry-After header value (seconds, per RFC 7231) if present and
+// valid, falling back to fallback otherwise (CoinGecko does not always send one).
+func retryAfterOrDefault(retryAfter string, fallback time.Duration) time.Duration {
+	if retryAfter == "" {
+		return fallback
+	}
+	seconds, err := strconv.Atoi(retryAfter)
+	if err != nil || seconds < 0 {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
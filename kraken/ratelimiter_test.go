@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewCoinGeckoAPIConfigFromEnvDefaultsToFreeTier(t *testing.T) {
+	t.Setenv(CoinGeckoAPIKeyEnvVar, "")
+
+	cfg := NewCoinGeckoAPIConfigFromEnv()
+	if cfg.BaseURL != coinGeckoPublicBaseURL {
+		t.Errorf("BaseURL = %q, want %q", cfg.BaseURL, coinGeckoPublicBaseURL)
+	}
+	if cfg.APIKeyHeader != "" {
+		t.Errorf("APIKeyHeader = %q, want empty (no key configured)", cfg.APIKeyHeader)
+	}
+}
+
+func TestNewCoinGeckoAPIConfigFromEnvUsesProTierWhenKeySet(t *testing.T) {
+	t.Setenv(CoinGeckoAPIKeyEnvVar, "test-pro-key")
+
+	cfg := NewCoinGeckoAPIConfigFromEnv()
+	if cfg.BaseURL != coinGeckoProBaseURL {
+		t.Errorf("BaseURL = %q, want %q", cfg.BaseURL, coinGeckoProBaseURL)
+	}
+	if cfg.APIKeyHeader != coinGeckoProAPIKeyHeader || cfg.APIKey != "test-pro-key" {
+		t.Errorf("APIKeyHeader/APIKey = %q/%q, want %q/%q", cfg.APIKeyHeader, cfg.APIKey, coinGeckoProAPIKeyHeader, "test-pro-key")
+	}
+}
+
+func TestTokenBucketWaitBlocksUntilRefilled(t *testing.T) {
+	// 60 calls/minute == 1/sec, burst of 1: the first Wait is immediate, the second must block
+	// roughly a second for the bucket to refill.
+	b := NewTokenBucket(60, 1)
+
+	start := time.Now()
+	b.Wait()
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("first Wait took %s, want ~immediate (bucket starts full)", elapsed)
+	}
+
+	start = time.Now()
+	b.Wait()
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("second Wait took %s, want to block for the bucket to refill", elapsed)
+	}
+}
+
+func TestCoinGeckoGetRetriesOn429WithRetryAfter(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	origConfig := coinGeckoAPIConfig
+	t.Cleanup(func() { coinGeckoAPIConfig = origConfig })
+	coinGeckoAPIConfig = &CoinGeckoAPIConfig{
+		BaseURL: server.URL,
+		Limiter: NewTokenBucket(coinGeckoProCallsPerMinute, coinGeckoProCallsPerMinute),
+	}
+
+	resp, err := coinGeckoGet(server.URL)
+	if err != nil {
+		t.Fatalf("coinGeckoGet: unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if attempts != 2 {
+		t.Errorf("server saw %d attempts, want 2 (one 429, then a retry that succeeds)", attempts)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("final response status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestRetryAfterOrDefault(t *testing.T) {
+	if got := retryAfterOrDefault("5", time.Second); got != 5*time.Second {
+		t.Errorf("retryAfterOrDefault(5) = %s, want 5s", got)
+	}
+	if got := retryAfterOrDefault("", 3*time.Second); got != 3*time.Second {
+		t.Errorf("retryAfterOrDefault(\"\") = %s, want the fallback (3s)", got)
+	}
+	if got := retryAfterOrDefault("not-a-number", 3*time.Second); got != 3*time.Second {
+		t.Errorf("retryAfterOrDefault(not-a-number) = %s, want the fallback (3s)", got)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+// SymbolResolver replaces this file's original hand-maintained token2cgToken map with a
+// lazily-populated lookup against CoinGecko's /coins/list, the same approach
+// pkg/pricing/coingecko.go's CoinGeckoProvider already uses for its own ticker->id resolution (see
+// resolveID/ensureCoinList there). Unlike that simpler resolver, more than one CoinGecko-listed
+// project can share a ticker (e.g. several projects use "UNI"), so SymbolResolver additionally
+// supports a user-supplied overrides file and, failing that, breaks a tie by market cap via
+// /coins/markets - the same approach Blockbook's coingecko.go takes.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// coinsListItem is one element of CoinGecko's /coins/list response.
+type coinsListItem struct {
+	ID     string `json:"id"`
+	Symbol string `json:"symbol"`
+	Name   string `json:"name"`
+}
+
+// coinsMarketsItem is the subset of CoinGecko's /coins/markets response rankByMarketCap needs.
+type coinsMarketsItem struct {
+	ID        string  `json:"id"`
+	MarketCap float64 `json:"market_cap"`
+}
+
+// SymbolResolver resolves a ticker symbol ("BTC") to a CoinGecko coin id ("bitcoin").
+type SymbolResolver struct {
+	BaseURL string
+	Client  *http.Client
+
+	// listCacheFile, if non-empty, caches /coins/list's response to disk so it is only fetched
+	// once across runs of this program, not once per run (see ensureCoinsList).
+	listCacheFile string
+
+	// overrides maps SYMBOL -> coingecko-id and always wins over automatic resolution, for a
+	// ticker whose market-cap ranking would otherwise pick the wrong one of several colliding
+	// projects.
+	overrides map[string]string
+
+	// bySymbol is lazily populated by ensureCoinsList from /coins/list (or its disk cache),
+	// grouping every coinsListItem sharing a lower-cased ticker.
+	bySymbol map[string][]coinsListItem
+}
+
+// NewSymbolResolver returns a SymbolResolver against the public CoinGecko API. listCacheFile, if
+// non-empty, is where /coins/list's response is cached across runs; overridesFile, if non-empty,
+// is a JSON file of {"SYMBOL": "coingecko-id"} entries that always win over automatic resolution.
+// Neither file needs to already exist: a missing listCacheFile is simply populated on first use,
+// and a missing overridesFile is treated as "no overrides configured".
+func NewSymbolResolver(listCacheFile, overridesFile string) (*SymbolResolver, error) {
+	overrides, err := loadSymbolOverrides(overridesFile)
+	if err != nil {
+		return nil, err
+	}
+	return &SymbolResolver{
+		BaseURL:       "https://api.coingecko.com/api/v3",
+		Client:        http.DefaultClient,
+		listCacheFile: listCacheFile,
+		overrides:     overrides,
+	}, nil
+}
+
+// loadSymbolOverrides reads path as a JSON {"SYMBOL": "coingecko-id"} map, upper-casing its keys.
+// An empty path, or one that doesn't exist, is not an error: it just means no overrides apply.
+func loadSymbolOverrides(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("SymbolResolver: reading overrides %q: %w", path, err)
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("SymbolResolver: parsing overrides %q: %w", path, err)
+	}
+	overrides := make(map[string]string, len(raw))
+	for symbol, id := range raw {
+		overrides[strings.ToUpper(symbol)] = id
+	}
+	return overrides, nil
+}
+
+// Resolve returns the CoinGecko coin id for symbol: an overrides entry first, then the sole
+// /coins/list match, then - for a symbol shared by more than one coin - the highest-market-cap
+// match via /coins/markets. The bool result is false if symbol is found nowhere.
+func (r *SymbolResolver) Resolve(symbol string) (string, bool) {
+	symbol = strings.ToUpper(symbol)
+
+	if id, found := r.overrides[symbol]; found {
+		return id, true
+	}
+
+	if err := r.ensureCoinsList(); err != nil {
+		fmt.Printf("SymbolResolver: %s\n", err)
+		return "", false
+	}
+
+	matches := r.bySymbol[strings.ToLower(symbol)]
+	switch len(matches) {
+	case 0:
+		return "", false
+	case 1:
+		return matches[0].ID, true
+	default:
+		id, err := r.rankByMarketCap(matches)
+		if err != nil {
+			fmt.Printf("SymbolResolver: %s: ranking %d candidates by market cap: %s\n", symbol, len(matches), err)
+			return matches[0].ID, true // best effort: fall back to the first entry CoinGecko listed
+		}
+		return id, true
+	}
+}
+
+// ensureCoinsList lazily populates r.bySymbol: from listCacheFile if that already holds a cached
+// response, otherwise from CoinGecko's /coins/list, which it then writes to listCacheFile (when
+// configured) for the next run.
+func (r *SymbolResolver) ensureCoinsList() error {
+	if r.bySymbol != nil {
+		return nil
+	}
+
+	items, err := r.loadCachedCoinsList()
+	if err != nil {
+		return err
+	}
+	if items == nil {
+		items, err = r.fetchCoinsList()
+		if err != nil {
+			return err
+		}
+		if err := r.saveCachedCoinsList(items); err != nil {
+			fmt.Printf("SymbolResolver: caching coins list: %s\n", err)
+		}
+	}
+
+	bySymbol := make(map[string][]coinsListItem, len(items))
+	for _, item := range items {
+		symbol := strings.ToLower(item.Symbol)
+		bySymbol[symbol] = append(bySymbol[symbol], item)
+	}
+	r.bySymbol = bySymbol
+	return nil
+}
+
+func (r *SymbolResolver) loadCachedCoinsList() ([]coinsListItem, error) {
+	if r.listCacheFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(r.listCacheFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("SymbolResolver: reading cached coins list %q: %w", r.listCacheFile, err)
+	}
+	var items []coinsListItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("SymbolResolver: parsing cached coins list %q: %w", r.listCacheFile, err)
+	}
+	return items, nil
+}
+
+func (r *SymbolResolver) saveCachedCoinsList(items []coinsListItem) error {
+	if r.listCacheFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.listCacheFile, data, 0644)
+}
+
+func (r *SymbolResolver) fetchCoinsList() ([]coinsListItem, error) {
+	url := r.BaseURL + "/coins/list"
+	resp, err := r.Client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("SymbolResolver: %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SymbolResolver: %s: unexpected status %s", url, resp.Status)
+	}
+
+	var items []coinsListItem
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, fmt.Errorf("SymbolResolver: %s: decoding response: %w", url, err)
+	}
+	return items, nil
+}
+
+// rankByMarketCap queries /coins/markets for candidates' ids and returns whichever has the
+// highest market cap, breaking a symbol collision (e.g. more than one project using "UNI").
+func (r *SymbolResolver) rankByMarketCap(candidates []coinsListItem) (string, error) {
+	ids := make([]string, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.ID
+	}
+
+	url := fmt.Sprintf("%s/coins/markets?vs_currency=usd&ids=%s", r.BaseURL, strings.Join(ids, ","))
+	resp, err := r.Client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+
+	var markets []coinsMarketsItem
+	if err := json.NewDecoder(resp.Body).Decode(&markets); err != nil {
+		return "", fmt.Errorf("%s: decoding response: %w", url, err)
+	}
+	if len(markets) == 0 {
+		return "", fmt.Errorf("%s: no market data for any candidate", url)
+	}
+
+	sort.Slice(markets, func(i, j int) bool { return markets[i].MarketCap > markets[j].MarketCap })
+	return markets[0].ID, nil
+}
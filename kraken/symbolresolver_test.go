@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSymbolResolverResolveUsesOverrideFirst(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("unexpected request for a symbol covered by an override: %s", r.URL)
+	}))
+	defer server.Close()
+
+	overridesFile := filepath.Join(t.TempDir(), "overrides.json")
+	if err := os.WriteFile(overridesFile, []byte(`{"UNI": "uniswap"}`), 0644); err != nil {
+		t.Fatalf("writing %q: %s", overridesFile, err)
+	}
+
+	r, err := NewSymbolResolver("", overridesFile)
+	if err != nil {
+		t.Fatalf("NewSymbolResolver: unexpected error: %s", err)
+	}
+	r.BaseURL = server.URL
+	r.Client = server.Client()
+
+	id, ok := r.Resolve("uni")
+	if !ok || id != "uniswap" {
+		t.Errorf("Resolve(uni) = (%q, %v), want (\"uniswap\", true) from the override", id, ok)
+	}
+}
+
+func TestSymbolResolverResolveSingleMatch(t *testing.T) {
+	listCalls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/coins/list" {
+			t.Fatalf("unexpected request: %s", r.URL)
+		}
+		listCalls++
+		fmt.Fprint(w, `[{"id":"bitcoin","symbol":"btc","name":"Bitcoin"}]`)
+	}))
+	defer server.Close()
+
+	r, err := NewSymbolResolver("", "")
+	if err != nil {
+		t.Fatalf("NewSymbolResolver: unexpected error: %s", err)
+	}
+	r.BaseURL = server.URL
+	r.Client = server.Client()
+
+	id, ok := r.Resolve("BTC")
+	if !ok || id != "bitcoin" {
+		t.Errorf("Resolve(BTC) = (%q, %v), want (\"bitcoin\", true)", id, ok)
+	}
+
+	if _, ok := r.Resolve("BTC"); !ok {
+		t.Fatalf("Resolve (second call): expected ok=true")
+	}
+	if listCalls != 1 {
+		t.Errorf("/coins/list was called %d times, want 1 (the result should be memoized)", listCalls)
+	}
+}
+
+func TestSymbolResolverResolveBreaksTieByMarketCap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/coins/list":
+			fmt.Fprint(w, `[{"id":"uniswap","symbol":"uni","name":"Uniswap"},{"id":"unicorn-token","symbol":"uni","name":"Unicorn Token"}]`)
+		case "/coins/markets":
+			fmt.Fprint(w, `[{"id":"uniswap","market_cap":5000000000},{"id":"unicorn-token","market_cap":100}]`)
+		default:
+			t.Fatalf("unexpected request: %s", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	r, err := NewSymbolResolver("", "")
+	if err != nil {
+		t.Fatalf("NewSymbolResolver: unexpected error: %s", err)
+	}
+	r.BaseURL = server.URL
+	r.Client = server.Client()
+
+	id, ok := r.Resolve("UNI")
+	if !ok || id != "uniswap" {
+		t.Errorf("Resolve(UNI) = (%q, %v), want (\"uniswap\", true) (the higher market cap candidate)", id, ok)
+	}
+}
+
+func TestSymbolResolverResolveUnknownSymbol(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	r, err := NewSymbolResolver("", "")
+	if err != nil {
+		t.Fatalf("NewSymbolResolver: unexpected error: %s", err)
+	}
+	r.BaseURL = server.URL
+	r.Client = server.Client()
+
+	if _, ok := r.Resolve("NOSUCHTOKEN"); ok {
+		t.Errorf("Resolve for an unknown symbol: expected ok=false")
+	}
+}
+
+func TestSymbolResolverCachesCoinsListToDisk(t *testing.T) {
+	listCalls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listCalls++
+		fmt.Fprint(w, `[{"id":"bitcoin","symbol":"btc","name":"Bitcoin"}]`)
+	}))
+	defer server.Close()
+
+	cacheFile := filepath.Join(t.TempDir(), "coins-list.json")
+
+	first, err := NewSymbolResolver(cacheFile, "")
+	if err != nil {
+		t.Fatalf("NewSymbolResolver: unexpected error: %s", err)
+	}
+	first.BaseURL = server.URL
+	first.Client = server.Client()
+	if _, ok := first.Resolve("BTC"); !ok {
+		t.Fatalf("Resolve: expected ok=true")
+	}
+
+	second, err := NewSymbolResolver(cacheFile, "")
+	if err != nil {
+		t.Fatalf("NewSymbolResolver: unexpected error: %s", err)
+	}
+	second.BaseURL = server.URL
+	second.Client = server.Client()
+	if id, ok := second.Resolve("BTC"); !ok || id != "bitcoin" {
+		t.Errorf("Resolve from a second resolver sharing cacheFile = (%q, %v), want (\"bitcoin\", true)", id, ok)
+	}
+
+	if listCalls != 1 {
+		t.Errorf("/coins/list was called %d times across two resolvers sharing a disk cache, want 1", listCalls)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+// Functions in this source file parse timestamps from price-history sources (CSV dumps, test
+// fixtures, API payloads) whose date/time shape is not known in advance.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// runeClass is the coarse category ParsePriceTimestamp's state machine classifies each rune of a
+// timestamp into, before deciding which time.Parse layout the timestamp as a whole matches.
+type runeClass int
+
+const (
+	classDigit runeClass = iota
+	classDash
+	classSlash
+	classColon
+	classAlpha
+	classSpace
+	classOther
+)
+
+func classify(r rune) runeClass {
+	switch {
+	case r >= '0' && r <= '9':
+		return classDigit
+	case r == '-':
+		return classDash
+	case r == '/':
+		return classSlash
+	case r == ':':
+		return classColon
+	case unicode.IsSpace(r):
+		return classSpace
+	case unicode.IsLetter(r):
+		return classAlpha
+	default:
+		return classOther
+	}
+}
+
+// dateState is where ParsePriceTimestamp's left-to-right scan is in classifying the leading date
+// portion of a timestamp, modelled on the single-pass approach araddon/dateparse uses: walk the
+// string once, and stop as soon as enough of its shape is known to settle on one layout, rather
+// than trying a list of candidate layouts against the whole string.
+type dateState int
+
+const (
+	dateStart     dateState = iota
+	dateDigit               // seen one or more leading digits, still in the first group
+	dateDigitDash           // first digit group followed by '-': "2006-" or "02-"
+	dateDigitSlash          // first digit group followed by '/': "01/" or "02/"
+	dateAlpha               // seen one or more leading letters: a weekday or month name
+	dateAlphaSpace          // month/weekday name followed by a space
+)
+
+var weekdayNames = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+// ParsePriceTimestamp parses s into a time.Time without requiring the caller to know in advance
+// which of the many shapes real price-feed/exchange CSV dumps use for timestamps: RFC3339 (with
+// a "Z" or a numeric offset), "2006-01-02 15:04:05", slash-separated calendar dates in either
+// DD/MM/YYYY or MM/DD/YYYY order, "Jan 2 2006 15:04:05" (with or without a comma, and with an
+// optional leading weekday name), and bare Unix epoch seconds or milliseconds.
+//
+// It works the way araddon/dateparse does: a single left-to-right scan classifies each rune into
+// a coarse class (digit, dash, slash, colon, alpha, space) and walks a small state machine until
+// enough of the shape is known to pick a time.Parse layout, rather than trying a list of layouts
+// against the whole string.
+//
+// preferMonthFirst resolves the one genuine ambiguity, a slash-separated date where both fields
+// are <= 12: true reads it "MM/DD/YYYY" (US), false reads it "DD/MM/YYYY" (EU/UK). It has no
+// effect once either field is > 12, which is unambiguous regardless of the toggle.
+func ParsePriceTimestamp(s string, preferMonthFirst bool) (time.Time, error) {
+	original := s
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, fmt.Errorf("ParsePriceTimestamp: empty timestamp")
+	}
+
+	s = skipLeadingWeekday(s)
+
+	if t, ok := parseEpoch(s); ok {
+		return t, nil
+	}
+
+	// A trailing " UTC" (as written by loadPriceDataForCoin's own price-data CSVs) names the
+	// location rather than being part of any layout time.Parse understands; strip it and parse
+	// the rest as UTC, same as if it had never been there.
+	if strings.HasSuffix(s, " UTC") {
+		s = strings.TrimSuffix(s, " UTC")
+	}
+
+	layout, err := classifyLayout(s, preferMonthFirst)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ParsePriceTimestamp: %q: %w", original, err)
+	}
+
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ParsePriceTimestamp: %q: %w", original, err)
+	}
+	return t, nil
+}
+
+// skipLeadingWeekday strips a leading weekday name (and the space or ", " following it) such as
+// "Mon " or "Monday, " so the rest of the scan only ever sees the date itself.
+func skipLeadingWeekday(s string) string {
+	for _, day := range weekdayNames {
+		for _, name := range []string{day, day[:3]} {
+			if strings.HasPrefix(s, name) {
+				rest := strings.TrimPrefix(s, name)
+				rest = strings.TrimPrefix(rest, ",")
+				return strings.TrimSpace(rest)
+			}
+		}
+	}
+	return s
+}
+
+// parseEpoch recognises a timestamp that is nothing but digits as a Unix epoch: 10 digits or
+// fewer is whole seconds, more than 10 is milliseconds.
+func parseEpoch(s string) (time.Time, bool) {
+	for _, r := range s {
+		if classify(r) != classDigit {
+			return time.Time{}, false
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if len(s) > 10 {
+		return time.UnixMilli(n).UTC(), true
+	}
+	return time.Unix(n, 0).UTC(), true
+}
+
+// classifyLayout runs the dateState scan over s far enough to identify the date portion's shape,
+// then assembles the matching time.Parse layout, appending a time-of-day suffix ("15:04:05", an
+// ISO "T15:04:05" plus offset, or nothing) based on what follows the date.
+func classifyLayout(s string, preferMonthFirst bool) (string, error) {
+	state := dateStart
+	firstGroupLen := 0
+
+	for i, r := range s {
+		class := classify(r)
+		switch state {
+		case dateStart:
+			switch class {
+			case classAlpha:
+				state = dateAlpha
+			case classDigit:
+				state = dateDigit
+			default:
+				return "", fmt.Errorf("unrecognised timestamp shape (unexpected leading character %q)", r)
+			}
+
+		case dateDigit:
+			switch class {
+			case classDigit:
+				// still inside the leading digit group
+			case classDash:
+				firstGroupLen = i
+				return dashDateLayout(s, firstGroupLen)
+			case classSlash:
+				firstGroupLen = i
+				return slashDateLayout(s, firstGroupLen, preferMonthFirst)
+			default:
+				return "", fmt.Errorf("unrecognised timestamp shape (expected '-' or '/' after leading digits, got %q)", r)
+			}
+
+		case dateAlpha:
+			if class == classSpace {
+				state = dateAlphaSpace
+			} else if class != classAlpha {
+				return "", fmt.Errorf("unrecognised timestamp shape (unexpected character %q in month name)", r)
+			}
+
+		case dateAlphaSpace:
+			return monthNameLayout(s)
+		}
+	}
+
+	return "", fmt.Errorf("unrecognised timestamp shape (ran out of input while classifying)")
+}
+
+// dashDateLayout handles a timestamp whose date portion is dash-separated: "2006-01-02..." (ISO,
+// year first - the only reading, since preferMonthFirst only disambiguates slash dates).
+func dashDateLayout(s string, firstGroupLen int) (string, error) {
+	if firstGroupLen != 4 {
+		return "", fmt.Errorf("unrecognised timestamp shape (dash-separated date must start with a 4-digit year)")
+	}
+	if strings.Contains(s, "T") {
+		return "2006-01-02" + timeOfDayLayout(s, true), nil
+	}
+	return "2006-01-02" + timeOfDayLayout(s, false), nil
+}
+
+// slashDateLayout handles a timestamp whose date portion is slash-separated, resolving
+// DD/MM/YYYY vs MM/DD/YYYY per preferMonthFirst (see ParsePriceTimestamp).
+func slashDateLayout(s string, firstGroupLen int, preferMonthFirst bool) (string, error) {
+	if firstGroupLen == 4 {
+		return "2006/01/02" + timeOfDayLayout(s, false), nil
+	}
+	first, _ := strconv.Atoi(s[:firstGroupLen])
+	second := 0
+	rest := s[firstGroupLen+1:]
+	if end := strings.IndexByte(rest, '/'); end > 0 {
+		second, _ = strconv.Atoi(rest[:end])
+	}
+	monthFirst := preferMonthFirst
+	if first > 12 {
+		monthFirst = false
+	} else if second > 12 {
+		monthFirst = true
+	}
+	if monthFirst {
+		return "01/02/2006" + timeOfDayLayout(s, false), nil
+	}
+	return "02/01/2006" + timeOfDayLayout(s, false), nil
+}
+
+// monthNameLayout handles a timestamp that opens with a month name: "Jan 2 2006 15:04:05" or
+// "Jan 2, 2006 15:04:05".
+func monthNameLayout(s string) (string, error) {
+	if strings.Contains(s, ",") {
+		return "Jan 2, 2006" + timeOfDayLayout(s, false), nil
+	}
+	return "Jan 2 2006" + timeOfDayLayout(s, false), nil
+}
+
+// timeOfDayLayout returns the Go layout fragment for whatever time-of-day portion follows a
+// timestamp's date: "" if there is none, otherwise "15:04:05" led in by "T" (iso) or a plain
+// space, with a trailing "Z07:00" for the iso case to accept either a bare "Z" or a numeric UTC
+// offset. A colon is the one character appearing in a time-of-day that never appears in any date
+// shape ParsePriceTimestamp recognises (including the spaces inside "Jan 2 2006"), so its mere
+// presence is enough to detect a time-of-day without re-deriving the date's own length.
+func timeOfDayLayout(s string, iso bool) string {
+	if !strings.Contains(s, ":") {
+		return ""
+	}
+	if iso {
+		return "T15:04:05Z07:00"
+	}
+	return " 15:04:05"
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePriceTimestamp(t *testing.T) {
+	want := time.Date(2021, time.October, 23, 18, 0, 1, 0, time.UTC)
+
+	cases := []struct {
+		name             string
+		s                string
+		preferMonthFirst bool
+	}{
+		{"RFC3339 with Z", "2021-10-23T18:00:01Z", false},
+		{"RFC3339 with a numeric offset", "2021-10-23T18:00:01+00:00", false},
+		{"space-separated ISO date", "2021-10-23 18:00:01", false},
+		{"DD/MM/YYYY", "23/10/2021 18:00:01", false},
+		{"MM/DD/YYYY", "10/23/2021 18:00:01", true},
+		{"month name", "Oct 23 2021 18:00:01", false},
+		{"month name with a comma", "Oct 23, 2021 18:00:01", false},
+		{"leading weekday, full name", "Saturday, 2021-10-23 18:00:01", false},
+		{"leading weekday, abbreviated", "Sat 2021-10-23 18:00:01", false},
+		{"trailing UTC suffix", "2021-10-23 18:00:01 UTC", false},
+		{"bare Unix epoch seconds", "1635012001", false},
+		{"bare Unix epoch milliseconds", "1635012001000", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParsePriceTimestamp(c.s, c.preferMonthFirst)
+			if err != nil {
+				t.Fatalf("ParsePriceTimestamp(%q): unexpected error: %s", c.s, err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("ParsePriceTimestamp(%q) = %s, want %s", c.s, got, want)
+			}
+		})
+	}
+}
+
+func TestParsePriceTimestampAmbiguity(t *testing.T) {
+	// 2021-03-04: day and month are both <= 12, so preferMonthFirst is the only thing that can
+	// tell "04/03/2021" apart as 4 March or as 3 April.
+	asEU, err := ParsePriceTimestamp("04/03/2021", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC); !asEU.Equal(want) {
+		t.Errorf("ParsePriceTimestamp(\"04/03/2021\", false) = %s, want %s (4 March)", asEU, want)
+	}
+
+	asUS, err := ParsePriceTimestamp("04/03/2021", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := time.Date(2021, time.April, 3, 0, 0, 0, 0, time.UTC); !asUS.Equal(want) {
+		t.Errorf("ParsePriceTimestamp(\"04/03/2021\", true) = %s, want %s (3 April)", asUS, want)
+	}
+
+	// Once a field is > 12 the date is unambiguous regardless of preferMonthFirst.
+	unambiguous := "23/10/2021"
+	want := time.Date(2021, time.October, 23, 0, 0, 0, 0, time.UTC)
+	for _, preferMonthFirst := range []bool{true, false} {
+		got, err := ParsePriceTimestamp(unambiguous, preferMonthFirst)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("ParsePriceTimestamp(%q, %v) = %s, want %s", unambiguous, preferMonthFirst, got, want)
+		}
+	}
+}
+
+func TestParsePriceTimestampErrors(t *testing.T) {
+	cases := []string{"", "not a date", "2021--10-23", "#2021-10-23"}
+	for _, s := range cases {
+		if _, err := ParsePriceTimestamp(s, false); err == nil {
+			t.Errorf("ParsePriceTimestamp(%q): expected an error, got none", s)
+		}
+	}
+}
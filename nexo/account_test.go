@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+// TestRejectedHoldsAndRefundedReleases runs a "Rejected" row (an attempted GBP withdrawal that
+// never settled) followed by a "Refunded" row for the same currency through
+// convertSingleTransaction, and checks that the Account ends with Held back at zero and the
+// originally-withdrawn amount released back to Available.
+func TestRejectedHoldsAndRefundedReleases(t *testing.T) {
+	output := make(map[string][][]string, 0)
+	exchangeToWithdraw := make([]queuedRecord, 0)
+	depositToExchange := make([]queuedRecord, 0)
+	accounts := make(map[string]*Account, 0)
+
+	rejectedRow := buildStandardTestVector()
+	rejectedRow[tx_ID] = "TX-REJECTED"
+	rejectedRow[tx_Type] = "Rejected"
+	rejectedRow[tx_InputCurrency] = "GBP"
+	rejectedRow[tx_OutputCurrency] = "GBP"
+	rejectedRow[tx_InputAmount] = "-25.00"
+	rejectedRow[tx_OutputAmount] = "-25.00"
+	rejectedRow[tx_UsdEquivalent] = "$30.00"
+	rejectedRow[tx_DateTime] = "2022-01-01 09:00:00"
+
+	if errorText := convertSingleTransaction(rejectedRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, accounts, "Europe/London"); errorText != "" {
+		t.Fatalf("convertSingleTransaction(Rejected): unexpected error text: %q", errorText)
+	}
+
+	acct, found := accounts["GBP"]
+	if !found {
+		t.Fatalf("expected a GBP Account after a Rejected row, found none")
+	}
+	if got, want := acct.Held.String(), "25.00"; got != want {
+		t.Errorf("after Rejected: Held = %q, want %q", got, want)
+	}
+	if got, want := acct.Available.String(), "-25.00"; got != want {
+		t.Errorf("after Rejected: Available = %q, want %q", got, want)
+	}
+	if AnyAccountNeedsAttention(accounts) != true {
+		t.Errorf("AnyAccountNeedsAttention: got false, want true while GBP is still Held")
+	}
+
+	refundedRow := buildStandardTestVector()
+	refundedRow[tx_ID] = "TX-REFUNDED"
+	refundedRow[tx_Type] = "Refunded"
+	refundedRow[tx_InputCurrency] = "GBP"
+	refundedRow[tx_OutputCurrency] = "GBP"
+	refundedRow[tx_InputAmount] = "25.00"
+	refundedRow[tx_OutputAmount] = "25.00"
+	refundedRow[tx_UsdEquivalent] = "$30.00"
+	refundedRow[tx_DateTime] = "2022-01-02 09:00:00"
+
+	if errorText := convertSingleTransaction(refundedRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, accounts, "Europe/London"); errorText != "" {
+		t.Fatalf("convertSingleTransaction(Refunded): unexpected error text: %q", errorText)
+	}
+
+	if got, want := acct.Held.String(), "0.00"; got != want {
+		t.Errorf("after Refunded: Held = %q, want %q", got, want)
+	}
+	if got, want := acct.Available.String(), "0.00"; got != want {
+		t.Errorf("after Refunded: Available = %q, want %q", got, want)
+	}
+	if AnyAccountNeedsAttention(accounts) != false {
+		t.Errorf("AnyAccountNeedsAttention: got true, want false once GBP is fully refunded")
+	}
+}
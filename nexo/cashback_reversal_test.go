@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestReportCardCashbackReversalsDetectsClawback builds two "Exchange Cashback" rows - the
+// second exactly negating the first, a few days later - and checks that pkg/matcher's reversal
+// detection flags the pairing.
+func TestReportCardCashbackReversalsDetectsClawback(t *testing.T) {
+	original := buildStandardTestVector()
+	original[tx_ID] = "TX-CASHBACK"
+	original[tx_Type] = "Exchange Cashback"
+	original[tx_InputCurrency] = "BTC"
+	original[tx_OutputCurrency] = "BTC"
+	original[tx_InputAmount] = "0.50"
+	original[tx_OutputAmount] = "0.50"
+	original[tx_Details] = "approved / 0.5% on top of your Exchange transaction"
+	original[tx_DateTime] = "2022-01-01 09:00:00"
+
+	clawback := buildStandardTestVector()
+	clawback[tx_ID] = "TX-CLAWBACK"
+	clawback[tx_Type] = "Exchange Cashback"
+	clawback[tx_InputCurrency] = "BTC"
+	clawback[tx_OutputCurrency] = "BTC"
+	clawback[tx_InputAmount] = "-0.50"
+	clawback[tx_OutputAmount] = "-0.50"
+	clawback[tx_Details] = "approved / 0.5% on top of your Exchange transaction"
+	clawback[tx_DateTime] = "2022-01-03 09:00:00"
+
+	report := reportCardCashbackReversals([][]string{original, clawback})
+	if report == "" {
+		t.Fatalf("reportCardCashbackReversals: got no report, want a reversal flagged")
+	}
+	wantSubstrings := []string{"TX-CLAWBACK", "TX-CASHBACK"}
+	for _, want := range wantSubstrings {
+		if !strings.Contains(report, want) {
+			t.Errorf("reportCardCashbackReversals: report %q missing %q", report, want)
+		}
+	}
+}
+
+// TestReportCardCashbackReversalsIgnoresUnrelatedCashback checks that two "Exchange Cashback"
+// rows with different amounts are not flagged as a reversal.
+func TestReportCardCashbackReversalsIgnoresUnrelatedCashback(t *testing.T) {
+	first := buildStandardTestVector()
+	first[tx_ID] = "TX-CASHBACK-1"
+	first[tx_Type] = "Exchange Cashback"
+	first[tx_InputCurrency] = "BTC"
+	first[tx_OutputCurrency] = "BTC"
+	first[tx_InputAmount] = "0.50"
+	first[tx_OutputAmount] = "0.50"
+	first[tx_Details] = "approved / 0.5% on top of your Exchange transaction"
+	first[tx_DateTime] = "2022-01-01 09:00:00"
+
+	second := buildStandardTestVector()
+	second[tx_ID] = "TX-CASHBACK-2"
+	second[tx_Type] = "Exchange Cashback"
+	second[tx_InputCurrency] = "BTC"
+	second[tx_OutputCurrency] = "BTC"
+	second[tx_InputAmount] = "0.75"
+	second[tx_OutputAmount] = "0.75"
+	second[tx_Details] = "approved / 0.5% on top of your Exchange transaction"
+	second[tx_DateTime] = "2022-01-03 09:00:00"
+
+	if report := reportCardCashbackReversals([][]string{first, second}); report != "" {
+		t.Errorf("reportCardCashbackReversals: got %q, want no reversal flagged", report)
+	}
+}
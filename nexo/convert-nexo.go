@@ -8,7 +8,20 @@ package main
 // Row processing should be enhanced to check all rows, even those that produce no output.
 
 // Notes:
-// Timestamps are in CET. These are NOT YET converted to UK local time.
+// Timestamps are in CET/CEST (see sourceTimezone). The "uk date/time" column is the same instant
+// converted to the -output-tz flag's zone (default Europe/London) via the timeconv package.
+// Every amount column is parsed through the Money type (money.go), never as a float, so large
+// crypto amounts never lose precision to comparison/formatting. Money's per-currency decimal
+// scale can be overridden without a recompile via -scale-config (see LoadScaleOverridesFile).
+// -format ofx's account CURDEF defaults to GBP and can be changed with -ofx-base (see ofx.go).
+// WithdrawExchanged/ExchangeDepositedOn match against the exchangeToWithdraw/depositToExchange
+// queues by exact amount and a time window by default, regardless of queue order; -strict-fifo
+// reverts to matching strictly in queue order instead (see legmatch.go).
+// "Rejected"/"Refunded" rows are tracked as per-currency Available/Held balances (see account.go)
+// and summarised to <output file>.accounts.csv; the program exits non-zero if any currency ends
+// with a non-zero Held balance or a locked Account.
+// Some transaction Types are handled by a pluggable LegValidator (see validator.go) instead of the
+// switch statement below; a Type with its own registered validator is dispatched to it first.
 
 // Note that an older format was used until some time between 2022-03-16 and 2022-04-06.
 //
@@ -70,24 +83,59 @@ package main
 // Handle GBP -> XXX: this is a BUY of XXX
 // Handle Crypto Earn: this is STAKING
 // Handle  Card Cashback Reversal (look for identical transaction later???)
-// Handle Withdraw: this is TRANSFER-OUT
 // Add option to spread out transactions by currency, so group together all CRO and all AVAX etc.
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/AntonioCarlini/data-processing/nexo/costbasis"
+	"github.com/AntonioCarlini/data-processing/pkg/fxrate"
+	"github.com/AntonioCarlini/data-processing/pkg/schema"
+	"github.com/AntonioCarlini/data-processing/pkg/timeconv"
+	// Aliased: main()'s own `ledger *costbasis.Ledger` variable (the cost-basis ledger) already
+	// owns the identifier "ledger".
+	txledger "github.com/AntonioCarlini/data-processing/pkg/ledger"
 )
 
 func main() {
 
+	// "query" is a subcommand, not a flag, the same way e.g. "go build" vs "go test" dispatch:
+	// it has its own flag set and doesn't take the two positional CSV arguments below.
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		runQueryCommand(os.Args[2:])
+		return
+	}
+
+	format := flag.String("format", "csv", "output format: \"csv\" (default) or \"ofx\"")
+	costBasisStrategy := flag.String("costbasis", "", "compute realised GBPX disposal gains using a cost-basis strategy: \"fifo\", \"lifo\", \"hmrc\", or \"\" (default) to disable")
+	outputTZ := flag.String("output-tz", "Europe/London", "IANA timezone to convert Nexo's CET/CEST timestamps into for the \"uk date/time\" column")
+	scaleConfig := flag.String("scale-config", "", "path to a JSON file of currency code -> decimal scale overrides (e.g. {\"ETH\": 18}), or \"\" (default) to use the built-in defaults only")
+	ofxBase := flag.String("ofx-base", "GBP", "ISO 4217 code to use as the account's CURDEF in -format ofx output; every other currency rides as ORIGCURRENCY")
+	flag.BoolVar(&strictFIFO, "strict-fifo", false, "match WithdrawExchanged/ExchangeDepositedOn against the exchangeToWithdraw/depositToExchange queues strictly in queue order (the original behaviour), instead of the default order-independent, exact-amount/time-window matcher (see legmatch.go)")
+	fxCacheDir := flag.String("fx-cache", "", "directory to cache ECB USD/GBP exchange rates in (see pkg/fxrate); if set, usdToGBP converts cost-basis USD amounts at their historical rate instead of passing them through 1:1")
+	sqlitePath := flag.String("sqlite", "", "path to a pkg/ledger SQLite database to import every transaction into alongside (or instead of) -format output, deduplicating against rows already recorded there from an earlier, overlapping run; \"\" (default) disables this")
 	flag.Parse()
 
+	if *scaleConfig != "" {
+		if err := LoadScaleOverridesFile(*scaleConfig); err != nil {
+			log.Fatalf("Cannot load -scale-config %q: %s\n", *scaleConfig, err.Error())
+		}
+	}
+
+	if *fxCacheDir != "" {
+		fxConverter = fxrate.NewFileCache(*fxCacheDir, fxrate.NewECBProvider())
+	}
+
 	inputs := flag.Args()
 	if len(inputs) != 2 {
 		log.Fatalf("Exactly 2 arguments required but %d supplied\n", len(inputs))
@@ -103,21 +151,13 @@ func main() {
 		log.Fatalf("Input CSV file %s must contain at least two rows and it does not. Only %d rows present.", transactionsFilename, len(transactions))
 	}
 
-	// The first element must match this exactly otherwise the format may have changed:
-	expectedFirstRow := []string{"Transaction", "Type", "Input Currency", "Input Amount", "Output Currency", "Output Amount", "USD Equivalent", "Details", "Outstanding Loan", "Date / Time"}
+	// The first row must match a known Nexo header (see pkg/schema). schema.Detect rejects with a
+	// Levenshtein-ranked list of how close the file's header came to every known schema, so a
+	// changed export format is an actionable diagnostic rather than a bare "perhaps the format has
+	// changed?" exit.
 	firstRow := transactions[0]
-	if !testSlicesEqual(firstRow, expectedFirstRow) {
-		fmt.Printf("Expected first row format: %s\n", expectedFirstRow)
-		fmt.Printf("Actual first row format:   %s\n", firstRow)
-		fmt.Printf("lengths: expected: %d, actual: %d\n", len(expectedFirstRow), len(firstRow))
-		for i := 0; i < len(firstRow); i = i + 1 {
-			if firstRow[i] != expectedFirstRow[i] {
-				fmt.Printf("Mismatch found at element %d. Actual: [%s], expected: [%s]\n", i, firstRow[i], expectedFirstRow[i])
-			} else {
-				fmt.Printf("Match for element %d\n", i)
-			}
-		}
-		log.Fatalf("First CSV row fails to match expectations. Perhaps the format has changed?")
+	if _, err := schema.Detect(firstRow); err != nil {
+		log.Fatalf("%s\n", err)
 	}
 
 	// The first element is the identification row, which now just gets in the way
@@ -130,9 +170,132 @@ func main() {
 		transactions[i], transactions[j] = transactions[j], transactions[i]
 	}
 
-	convertedTransactions := convertTransactions(transactions)
+	if *sqlitePath != "" {
+		if err := importTransactions(*sqlitePath, transactions); err != nil {
+			log.Fatalf("-sqlite %q: %s\n", *sqlitePath, err)
+		}
+	}
+
+	var ledger *costbasis.Ledger
+	switch *costBasisStrategy {
+	case "":
+		// cost-basis tracking disabled
+	case "fifo":
+		ledger = costbasis.NewLedger(costbasis.FIFO{})
+	case "lifo":
+		ledger = costbasis.NewLedger(costbasis.LIFO{})
+	case "hmrc":
+		ledger = costbasis.NewLedger(costbasis.HMRCPool{})
+	default:
+		log.Fatalf("Unknown -costbasis %q: expected \"fifo\", \"lifo\", \"hmrc\" or \"\"\n", *costBasisStrategy)
+	}
+
+	convertedTransactions, perCurrencyOutput, gains, accounts := convertTransactions(transactions, ledger, *outputTZ)
+
+	switch *format {
+	case "csv":
+		writeConvertedTransactions(outputFile, convertedTransactions)
+	case "ofx":
+		ofxDocument, err := writeOFX(perCurrencyOutput, *ofxBase)
+		if err != nil {
+			log.Fatalf("Cannot build OFX output: %s\n", err.Error())
+		}
+		if err := os.WriteFile(outputFile, []byte(ofxDocument), 0644); err != nil {
+			log.Fatalf("Cannot write '%s': %s\n", outputFile, err.Error())
+		}
+	default:
+		log.Fatalf("Unknown -format %q: expected \"csv\" or \"ofx\"\n", *format)
+	}
+
+	if ledger != nil {
+		header := []string{"Transaction", "Date / Time", "Currency", "Quantity", "Cost (GBP)", "Proceeds (GBP)", "Gain (GBP)"}
+		writeConvertedTransactions(outputFile+".gains.csv", append([][]string{header}, gains...))
+	}
+
+	if err := writeAccountSummary(outputFile+".accounts.csv", accounts); err != nil {
+		log.Fatalf("Cannot write account summary: %s\n", err.Error())
+	}
+	if AnyAccountNeedsAttention(accounts) {
+		fmt.Fprintf(os.Stderr, "One or more currencies have an unresolved Held balance or a locked Account; see %s.accounts.csv\n", outputFile)
+		os.Exit(1)
+	}
+}
+
+// importTransactions opens (creating if necessary) the SQLite database at sqlitePath and inserts
+// one txledger.Row per transaction, reporting how many were new versus already present (from an
+// earlier, overlapping run) to stdout. transactions must already have had its identification row
+// stripped.
+func importTransactions(sqlitePath string, transactions [][]string) error {
+	store, err := txledger.NewSQLiteStore(sqlitePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var newCount, dupCount int
+	for _, row := range transactions {
+		asset, amount := row[tx_OutputCurrency], row[tx_OutputAmount]
+		if asset == "" {
+			asset, amount = row[tx_InputCurrency], row[tx_InputAmount]
+		}
+		rawJSON, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("marshalling TX %s: %w", row[tx_ID], err)
+		}
+		txRow := txledger.Row{
+			Source:         "nexo.io",
+			SourceRowHash:  txledger.ComputeRowHash("nexo.io", row[tx_DateTime], row[tx_Type], asset, amount, row[tx_ID]),
+			TimestampUTC:   row[tx_DateTime],
+			Kind:           row[tx_Type],
+			Asset:          asset,
+			Amount:         amount,
+			NativeAmount:   row[tx_InputAmount],
+			NativeCurrency: row[tx_InputCurrency],
+			TxHash:         row[tx_ID],
+			RawJSON:        string(rawJSON),
+		}
+		inserted, err := store.Insert(txRow)
+		if err != nil {
+			return fmt.Errorf("inserting TX %s: %w", row[tx_ID], err)
+		}
+		if inserted {
+			newCount++
+		} else {
+			dupCount++
+		}
+	}
+	fmt.Printf("-sqlite %s: %d new row(s), %d duplicate row(s) already recorded\n", sqlitePath, newCount, dupCount)
+	return nil
+}
+
+// runQueryCommand implements the "query" subcommand: dump a -sqlite database's rows for a single
+// asset, in the same per-asset/time order -format output groups by, without running a conversion.
+func runQueryCommand(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	sqlitePath := fs.String("sqlite", "", "path to the -sqlite database to query (required)")
+	fs.Parse(args)
+
+	if *sqlitePath == "" {
+		log.Fatalf("query: -sqlite is required\n")
+	}
+	if fs.NArg() != 1 {
+		log.Fatalf("query: exactly one asset argument required, e.g. query -sqlite path.db BTC\n")
+	}
+	asset := fs.Arg(0)
+
+	store, err := txledger.NewSQLiteStore(*sqlitePath)
+	if err != nil {
+		log.Fatalf("query: %s\n", err)
+	}
+	defer store.Close()
 
-	writeConvertedTransactions(outputFile, convertedTransactions)
+	rows, err := store.Rows(asset)
+	if err != nil {
+		log.Fatalf("query: %s\n", err)
+	}
+	for _, r := range rows {
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", r.TimestampUTC, r.Kind, r.Asset, r.Amount, r.TxHash)
+	}
 }
 
 func readTransactions(name string) [][]string {
@@ -175,7 +338,24 @@ const ( // iota is reset to 0
 	tx_DateTime        = 9 //
 )
 
-func convertTransactions(transactions [][]string) [][]string {
+// queuedRecord holds a raw CSV row together with its Money-typed amount, for use in the
+// exchangeToWithdraw/depositToExchange FIFO queues. See splitFIFOHead for how queued amounts
+// are matched (and, where necessary, split) against the row that claims them. usdEquivalent is
+// carried along so the matching leg can check for exchange-rate drift (see
+// peekFIFOHeadUsdEquivalent) without having to re-parse the original row's USD Equivalent column.
+type queuedRecord struct {
+	row           []string
+	amount        Money
+	usdEquivalent Money
+}
+
+// convertTransactions processes transactions in order and returns the flattened CSV-report rows,
+// the per-currency `output` map that produced them (the latter is what writeOFX consumes), any
+// realised-gain rows recorded against ledger, and the per-currency Account balances built up by
+// "Rejected"/"Refunded" rows (see account.go). ledger may be nil, in which case cost-basis
+// tracking is skipped and the returned gains slice is always empty. outputTZ is the IANA zone
+// (e.g. "Europe/London") each row's "uk date/time" column is converted into.
+func convertTransactions(transactions [][]string, ledger *costbasis.Ledger, outputTZ string) ([][]string, map[string][][]string, [][]string, map[string]*Account) {
 
 	// TBD
 	// This needs to record per-currency (as per kraken) using the Output Currency as the key.
@@ -185,21 +365,31 @@ func convertTransactions(transactions [][]string) [][]string {
 	// What is the correct way of handling NEXO/USDC and USDC/UST transactions?
 	// Note that a GBPX=>NEXO transaction does not record the amount of GBPX exchanged, only the dollar equivalent.
 
-	output := make(map[string][][]string, 0)  // map of currency => array of strings
-	exchangeToWithdraw := make([][]string, 0) // FIFO queue or records
-	depositToExchange := make([][]string, 0)  // FIFO queue or records
+	output := make(map[string][][]string, 0)      // map of currency => array of strings
+	exchangeToWithdraw := make([]queuedRecord, 0) // FIFO queue or records
+	depositToExchange := make([]queuedRecord, 0)  // FIFO queue or records
+	gains := make([][]string, 0)                  // realised-gain rows, populated only if ledger != nil
+	accounts := make(map[string]*Account, 0)      // per-currency Available/Held balances; see account.go
 
 	for _, row := range transactions {
-		errorText := convertSingleTransaction(row, &output, &exchangeToWithdraw, &depositToExchange)
+		errorText := convertSingleTransaction(row, &output, &exchangeToWithdraw, &depositToExchange, ledger, &gains, accounts, outputTZ)
 		if len(errorText) > 0 {
 			fmt.Print(errorText)
 		}
 
 	}
 
-	// At this point the exchangeToWithdraw FIFO should be empty
-	if len(exchangeToWithdraw) > 0 {
-		fmt.Printf("There are ")
+	// Anything still queued in exchangeToWithdraw or depositToExchange has no matching
+	// confirmation leg in its own chain; reconcile what's left as cross-venue transfers before
+	// reporting on anything that still doesn't match.
+	if err := reconcileTransfers(&output, &exchangeToWithdraw, &depositToExchange, DefaultReconcileConfig); err != nil {
+		fmt.Printf("%s\n", err)
+	}
+
+	// See cashback_reversal.go: flags any "Exchange Cashback" row that nexo.io later clawed back,
+	// so a human reviewing the output knows the clawback row isn't a second, unrelated reward.
+	if report := reportCardCashbackReversals(transactions); report != "" {
+		fmt.Print(report)
 	}
 
 	// Find all the currencies in the map
@@ -241,14 +431,183 @@ func convertTransactions(transactions [][]string) [][]string {
 		finalOutput = append(finalOutput, []string{"", ""})
 	}
 
-	return finalOutput
+	return finalOutput, output, gains, accounts
+}
+
+// sourceTimezone is the IANA zone Nexo's "Date / Time" column is expressed in (see the file-level
+// Notes comment above).
+const sourceTimezone = "Europe/Berlin"
+
+// convertDateTime converts row's Date / Time column from sourceTimezone into outputTZ, for the
+// output rows' "uk date/time" column.
+func convertDateTime(row []string, outputTZ string) (string, error) {
+	return timeconv.Convert(row[tx_DateTime], sourceTimezone, outputTZ)
+}
+
+// parseUsdEquivalent parses a Nexo "USD Equivalent" column (e.g. "$98.76"), which must be
+// prefixed with "$", into a Money value denominated in USD. Centralising the "$" prefix check and
+// the parse here - rather than indexing into the raw string at each call site
+// (row[tx_UsdEquivalent][0] != '$', row[tx_UsdEquivalent][1:]) - means a missing or malformed
+// prefix is reported as an error instead of risking an index-out-of-range panic on a short or
+// empty column.
+func parseUsdEquivalent(raw string) (Money, error) {
+	if !strings.HasPrefix(raw, "$") {
+		return Money{}, fmt.Errorf("expected a USD amount prefixed with \"$\", got %q", raw)
+	}
+	return ParseMoney(strings.TrimPrefix(raw, "$"), "USD")
+}
+
+// fxConverter resolves the historical USD/GBP rate usdToGBP applies when set; nil (the default)
+// keeps usdToGBP's original 1:1 behaviour. It is a package-level var, the same way strictFIFO
+// (legmatch.go) is, since threading a converter through every one of usdToGBP's callers' own
+// callers would mean touching convertSingleTransaction's ~37 call sites for a value that is
+// effectively a run-wide setting, not something that varies row to row. -fx-cache sets it in
+// main().
+var fxConverter fxrate.CurrencyConverter
+
+// usdToGBP converts a bare (no "$" prefix) USD decimal amount, valued at, into GBP pence. With no
+// fxConverter configured it is a 1:1 placeholder - the only behaviour this function has ever had,
+// preserved as the default since nothing in the existing cost-basis test suite expects otherwise
+// - rather than a real USD/GBP exchange rate lookup. When fxConverter is set (see -fx-cache in
+// main()), it resolves at's historical USD->GBP rate and applies it instead.
+func usdToGBP(usdAmount string, at time.Time) (int64, error) {
+	money, err := ParseMoney(usdAmount, "GBP")
+	if err != nil {
+		return 0, err
+	}
+	if fxConverter == nil {
+		return money.Amount(), nil
+	}
+	rateStr, err := fxConverter.Rate("USD", "GBP", at)
+	if err != nil {
+		return 0, fmt.Errorf("usdToGBP: %w", err)
+	}
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil {
+		return 0, fmt.Errorf("usdToGBP: unparseable rate %q: %w", rateStr, err)
+	}
+	return int64(math.Round(float64(money.Amount()) * rate)), nil
+}
+
+// acquireLot records an acquisition lot of quantity in ledger, dated from row's Date/Time column
+// and costed (for the whole lot) from costUSD via usdToGBP. It is a no-op if ledger is nil.
+func acquireLot(ledger *costbasis.Ledger, row []string, quantity Money, costUSD string) string {
+	if ledger == nil {
+		return ""
+	}
+	acquiredAt, err := time.Parse("2006-01-02 15:04:05", row[tx_DateTime])
+	if err != nil {
+		return fmt.Sprintf("TX %s: cost-basis acquisition date invalid [%s]: %s\n", row[tx_ID], row[tx_DateTime], err)
+	}
+	costGBP, err := usdToGBP(costUSD, acquiredAt)
+	if err != nil {
+		return fmt.Sprintf("TX %s: cost-basis acquisition cost invalid [%s]: %s\n", row[tx_ID], costUSD, err)
+	}
+	ledger.Acquire(string(quantity.Code()), acquiredAt, quantity.Amount(), costGBP, row[tx_ID])
+	return ""
+}
+
+// disposeLot consumes a disposal of quantity from ledger and appends a realised-gain row to
+// gains (cost basis from the ledger vs. proceeds, the Money actually realised by the disposal).
+// It is a no-op if ledger is nil.
+func disposeLot(ledger *costbasis.Ledger, gains *[][]string, row []string, quantity, proceeds Money) string {
+	if ledger == nil {
+		return ""
+	}
+	disposedAt, err := time.Parse("2006-01-02 15:04:05", row[tx_DateTime])
+	if err != nil {
+		return fmt.Sprintf("TX %s: cost-basis disposal date invalid [%s]: %s\n", row[tx_ID], row[tx_DateTime], err)
+	}
+	disposal := ledger.Dispose(string(quantity.Code()), disposedAt, quantity.Amount())
+	if disposal.Unmatched != 0 {
+		return fmt.Sprintf("TX %s: cost-basis disposal of %s exceeds recorded acquisitions by %d minor units\n", row[tx_ID], quantity.Code(), disposal.Unmatched)
+	}
+	costMoney := MustNew(disposal.CostGBP, MustCurrSymbol("GBP"))
+	gainMoney, err := proceeds.Subtract(costMoney)
+	if err != nil {
+		return fmt.Sprintf("TX %s: cost-basis gain calculation error: %s\n", row[tx_ID], err)
+	}
+	*gains = append(*gains, []string{row[tx_ID], row[tx_DateTime], string(quantity.Code()), quantity.String(), costMoney.String(), proceeds.String(), gainMoney.String()})
+	return ""
+}
+
+// FeeKind categorises a Fee by where it was charged.
+type FeeKind string
+
+const (
+	NetworkFee  FeeKind = "NetworkFee"
+	ExchangeFee FeeKind = "ExchangeFee"
+	SpreadFee   FeeKind = "SpreadFee"
+)
+
+// Fee records a charge taken out of a transaction by the network or the exchange, over and
+// above the amount actually received: Amount is denominated in Currency (the same currency as
+// the transaction that incurred it), and FiatValue is its GBP-equivalent cost-basis value.
+type Fee struct {
+	Currency  string
+	Amount    Money
+	FiatValue Money
+	Kind      FeeKind
+}
+
+// recordFee computes the Fee implied by a transaction whose gross and net amounts - the same
+// currency, just two different points in the same transaction - differ, realising it as a
+// disposal against ledger (at a proportional share of row's USD-equivalent value) so the fee is
+// not silently lost from the cost basis. It returns (nil, "") if gross and net are equal: there
+// is no fee to record. It is a no-op beyond computing the Fee itself if ledger is nil.
+func recordFee(ledger *costbasis.Ledger, gains *[][]string, row []string, gross, net Money, kind FeeKind) (*Fee, string) {
+	feeAmount := gross.Amount() - net.Amount()
+	if feeAmount < 0 {
+		feeAmount = -feeAmount
+	}
+	if feeAmount == 0 {
+		return nil, ""
+	}
+	feeMoney := MustNew(feeAmount, gross.Code())
+
+	if ledger == nil {
+		return &Fee{Currency: string(gross.Code()), Amount: feeMoney, Kind: kind}, ""
+	}
+
+	usdEquivalent, err := parseUsdEquivalent(row[tx_UsdEquivalent])
+	if err != nil {
+		return nil, fmt.Sprintf("TX %s: fee fiat-value conversion error: %s\n", row[tx_ID], err)
+	}
+	feeAt, err := time.Parse("2006-01-02 15:04:05", row[tx_DateTime])
+	if err != nil {
+		return nil, fmt.Sprintf("TX %s: fee fiat-value conversion error: %s\n", row[tx_ID], err)
+	}
+	totalGBP, err := usdToGBP(usdEquivalent.String(), feeAt)
+	if err != nil {
+		return nil, fmt.Sprintf("TX %s: fee fiat-value conversion error: %s\n", row[tx_ID], err)
+	}
+	totalAmount := gross.Amount()
+	if net.Amount() > totalAmount {
+		totalAmount = net.Amount()
+	}
+	fiatValue := MustNew(totalGBP*feeAmount/totalAmount, MustCurrSymbol("GBP"))
+	if errText := disposeLot(ledger, gains, row, feeMoney, fiatValue); errText != "" {
+		return nil, errText
+	}
+	return &Fee{Currency: string(gross.Code()), Amount: feeMoney, FiatValue: fiatValue, Kind: kind}, ""
+}
+
+// feeOutputRow formats fee as an output-map row tagged with its Kind, the same shape as the
+// REWARD/STAKING/TRANSFER rows built elsewhere in convertSingleTransaction. ukDateTime is row's
+// Date / Time column already converted to the output timezone (see convertDateTime).
+func feeOutputRow(row []string, fee Fee, ukDateTime string) []string {
+	return []string{"", "nexo.io", row[tx_DateTime], ukDateTime, fee.Amount.String(), "", "", "", "", "", "", "", "", string(fee.Kind)}
 }
 
 // Handles a single row of the input CSV, representing a single transaction.
 // All transactions are sanity checked.
 // Only some transactions produce output.
 // Some transactions produce data records for subsequent transactions to use.
-func convertSingleTransaction(row []string, output *map[string][][]string, exchangeToWithdraw *[][]string, depositToExchange *[][]string) string {
+// ledger, if non-nil, accumulates cost-basis lots from acquisition events and realises gains
+// into gains when a later event disposes of them; see acquireLot and disposeLot. accounts, if
+// non-nil, accumulates per-currency Available/Held balances from "Rejected"/"Refunded" rows; see
+// account.go. outputTZ is the IANA zone the "uk date/time" column is converted into.
+func convertSingleTransaction(row []string, output *map[string][][]string, exchangeToWithdraw *[]queuedRecord, depositToExchange *[]queuedRecord, ledger *costbasis.Ledger, gains *[][]string, accounts map[string]*Account, outputTZ string) string {
 
 	errorOutput := ""
 
@@ -257,77 +616,39 @@ func convertSingleTransaction(row []string, output *map[string][][]string, excha
 		errorOutput += fmt.Sprintf("TX %s: Outstanding Load error: %s\n", row[tx_ID], row[tx_OutstandingLoan])
 	}
 
-	// Handle each transaction Type separately
-	switch row[tx_Type] { // row[1] is the "Type"
-	case "LockingTermDeposit":
-		// LockingTermDeposit represents moving a token from the normal wallet into a wallet where it earns higher STAKING rewards in return for being locked.
-		// This line generates no output and is checked purely to ensure that the format is understood and has not changed.
-		// Input/Output Currency must be identical
-		if row[tx_InputCurrency] != row[tx_OutputCurrency] {
-			errorOutput += fmt.Sprintf("TX %s: LockingTermDeposit currency error: input: %s, output: %s\n", row[tx_ID], row[tx_InputCurrency], row[tx_OutputCurrency])
-		}
-		// Input Amount and Output Amount must be identical in absolute value the former is negative and the latter is positive.
-		if row[tx_InputAmount][0] != '-' || row[tx_InputAmount][1:] != row[tx_OutputAmount] {
-			valuesDiffer := true
-			if row[tx_InputCurrency] == "GBPX" {
-				inputAmountFloat, err := strconv.ParseFloat(row[tx_InputAmount], 64)
-				if err != nil {
-					errorOutput += fmt.Sprintf("TX %s: LockingTermDeposit Input Amount conversion error: %s, issue: %s\n", row[tx_ID], row[tx_InputAmount], err)
-				}
-				outputAmountFloat, err := strconv.ParseFloat(row[tx_OutputAmount], 64)
-				if err != nil {
-					errorOutput += fmt.Sprintf("TX %s: LockingTermDeposit Output Amount conversion error: %s, issue: %s\n", row[tx_ID], row[tx_OutputAmount], err)
-				}
-				if inputAmountFloat == -outputAmountFloat {
-					valuesDiffer = false
-				}
-			}
-			if valuesDiffer {
-				errorOutput += fmt.Sprintf("TX %s: LockingTermDeposit currency amount error: input: %s, output: %s\n", row[tx_ID], row[tx_InputAmount], row[tx_OutputAmount])
-			}
-		}
-		//       Details: "approved / Transfer from Savings Wallet to Term Wallet"
-		if !strings.HasPrefix(row[tx_Details], "approved / Transfer from Savings Wallet to Term Wallet") {
-			errorOutput += fmt.Sprintf("TX %s: LockingTermDeposit Details error: input: %s\n", row[tx_ID], row[tx_Details])
-		}
-		if row[tx_UsdEquivalent][0] != '$' {
-			errorOutput += fmt.Sprintf("TX %s: LockingTermDeposit not in dollars [%s]\n", row[tx_ID], row[tx_UsdEquivalent])
-		}
-	case "UnlockingTermDeposit":
-		// UnlockingTermDeposit represents moving a token from the long term wallet into a normal wallet at the end of a term period.
-		// This line generates no output and is checked purely to ensure that the format is understood and has not changed.
-		// Input/Output Currency must be identical
-		if row[tx_InputCurrency] != row[tx_OutputCurrency] {
-			errorOutput += fmt.Sprintf("TX %s: UnlockingTermDeposit currency error: input: %s, output: %s\n", row[tx_ID], row[tx_InputCurrency], row[tx_InputCurrency])
-		}
-		// Input Amount and Output Amount must be identical.
-		if row[tx_InputAmount] != row[tx_OutputAmount] {
-			valuesDiffer := true
-			if row[tx_InputCurrency] == "GBPX" {
-				inputAmountFloat, err := strconv.ParseFloat(row[tx_InputAmount], 64)
-				if err != nil {
-					errorOutput += fmt.Sprintf("TX %s: UnlockingTermDeposit Input Amount conversion error: %s, issue: %s\n", row[tx_ID], row[tx_InputAmount], err)
-				}
-				outputAmountFloat, err := strconv.ParseFloat(row[tx_OutputAmount], 64)
-				if err != nil {
-					errorOutput += fmt.Sprintf("TX %s: UnlockingTermDeposit Output Amount conversion error: %s, issue: %s\n", row[tx_ID], row[tx_OutputAmount], err)
-				}
-				if inputAmountFloat == outputAmountFloat {
-					valuesDiffer = false
-				}
-			}
-			if valuesDiffer {
-				errorOutput += fmt.Sprintf("TX %s: UnlockingTermDeposit currency amount error: input: %s, output: %s\n", row[tx_ID], row[tx_InputAmount], row[tx_OutputAmount])
-			}
-		}
-		//       Details: "approved / Transfer from Term Wallet to Savings Wallet"
-		if !strings.HasPrefix(row[tx_Details], "approved / Transfer from Term Wallet to Savings Wallet") {
-			errorOutput += fmt.Sprintf("TX %s: UnlockingTermDeposit Details error: input: %s\n", row[tx_ID], row[tx_Details])
-		}
-		if row[tx_UsdEquivalent][0] != '$' {
-			errorOutput += fmt.Sprintf("TX %s: UnlockingTermDeposit not in dollars [%s]\n", row[tx_ID], row[tx_UsdEquivalent])
+	// Parsed once here rather than at each "is this in dollars?" check below, so every
+	// transaction type shares one exact Money-backed parse of the column instead of indexing into
+	// the raw string for both the prefix check and the value itself.
+	usdEquivalent, usdEquivalentErr := parseUsdEquivalent(row[tx_UsdEquivalent])
+
+	// Likewise converted once and shared by every entry built below, for the "uk date/time" column.
+	ukDateTime, ukDateTimeErr := convertDateTime(row, outputTZ)
+	if ukDateTimeErr != nil {
+		errorOutput += fmt.Sprintf("TX %s: Date / Time conversion error [%s]: %s\n", row[tx_ID], row[tx_DateTime], ukDateTimeErr)
+	}
+
+	// A registered LegValidator (see validator.go) takes priority over the switch below; only a
+	// Type nothing has registered for falls through to it. LockingTermDeposit, UnlockingTermDeposit,
+	// Rejected and Refunded have all migrated to validators of their own - see
+	// validator_lockingtermdeposit.go, validator_unlockingtermdeposit.go, validator_rejected.go and
+	// validator_refunded.go.
+	if validator, found := legValidators[row[tx_Type]]; found {
+		state := &MatchState{
+			Output:             output,
+			ExchangeToWithdraw: exchangeToWithdraw,
+			DepositToExchange:  depositToExchange,
+			Ledger:             ledger,
+			Gains:              gains,
+			Accounts:           accounts,
+			UsdEquivalent:      usdEquivalent,
+			UsdEquivalentErr:   usdEquivalentErr,
+			UkDateTime:         ukDateTime,
 		}
+		return errorOutput + issuesToErrorOutput(validator.Validate(row, state))
+	}
 
+	// Handle each remaining transaction Type separately
+	switch row[tx_Type] { // row[1] is the "Type"
 	case "FixedTermInterest":
 		// "FixedTermInterest" is a staking reward that happens in a "Long Term Wallet".
 		// This is handled almost identically to "Interest".
@@ -346,16 +667,19 @@ func convertSingleTransaction(row []string, output *map[string][][]string, excha
 		if !strings.HasPrefix(row[tx_Details], "approved / ") {
 			errorOutput += fmt.Sprintf("TX %s: Interest Details error: input: %s\n", row[tx_ID], row[tx_Details])
 		}
-		if row[tx_UsdEquivalent][0] != '$' {
-			errorOutput += fmt.Sprintf("TX %s: Interest not in dollars [%s]\n", row[tx_ID], row[tx_UsdEquivalent])
+		if usdEquivalentErr != nil {
+			errorOutput += fmt.Sprintf("TX %s: Interest not in dollars [%s]: %s\n", row[tx_ID], row[tx_UsdEquivalent], usdEquivalentErr)
 		}
 		// [3] is amount of nexo
 		// [6] is USD earned (but the "$" needs to be stripped)
 		// [9] is date/time in CET
 		// Output should be "nexo.io", date/time, uk date/time, nexo, (price), total, exch, £, "", "", "", "", "STAKING"
 		// Double check that the "USD equivalent" is stated in USD
-		entry := []string{"", "nexo.io", row[tx_DateTime], "", row[tx_InputAmount], "", row[tx_UsdEquivalent][1:], "", "", "", "", "", "", "STAKING"}
+		entry := []string{"", "nexo.io", row[tx_DateTime], ukDateTime, row[tx_InputAmount], "", usdEquivalent.String(), "", "", "", "", "", "", "STAKING"}
 		(*output)[row[tx_InputCurrency]] = append((*output)[row[tx_InputCurrency]], entry)
+		if interestMoney, err := ParseMoney(row[tx_InputAmount], row[tx_InputCurrency]); err == nil {
+			errorOutput += acquireLot(ledger, row, interestMoney, usdEquivalent.String())
+		}
 	case "Deposit":
 		// "Deposit" transactions need to be recorded as "REWARD"
 
@@ -364,7 +688,7 @@ func convertSingleTransaction(row []string, output *map[string][][]string, excha
 			errorOutput += fmt.Sprintf("TX %s: Deposit currency error: input: %s, output: %s\n", row[tx_ID], row[tx_InputCurrency], row[tx_InputCurrency])
 		}
 		// Input Amount and Output Amount must be identical
-		if row[tx_InputAmount] != row[tx_OutputAmount] {
+		if depositInputMoney, depositOutputMoney, err := ParseMoneyPair(row[tx_InputAmount], row[tx_InputCurrency], row[tx_OutputAmount], row[tx_OutputCurrency]); err == nil && !depositInputMoney.Equals(depositOutputMoney) {
 			// TBD fmt.Printf("TX %s: Interest currency amount error: input: %s, output: %s\n", row[tx_ID], row[tx_InputAmount], row[tx_OutputAmount])
 		}
 		// Details: "approved / Nexonomics Exchange Cash-back Promotion"
@@ -372,34 +696,62 @@ func convertSingleTransaction(row []string, output *map[string][][]string, excha
 			errorOutput += fmt.Sprintf("TX %s: Deposit Details error: input: %s\n", row[tx_ID], row[tx_Details])
 		}
 		// Double check that the "USD equivalent" is stated in USD
-		if row[tx_UsdEquivalent][0] != '$' {
-			errorOutput += fmt.Sprintf("TX %s: Deposit not in dollars [%s]\n", row[tx_ID], row[tx_UsdEquivalent])
+		if usdEquivalentErr != nil {
+			errorOutput += fmt.Sprintf("TX %s: Deposit not in dollars [%s]: %s\n", row[tx_ID], row[tx_UsdEquivalent], usdEquivalentErr)
 		}
 		// [3] is amount of nexo
 		// [6] is USD earned (but the "$" needs to be stripped)
 		// [9] is date/time in CET
 		// Output should be "nexo.io", date/time, uk date/time, nexo, (price), total, exch, £, "", "", "", "", "STAKING"
-		entry := []string{"", "nexo.io", row[tx_DateTime], "", row[tx_InputAmount], "", row[tx_UsdEquivalent][1:], "", "", "", "", "", "", "REWARD"}
+		entry := []string{"", "nexo.io", row[tx_DateTime], ukDateTime, row[tx_InputAmount], "", usdEquivalent.String(), "", "", "", "", "", "", "REWARD"}
 		(*output)[row[tx_InputCurrency]] = append((*output)[row[tx_InputCurrency]], entry)
+		if depositMoney, err := ParseMoney(row[tx_InputAmount], row[tx_InputCurrency]); err == nil {
+			errorOutput += acquireLot(ledger, row, depositMoney, usdEquivalent.String())
+		}
+	case "Withdrawal":
+		// "Withdrawal" transactions send currency off NEXO to an external address: this is
+		// TRANSFER-OUT, not a conversion, so Input/Output Currency must match.
+		if row[tx_InputCurrency] != row[tx_OutputCurrency] {
+			errorOutput += fmt.Sprintf("TX %s: Withdrawal currency error: input: %s, output: %s\n", row[tx_ID], row[tx_InputCurrency], row[tx_OutputCurrency])
+		}
+		if !strings.HasPrefix(row[tx_Details], "approved / ") {
+			errorOutput += fmt.Sprintf("TX %s: Withdrawal Details error: input: %s\n", row[tx_ID], row[tx_Details])
+		}
+		entry := []string{"", "nexo.io", row[tx_DateTime], ukDateTime, row[tx_InputAmount], "", usdEquivalent.String(), "", "", "", "", "", "", "TRANSFER-OUT"}
+		(*output)[row[tx_InputCurrency]] = append((*output)[row[tx_InputCurrency]], entry)
+		// The network sometimes takes a cut between what leaves the NEXO-side wallet (Input
+		// Amount) and what actually arrives (Output Amount); record the difference as a
+		// NetworkFee rather than silently losing it from the cost basis.
+		if withdrawalInputMoney, withdrawalOutputMoney, err := ParseMoneyPair(row[tx_InputAmount], row[tx_InputCurrency], row[tx_OutputAmount], row[tx_OutputCurrency]); err != nil {
+			errorOutput += fmt.Sprintf("TX %s: Withdrawal amount conversion error: %s\n", row[tx_ID], err)
+		} else if fee, feeErr := recordFee(ledger, gains, row, withdrawalInputMoney, withdrawalOutputMoney, NetworkFee); feeErr != "" {
+			errorOutput += feeErr
+		} else if fee != nil {
+			(*output)[row[tx_InputCurrency]] = append((*output)[row[tx_InputCurrency]], feeOutputRow(row, *fee, ukDateTime))
+		}
 	case "Exchange Cashback":
 		// Input/Output Currency must be BTC (because that is the only example so far)
 		if (row[tx_InputCurrency] != "BTC") || (row[tx_OutputCurrency] != "BTC") {
 			errorOutput += fmt.Sprintf("TX %s: Exchange currency error: input: %s, output: %s\n", row[tx_ID], row[tx_InputCurrency], row[tx_InputCurrency])
 		}
-		// Input Amount and Output Amount must be identical
-		if row[tx_InputAmount] != row[tx_OutputAmount] {
-			errorOutput += fmt.Sprintf("TX %s: Exchange currency amount error: input: %s, output: %s\n", row[tx_ID], row[tx_InputAmount], row[tx_OutputAmount])
-		}
 		// Details: "approved / 0.5% on top of your Exchange transaction"
 		if row[tx_Details] != "approved / 0.5% on top of your Exchange transaction" {
 			errorOutput += fmt.Sprintf("TX %s: Exchange Details error: input: %s\n", row[tx_ID], row[tx_Details])
 		}
 		// Double check that the "USD equivalent" is stated in USD
-		if row[tx_UsdEquivalent][0] != '$' {
-			errorOutput += fmt.Sprintf("TX %s: Exchange not in dollars [%s]\n", row[tx_ID], row[tx_UsdEquivalent])
+		if usdEquivalentErr != nil {
+			errorOutput += fmt.Sprintf("TX %s: Exchange not in dollars [%s]: %s\n", row[tx_ID], row[tx_UsdEquivalent], usdEquivalentErr)
+		}
+		// Input Amount and Output Amount are usually identical; on the rare row where the venue
+		// takes its own cut out of the cashback before crediting it, record the difference as an
+		// ExchangeFee instead of flatly rejecting the row.
+		if cashbackInputMoney, cashbackOutputMoney, err := ParseMoneyPair(row[tx_InputAmount], row[tx_InputCurrency], row[tx_OutputAmount], row[tx_OutputCurrency]); err != nil {
+			errorOutput += fmt.Sprintf("TX %s: Exchange Cashback amount conversion error: %s\n", row[tx_ID], err)
+		} else if fee, feeErr := recordFee(ledger, gains, row, cashbackInputMoney, cashbackOutputMoney, ExchangeFee); feeErr != "" {
+			errorOutput += feeErr
+		} else if fee != nil {
+			(*output)[row[tx_InputCurrency]] = append((*output)[row[tx_InputCurrency]], feeOutputRow(row, *fee, ukDateTime))
 		}
-		// TBD
-		// Nothing yet recorded because I do not know how to record it!
 	case "Exchange":
 		// "Exchange" transactions represent a purchase and need to be recorded as "BUY" if the starting token is "GBPX".
 		// Otherwise this is a sale of tokenA for tokenB.
@@ -420,7 +772,7 @@ func convertSingleTransaction(row []string, output *map[string][][]string, excha
 		startingToken := "INVALID-TOKEN-A"
 		endingToken := "INVALID-TOKEN-B"
 		amountStartingToken := row[tx_InputAmount]
-		amountUSD := "!! " + row[tx_UsdEquivalent][1:]
+		amountUSD := "!! " + usdEquivalent.String()
 		amountEndingToken := row[tx_OutputAmount]
 		tokens := strings.SplitN(row[tx_InputCurrency], "/", 2)
 		if len(tokens) == 2 {
@@ -453,36 +805,62 @@ func convertSingleTransaction(row []string, output *map[string][][]string, excha
 			endingToken = row[tx_OutputCurrency]
 			amountStartingToken = row[tx_InputAmount]
 			amountEndingToken = row[tx_OutputAmount]
-			amountUSD = row[tx_UsdEquivalent][1:]
+			amountUSD = usdEquivalent.String()
 		} else {
 			errorOutput += fmt.Sprintf("TX %s: Exchange Input Currency format error: %s\n", row[tx_ID], row[tx_InputCurrency])
 		}
 
 		// Double check that the "USD equivalent" is stated in USD
-		if row[tx_UsdEquivalent][0] != '$' {
-			errorOutput += fmt.Sprintf("TX %s: Deposit not in dollars [%s]\n", row[tx_ID], row[tx_UsdEquivalent])
+		if usdEquivalentErr != nil {
+			errorOutput += fmt.Sprintf("TX %s: Deposit not in dollars [%s]: %s\n", row[tx_ID], row[tx_UsdEquivalent], usdEquivalentErr)
 		}
 
+		fairValueUSD := strings.TrimPrefix(amountUSD, "!! ")
+
 		if startingToken == "GBPX" {
 			// This is a BUY of the OutputCurrency
 			notes := "Purchased " + row[tx_OutputCurrency] + " using £GBP"
-			entry := []string{"", "nexo.io", row[tx_DateTime], "", amountEndingToken, "", amountUSD, "", amountStartingToken[1:], "", "", "", "", "BUY", "", "", "", "", "", "", "", "", "", "", notes}
+			entry := []string{"", "nexo.io", row[tx_DateTime], ukDateTime, amountEndingToken, "", amountUSD, "", amountStartingToken[1:], "", "", "", "", "BUY", "", "", "", "", "", "", "", "", "", "", notes}
 			(*output)[endingToken] = append((*output)[endingToken], entry)
+			if boughtMoney, err := ParseMoney(amountEndingToken, endingToken); err == nil {
+				errorOutput += acquireLot(ledger, row, boughtMoney, fairValueUSD)
+			}
 		} else {
 			if !allowedExchangeCurrency[startingToken] {
 				errorOutput += fmt.Sprintf("TX %s: Exchange starting currency error: %s\n", row[tx_ID], row[tx_OutputCurrency])
 			}
 			notes := "Exchanged " + startingToken + " for " + endingToken
 			// This is a SELL of the startingToken ...
-			entry := []string{"", "nexo.io", row[tx_DateTime], "", amountStartingToken, "", amountUSD, "", "", "", "", "", "", "SELL", "", "", "", "", "", "", "", "", "", "", notes}
+			entry := []string{"", "nexo.io", row[tx_DateTime], ukDateTime, amountStartingToken, "", amountUSD, "", "", "", "", "", "", "SELL", "", "", "", "", "", "", "", "", "", "", notes}
 			(*output)[startingToken] = append((*output)[startingToken], entry)
 			// ... and a BUY of the endingToken
-			entry = []string{"", "nexo.io", row[tx_DateTime], "", amountEndingToken, "", amountUSD, "", "", "", "", "", "", "BUY", "", "", "", "", "", "", "", "", "", "", notes}
+			entry = []string{"", "nexo.io", row[tx_DateTime], ukDateTime, amountEndingToken, "", amountUSD, "", "", "", "", "", "", "BUY", "", "", "", "", "", "", "", "", "", "", notes}
 			(*output)[endingToken] = append((*output)[endingToken], entry)
 
+			// The pre-April-2022 format (len(tokens) == 2) never records how much of the
+			// starting token was actually sold - only the ending token's amount and the
+			// trade's USD-equivalent value (the same ambiguity amountStartingToken's "!!"
+			// prefix already flags for manual review above). As a best-effort approximation
+			// for cost-basis purposes we assume parity and close the starting-token lots
+			// using the ending token's numeric amount; the new format needs no such
+			// approximation since amountStartingToken is the real sold quantity there.
+			qtySoldStr := amountStartingToken
+			if len(tokens) == 2 {
+				qtySoldStr = amountEndingToken
+			}
+			if qtySold, err := ParseMoney(qtySoldStr, startingToken); err == nil {
+				if exchangedAt, err := time.Parse("2006-01-02 15:04:05", row[tx_DateTime]); err == nil {
+					if costGBP, err := usdToGBP(fairValueUSD, exchangedAt); err == nil {
+						errorOutput += disposeLot(ledger, gains, row, qtySold, MustNew(costGBP, MustCurrSymbol("GBP")))
+					}
+				}
+			}
+			if boughtMoney, err := ParseMoney(amountEndingToken, endingToken); err == nil {
+				errorOutput += acquireLot(ledger, row, boughtMoney, fairValueUSD)
+			}
 		}
 		// Output should be "nexo.io", date/time, uk date/time, nexo, (price), total, exch, £, "", "", "", "", "STAKING"
-		// entry := []string{"", "nexo.io", row[tx_DateTime], "", row[tx_InputAmount], "", row[tx_UsdEquivalent][1:], "", "", "", "", "", "", "BUY"}
+		// entry := []string{"", "nexo.io", row[tx_DateTime], "", row[tx_InputAmount], "", usdEquivalent.String(), "", "", "", "", "", "", "BUY"}
 		// TBD - list once things are separated by currency
 		//// output = append(output, entry)
 		//// fmt.Printf("NOT outputting %s: %s\n", row[1], entry)
@@ -490,42 +868,46 @@ func convertSingleTransaction(row []string, output *map[string][][]string, excha
 		// ExchangeToWithDraw represents the first of two operations that are involved in removing funds from NEXO.
 		// This transaction records a 1:1 converion of GBPX to GBP.
 		// There should be a correspodning (later) matching WithdrawExchanged that records the actual removal of the funds.
-		// For now it is assumed that the corresponding WithdrawExchanged records occur in the same order as the corresponding
-		// ExchangeToWithdraw records so that all that is needed to match is a simple FIFO.
+		// It does not need to arrive in the same order this row was queued in: matchOrSplitPendingLeg
+		// (see legmatch.go) matches by exact amount and a time window first, and only assumes queue
+		// order as a fallback for multi-leg settlements, or if -strict-fifo was given.
 
 		// "Input Currency" will always be GBPX and "Output Currency" will always be GBP
 		if (row[tx_InputCurrency] != "GBPX") || (row[tx_OutputCurrency] != "GBP") {
 			errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw does not use GBP [%s,%s]\n", row[tx_ID], row[tx_InputCurrency], row[tx_OutputCurrency])
 		}
-		// Input Amount and Output Amount must be identical in absolute value the former is negative and the latter is positive.
-		if row[tx_InputAmount][0] != '-' || row[tx_InputAmount][1:] != row[tx_OutputAmount] {
-			valuesDiffer := true
-			if row[tx_InputCurrency] == "GBPX" {
-				inputAmountFloat, err := strconv.ParseFloat(row[tx_InputAmount], 64)
-				if err != nil {
-					errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw Input Amount conversion error: %s, issue: %s\n", row[tx_ID], row[tx_InputAmount], err)
-				}
-				outputAmountFloat, err := strconv.ParseFloat(row[tx_OutputAmount], 64)
-				if err != nil {
-					errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw Output Amount conversion error: %s, issue: %s\n", row[tx_ID], row[tx_OutputAmount], err)
-				}
-				if inputAmountFloat == -outputAmountFloat {
-					valuesDiffer = false
-				}
-			}
-			if valuesDiffer {
-				errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw currency amount error: input: %s, output: %s\n", row[tx_ID], row[tx_InputAmount], row[tx_OutputAmount])
-			}
+		// Input Amount and Output Amount must be identical in absolute value: the former is negative and the latter is positive.
+		exchangeInputMoney, inputErr := ParseMoney(row[tx_InputAmount], row[tx_InputCurrency])
+		exchangeOutputMoney, outputErr := ParseMoney(row[tx_OutputAmount], row[tx_OutputCurrency])
+		if inputErr != nil {
+			errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw Input Amount conversion error: %s, issue: %s\n", row[tx_ID], row[tx_InputAmount], inputErr)
+		}
+		if outputErr != nil {
+			errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw Output Amount conversion error: %s, issue: %s\n", row[tx_ID], row[tx_OutputAmount], outputErr)
+		}
+		// GBPX is pegged 1:1 to GBP, so the minor-unit magnitudes (not the CurrSymbol) must match.
+		if inputErr == nil && outputErr == nil && exchangeInputMoney.Negate().Amount() != exchangeOutputMoney.Amount() {
+			errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw currency amount error: input: %s, output: %s\n", row[tx_ID], row[tx_InputAmount], row[tx_OutputAmount])
 		}
 		// [6] will be the dollar equivalent (just check that it starts '$)
-		if row[tx_UsdEquivalent][0] != '$' {
-			errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw dollar equivalent invalid [%s]\n", row[tx_ID], row[tx_UsdEquivalent])
+		if usdEquivalentErr != nil {
+			errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw dollar equivalent invalid [%s]: %s\n", row[tx_ID], row[tx_UsdEquivalent], usdEquivalentErr)
 		}
 		// [7] will be "approved / GBPX to GBP"
 		if row[tx_Details] != "approved / GBPX to GBP" {
 			errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw details invalid [%s]\n", row[tx_ID], row[tx_Details])
 		}
-		*exchangeToWithdraw = append(*exchangeToWithdraw, row) // Add the record to the FIFO
+		// This is where GBPX is actually given up (WithdrawExchanged only moves the resulting
+		// GBP out of Nexo), so it's the disposal event that realises a cost-basis gain, not
+		// WithdrawExchanged.
+		if inputErr == nil && outputErr == nil {
+			errorOutput += disposeLot(ledger, gains, row, exchangeInputMoney.Negate(), exchangeOutputMoney)
+		}
+		// Queued in GBP (exchangeOutputMoney), not GBPX (exchangeInputMoney): WithdrawExchanged's
+		// own Input Amount is GBP, and matchOrSplitPendingLeg/splitFIFOHead compare queued and
+		// requested amounts directly, so the two legs have to speak the same currency and sign -
+		// the same convention depositToExchange/ExchangeDepositedOn already use.
+		*exchangeToWithdraw = append(*exchangeToWithdraw, queuedRecord{row: row, amount: exchangeOutputMoney, usdEquivalent: usdEquivalent}) // Add the record to the FIFO
 	case "WithdrawExchanged":
 		// WithdrawExchanged represents the second of two operations that are involved in removing funds from NEXO.
 		// This transaction records the actual withdrawal of GBP from NEXO.
@@ -542,48 +924,57 @@ func convertSingleTransaction(row []string, output *map[string][][]string, excha
 		//if (row[tx_InputAmount] >= -22) || (row[tx_InputAmount] != -row[tx_OutputAmount]) {
 		//	fmt.Printf("TX %s: ExchangeToWithdraw amount inconsistent [%s,%s]\n", row[tx_ID], row[tx_InputAmount], row[tx_OutputAmount])
 		//}
-		if row[tx_UsdEquivalent][0] != '$' {
-			errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw dollar equivalent invalid [%s]\n", row[tx_ID], row[tx_UsdEquivalent])
+		if usdEquivalentErr != nil {
+			errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw dollar equivalent invalid [%s]: %s\n", row[tx_ID], row[tx_UsdEquivalent], usdEquivalentErr)
 		}
 		if row[tx_Details] != "approved / GBP withdrawal" {
 			errorOutput += fmt.Sprintf("TX %s: ExchangeToWithdraw details invalid [%s]\n", row[tx_ID], row[tx_Details])
 		}
-		if len(*exchangeToWithdraw) < 0 {
-			errorOutput += fmt.Sprintf("TX %s: WithdrawExchanged with no matching ExchangeToWithdraw\n", row[tx_ID])
+		// A single ExchangeToWithdraw is sometimes covered by more than one WithdrawExchanged
+		// (or vice versa), so the queued legs are matched against this row's amount via
+		// matchOrSplitPendingLeg rather than requiring an exact one-to-one pop.
+		// The £/$ exchange rate may drift slightly between the ExchangeToWithdraw and the
+		// WithdrawExchanged, so "USD Equivalent" is compared within ScaleTolerancePercent, not exactly.
+		withdrawMoney, err := ParseMoney(row[tx_InputAmount], row[tx_InputCurrency])
+		if err != nil {
+			errorOutput += fmt.Sprintf("TX %s: WithdrawExchanged Input Amount invalid [%s]: %s\n", row[tx_ID], row[tx_InputAmount], err)
 		} else {
-			matchingExchangeToWithdraw := (*exchangeToWithdraw)[0] // Get the presumed matching record
-			(*exchangeToWithdraw) = (*exchangeToWithdraw)[1:]      // Remove that record from the FIFO
-			// Both this record and the presumed matching ExchangeToWithdraw have been checked for validity.
-			// To check for a match all that is needed is that "Input Amount" [3] "Output Currency" [4]
-			// Note that "USD Equivalent" may not match presumably because the £/$ exchange rate may drift slightly
-			// between the times when the ExchangeToWithdraw and the WithdrawExchanged happen.
-			if (row[tx_InputAmount] != matchingExchangeToWithdraw[tx_InputAmount]) || (row[tx_OutputCurrency] != matchingExchangeToWithdraw[tx_OutputCurrency]) {
-				errorOutput += fmt.Sprintf("TX %s: WithdrawExchanged finds non-matching ExchangeToWithdraw [TX: %s]\n", row[tx_ID], matchingExchangeToWithdraw[tx_ID])
+			withdrawnAt, withdrawnAtErr := time.Parse("2006-01-02 15:04:05", row[tx_DateTime])
+			if queuedUsd, found := matchPendingLegUsdEquivalent(*exchangeToWithdraw, withdrawMoney, withdrawnAt, withdrawnAtErr == nil); found && usdEquivalentErr == nil {
+				if within, tolErr := queuedUsd.WithinTolerancePercent(usdEquivalent, ScaleTolerancePercent(usdEquivalent.Code())); tolErr == nil && !within {
+					errorOutput += fmt.Sprintf("TX %s: WithdrawExchanged USD equivalent drift: ExchangeToWithdraw recorded %s, this row recorded %s\n", row[tx_ID], queuedUsd.String(), usdEquivalent.String())
+				}
+			}
+			if err := matchOrSplitPendingLeg(exchangeToWithdraw, withdrawMoney, withdrawnAt, withdrawnAtErr == nil, row[tx_ID]); err != nil {
+				errorOutput += fmt.Sprintf("TX %s: WithdrawExchanged finds no matching ExchangeToWithdraw: %s\n", row[tx_ID], err)
 			}
 		}
 		// Nothing needs to be recorded for a removal of fiat from NEXO
 	case "DepositToExchange":
 		// DepositToExchange represents the first of two operations that are involved in adding funds to NEXO.
 		// There should be a correspodning (later) matching ExchangeDepositedOn that records the actual deposit of the funds.
-		// For now it is assumed that the corresponding WithdrawExchanged records occur in the same order as the corresponding
-		// ExchangeToWithdraw records so that all that is needed to match is a simple FIFO.
+		// It does not need to arrive in the same order this row was queued in: matchOrSplitPendingLeg
+		// (see legmatch.go) matches by exact amount and a time window first, and only assumes queue
+		// order as a fallback for multi-leg settlements, or if -strict-fifo was given.
 		// "Input Currency" will always be GBPX and "Output Currency" will always be GBP
 		if (row[tx_InputCurrency] != "GBP") || (row[tx_OutputCurrency] != "GBPX") {
 			errorOutput += fmt.Sprintf("TX %s: DepositToExchange does not use GBP [%s,%s]\n", row[tx_ID], row[tx_InputCurrency], row[tx_OutputCurrency])
 		}
-		// Input Amount and Output Amount must be identical.
-		if row[tx_InputAmount] != row[tx_OutputAmount] {
+		// Input Amount and Output Amount must be identical (GBP is pegged 1:1 to GBPX).
+		depositInputMoney, inputErr := ParseMoney(row[tx_InputAmount], row[tx_InputCurrency])
+		depositOutputMoney, outputErr := ParseMoney(row[tx_OutputAmount], row[tx_OutputCurrency])
+		if inputErr != nil || outputErr != nil || depositInputMoney.Amount() != depositOutputMoney.Amount() {
 			errorOutput += fmt.Sprintf("TX %s: DepositToExchange currency amount error: input: %s, output: %s\n", row[tx_ID], row[tx_InputAmount], row[tx_OutputAmount])
 		}
 		// "USD Equivalent" will be the dollar equivalent (just check that it starts '$)
-		if row[tx_UsdEquivalent][0] != '$' {
-			errorOutput += fmt.Sprintf("TX %s: DepositToExchange dollar equivalent invalid [%s]\n", row[tx_ID], row[tx_UsdEquivalent])
+		if usdEquivalentErr != nil {
+			errorOutput += fmt.Sprintf("TX %s: DepositToExchange dollar equivalent invalid [%s]: %s\n", row[tx_ID], row[tx_UsdEquivalent], usdEquivalentErr)
 		}
 		// "Details"" will be "approved / GBP Top Up"
 		if row[tx_Details] != "approved / GBP Top Up" {
 			errorOutput += fmt.Sprintf("TX %s: DepositToExchange details invalid [%s]\n", row[tx_ID], row[tx_Details])
 		}
-		*depositToExchange = append(*depositToExchange, row) // Add the record to the FIFO
+		*depositToExchange = append(*depositToExchange, queuedRecord{row: row, amount: depositInputMoney, usdEquivalent: usdEquivalent}) // Add the record to the FIFO
 	case "ExchangeDepositedOn":
 		// ExchangeDepositedOn represents the second of two operations that are involved in depositing funds on NEXO.
 		// This transaction records the actual deposit of GBP on NEXO.
@@ -600,24 +991,34 @@ func convertSingleTransaction(row []string, output *map[string][][]string, excha
 		//if (row[tx_InputAmount] >= -22) || (row[tx_InputAmount] != -row[tx_OutputAmount]) {
 		//	fmt.Printf("TX %s: ExchangeDepositedOn amount inconsistent [%s,%s]\n", row[tx_ID], row[tx_InputAmount], row[tx_OutputAmount])
 		//}
-		if row[tx_UsdEquivalent][0] != '$' {
-			errorOutput += fmt.Sprintf("TX %s: ExchangeDepositedOn dollar equivalent invalid [%s]\n", row[tx_ID], row[tx_UsdEquivalent])
+		if usdEquivalentErr != nil {
+			errorOutput += fmt.Sprintf("TX %s: ExchangeDepositedOn dollar equivalent invalid [%s]: %s\n", row[tx_ID], row[tx_UsdEquivalent], usdEquivalentErr)
 		}
 		if row[tx_Details] != "approved / GBP to GBPX" {
 			errorOutput += fmt.Sprintf("TX %s: ExchangeDepositedOn details invalid [%s]\n", row[tx_ID], row[tx_Details])
 		}
-		if len(*exchangeToWithdraw) <= 0 {
-			errorOutput += fmt.Sprintf("TX %s: WithdrawExchanged with no matching ExchangeDepositedOn\n", row[tx_ID])
+		// A single DepositToExchange is sometimes covered by more than one ExchangeDepositedOn
+		// (or vice versa), so the queued legs are matched against this row's amount via
+		// matchOrSplitPendingLeg rather than requiring an exact one-to-one pop.
+		// The £/$ exchange rate may drift slightly between the DepositToExchange and the
+		// ExchangeDepositedOn, so "USD Equivalent" is compared within ScaleTolerancePercent, not exactly.
+		depositedMoney, err := ParseMoney(row[tx_InputAmount], row[tx_InputCurrency])
+		if err != nil {
+			errorOutput += fmt.Sprintf("TX %s: ExchangeDepositedOn Input Amount invalid [%s]: %s\n", row[tx_ID], row[tx_InputAmount], err)
 		} else {
-			matchingDepositToExchange := (*depositToExchange)[0] // Get the presumed matching record
-			(*depositToExchange) = (*depositToExchange)[1:]      // Remove that record from the FIFO
-			// Both this record and the presumed matching DepositToExchange have been checked for validity.
-			// To check for a match all that is needed is that "Input Amount" and "Output Currency" match
-			if (row[tx_InputAmount] != matchingDepositToExchange[tx_InputAmount]) || (row[tx_OutputCurrency] != matchingDepositToExchange[tx_OutputCurrency]) {
-				errorOutput += fmt.Sprintf("TX %s: ExchangeDepositedOn finds non-matching ExchangeToWithdraw [TX: %s]\n", row[tx_ID], matchingDepositToExchange[tx_ID])
+			depositedAt, depositedAtErr := time.Parse("2006-01-02 15:04:05", row[tx_DateTime])
+			if queuedUsd, found := matchPendingLegUsdEquivalent(*depositToExchange, depositedMoney, depositedAt, depositedAtErr == nil); found && usdEquivalentErr == nil {
+				if within, tolErr := queuedUsd.WithinTolerancePercent(usdEquivalent, ScaleTolerancePercent(usdEquivalent.Code())); tolErr == nil && !within {
+					errorOutput += fmt.Sprintf("TX %s: ExchangeDepositedOn USD equivalent drift: DepositToExchange recorded %s, this row recorded %s\n", row[tx_ID], queuedUsd.String(), usdEquivalent.String())
+				}
 			}
-			// Note that "USD Equivalent" may not match presumably because the £/$ exchange rate may drift slightly
-			// between the times when the DepositToExchange and the ExchangeDepositedOn happen.
+			if err := matchOrSplitPendingLeg(depositToExchange, depositedMoney, depositedAt, depositedAtErr == nil, row[tx_ID]); err != nil {
+				errorOutput += fmt.Sprintf("TX %s: ExchangeDepositedOn finds no matching DepositToExchange: %s\n", row[tx_ID], err)
+			}
+		}
+		// This is where GBPX is actually acquired; it is later disposed of by ExchangeToWithdraw.
+		if gbpxMoney, err := ParseMoney(row[tx_OutputAmount], row[tx_OutputCurrency]); err == nil {
+			errorOutput += acquireLot(ledger, row, gbpxMoney, usdEquivalent.String())
 		}
 		// Nothing needs to be recorded for a deposit of fiat into NEXO
 	default:
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/AntonioCarlini/data-processing/nexo/costbasis"
 )
 
 const test_id = "9876-5432-10"
@@ -23,26 +27,26 @@ type OutsandingLoanTestData struct {
 // This test verifies that if a new transaction type appears, it will be flagged
 func TestUnknownTransactionType(t *testing.T) {
 	outputError := ""
-	output := make(map[string][][]string, 0)  // map of currency => array of strings
-	exchangeToWithdraw := make([][]string, 0) // FIFO queue or records
-	depositToExchange := make([][]string, 0)  // FIFO queue or records
+	output := make(map[string][][]string, 0)      // map of currency => array of strings
+	exchangeToWithdraw := make([]queuedRecord, 0) // FIFO queue or records
+	depositToExchange := make([]queuedRecord, 0)  // FIFO queue or records
 
 	testName := "inject unknown transaction"
 	testRow := buildStandardTestVector()
 	testRow[tx_Type] = "An Unexpected Transaction"
 
 	// Start by testing a set of data that should be OK
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// output, exch2Withdraw and dep2Exchange should always be empty
 	if len(output) != 0 {
 		t.Errorf("%s/%s: output not empty: got %q", testRow[tx_Type], testName, output)
 	}
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", testRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", testRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", testRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", testRow[tx_Type], testName, depositToExchange)
 	}
 
 	// An error MUST be reported, so lack of error text is problematic
@@ -55,9 +59,9 @@ func TestUnknownTransactionType(t *testing.T) {
 func TestLockingTermDeposit(t *testing.T) {
 	testName := ""
 	outputError := ""
-	output := make(map[string][][]string, 0)  // map of currency => array of strings
-	exchangeToWithdraw := make([][]string, 0) // FIFO queue or records
-	depositToExchange := make([][]string, 0)  // FIFO queue or records
+	output := make(map[string][][]string, 0)      // map of currency => array of strings
+	exchangeToWithdraw := make([]queuedRecord, 0) // FIFO queue or records
+	depositToExchange := make([]queuedRecord, 0)  // FIFO queue or records
 
 	validTestRow := buildStandardTestVector()
 	validTestRow[tx_Type] = "LockingTermDeposit"
@@ -67,17 +71,17 @@ func TestLockingTermDeposit(t *testing.T) {
 
 	// Start by testing a set of data that should be OK
 	testName = "valid data"
-	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// output, exch2Withdraw and dep2Exchange should always be empty
 	if len(output) != 0 {
 		t.Errorf("%s/%s: output not empty: got %q", validTestRow[tx_Type], testName, output)
 	}
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", validTestRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", validTestRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", validTestRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", validTestRow[tx_Type], testName, depositToExchange)
 	}
 
 	// No error should be reported
@@ -91,17 +95,17 @@ func TestLockingTermDeposit(t *testing.T) {
 	copy(testRow, validTestRow)
 
 	testRow[tx_InputAmount] = "9.99"
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// output, exch2Withdraw and dep2Exchange should always be empty
 	if len(output) != 0 {
 		t.Errorf("%s/%s: output not empty: got %q", testRow[tx_Type], testName, output)
 	}
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", testRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", testRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", testRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", testRow[tx_Type], testName, depositToExchange)
 	}
 
 	// An error should be reported
@@ -114,9 +118,9 @@ func TestLockingTermDeposit(t *testing.T) {
 func TestUnlockingTermDeposit(t *testing.T) {
 	testName := ""
 	outputError := ""
-	output := make(map[string][][]string, 0)  // map of currency => array of strings
-	exchangeToWithdraw := make([][]string, 0) // FIFO queue or records
-	depositToExchange := make([][]string, 0)  // FIFO queue or records
+	output := make(map[string][][]string, 0)      // map of currency => array of strings
+	exchangeToWithdraw := make([]queuedRecord, 0) // FIFO queue or records
+	depositToExchange := make([]queuedRecord, 0)  // FIFO queue or records
 
 	validTestRow := buildStandardTestVector()
 	validTestRow[tx_Type] = "UnlockingTermDeposit"
@@ -126,17 +130,17 @@ func TestUnlockingTermDeposit(t *testing.T) {
 
 	// Start by testing a set of data that should be OK
 	testName = "valid data"
-	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// output, exch2Withdraw and dep2Exchange should always be empty
 	if len(output) != 0 {
 		t.Errorf("%s/%s: output not empty: got %q", validTestRow[tx_Type], testName, output)
 	}
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", validTestRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", validTestRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", validTestRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", validTestRow[tx_Type], testName, depositToExchange)
 	}
 
 	// No error should be reported
@@ -150,17 +154,17 @@ func TestUnlockingTermDeposit(t *testing.T) {
 	copy(testRow, validTestRow)
 	testRow[tx_InputAmount] = "8.76"
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// output, exch2Withdraw and dep2Exchange should always be empty
 	if len(output) != 0 {
 		t.Errorf("%s/%s: output not empty: got %q", testRow[tx_Type], testName, output)
 	}
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", testRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", testRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", testRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", testRow[tx_Type], testName, depositToExchange)
 	}
 
 	// An error should be reported
@@ -173,9 +177,9 @@ func TestUnlockingTermDeposit(t *testing.T) {
 func TestDeposit(t *testing.T) {
 	testName := ""
 	outputError := ""
-	output := make(map[string][][]string, 0)  // map of currency => array of strings
-	exchangeToWithdraw := make([][]string, 0) // FIFO queue or records
-	depositToExchange := make([][]string, 0)  // FIFO queue or records
+	output := make(map[string][][]string, 0)      // map of currency => array of strings
+	exchangeToWithdraw := make([]queuedRecord, 0) // FIFO queue or records
+	depositToExchange := make([]queuedRecord, 0)  // FIFO queue or records
 
 	validTestRow := buildStandardTestVector()
 	validTestRow[tx_Type] = "Deposit"
@@ -185,7 +189,7 @@ func TestDeposit(t *testing.T) {
 
 	// Start by testing a set of data that should be OK
 	testName = "valid data"
-	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// The output map should have one key (NEXO) and one entry under that key
 	if len(output) != 1 {
@@ -198,10 +202,10 @@ func TestDeposit(t *testing.T) {
 
 	// output, exch2Withdraw and dep2Exchange should always be empty
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", validTestRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", validTestRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", validTestRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", validTestRow[tx_Type], testName, depositToExchange)
 	}
 
 	// No error should be reported
@@ -215,17 +219,17 @@ func TestDeposit(t *testing.T) {
 	copy(testRow, validTestRow)
 	testRow[tx_InputAmount] = "8.76"
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// output, exch2Withdraw and dep2Exchange should always be empty
 	if len(output) != 1 {
 		t.Errorf("%s/%s: output not empty: got %q", testRow[tx_Type], testName, output)
 	}
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", testRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", testRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", testRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", testRow[tx_Type], testName, depositToExchange)
 	}
 
 	// An error should be reported
@@ -239,9 +243,9 @@ func TestDeposit(t *testing.T) {
 func TestExchangeToWithdraw(t *testing.T) {
 	testName := ""
 	outputError := "outputError"
-	output := make(map[string][][]string, 0)  // map of currency => array of strings
-	exchangeToWithdraw := make([][]string, 0) // FIFO queue or records
-	depositToExchange := make([][]string, 0)  // FIFO queue or records
+	output := make(map[string][][]string, 0)      // map of currency => array of strings
+	exchangeToWithdraw := make([]queuedRecord, 0) // FIFO queue or records
+	depositToExchange := make([]queuedRecord, 0)  // FIFO queue or records
 
 	validTestRow := buildStandardTestVector()
 	validTestRow[tx_Type] = "ExchangeToWithdraw"
@@ -253,7 +257,7 @@ func TestExchangeToWithdraw(t *testing.T) {
 
 	// Start by testing a set of data that should be OK
 	testName = "valid data"
-	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// output should always be empty
 	if len(output) != 0 {
@@ -263,15 +267,15 @@ func TestExchangeToWithdraw(t *testing.T) {
 	if len(exchangeToWithdraw) == 0 {
 		t.Errorf("%s/%s: exchangeToWithdraw unexpectedly emptyempty", validTestRow[tx_Type], testName)
 	} else if len(exchangeToWithdraw) != 1 {
-		t.Errorf("%s/%s: exchangeToWithdraw has too many entries: got %q, expected %q", validTestRow[tx_Type], testName, exchangeToWithdraw, validTestRow)
+		t.Errorf("%s/%s: exchangeToWithdraw has too many entries: got %v, expected %q", validTestRow[tx_Type], testName, exchangeToWithdraw, validTestRow)
 	} else {
-		if !testSlicesEqual(exchangeToWithdraw[0], validTestRow) {
-			t.Errorf("%s/%s: exchangeToWithdraw has bad contents: got %q, expected %q", validTestRow[tx_Type], testName, exchangeToWithdraw, validTestRow)
+		if !testSlicesEqual(exchangeToWithdraw[0].row, validTestRow) {
+			t.Errorf("%s/%s: exchangeToWithdraw has bad contents: got %v, expected %q", validTestRow[tx_Type], testName, exchangeToWithdraw, validTestRow)
 		}
 	}
 	// depositToExchange should always be empty
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", validTestRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", validTestRow[tx_Type], testName, depositToExchange)
 	}
 
 	// No error should be reported
@@ -285,7 +289,7 @@ func TestExchangeToWithdraw(t *testing.T) {
 	copy(testRow, validTestRow)
 	testRow[tx_InputAmount] = "8.76"
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// An error should be reported
 	if len(outputError) == 0 {
@@ -297,7 +301,7 @@ func TestExchangeToWithdraw(t *testing.T) {
 	copy(testRow, validTestRow)
 	testRow[tx_InputCurrency] = "BAD-CURRENCY"
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// An error should be reported
 	if len(outputError) == 0 {
@@ -309,7 +313,7 @@ func TestExchangeToWithdraw(t *testing.T) {
 	copy(testRow, validTestRow)
 	testRow[tx_OutputCurrency] = "BAD-CURRENCY"
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// An error should be reported
 	if len(outputError) == 0 {
@@ -317,84 +321,156 @@ func TestExchangeToWithdraw(t *testing.T) {
 	}
 }
 
-// These tests verify that a "WithdrawExchanged" is (broadly) handled correctly
+// These tests verify that a "WithdrawExchanged" is (broadly) handled correctly, including its
+// FIFO matching (and splitting) against queued ExchangeToWithdraw records. Most scenarios are
+// expressed with the testgen DSL via RunScenario, since they are really about the shape of the
+// transaction sequence rather than any one row's fields.
 func TestWithdrawExchanged(t *testing.T) {
-	testName := ""
-	outputError := ""
-	output := make(map[string][][]string, 0) // map of currency => array of strings
-	depositToExchange := make([][]string, 0) // FIFO queue or records
-
-	exchangeToWithdrawRow := buildStandardTestVector()
-	exchangeToWithdrawRow[tx_Type] = "ExchangeToWithdraw"
-	exchangeToWithdrawRow[tx_InputAmount] = "9.99"
-	exchangeToWithdrawRow[tx_InputCurrency] = "GBP"
-	exchangeToWithdrawRow[tx_OutputCurrency] = "GBP"
-	exchangeToWithdraw := [][]string{exchangeToWithdrawRow}
-
-	validTestRow := buildStandardTestVector()
-	validTestRow[tx_Type] = "WithdrawExchanged"
-	validTestRow[tx_InputAmount] = "9.99"
-	validTestRow[tx_InputCurrency] = "GBP"
-	validTestRow[tx_OutputAmount] = "9.99"
-	validTestRow[tx_OutputCurrency] = "GBP"
-	validTestRow[tx_Details] = "approved / GBP withdrawal"
-
-	// Start by testing a set of data that should be OK
-	testName = "valid data"
-	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange)
-
-	// output, exch2Withdraw and dep2Exchange should always be empty
+	// Valid data: a single ExchangeToWithdraw matched 1:1 by a WithdrawExchanged.
+	output, exchangeToWithdraw, depositToExchange, errorText := RunScenario(t, `
+		ExchangeToWithdraw GBPX>GBP 9.99
+		WithdrawExchanged  GBP      9.99
+	`)
 	if len(output) != 0 {
-		t.Errorf("%s/%s: output not empty: got %q", validTestRow[tx_Type], testName, output)
+		t.Errorf("valid data: output not empty: got %q", output)
 	}
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw should be empty: got %q", validTestRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("valid data: exchangeToWithdraw should be empty: got %v", exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", validTestRow[tx_Type], testName, depositToExchange)
+		t.Errorf("valid data: depositToExchange not empty: got %v", depositToExchange)
 	}
-
-	// No error should be reported
-	if len(outputError) != 0 {
-		t.Errorf("%s/%s: unexpected error text: %q", validTestRow[tx_Type], testName, outputError)
+	if errorText != "" {
+		t.Errorf("valid data: unexpected error text: %q", errorText)
 	}
 
-	// Check that a mismatched input amount with ExchangeToWithdraw is caught
-	testName = "mismatched input amount"
-	testRow := make([]string, len(validTestRow))
-	copy(testRow, validTestRow)
-	testRow[tx_InputAmount] = "8.76"
-	exchangeToWithdraw = [][]string{exchangeToWithdrawRow}
+	// Queue head too big: a WithdrawExchanged smaller than the queued ExchangeToWithdraw splits
+	// the queue head rather than erroring: the consumed part is matched and a residual record
+	// (marked "-split-N") is left at the head of the queue.
+	_, exchangeToWithdraw, _, errorText = RunScenario(t, `
+		ExchangeToWithdraw GBPX>GBP 9.99
+		WithdrawExchanged  GBP      8.76
+	`)
+	if errorText != "" {
+		t.Errorf("queue head too big: unexpected error text: %q", errorText)
+	}
+	residualAmount, _ := ParseMoney("1.23", "GBP")
+	if len(exchangeToWithdraw) != 1 || !exchangeToWithdraw[0].amount.Equals(residualAmount) {
+		t.Errorf("queue head too big: expected a single residual record of %s, got %v", residualAmount, exchangeToWithdraw)
+	}
+	if exchangeToWithdraw[0].row[tx_ID] != "TX-1-split-1" {
+		t.Errorf("queue head too big: expected residual TX ID %q, got %q", "TX-1-split-1", exchangeToWithdraw[0].row[tx_ID])
+	}
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	// Request spans multiple queue heads: a WithdrawExchanged can be satisfied by draining more
+	// than one queued ExchangeToWithdraw record.
+	_, exchangeToWithdraw, _, errorText = RunScenario(t, `
+		ExchangeToWithdraw GBPX>GBP 5.00
+		ExchangeToWithdraw GBPX>GBP 4.99
+		WithdrawExchanged  GBP      9.99
+	`)
+	if errorText != "" {
+		t.Errorf("request spans multiple queue heads: unexpected error text: %q", errorText)
+	}
+	if len(exchangeToWithdraw) != 0 {
+		t.Errorf("request spans multiple queue heads: expected the queue to be drained, got %v", exchangeToWithdraw)
+	}
 
-	// An error should be reported
-	if len(outputError) == 0 {
-		t.Errorf("%s/%s: unexpected error text: %q", testRow[tx_Type], testName, outputError)
+	// Request drains the queue: a WithdrawExchanged bigger than the entire queue is reported as
+	// an underflow.
+	_, _, _, errorText = RunScenario(t, `
+		ExchangeToWithdraw GBPX>GBP 5.00
+		WithdrawExchanged  GBP      9.99
+	`)
+	if errorText == "" {
+		t.Errorf("request drains the queue: expected an error, got none")
 	}
 
-	// Check that a mismatched output currency with ExchangeToWithdraw is caught
-	testName = "mismatched input amount"
-	testRow = make([]string, len(validTestRow))
-	copy(testRow, validTestRow)
+	// Mismatched output currency: the DSL always uses GBP on both sides of a WithdrawExchanged,
+	// so this row-validity check (independent of queue matching) is still built by hand.
+	exchangeToWithdrawRow := buildStandardTestVector()
+	exchangeToWithdrawRow[tx_Type] = "ExchangeToWithdraw"
+	exchangeToWithdrawRow[tx_InputAmount] = "9.99"
+	exchangeToWithdrawRow[tx_InputCurrency] = "GBP"
+	exchangeToWithdrawRow[tx_OutputCurrency] = "GBP"
+	exchangeToWithdrawAmount, _ := ParseMoney(exchangeToWithdrawRow[tx_InputAmount], exchangeToWithdrawRow[tx_InputCurrency])
+
+	testRow := buildStandardTestVector()
+	testRow[tx_Type] = "WithdrawExchanged"
+	testRow[tx_InputAmount] = "9.99"
+	testRow[tx_InputCurrency] = "GBP"
+	testRow[tx_OutputAmount] = "9.99"
 	testRow[tx_OutputCurrency] = "NEXO"
-	exchangeToWithdraw = [][]string{exchangeToWithdrawRow}
+	testRow[tx_Details] = "approved / GBP withdrawal"
+	mismatchOutput := make(map[string][][]string, 0)
+	mismatchExchangeToWithdraw := []queuedRecord{{row: exchangeToWithdrawRow, amount: exchangeToWithdrawAmount}}
+	mismatchDepositToExchange := make([]queuedRecord, 0)
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	errorText = convertSingleTransaction(testRow, &mismatchOutput, &mismatchExchangeToWithdraw, &mismatchDepositToExchange, nil, nil, nil, "Europe/London")
 
-	// An error should be reported
-	if len(outputError) == 0 {
-		t.Errorf("%s/%s: unexpected error text: %q", testRow[tx_Type], testName, outputError)
+	if errorText == "" {
+		t.Errorf("mismatched output currency: expected an error, got none")
 	}
 }
 
+// TestWithdrawExchangedUsdEquivalentDrift verifies the tolerance-derived check
+// (see Money.WithinTolerancePercent / ScaleTolerancePercent) that replaced convert-nexo.go's
+// former "USD Equivalent may not match, presumably due to rate drift" comment with an actual
+// comparison against the queued ExchangeToWithdraw's own USD Equivalent.
+func TestWithdrawExchangedUsdEquivalentDrift(t *testing.T) {
+	queuedRow := buildStandardTestVector()
+	queuedRow[tx_Type] = "ExchangeToWithdraw"
+	queuedRow[tx_InputCurrency] = "GBPX"
+	queuedRow[tx_OutputCurrency] = "GBP"
+	queuedRow[tx_InputAmount] = "-9.99"
+	queuedRow[tx_OutputAmount] = "9.99"
+	queuedAmount, _ := ParseMoney(queuedRow[tx_InputAmount], queuedRow[tx_InputCurrency])
+	queuedUsd, _ := parseUsdEquivalent("$100.00")
+
+	buildQueue := func() []queuedRecord {
+		return []queuedRecord{{row: queuedRow, amount: queuedAmount, usdEquivalent: queuedUsd}}
+	}
+
+	withdrawRow := func(usd string) []string {
+		row := buildStandardTestVector()
+		row[tx_Type] = "WithdrawExchanged"
+		row[tx_InputCurrency] = "GBP"
+		row[tx_OutputCurrency] = "GBP"
+		row[tx_InputAmount] = "9.99"
+		row[tx_OutputAmount] = "9.99"
+		row[tx_Details] = "approved / GBP withdrawal"
+		row[tx_UsdEquivalent] = usd
+		return row
+	}
+
+	t.Run("within tolerance", func(t *testing.T) {
+		output := make(map[string][][]string, 0)
+		exchangeToWithdraw := buildQueue()
+		depositToExchange := make([]queuedRecord, 0)
+		errorText := convertSingleTransaction(withdrawRow("$100.40"), &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
+		if strings.Contains(errorText, "drift") {
+			t.Errorf("within tolerance (0.4%%): unexpected drift error: %q", errorText)
+		}
+	})
+
+	t.Run("beyond tolerance", func(t *testing.T) {
+		output := make(map[string][][]string, 0)
+		exchangeToWithdraw := buildQueue()
+		depositToExchange := make([]queuedRecord, 0)
+		errorText := convertSingleTransaction(withdrawRow("$101.00"), &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
+		if !strings.Contains(errorText, "drift") {
+			t.Errorf("beyond tolerance (1%%): expected a drift error, got %q", errorText)
+		}
+	})
+}
+
 // These tests verify that a "DepositToExchange" is (broadly) handled correctly
 func TestDepositToExchange(t *testing.T) {
 	testName := ""
 	outputError := "outputError"
-	output := make(map[string][][]string, 0)  // map of currency => array of strings
-	exchangeToWithdraw := make([][]string, 0) // FIFO queue or records
-	depositToExchange := make([][]string, 0)  // FIFO queue or records
+	output := make(map[string][][]string, 0)      // map of currency => array of strings
+	exchangeToWithdraw := make([]queuedRecord, 0) // FIFO queue or records
+	depositToExchange := make([]queuedRecord, 0)  // FIFO queue or records
 
 	validTestRow := buildStandardTestVector()
 	validTestRow[tx_Type] = "DepositToExchange"
@@ -406,7 +482,7 @@ func TestDepositToExchange(t *testing.T) {
 
 	// Start by testing a set of data that should be OK
 	testName = "valid data"
-	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// output should always be empty
 	if len(output) != 0 {
@@ -414,16 +490,16 @@ func TestDepositToExchange(t *testing.T) {
 	}
 	// exchangeToWithdraw should always be empty
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", validTestRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", validTestRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	// exchangeToWithdraw should exactly match validTestRow
 	if len(depositToExchange) == 0 {
 		t.Errorf("%s/%s: depositToExchange unexpectedly emptyempty", validTestRow[tx_Type], testName)
 	} else if len(depositToExchange) != 1 {
-		t.Errorf("%s/%s: depositToExchange has too many entries: got %q, expected %q", validTestRow[tx_Type], testName, depositToExchange, validTestRow)
+		t.Errorf("%s/%s: depositToExchange has too many entries: got %v, expected %q", validTestRow[tx_Type], testName, depositToExchange, validTestRow)
 	} else {
-		if !testSlicesEqual(depositToExchange[0], validTestRow) {
-			t.Errorf("%s/%s: depositToExchange has bad contents: got %q, expected %q", validTestRow[tx_Type], testName, depositToExchange, validTestRow)
+		if !testSlicesEqual(depositToExchange[0].row, validTestRow) {
+			t.Errorf("%s/%s: depositToExchange has bad contents: got %v, expected %q", validTestRow[tx_Type], testName, depositToExchange, validTestRow)
 		}
 	}
 
@@ -438,7 +514,7 @@ func TestDepositToExchange(t *testing.T) {
 	copy(testRow, validTestRow)
 	testRow[tx_InputAmount] = "8.76"
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// An error should be reported
 	if len(outputError) == 0 {
@@ -450,7 +526,7 @@ func TestDepositToExchange(t *testing.T) {
 	copy(testRow, validTestRow)
 	testRow[tx_InputCurrency] = "BAD-CURRENCY"
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// An error should be reported
 	if len(outputError) == 0 {
@@ -462,7 +538,7 @@ func TestDepositToExchange(t *testing.T) {
 	copy(testRow, validTestRow)
 	testRow[tx_OutputCurrency] = "BAD-CURRENCY"
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// An error should be reported
 	if len(outputError) == 0 {
@@ -471,76 +547,96 @@ func TestDepositToExchange(t *testing.T) {
 }
 
 // These tests verify that a "ExchangeDepositedOn" is (broadly) handled correctly
+// These tests verify that an "ExchangeDepositedOn" is (broadly) handled correctly, including
+// its FIFO matching (and splitting) against queued DepositToExchange records. Most scenarios
+// are expressed with the testgen DSL via RunScenario, since they are really about the shape of
+// the transaction sequence rather than any one row's fields.
 func TestExchangeDepositedOn(t *testing.T) {
-	testName := ""
-	outputError := ""
-	output := make(map[string][][]string, 0)  // map of currency => array of strings
-	exchangeToWithdraw := make([][]string, 0) // FIFO queue or records
-	depositToExchange := make([][]string, 0)  // FIFO queue or records
-
-	depositToExchangeRow := buildStandardTestVector()
-	depositToExchangeRow[tx_ID] = "TX-ID-DEP2EXCH"
-	depositToExchangeRow[tx_Type] = "DepositToExchange"
-	depositToExchangeRow[tx_InputAmount] = "9.99"
-	depositToExchangeRow[tx_InputCurrency] = "GBP"
-	depositToExchangeRow[tx_OutputAmount] = "9.99"
-	depositToExchangeRow[tx_OutputCurrency] = "GBPX"
-	depositToExchange = [][]string{depositToExchangeRow}
-
-	validTestRow := buildStandardTestVector()
-	validTestRow[tx_Type] = "ExchangeDepositedOn"
-	validTestRow[tx_InputAmount] = "9.99"
-	validTestRow[tx_InputCurrency] = "GBP"
-	validTestRow[tx_OutputAmount] = "9.99"
-	validTestRow[tx_OutputCurrency] = "GBPX"
-	validTestRow[tx_Details] = "approved / GBP to GBPX"
-
-	// Start by testing a set of data that should be OK
-	testName = "valid data"
-	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange)
-
-	// output, exch2Withdraw and dep2Exchange should always be empty
+	// Valid data: a single DepositToExchange matched 1:1 by an ExchangeDepositedOn.
+	output, exchangeToWithdraw, depositToExchange, errorText := RunScenario(t, `
+		DepositToExchange   GBP>GBPX 9.99
+		ExchangeDepositedOn GBP>GBPX 9.99
+	`)
 	if len(output) != 0 {
-		t.Errorf("%s/%s: output not empty: got %q", validTestRow[tx_Type], testName, output)
+		t.Errorf("valid data: output not empty: got %q", output)
 	}
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw should be empty: got %q", validTestRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("valid data: exchangeToWithdraw not empty: got %v", exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", validTestRow[tx_Type], testName, depositToExchange)
+		t.Errorf("valid data: depositToExchange should be empty: got %v", depositToExchange)
 	}
-
-	// No error should be reported
-	if len(outputError) != 0 {
-		t.Errorf("%s/%s: unexpected error text: %q", validTestRow[tx_Type], testName, outputError)
+	if errorText != "" {
+		t.Errorf("valid data: unexpected error text: %q", errorText)
 	}
 
-	// Check that a mismatched input amount with DepositToExchange is caught
-	testName = "mismatched input amount"
-	testRow := make([]string, len(validTestRow))
-	copy(testRow, validTestRow)
-	testRow[tx_InputAmount] = "8.76"
-	depositToExchange = [][]string{depositToExchangeRow}
+	// Queue head too big: an ExchangeDepositedOn smaller than the queued DepositToExchange
+	// splits the queue head rather than erroring: the consumed part is matched and a residual
+	// record (marked "-split-N") is left at the head of the queue.
+	_, _, depositToExchange, errorText = RunScenario(t, `
+		DepositToExchange   GBP>GBPX 9.99
+		ExchangeDepositedOn GBP>GBPX 8.76
+	`)
+	if errorText != "" {
+		t.Errorf("queue head too big: unexpected error text: %q", errorText)
+	}
+	residualAmount, _ := ParseMoney("1.23", "GBP")
+	if len(depositToExchange) != 1 || !depositToExchange[0].amount.Equals(residualAmount) {
+		t.Errorf("queue head too big: expected a single residual record of %s, got %v", residualAmount, depositToExchange)
+	}
+	if depositToExchange[0].row[tx_ID] != "TX-1-split-1" {
+		t.Errorf("queue head too big: expected residual TX ID %q, got %q", "TX-1-split-1", depositToExchange[0].row[tx_ID])
+	}
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	// Request spans multiple queue heads: an ExchangeDepositedOn can be satisfied by draining
+	// more than one queued DepositToExchange record.
+	_, _, depositToExchange, errorText = RunScenario(t, `
+		DepositToExchange   GBP>GBPX 5.00
+		DepositToExchange   GBP>GBPX 4.99
+		ExchangeDepositedOn GBP>GBPX 9.99
+	`)
+	if errorText != "" {
+		t.Errorf("request spans multiple queue heads: unexpected error text: %q", errorText)
+	}
+	if len(depositToExchange) != 0 {
+		t.Errorf("request spans multiple queue heads: expected the queue to be drained, got %v", depositToExchange)
+	}
 
-	// An error should be reported
-	if len(outputError) == 0 {
-		t.Errorf("%s/%s: unexpected error text: %q", testRow[tx_Type], testName, outputError)
+	// Request drains the queue: an ExchangeDepositedOn bigger than the entire queue is reported
+	// as an underflow.
+	_, _, _, errorText = RunScenario(t, `
+		DepositToExchange   GBP>GBPX 5.00
+		ExchangeDepositedOn GBP>GBPX 9.99
+	`)
+	if errorText == "" {
+		t.Errorf("request drains the queue: expected an error, got none")
 	}
 
-	// Check that a mismatched output currency with ExchangeToWithdraw is caught
-	testName = "mismatched input amount"
-	testRow = make([]string, len(validTestRow))
-	copy(testRow, validTestRow)
+	// Mismatched output currency: the DSL always pairs GBP/GBPX, so this row-validity check
+	// (independent of queue matching) is still built by hand.
+	depositToExchangeRow := buildStandardTestVector()
+	depositToExchangeRow[tx_Type] = "DepositToExchange"
+	depositToExchangeRow[tx_InputAmount] = "9.99"
+	depositToExchangeRow[tx_InputCurrency] = "GBP"
+	depositToExchangeRow[tx_OutputAmount] = "9.99"
+	depositToExchangeRow[tx_OutputCurrency] = "GBPX"
+	depositToExchangeAmount, _ := ParseMoney(depositToExchangeRow[tx_InputAmount], depositToExchangeRow[tx_InputCurrency])
+
+	testRow := buildStandardTestVector()
+	testRow[tx_Type] = "ExchangeDepositedOn"
+	testRow[tx_InputAmount] = "9.99"
+	testRow[tx_InputCurrency] = "GBP"
+	testRow[tx_OutputAmount] = "9.99"
 	testRow[tx_OutputCurrency] = "NEXO"
-	depositToExchange = [][]string{depositToExchangeRow}
+	testRow[tx_Details] = "approved / GBP to GBPX"
+	mismatchOutput := make(map[string][][]string, 0)
+	mismatchExchangeToWithdraw := make([]queuedRecord, 0)
+	mismatchDepositToExchange := []queuedRecord{{row: depositToExchangeRow, amount: depositToExchangeAmount}}
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	errorText = convertSingleTransaction(testRow, &mismatchOutput, &mismatchExchangeToWithdraw, &mismatchDepositToExchange, nil, nil, nil, "Europe/London")
 
-	// An error should be reported
-	if len(outputError) == 0 {
-		t.Errorf("%s/%s: unexpected error text: %q", testRow[tx_Type], testName, outputError)
+	if errorText == "" {
+		t.Errorf("mismatched output currency: expected an error, got none")
 	}
 }
 
@@ -559,9 +655,9 @@ func TestFixedTermInterest(t *testing.T) {
 func InterestTransaction(t *testing.T, pType string) {
 	testName := ""
 	outputError := ""
-	output := make(map[string][][]string, 0)  // map of currency => array of strings
-	exchangeToWithdraw := make([][]string, 0) // FIFO queue or records
-	depositToExchange := make([][]string, 0)  // FIFO queue or records
+	output := make(map[string][][]string, 0)      // map of currency => array of strings
+	exchangeToWithdraw := make([]queuedRecord, 0) // FIFO queue or records
+	depositToExchange := make([]queuedRecord, 0)  // FIFO queue or records
 
 	validTestRow := buildStandardTestVector()
 	validTestRow[tx_Type] = pType
@@ -569,7 +665,7 @@ func InterestTransaction(t *testing.T, pType string) {
 
 	// Start by testing a set of data that should be OK
 	testName = "valid data"
-	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// The output map should have one key (NEXO) and one entry under that key
 	if len(output) != 1 {
@@ -578,14 +674,16 @@ func InterestTransaction(t *testing.T, pType string) {
 		t.Errorf("%s/%s: output has wrong [NEXO] data: %q", validTestRow[tx_Type], testName, output)
 	} else if output["NEXO"][0][13] != "STAKING" {
 		t.Errorf("%s/%s: output has wrong event (expected STAKING): %q", validTestRow[tx_Type], testName, output)
+	} else if output["NEXO"][0][3] != "2022-04-05 06:00:06" {
+		t.Errorf("%s/%s: output has wrong uk date/time (expected test_date converted CEST->BST): %q", validTestRow[tx_Type], testName, output)
 	}
 
 	// output, exch2Withdraw and dep2Exchange should always be empty
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", validTestRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", validTestRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", validTestRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", validTestRow[tx_Type], testName, depositToExchange)
 	}
 
 	// No error should be reported
@@ -599,7 +697,7 @@ func InterestTransaction(t *testing.T, pType string) {
 	copy(testRow, validTestRow)
 	testRow[tx_Details] = "unapproved"
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// An error should be reported
 	if len(outputError) == 0 {
@@ -612,9 +710,9 @@ func InterestTransaction(t *testing.T, pType string) {
 func TestExchangePreMay2022(t *testing.T) {
 	testName := ""
 	outputError := ""
-	output := make(map[string][][]string, 0)  // map of currency => array of strings
-	exchangeToWithdraw := make([][]string, 0) // FIFO queue or records
-	depositToExchange := make([][]string, 0)  // FIFO queue or records
+	output := make(map[string][][]string, 0)      // map of currency => array of strings
+	exchangeToWithdraw := make([]queuedRecord, 0) // FIFO queue or records
+	depositToExchange := make([]queuedRecord, 0)  // FIFO queue or records
 
 	validTestRow := buildStandardTestVector()
 	validTestRow[tx_Type] = "Exchange"
@@ -626,7 +724,7 @@ func TestExchangePreMay2022(t *testing.T) {
 
 	// Start by testing a set of data that should be OK
 	testName = "valid GBP purchase"
-	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// The output map should have one key (NEXO) and one entry under that key
 	if len(output) != 1 {
@@ -639,10 +737,10 @@ func TestExchangePreMay2022(t *testing.T) {
 
 	// output, exch2Withdraw and dep2Exchange should always be empty
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", validTestRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", validTestRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", validTestRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", validTestRow[tx_Type], testName, depositToExchange)
 	}
 
 	// No error should be reported
@@ -657,7 +755,7 @@ func TestExchangePreMay2022(t *testing.T) {
 	testRow[tx_InputCurrency] = "NEXO/UST"
 	output = make(map[string][][]string, 0)
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// output, exch2Withdraw and dep2Exchange should always be empty
 	if len(output) != 2 {
@@ -679,16 +777,99 @@ func TestExchangePreMay2022(t *testing.T) {
 	}
 
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", testRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", testRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", testRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", testRow[tx_Type], testName, depositToExchange)
 	}
 
 	// No error should be reported
 	if len(outputError) != 0 {
 		t.Errorf("%s/%s: unexpected error text: %q", testRow[tx_Type], testName, outputError)
 	}
+
+	// With a ledger attached, the same NEXO->UST swap should close the (pre-seeded) NEXO lot
+	// and open a UST lot at the fair-value price implied by the row's USD equivalent field.
+	testName = "valid swap with cost-basis ledger"
+	ledgerOutput := make(map[string][][]string, 0)
+	ledgerExchangeToWithdraw := make([]queuedRecord, 0)
+	ledgerDepositToExchange := make([]queuedRecord, 0)
+	ledger := costbasis.NewLedger(costbasis.FIFO{})
+	gains := make([][]string, 0)
+	ledger.Acquire("NEXO", testDate(t, "2022-01-01 09:00:00"), 999000000, 500000, "TX-SEED-NEXO")
+
+	outputError = convertSingleTransaction(testRow, &ledgerOutput, &ledgerExchangeToWithdraw, &ledgerDepositToExchange, ledger, &gains, nil, "Europe/London")
+	if len(outputError) != 0 {
+		t.Errorf("%s/%s: unexpected error text: %q", testRow[tx_Type], testName, outputError)
+	}
+
+	if len(gains) != 1 {
+		t.Fatalf("%s/%s: gains: got %d rows, want 1: %v", testRow[tx_Type], testName, len(gains), gains)
+	}
+	if gains[0][2] != "NEXO" {
+		t.Errorf("%s/%s: gains[0] currency = %q, want NEXO: %v", testRow[tx_Type], testName, gains[0][2], gains[0])
+	}
+
+	// The UST lot opened by the swap should be disposable in turn, at the same fair-value cost.
+	ustDisposal := ledger.Dispose("UST", testDate(t, "2022-04-06 00:00:00"), 999)
+	if ustDisposal.Unmatched != 0 {
+		t.Errorf("%s/%s: UST lot not opened as expected: %+v", testRow[tx_Type], testName, ustDisposal)
+	}
+	if ustDisposal.CostGBP != 9876 {
+		t.Errorf("%s/%s: UST lot cost = %d, want 9876", testRow[tx_Type], testName, ustDisposal.CostGBP)
+	}
+}
+
+// testDate parses a "YYYY-MM-DD HH:MM:SS" string as used throughout the nexo CSV format,
+// failing the test immediately if it doesn't parse.
+func testDate(t *testing.T, s string) time.Time {
+	t.Helper()
+	when, err := time.Parse("2006-01-02 15:04:05", s)
+	if err != nil {
+		t.Fatalf("testDate(%q): %s", s, err)
+	}
+	return when
+}
+
+// fakeCurrencyConverter is a fxrate.CurrencyConverter stub that returns a fixed rate regardless of
+// from/to/t, for exercising usdToGBP's opt-in conversion path without a network call.
+type fakeCurrencyConverter struct {
+	rate string
+	err  error
+}
+
+func (f fakeCurrencyConverter) Rate(from, to string, t time.Time) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.rate, nil
+}
+
+// TestUsdToGBP checks usdToGBP's two modes: with fxConverter left at its nil default it passes the
+// USD amount through 1:1 (the only behaviour it has ever had, and what every other test in this
+// file - e.g. TestExchangePreMay2022's hardcoded CostGBP == 9876 - assumes); with fxConverter set,
+// it applies the configured historical rate instead.
+func TestUsdToGBP(t *testing.T) {
+	at := testDate(t, "2022-01-01 09:00:00")
+
+	got, err := usdToGBP("10.00", at)
+	if err != nil {
+		t.Fatalf("usdToGBP with nil fxConverter: unexpected error: %s", err)
+	}
+	if got != 1000 {
+		t.Errorf("usdToGBP with nil fxConverter: got %d, want 1000 (1:1 passthrough)", got)
+	}
+
+	fxConverter = fakeCurrencyConverter{rate: "0.8"}
+	defer func() { fxConverter = nil }()
+
+	got, err = usdToGBP("10.00", at)
+	if err != nil {
+		t.Fatalf("usdToGBP with fxConverter set: unexpected error: %s", err)
+	}
+	if got != 800 {
+		t.Errorf("usdToGBP with fxConverter set: got %d, want 800 (10.00 USD @ 0.8)", got)
+	}
 }
 
 // These tests verify that a "Withdrawal" is (broadly) handled correctly
@@ -696,9 +877,9 @@ func TestWithdrawal(t *testing.T) {
 
 	testName := ""
 	outputError := ""
-	output := make(map[string][][]string, 0)  // map of currency => array of strings
-	exchangeToWithdraw := make([][]string, 0) // FIFO queue or records
-	depositToExchange := make([][]string, 0)  // FIFO queue or records
+	output := make(map[string][][]string, 0)      // map of currency => array of strings
+	exchangeToWithdraw := make([]queuedRecord, 0) // FIFO queue or records
+	depositToExchange := make([]queuedRecord, 0)  // FIFO queue or records
 
 	validTestRow := buildStandardTestVector()
 	validTestRow[tx_Type] = "Withdrawal"
@@ -710,7 +891,7 @@ func TestWithdrawal(t *testing.T) {
 
 	// Start by testing a set of data that should be OK
 	testName = "valid data"
-	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(validTestRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
 	// The output map should have one key (BTC) and one entry under that key
 	if len(output) != 1 {
@@ -723,10 +904,10 @@ func TestWithdrawal(t *testing.T) {
 
 	// output, exch2Withdraw and dep2Exchange should always be empty
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", validTestRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", validTestRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", validTestRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", validTestRow[tx_Type], testName, depositToExchange)
 	}
 
 	// No error should be reported
@@ -734,32 +915,245 @@ func TestWithdrawal(t *testing.T) {
 		t.Errorf("%s/%s: unexpected error text: %q", validTestRow[tx_Type], testName, outputError)
 	}
 
-	// Check that a mismatched input/output amount is caught
+	// Check that a mismatched input/output amount is recorded as a NetworkFee rather than lost
 	testName = "mismatched input/output amount"
 	testRow := make([]string, len(validTestRow))
 	copy(testRow, validTestRow)
 	testRow[tx_InputAmount] = "8.76"
 
-	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange)
+	outputError = convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
 
-	// output, exch2Withdraw and dep2Exchange should always be empty
-	if len(output) != 1 {
-		t.Errorf("%s/%s: output not empty: got %q", testRow[tx_Type], testName, output)
-	}
+	// exch2Withdraw and dep2Exchange are unrelated to Withdrawal and should stay empty
 	if len(exchangeToWithdraw) != 0 {
-		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %q", testRow[tx_Type], testName, exchangeToWithdraw)
+		t.Errorf("%s/%s: exchangeToWithdraw not empty: got %v", testRow[tx_Type], testName, exchangeToWithdraw)
 	}
 	if len(depositToExchange) != 0 {
-		t.Errorf("%s/%s: depositToExchange not empty: got %q", testRow[tx_Type], testName, depositToExchange)
+		t.Errorf("%s/%s: depositToExchange not empty: got %v", testRow[tx_Type], testName, depositToExchange)
 	}
 
-	// An error should be reported
-	if len(outputError) != 1 {
-		// Currently the code chooses not to report this issue
-		// TBD t.Errorf("%s/%s: unexpected error text: %q", validTestRow[tx_Type], testName, outputError)
+	// No error should be reported: the fee is recorded, not flagged as a problem
+	if len(outputError) != 0 {
+		t.Errorf("%s/%s: unexpected error text: %q", testRow[tx_Type], testName, outputError)
+	}
+
+	// A NetworkFee row for the 1.23 BTC delta (8.76 -> 9.99) should have been appended alongside
+	// the TRANSFER-OUT row from this sub-test and the one from "valid data" above.
+	btcOutput := output["BTC"]
+	if len(btcOutput) != 3 {
+		t.Fatalf("%s/%s: output[BTC]: got %d rows, want 3: %v", testRow[tx_Type], testName, len(btcOutput), btcOutput)
+	}
+	feeRow := btcOutput[len(btcOutput)-1]
+	if got, want := feeRow[len(feeRow)-1], "NetworkFee"; got != want {
+		t.Errorf("%s/%s: output[BTC] last row tag = %q, want %q", testRow[tx_Type], testName, got, want)
+	}
+	if got, want := feeRow[4], "1.23000000"; got != want {
+		t.Errorf("%s/%s: NetworkFee amount = %q, want %q", testRow[tx_Type], testName, got, want)
+	}
+}
+
+// TestExchangeCashbackFee checks that an Exchange Cashback row where the venue's own cut leaves
+// Input Amount and Output Amount different - the "fee in a third currency" case, given this CSV
+// schema has no separate fee-currency column of its own - is recorded as an ExchangeFee rather
+// than rejected.
+func TestExchangeCashbackFee(t *testing.T) {
+	output := make(map[string][][]string, 0)
+	exchangeToWithdraw := make([]queuedRecord, 0)
+	depositToExchange := make([]queuedRecord, 0)
+
+	row := buildStandardTestVector()
+	row[tx_Type] = "Exchange Cashback"
+	row[tx_InputCurrency] = "BTC"
+	row[tx_OutputCurrency] = "BTC"
+	row[tx_InputAmount] = "0.50"
+	row[tx_OutputAmount] = "0.45"
+	row[tx_Details] = "approved / 0.5% on top of your Exchange transaction"
+
+	outputError := convertSingleTransaction(row, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
+	if len(outputError) != 0 {
+		t.Fatalf("Exchange Cashback: unexpected error text: %q", outputError)
+	}
+
+	btcOutput := output["BTC"]
+	if len(btcOutput) != 1 {
+		t.Fatalf("output[BTC]: got %d rows, want 1: %v", len(btcOutput), btcOutput)
+	}
+	feeRow := btcOutput[0]
+	if got, want := feeRow[len(feeRow)-1], "ExchangeFee"; got != want {
+		t.Errorf("output[BTC][0] tag = %q, want %q", got, want)
+	}
+	if got, want := feeRow[4], "0.05000000"; got != want {
+		t.Errorf("ExchangeFee amount = %q, want %q", got, want)
 	}
 }
 
 func buildStandardTestVector() []string {
 	return []string{test_id, test_type, test_input_currency, test_input_amount, test_output_currency, test_output_amount, test_usd_equiv, test_detail, test_outstanding_loan, test_date}
 }
+
+// TestCostBasisWiring runs an ExchangeDepositedOn (GBPX acquisition) followed by an
+// ExchangeToWithdraw (GBPX disposal) through convertSingleTransaction with a FIFO ledger
+// attached, and checks that a realised-gain row comes out with the expected cost/proceeds/gain.
+func TestCostBasisWiring(t *testing.T) {
+	ledger := costbasis.NewLedger(costbasis.FIFO{})
+	gains := make([][]string, 0)
+	output := make(map[string][][]string, 0)
+	exchangeToWithdraw := make([]queuedRecord, 0)
+	depositToExchange := make([]queuedRecord, 0)
+
+	// ExchangeDepositedOn requires a queued DepositToExchange to match against (see
+	// matchOrSplitPendingLeg), even though that matching is orthogonal to the cost-basis wiring
+	// this test actually cares about.
+	depositRow := buildStandardTestVector()
+	depositRow[tx_ID] = "TX-DEPOSIT"
+	depositRow[tx_Type] = "DepositToExchange"
+	depositRow[tx_InputCurrency] = "GBP"
+	depositRow[tx_OutputCurrency] = "GBPX"
+	depositRow[tx_InputAmount] = "9.99"
+	depositRow[tx_OutputAmount] = "9.99"
+	depositRow[tx_UsdEquivalent] = "$12.00"
+	depositRow[tx_Details] = "approved / GBP Top Up"
+	depositRow[tx_DateTime] = "2021-12-31 09:00:00"
+
+	acquireRow := buildStandardTestVector()
+	acquireRow[tx_ID] = "TX-ACQUIRE"
+	acquireRow[tx_Type] = "ExchangeDepositedOn"
+	acquireRow[tx_InputCurrency] = "GBP"
+	acquireRow[tx_OutputCurrency] = "GBPX"
+	acquireRow[tx_InputAmount] = "9.99"
+	acquireRow[tx_OutputAmount] = "9.99"
+	acquireRow[tx_UsdEquivalent] = "$12.00"
+	acquireRow[tx_Details] = "approved / GBP to GBPX"
+	acquireRow[tx_DateTime] = "2022-01-01 09:00:00"
+
+	disposeRow := buildStandardTestVector()
+	disposeRow[tx_ID] = "TX-DISPOSE"
+	disposeRow[tx_Type] = "ExchangeToWithdraw"
+	disposeRow[tx_InputCurrency] = "GBPX"
+	disposeRow[tx_OutputCurrency] = "GBP"
+	disposeRow[tx_InputAmount] = "-9.99"
+	disposeRow[tx_OutputAmount] = "9.99"
+	disposeRow[tx_UsdEquivalent] = "$12.50"
+	disposeRow[tx_Details] = "approved / GBPX to GBP"
+	disposeRow[tx_DateTime] = "2022-01-02 09:00:00"
+
+	for _, row := range [][]string{depositRow, acquireRow, disposeRow} {
+		if errorText := convertSingleTransaction(row, &output, &exchangeToWithdraw, &depositToExchange, ledger, &gains, nil, "Europe/London"); errorText != "" {
+			t.Fatalf("convertSingleTransaction(%s, %q): unexpected error text: %q", row[tx_Type], "Europe/London", errorText)
+		}
+	}
+
+	if len(gains) != 1 {
+		t.Fatalf("gains: got %d rows, want 1: %v", len(gains), gains)
+	}
+
+	got := gains[0]
+	want := []string{"TX-DISPOSE", "2022-01-02 09:00:00", "GBPX", "9.99", "12.00", "9.99", "-2.01"}
+	if len(got) != len(want) {
+		t.Fatalf("gains[0] = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("gains[0][%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// TestReconcileTransfers feeds an ExchangeToWithdraw with no matching WithdrawExchanged and a
+// DepositToExchange with no matching ExchangeDepositedOn - a withdrawal that never completed
+// because the money was topped back up instead - and checks that reconcileTransfers collapses
+// the pair into a single TRANSFER row and drains both queues.
+func TestReconcileTransfers(t *testing.T) {
+	output := make(map[string][][]string, 0)
+	exchangeToWithdraw := make([]queuedRecord, 0)
+	depositToExchange := make([]queuedRecord, 0)
+
+	withdrawRow := buildStandardTestVector()
+	withdrawRow[tx_ID] = "TX-WITHDRAW-START"
+	withdrawRow[tx_Type] = "ExchangeToWithdraw"
+	withdrawRow[tx_InputCurrency] = "GBPX"
+	withdrawRow[tx_OutputCurrency] = "GBP"
+	withdrawRow[tx_InputAmount] = "-9.99"
+	withdrawRow[tx_OutputAmount] = "9.99"
+	withdrawRow[tx_UsdEquivalent] = "$12.00"
+	withdrawRow[tx_Details] = "approved / GBPX to GBP"
+	withdrawRow[tx_DateTime] = "2022-01-01 09:00:00"
+
+	depositRow := buildStandardTestVector()
+	depositRow[tx_ID] = "TX-DEPOSIT-START"
+	depositRow[tx_Type] = "DepositToExchange"
+	depositRow[tx_InputCurrency] = "GBP"
+	depositRow[tx_OutputCurrency] = "GBPX"
+	depositRow[tx_InputAmount] = "9.99"
+	depositRow[tx_OutputAmount] = "9.99"
+	depositRow[tx_UsdEquivalent] = "$12.00"
+	depositRow[tx_Details] = "approved / GBP Top Up"
+	depositRow[tx_DateTime] = "2022-01-02 09:00:00"
+
+	for _, row := range [][]string{withdrawRow, depositRow} {
+		if errorText := convertSingleTransaction(row, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London"); errorText != "" {
+			t.Fatalf("convertSingleTransaction(%s, %q): unexpected error text: %q", row[tx_Type], "Europe/London", errorText)
+		}
+	}
+
+	if err := reconcileTransfers(&output, &exchangeToWithdraw, &depositToExchange, DefaultReconcileConfig); err != nil {
+		t.Fatalf("reconcileTransfers: unexpected error: %s", err)
+	}
+
+	if len(exchangeToWithdraw) != 0 {
+		t.Errorf("exchangeToWithdraw not drained: got %v", exchangeToWithdraw)
+	}
+	if len(depositToExchange) != 0 {
+		t.Errorf("depositToExchange not drained: got %v", depositToExchange)
+	}
+
+	gbpOutput := output["GBP"]
+	if len(gbpOutput) != 1 {
+		t.Fatalf("output[GBP]: got %d rows, want 1: %v", len(gbpOutput), gbpOutput)
+	}
+	if got, want := gbpOutput[0][len(gbpOutput[0])-1], "TRANSFER"; got != want {
+		t.Errorf("output[GBP][0] tag = %q, want %q", got, want)
+	}
+}
+
+// TestReconcileTransfersUnmatched checks that a withdrawal with no eligible deposit is reported
+// rather than silently dropped.
+func TestReconcileTransfersUnmatched(t *testing.T) {
+	output := make(map[string][][]string, 0)
+
+	withdrawRow := buildStandardTestVector()
+	withdrawRow[tx_ID] = "TX-WITHDRAW-LONELY"
+	withdrawRow[tx_InputAmount] = "-9.99"
+	withdrawRow[tx_OutputAmount] = "9.99"
+	withdrawRow[tx_DateTime] = "2022-01-01 09:00:00"
+	exchangeToWithdraw := []queuedRecord{{row: withdrawRow, amount: MustNew(-999, MustCurrSymbol("GBPX"))}}
+	depositToExchange := make([]queuedRecord, 0)
+
+	err := reconcileTransfers(&output, &exchangeToWithdraw, &depositToExchange, DefaultReconcileConfig)
+	if err == nil {
+		t.Fatalf("reconcileTransfers: expected an unmatched-transfer error, got none")
+	}
+	if !strings.Contains(err.Error(), "TX-WITHDRAW-LONELY") {
+		t.Errorf("reconcileTransfers error = %q, want it to mention TX-WITHDRAW-LONELY", err.Error())
+	}
+	if len(exchangeToWithdraw) != 1 {
+		t.Errorf("exchangeToWithdraw: got %v, want the unmatched withdrawal left in place", exchangeToWithdraw)
+	}
+}
+
+// This test verifies that an unrecognised -output-tz value is reported as an error rather than
+// silently leaving the "uk date/time" column blank.
+func TestUnknownOutputTimezone(t *testing.T) {
+	output := make(map[string][][]string, 0)
+	exchangeToWithdraw := make([]queuedRecord, 0)
+	depositToExchange := make([]queuedRecord, 0)
+
+	testRow := buildStandardTestVector()
+	outputError := convertSingleTransaction(testRow, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Not/AZone")
+
+	if !strings.Contains(outputError, "Date / Time conversion error") {
+		t.Errorf("convertSingleTransaction with an unknown -output-tz: expected a Date / Time conversion error, got %q", outputError)
+	}
+	if output["NEXO"][0][3] != "" {
+		t.Errorf("convertSingleTransaction with an unknown -output-tz: want an empty uk date/time column, got %q", output["NEXO"][0][3])
+	}
+}
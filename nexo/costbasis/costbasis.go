@@ -0,0 +1,313 @@
+// Package costbasis tracks per-currency acquisition lots and realises a GBP gain/loss against
+// them when a disposal consumes some or all of a lot. Lot selection is pluggable via the
+// Strategy interface, so the same Ledger can be asked "what would the realised gain have been
+// under FIFO / LIFO / HMRCPool" without re-running the conversion.
+//
+// Amounts are minor-unit integers (e.g. pence, satoshis), not float64, for the same
+// rounding-safety reasons the nexo package's Money type exists; costbasis deliberately does not
+// import that type so that this package has no dependency on any one exchange's CSV layout.
+package costbasis
+
+import (
+	"sort"
+	"time"
+)
+
+// Lot records a single acquisition: Quantity is how much of Currency remains unconsumed, and
+// CostGBP is the total GBP cost (pence) of the *original* acquisition; costFor prorates it as
+// the lot is partially consumed. SourceTxID is the identifier of the transaction that created
+// the lot, so that a caller can nominate it by ID for specific-identification disposal (see
+// Ledger.DisposeLot).
+type Lot struct {
+	AcquiredAt time.Time
+	Currency   string
+	Quantity   int64 // remaining, minor units of Currency
+	CostGBP    int64 // pence, cost of the original (not remaining) quantity
+	SourceTxID string
+	original   int64 // original quantity, used to prorate CostGBP as the lot is consumed
+}
+
+// costFor returns the proportional GBP cost (pence, truncated towards zero) of consuming qty
+// minor units out of the lot's original quantity.
+func (l *Lot) costFor(qty int64) int64 {
+	if l.original == 0 {
+		return 0
+	}
+	return l.CostGBP * qty / l.original
+}
+
+// Consumption records that a disposal consumed Quantity minor units from a lot acquired at
+// AcquiredAt, at a proportional cost basis of CostGBP pence. HoldingPeriod is "short" or
+// "long" depending on how the gap between AcquiredAt and the disposal date compares to the
+// Ledger's LongTermThresholdDays.
+type Consumption struct {
+	AcquiredAt    time.Time
+	Quantity      int64
+	CostGBP       int64
+	SourceTxID    string
+	HoldingPeriod string
+}
+
+// Long and short holding-period labels for Consumption.HoldingPeriod.
+const (
+	HoldingPeriodShort = "short"
+	HoldingPeriodLong  = "long"
+)
+
+// defaultLongTermThresholdDays is the holding period, in days, at or beyond which a
+// Consumption is classified HoldingPeriodLong rather than HoldingPeriodShort. It mirrors the
+// common (e.g. US) one-year long-term capital gains threshold; NewLedger callers that need a
+// different threshold (e.g. for a different tax jurisdiction) can override it directly on the
+// returned Ledger.
+const defaultLongTermThresholdDays = 365
+
+// Disposal is the result of matching a disposal against the ledger for one currency.
+type Disposal struct {
+	Consumptions []Consumption
+	CostGBP      int64 // total GBP cost basis consumed, across all Consumptions
+	Unmatched    int64 // quantity still unsatisfied if the ledger held less than was disposed of
+}
+
+// Strategy selects which lots a disposal of qty minor units should consume, and in what order
+// or proportion. Dispose mutates lots in place: consumed quantity is removed, and fully
+// consumed lots are dropped from the slice.
+type Strategy interface {
+	Dispose(lots *[]*Lot, disposedAt time.Time, qty int64) Disposal
+}
+
+// FIFO consumes the oldest lots first.
+type FIFO struct{}
+
+func (FIFO) Dispose(lots *[]*Lot, disposedAt time.Time, qty int64) Disposal {
+	sort.SliceStable(*lots, func(i, j int) bool { return (*lots)[i].AcquiredAt.Before((*lots)[j].AcquiredAt) })
+	return disposeInOrder(lots, qty)
+}
+
+// LIFO consumes the most recently acquired lots first.
+type LIFO struct{}
+
+func (LIFO) Dispose(lots *[]*Lot, disposedAt time.Time, qty int64) Disposal {
+	sort.SliceStable(*lots, func(i, j int) bool { return (*lots)[i].AcquiredAt.After((*lots)[j].AcquiredAt) })
+	return disposeInOrder(lots, qty)
+}
+
+// HIFO consumes the highest-unit-cost lots first, which minimises realised gain (or maximises
+// realised loss) for a given disposal - useful for tax planning where FIFO/LIFO are not
+// mandated.
+type HIFO struct{}
+
+func (HIFO) Dispose(lots *[]*Lot, disposedAt time.Time, qty int64) Disposal {
+	sort.SliceStable(*lots, func(i, j int) bool {
+		return (*lots)[i].costsMoreThan((*lots)[j])
+	})
+	return disposeInOrder(lots, qty)
+}
+
+// costsMoreThan reports whether l's per-minor-unit cost is strictly greater than other's, used
+// to rank lots for HIFO. It compares CostGBP*other.original against other.CostGBP*l.original
+// rather than dividing each lot's own per-unit rate down to an integer first: at real (e.g.
+// satoshi-scale, 1e8 minor units per coin) quantities, CostGBP/original truncates to 0 for every
+// lot, making every comparison false and silently degrading HIFO to FIFO.
+func (l *Lot) costsMoreThan(other *Lot) bool {
+	if l.original == 0 || other.original == 0 {
+		return false
+	}
+	return l.CostGBP*other.original > other.CostGBP*l.original
+}
+
+// disposeInOrder consumes qty minor units starting from the front of (the already-ordered) lots.
+func disposeInOrder(lots *[]*Lot, qty int64) Disposal {
+	var d Disposal
+	remaining := qty
+	kept := (*lots)[:0]
+	for _, lot := range *lots {
+		if remaining <= 0 {
+			kept = append(kept, lot)
+			continue
+		}
+		take := lot.Quantity
+		if take > remaining {
+			take = remaining
+		}
+		cost := lot.costFor(take)
+		d.Consumptions = append(d.Consumptions, Consumption{AcquiredAt: lot.AcquiredAt, Quantity: take, CostGBP: cost, SourceTxID: lot.SourceTxID})
+		d.CostGBP += cost
+		lot.Quantity -= take
+		remaining -= take
+		if lot.Quantity > 0 {
+			kept = append(kept, lot)
+		}
+	}
+	*lots = kept
+	d.Unmatched = remaining
+	return d
+}
+
+// HMRCPool implements an approximation of the UK HMRC share-pooling rules: same-day
+// acquisitions are matched first, and the remainder is drawn from a single s.104 pooled-average
+// cost across every other lot of the currency.
+//
+// The 30-day "bed and breakfast" rule - matching a disposal against acquisitions made up to 30
+// days *after* it - is NOT implemented here: Ledger only ever sees one disposal's lots at a time
+// and has no way to look ahead at acquisitions still to come. pkg/taxlots.Process implements that
+// rule itself, ahead of calling into HMRCPool, since it holds every transaction up front and so
+// can look ahead; HMRCPool only ever sees the remainder left after that rule has already matched
+// what it can.
+type HMRCPool struct{}
+
+func (HMRCPool) Dispose(lots *[]*Lot, disposedAt time.Time, qty int64) Disposal {
+	var d Disposal
+	remaining := qty
+
+	var sameDay, rest []*Lot
+	for _, lot := range *lots {
+		if sameCalendarDay(lot.AcquiredAt, disposedAt) {
+			sameDay = append(sameDay, lot)
+		} else {
+			rest = append(rest, lot)
+		}
+	}
+
+	for _, lot := range sameDay {
+		if remaining <= 0 {
+			rest = append(rest, lot)
+			continue
+		}
+		take := lot.Quantity
+		if take > remaining {
+			take = remaining
+		}
+		cost := lot.costFor(take)
+		d.Consumptions = append(d.Consumptions, Consumption{AcquiredAt: lot.AcquiredAt, Quantity: take, CostGBP: cost, SourceTxID: lot.SourceTxID})
+		d.CostGBP += cost
+		lot.Quantity -= take
+		remaining -= take
+		if lot.Quantity > 0 {
+			rest = append(rest, lot)
+		}
+	}
+
+	if remaining > 0 {
+		var poolQty, poolCost int64
+		for _, lot := range rest {
+			poolQty += lot.Quantity
+			poolCost += lot.costFor(lot.Quantity)
+		}
+		if poolQty > 0 {
+			take := remaining
+			if take > poolQty {
+				take = poolQty
+			}
+			cost := poolCost * take / poolQty
+			d.Consumptions = append(d.Consumptions, Consumption{AcquiredAt: disposedAt, Quantity: take, CostGBP: cost, SourceTxID: "s.104 pool"})
+			d.CostGBP += cost
+			remaining -= take
+
+			// Shrink every pooled lot proportionally so a later disposal still sees a
+			// correctly-sized (if now less precisely dated) s.104 pool. Integer truncation
+			// here can leave the pool a handful of minor units oversized; that's the same
+			// trade-off Money.Allocate makes elsewhere in this codebase.
+			for _, lot := range rest {
+				lot.Quantity -= lot.Quantity * take / poolQty
+			}
+		}
+	}
+
+	kept := rest[:0]
+	for _, lot := range rest {
+		if lot.Quantity > 0 {
+			kept = append(kept, lot)
+		}
+	}
+	*lots = kept
+	d.Unmatched = remaining
+	return d
+}
+
+func sameCalendarDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// Ledger accumulates per-currency Lots as acquisitions occur and realises disposals against
+// them using Strategy. LongTermThresholdDays classifies each Consumption's HoldingPeriod; it
+// defaults to defaultLongTermThresholdDays but callers may override it directly.
+type Ledger struct {
+	Strategy              Strategy
+	LongTermThresholdDays int
+	lots                  map[string][]*Lot
+}
+
+// NewLedger returns a Ledger that selects lots for disposal using strategy.
+func NewLedger(strategy Strategy) *Ledger {
+	return &Ledger{Strategy: strategy, LongTermThresholdDays: defaultLongTermThresholdDays, lots: make(map[string][]*Lot)}
+}
+
+// Acquire records a new lot of currency: quantity minor units acquired at acquiredAt for a
+// total cost of costGBP pence, sourced from the transaction identified by sourceTxID.
+func (l *Ledger) Acquire(currency string, acquiredAt time.Time, quantity, costGBP int64, sourceTxID string) {
+	l.lots[currency] = append(l.lots[currency], &Lot{
+		AcquiredAt: acquiredAt,
+		Currency:   currency,
+		Quantity:   quantity,
+		CostGBP:    costGBP,
+		SourceTxID: sourceTxID,
+		original:   quantity,
+	})
+}
+
+// Dispose realises a disposal of quantity minor units of currency at disposedAt, using the
+// ledger's Strategy.
+func (l *Ledger) Dispose(currency string, disposedAt time.Time, quantity int64) Disposal {
+	lots := l.lots[currency]
+	d := l.Strategy.Dispose(&lots, disposedAt, quantity)
+	l.lots[currency] = lots
+	l.classifyHoldingPeriods(disposedAt, &d)
+	return d
+}
+
+// DisposeLot realises a disposal of quantity minor units of currency against the single lot
+// identified by sourceTxID, bypassing the ledger's Strategy - the specific-identification
+// policy the request names, where the caller (not a reusable ordering rule) nominates which
+// lot to close. It returns a zero Disposal with Unmatched set to quantity if no such lot with
+// enough remaining quantity exists.
+func (l *Ledger) DisposeLot(currency string, disposedAt time.Time, quantity int64, sourceTxID string) Disposal {
+	lots := l.lots[currency]
+	for i, lot := range lots {
+		if lot.SourceTxID != sourceTxID {
+			continue
+		}
+		take := lot.Quantity
+		if take > quantity {
+			take = quantity
+		}
+		cost := lot.costFor(take)
+		d := Disposal{
+			Consumptions: []Consumption{{AcquiredAt: lot.AcquiredAt, Quantity: take, CostGBP: cost, SourceTxID: lot.SourceTxID}},
+			CostGBP:      cost,
+			Unmatched:    quantity - take,
+		}
+		lot.Quantity -= take
+		if lot.Quantity == 0 {
+			lots = append(lots[:i], lots[i+1:]...)
+		}
+		l.lots[currency] = lots
+		l.classifyHoldingPeriods(disposedAt, &d)
+		return d
+	}
+	return Disposal{Unmatched: quantity}
+}
+
+// classifyHoldingPeriods sets each Consumption's HoldingPeriod, comparing disposedAt against
+// its AcquiredAt and l.LongTermThresholdDays.
+func (l *Ledger) classifyHoldingPeriods(disposedAt time.Time, d *Disposal) {
+	for i := range d.Consumptions {
+		held := disposedAt.Sub(d.Consumptions[i].AcquiredAt)
+		if held >= time.Duration(l.LongTermThresholdDays)*24*time.Hour {
+			d.Consumptions[i].HoldingPeriod = HoldingPeriodLong
+		} else {
+			d.Consumptions[i].HoldingPeriod = HoldingPeriodShort
+		}
+	}
+}
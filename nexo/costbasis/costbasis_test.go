@@ -0,0 +1,186 @@
+package costbasis
+
+import (
+	"testing"
+	"time"
+)
+
+func day(n int) time.Time {
+	return time.Date(2022, time.January, n, 9, 0, 0, 0, time.UTC)
+}
+
+// depositThenInterestThenWithdraw builds a Ledger under strategy with a Deposit lot of 100
+// minor units costing 1000 pence, an Interest lot of 10 minor units costing 50 pence, then
+// disposes of 50 minor units - the sequence the request asks every strategy to be tested
+// against.
+func depositThenInterestThenWithdraw(strategy Strategy) Disposal {
+	ledger := NewLedger(strategy)
+	ledger.Acquire("NEXO", day(1), 100, 1000, "TX-DEPOSIT")  // Deposit
+	ledger.Acquire("NEXO", day(2), 10, 50, "TX-INTEREST")    // Interest
+	return ledger.Dispose("NEXO", day(3), 50) // WithdrawExchanged
+}
+
+func TestLedgerFIFO(t *testing.T) {
+	d := depositThenInterestThenWithdraw(FIFO{})
+
+	if d.Unmatched != 0 {
+		t.Fatalf("Unmatched = %d, want 0", d.Unmatched)
+	}
+	// FIFO consumes the whole disposal from the oldest (Deposit) lot: 50/100 of 1000 pence.
+	if d.CostGBP != 500 {
+		t.Errorf("CostGBP = %d, want 500", d.CostGBP)
+	}
+}
+
+func TestLedgerLIFO(t *testing.T) {
+	d := depositThenInterestThenWithdraw(LIFO{})
+
+	if d.Unmatched != 0 {
+		t.Fatalf("Unmatched = %d, want 0", d.Unmatched)
+	}
+	// LIFO drains the newest (Interest) lot first: all 10 units at 50 pence, then 40 of the
+	// 100-unit Deposit lot at 1000*40/100 = 400 pence. Total = 450.
+	if d.CostGBP != 450 {
+		t.Errorf("CostGBP = %d, want 450", d.CostGBP)
+	}
+}
+
+func TestLedgerHMRCPool(t *testing.T) {
+	d := depositThenInterestThenWithdraw(HMRCPool{})
+
+	if d.Unmatched != 0 {
+		t.Fatalf("Unmatched = %d, want 0", d.Unmatched)
+	}
+	// Neither lot is same-day with the disposal, so both fall into a single s.104 pool: 110
+	// units costing 1050 pence total. 50 units costs 1050*50/110 = 477 pence (truncated).
+	if d.CostGBP != 477 {
+		t.Errorf("CostGBP = %d, want 477", d.CostGBP)
+	}
+}
+
+func TestLedgerHMRCPoolSameDayMatchesFirst(t *testing.T) {
+	ledger := NewLedger(HMRCPool{})
+	ledger.Acquire("NEXO", day(1), 100, 1000, "TX-DEPOSIT")
+	d := ledger.Dispose("NEXO", day(1), 20) // same day as the only lot
+
+	if d.Unmatched != 0 {
+		t.Fatalf("Unmatched = %d, want 0", d.Unmatched)
+	}
+	if d.CostGBP != 200 {
+		t.Errorf("CostGBP = %d, want 200", d.CostGBP)
+	}
+}
+
+func TestLedgerHIFO(t *testing.T) {
+	ledger := NewLedger(HIFO{})
+	ledger.Acquire("NEXO", day(1), 100, 500, "TX-CHEAP")  // 5 pence/unit
+	ledger.Acquire("NEXO", day(2), 50, 1000, "TX-DEAR")   // 20 pence/unit, acquired later but costlier
+	d := ledger.Dispose("NEXO", day(3), 60)
+
+	if d.Unmatched != 0 {
+		t.Fatalf("Unmatched = %d, want 0", d.Unmatched)
+	}
+	// HIFO closes the costlier lot first regardless of acquisition order: all 50 units of
+	// TX-DEAR (1000 pence), then 10 of the 100-unit TX-CHEAP lot (500*10/100 = 50 pence).
+	if d.CostGBP != 1050 {
+		t.Errorf("CostGBP = %d, want 1050", d.CostGBP)
+	}
+	if len(d.Consumptions) != 2 || d.Consumptions[0].SourceTxID != "TX-DEAR" {
+		t.Errorf("Consumptions = %+v, want TX-DEAR consumed first", d.Consumptions)
+	}
+}
+
+// TestLedgerHIFORealisticScale mirrors TestLedgerHIFO but at satoshi-style (1e8 minor units per
+// coin) quantities, the scale pkg/taxlots.Process actually acquires lots at. unitCostGBP's
+// original int64-division ranking truncated to 0 pence/unit for every lot at this scale,
+// silently degrading HIFO to FIFO; costsMoreThan's cross-multiplied comparison must still rank
+// the costlier lot first here.
+func TestLedgerHIFORealisticScale(t *testing.T) {
+	ledger := NewLedger(HIFO{})
+	ledger.Acquire("BTC", day(1), 100_000_000, 3_000_000, "TX-CHEAP") // ~3,000,000p for 1 BTC
+	ledger.Acquire("BTC", day(2), 50_000_000, 2_500_000, "TX-DEAR")   // ~5,000,000p/BTC, dearer per unit
+	d := ledger.Dispose("BTC", day(3), 60_000_000)
+
+	if d.Unmatched != 0 {
+		t.Fatalf("Unmatched = %d, want 0", d.Unmatched)
+	}
+	// HIFO must close the costlier-per-unit TX-DEAR lot first: all 50,000,000 units (2,500,000p),
+	// then 10,000,000 of the 100,000,000-unit TX-CHEAP lot (3,000,000*10,000,000/100,000,000 =
+	// 300,000p). Total = 2,800,000.
+	if d.CostGBP != 2_800_000 {
+		t.Errorf("CostGBP = %d, want 2800000", d.CostGBP)
+	}
+	if len(d.Consumptions) != 2 || d.Consumptions[0].SourceTxID != "TX-DEAR" {
+		t.Errorf("Consumptions = %+v, want TX-DEAR consumed first", d.Consumptions)
+	}
+}
+
+func TestLedgerDisposeLotSpecID(t *testing.T) {
+	ledger := NewLedger(FIFO{})
+	ledger.Acquire("NEXO", day(1), 100, 500, "TX-CHEAP")
+	ledger.Acquire("NEXO", day(2), 50, 1000, "TX-DEAR")
+
+	// Without spec-ID, FIFO would close TX-CHEAP first; DisposeLot instead lets the caller
+	// nominate TX-DEAR directly.
+	d := ledger.DisposeLot("NEXO", day(3), 50, "TX-DEAR")
+
+	if d.Unmatched != 0 {
+		t.Fatalf("Unmatched = %d, want 0", d.Unmatched)
+	}
+	if d.CostGBP != 1000 {
+		t.Errorf("CostGBP = %d, want 1000", d.CostGBP)
+	}
+	if len(d.Consumptions) != 1 || d.Consumptions[0].SourceTxID != "TX-DEAR" {
+		t.Errorf("Consumptions = %+v, want a single TX-DEAR consumption", d.Consumptions)
+	}
+
+	// A second FIFO-strategy disposal should now only see TX-CHEAP remaining.
+	rest := ledger.Dispose("NEXO", day(4), 100)
+	if rest.Unmatched != 0 || rest.CostGBP != 500 {
+		t.Errorf("rest = %+v, want {Unmatched:0 CostGBP:500}", rest)
+	}
+}
+
+func TestLedgerDisposeLotUnknownID(t *testing.T) {
+	ledger := NewLedger(FIFO{})
+	ledger.Acquire("NEXO", day(1), 100, 500, "TX-CHEAP")
+
+	d := ledger.DisposeLot("NEXO", day(2), 10, "TX-MISSING")
+	if d.Unmatched != 10 {
+		t.Errorf("Unmatched = %d, want 10", d.Unmatched)
+	}
+}
+
+func TestConsumptionHoldingPeriod(t *testing.T) {
+	ledger := NewLedger(FIFO{})
+	ledger.Acquire("NEXO", day(1), 100, 500, "TX-OLD")
+	d := ledger.Dispose("NEXO", day(1).AddDate(1, 0, 1), 10) // disposed just over a year later
+
+	if len(d.Consumptions) != 1 || d.Consumptions[0].HoldingPeriod != HoldingPeriodLong {
+		t.Errorf("Consumptions = %+v, want a single HoldingPeriodLong consumption", d.Consumptions)
+	}
+
+	ledger2 := NewLedger(FIFO{})
+	ledger2.Acquire("NEXO", day(1), 100, 500, "TX-NEW")
+	d2 := ledger2.Dispose("NEXO", day(2), 10) // disposed the next day
+
+	if len(d2.Consumptions) != 1 || d2.Consumptions[0].HoldingPeriod != HoldingPeriodShort {
+		t.Errorf("Consumptions = %+v, want a single HoldingPeriodShort consumption", d2.Consumptions)
+	}
+}
+
+func TestLedgerDisposalExceedsHoldings(t *testing.T) {
+	d := depositThenInterestThenWithdraw(FIFO{})
+	_ = d
+
+	ledger := NewLedger(FIFO{})
+	ledger.Acquire("NEXO", day(1), 10, 100, "TX-DEPOSIT")
+	d2 := ledger.Dispose("NEXO", day(2), 25)
+
+	if d2.Unmatched != 15 {
+		t.Errorf("Unmatched = %d, want 15", d2.Unmatched)
+	}
+	if d2.CostGBP != 100 {
+		t.Errorf("CostGBP = %d, want 100", d2.CostGBP)
+	}
+}
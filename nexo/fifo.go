@@ -0,0 +1,60 @@
+package main
+
+// This file implements partial matching for the exchangeToWithdraw/depositToExchange FIFO
+// queues. Real Nexo statements routinely have one ExchangeToWithdraw/DepositToExchange record
+// covered by two (or more) WithdrawExchanged/ExchangeDepositedOn events, or the other way
+// round, so a simple "pop exactly one head and compare" is not enough.
+
+import "fmt"
+
+// splitFIFOHead consumes requestedAmount from the front of queue, in FIFO order.
+//
+// If the head record's amount exceeds requestedAmount, the head is split: the consumed
+// portion is removed and a residual record - the same row, with its transaction ID suffixed
+// "-split-N" - is pushed back to the front of the queue carrying the remainder.
+//
+// If the head record's amount is less than or equal to requestedAmount, the head is popped
+// in full and, if more is still required, the next head is consumed in the same way.
+//
+// An error is returned if the queue drains before requestedAmount has been fully matched.
+func splitFIFOHead(queue *[]queuedRecord, requestedAmount Money, txID string) error {
+	remaining := requestedAmount.Amount()
+	splitCount := 0
+
+	for remaining > 0 {
+		if len(*queue) == 0 {
+			return fmt.Errorf("TX %s: FIFO underflow: %s still required but the queue is empty", txID, MustNew(remaining, requestedAmount.Code()))
+		}
+
+		head := (*queue)[0]
+		switch {
+		case head.amount.Amount() > remaining:
+			// The head covers more than was requested: split it, consuming the requested
+			// portion and pushing the residual back to the front of the queue.
+			splitCount++
+			residualRow := make([]string, len(head.row))
+			copy(residualRow, head.row)
+			residualRow[tx_ID] = fmt.Sprintf("%s-split-%d", head.row[tx_ID], splitCount)
+			(*queue)[0] = queuedRecord{row: residualRow, amount: MustNew(head.amount.Amount()-remaining, head.amount.Code()), usdEquivalent: head.usdEquivalent}
+			remaining = 0
+		case head.amount.Amount() == remaining:
+			*queue = (*queue)[1:]
+			remaining = 0
+		default:
+			*queue = (*queue)[1:]
+			remaining -= head.amount.Amount()
+		}
+	}
+
+	return nil
+}
+
+// peekFIFOHeadUsdEquivalent returns the USD equivalent recorded against the front of queue,
+// without consuming it, so the matching leg can check for exchange-rate drift (see
+// Money.WithinTolerancePercent) before splitFIFOHead runs. It reports false if queue is empty.
+func peekFIFOHeadUsdEquivalent(queue []queuedRecord) (Money, bool) {
+	if len(queue) == 0 {
+		return Money{}, false
+	}
+	return queue[0].usdEquivalent, true
+}
@@ -0,0 +1,168 @@
+package main
+
+// This file adds an order-independent alternative to splitFIFOHead for matching a
+// WithdrawExchanged/ExchangeDepositedOn row against its queued ExchangeToWithdraw/
+// DepositToExchange leg. splitFIFOHead's "queue head, split if necessary" approach assumes the
+// confirming leg always arrives in the same order its queued leg did; real exports don't
+// guarantee that (two withdrawals initiated seconds apart can easily settle in reverse), so an
+// exact-amount match further back in the queue would otherwise be silently (and wrongly) split
+// against whatever happens to be at the head.
+//
+// matchPendingLeg instead searches the whole queue for an entry whose amount exactly matches and
+// whose own timestamp falls within legMatchTimeTolerance of the requesting row, preferring the
+// candidate closest in time when more than one qualifies. When no exact-amount candidate exists
+// at all - a genuine multi-leg settlement, where a queued amount only partially covers (or is only
+// partially covered by) the requesting row - there is no key to look up, since that is precisely
+// the case an exact-match index cannot represent; matchOrSplitPendingLeg falls back to
+// splitFIFOHead's partial-consuming FIFO behaviour for that case, the only thing that can model
+// it. -strict-fifo disables all of this and always uses splitFIFOHead, unconditionally, for exact
+// back-compat with the original ordering assumption.
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// strictFIFO disables matchPendingLeg entirely (see the -strict-fifo flag in main()), making
+// matchOrSplitPendingLeg always defer straight to splitFIFOHead's original queue-order behaviour.
+var strictFIFO bool
+
+// legMatchTimeTolerance bounds how far apart (in either direction) a queued leg's own timestamp
+// may be from the row trying to match it. WithdrawExchanged/ExchangeDepositedOn normally follow
+// their ExchangeToWithdraw/DepositToExchange leg within seconds, so half an hour comfortably
+// covers reordering without risking a match against an unrelated, merely-similar-amount row.
+const legMatchTimeTolerance = 30 * time.Minute
+
+// LegMatchKind classifies the outcome of matchPendingLeg.
+type LegMatchKind int
+
+const (
+	LegUnmatched    LegMatchKind = iota // no exact-amount candidate within the time window at all
+	LegMatched                          // exactly one exact-amount candidate within the time window
+	LegTimeInverted                     // the only candidate's own timestamp is after the requesting row's
+	LegAmbiguous                        // more than one candidate tied for closest in time
+)
+
+// LegMatchResult reports what matchPendingLeg found against a queue. Index is only meaningful
+// when Kind is LegMatched or LegTimeInverted. CandidateIDs carries the transaction IDs tied for
+// closest, for a LegAmbiguous result.
+type LegMatchResult struct {
+	Kind         LegMatchKind
+	Index        int
+	CandidateIDs []string
+}
+
+// matchPendingLeg searches queue for the entry whose amount exactly equals requestedAmount and
+// whose row[tx_DateTime] is within legMatchTimeTolerance of requestedAt, across the whole queue
+// rather than just its head.
+func matchPendingLeg(queue []queuedRecord, requestedAmount Money, requestedAt time.Time) LegMatchResult {
+	type candidate struct {
+		index    int
+		delta    time.Duration
+		inverted bool
+	}
+	var candidates []candidate
+
+	for i, leg := range queue {
+		if leg.amount.Code() != requestedAmount.Code() || leg.amount.Amount() != requestedAmount.Amount() {
+			continue
+		}
+		legAt, err := time.Parse("2006-01-02 15:04:05", leg.row[tx_DateTime])
+		if err != nil {
+			continue
+		}
+		delta := requestedAt.Sub(legAt)
+		inverted := delta < 0
+		if inverted {
+			delta = -delta
+		}
+		if delta > legMatchTimeTolerance {
+			continue
+		}
+		candidates = append(candidates, candidate{index: i, delta: delta, inverted: inverted})
+	}
+
+	if len(candidates) == 0 {
+		return LegMatchResult{Kind: LegUnmatched}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].delta < candidates[j].delta })
+
+	if len(candidates) > 1 && candidates[1].delta == candidates[0].delta {
+		ids := make([]string, 0, len(candidates))
+		for _, c := range candidates {
+			if c.delta == candidates[0].delta {
+				ids = append(ids, queue[c.index].row[tx_ID])
+			}
+		}
+		return LegMatchResult{Kind: LegAmbiguous, CandidateIDs: ids}
+	}
+
+	best := candidates[0]
+	if best.inverted {
+		return LegMatchResult{Kind: LegTimeInverted, Index: best.index}
+	}
+	return LegMatchResult{Kind: LegMatched, Index: best.index}
+}
+
+// removeQueuedLeg removes the record at index from queue, preserving the order of the rest.
+func removeQueuedLeg(queue *[]queuedRecord, index int) {
+	*queue = append((*queue)[:index], (*queue)[index+1:]...)
+}
+
+// matchPendingLegUsdEquivalent returns the USD equivalent recorded against whichever leg
+// matchOrSplitPendingLeg would consume for requestedAmount/requestedAt, without consuming it, so
+// the caller can check for exchange-rate drift before matching actually happens. It falls back to
+// the FIFO head's USD equivalent (see peekFIFOHeadUsdEquivalent) in exactly the same cases
+// matchOrSplitPendingLeg itself falls back to splitFIFOHead - but only when the head's own amount
+// equals requestedAmount: a genuinely partial settlement (the head bigger than requested, or the
+// request spanning more than one head) has no 1:1 correspondence between the two USD equivalents
+// to compare, so reporting drift there would just be comparing unrelated quantities.
+func matchPendingLegUsdEquivalent(queue []queuedRecord, requestedAmount Money, requestedAt time.Time, requestedAtOK bool) (Money, bool) {
+	if !strictFIFO && requestedAtOK {
+		if result := matchPendingLeg(queue, requestedAmount, requestedAt); result.Kind == LegMatched || result.Kind == LegTimeInverted {
+			return queue[result.Index].usdEquivalent, true
+		}
+	}
+	if len(queue) == 0 || absAmount(queue[0].amount) != absAmount(requestedAmount) {
+		return Money{}, false
+	}
+	return peekFIFOHeadUsdEquivalent(queue)
+}
+
+// absAmount returns m's minor-unit amount with its sign discarded, so a queued leg's amount -
+// which may be recorded negative or positive depending on which side of the exchange it came
+// from - can be compared against a requested amount by magnitude alone.
+func absAmount(m Money) int64 {
+	if a := m.Amount(); a < 0 {
+		return -a
+	} else {
+		return a
+	}
+}
+
+// matchOrSplitPendingLeg is the entry point splitFIFOHead's two call sites now go through:
+// unless -strict-fifo was given (or requestedAt itself failed to parse), it tries matchPendingLeg
+// first and only falls back to splitFIFOHead's partial-consuming FIFO behaviour when no
+// exact-amount candidate exists at all.
+func matchOrSplitPendingLeg(queue *[]queuedRecord, requestedAmount Money, requestedAt time.Time, requestedAtOK bool, txID string) error {
+	if !strictFIFO && requestedAtOK {
+		switch result := matchPendingLeg(*queue, requestedAmount, requestedAt); result.Kind {
+		case LegMatched:
+			removeQueuedLeg(queue, result.Index)
+			return nil
+		case LegTimeInverted:
+			matchedID := (*queue)[result.Index].row[tx_ID]
+			removeQueuedLeg(queue, result.Index)
+			return fmt.Errorf("TX %s: matched %s by amount, but %s's own timestamp is after this row's - check for a clock or export-order issue", txID, matchedID, matchedID)
+		case LegAmbiguous:
+			return fmt.Errorf("TX %s: %d candidates of %s tied for closest in time: %v - resolve by hand, or pass -strict-fifo to use queue order instead", txID, len(result.CandidateIDs), requestedAmount.String(), result.CandidateIDs)
+		case LegUnmatched:
+			// No exact-amount candidate at all: likely a genuine multi-leg/split settlement,
+			// which only splitFIFOHead's partial-consuming FIFO can model. Fall through to it.
+		}
+	}
+
+	return splitFIFOHead(queue, requestedAmount, txID)
+}
@@ -0,0 +1,373 @@
+package main
+
+// This file introduces a small typed Money value, modelled on the common
+// "monies" library pattern: amounts are stored as an integer number of minor
+// units (e.g. pennies, satoshis) alongside a CurrSymbol, so that amounts can
+// be compared and combined without falling prey to string/float formatting
+// mismatches (e.g. "9.99" vs "9.990").
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CurrSymbol identifies the currency (or token) that a Money value is denominated in. Nexo
+// statements use both fiat codes (GBP) and token symbols (NEXO, BTC, GBPX ...), plus - inherited
+// from Kraken's export format, which shares a couple of token IDs with Nexo's - a handful of
+// aliases (XXBT, XXDG, XETH) for common tokens. NewCurrSymbol is the only place that normalizes
+// those aliases and checks a symbol is one this codebase actually knows how to handle, rather
+// than leaving that to an ad-hoc map wherever a currency happens to be displayed or compared.
+type CurrSymbol string
+
+// currSymbolAliases maps a handful of non-standard ticker spellings seen in exchange CSV exports
+// (see convert-kraken.go's own copy of this table) onto the plain ticker NewCurrSymbol normalizes
+// them to.
+var currSymbolAliases = map[string]string{
+	"XXBT": "BTC",
+	"XXDG": "DOGE",
+	"XETH": "ETH",
+}
+
+// knownCurrSymbols is the set of currencies/tokens NewCurrSymbol accepts: the ISO 4217 fiat codes
+// and crypto tickers this codebase's Nexo and Kraken statements actually use. It is deliberately
+// not a complete ISO 4217 table - only the codes this repo has ever seen in a real export.
+var knownCurrSymbols = map[string]bool{
+	"GBP": true,
+	"USD": true,
+	"EUR": true,
+
+	"GBPX":  true, // Nexo's GBP-pegged synthetic token
+	"BTC":   true,
+	"ETH":   true,
+	"DOGE":  true,
+	"NEXO":  true,
+	"ADA":   true,
+	"DOT":   true,
+	"SOL":   true,
+	"UST":   true,
+	"USDC":  true,
+	"USDT":  true,
+	"LTC":   true,
+	"XRP":   true,
+	"LINK":  true,
+	"BNB":   true,
+	"MATIC": true,
+	// CRO and AVAX are named in convert-nexo.go's own TODO list (grouping output by currency),
+	// so they are known to appear in real Nexo statements even without a test fixture for them.
+	"CRO":  true,
+	"AVAX": true,
+}
+
+// NewCurrSymbol normalizes raw (trimming whitespace, upper-casing, and resolving any known alias)
+// and validates the result against knownCurrSymbols.
+func NewCurrSymbol(raw string) (CurrSymbol, error) {
+	code := strings.ToUpper(strings.TrimSpace(raw))
+	if replacement, found := currSymbolAliases[code]; found {
+		code = replacement
+	}
+	if !knownCurrSymbols[code] {
+		return "", fmt.Errorf("CurrSymbol: unrecognised currency/token %q", raw)
+	}
+	return CurrSymbol(code), nil
+}
+
+// MustCurrSymbol is like NewCurrSymbol but panics on error. Intended for constants and tests.
+func MustCurrSymbol(raw string) CurrSymbol {
+	cs, err := NewCurrSymbol(raw)
+	if err != nil {
+		panic(err)
+	}
+	return cs
+}
+
+// ErrCurrencyMismatch is returned whenever an operation is attempted between two Money
+// values that are not denominated in the same CurrSymbol.
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// currencyScale records how many decimal places each currency is expressed to.
+// Anything not listed here defaults to 2 (the common fiat case).
+var currencyScale = map[CurrSymbol]int{
+	"BTC":  8,
+	"ETH":  18,
+	"NEXO": 8,
+	"GBPX": 2,
+	"GBP":  2,
+}
+
+// scaleOverrides holds currency scales loaded via LoadScaleOverridesFile, taking precedence over
+// currencyScale's built-in defaults. This is the adjustment point for a currency this codebase's
+// defaults get wrong, or a token currencyScale has no entry for at all, without a recompile.
+var scaleOverrides = map[CurrSymbol]int{}
+
+// LoadScaleOverridesFile reads a JSON file mapping currency code to decimal scale (e.g.
+// {"ETH": 18, "SHIB": 8}) and merges it into scaleOverrides. No YAML library is a dependency of
+// this module (see go.mod), so overrides are plain JSON via the standard library.
+func LoadScaleOverridesFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("LoadScaleOverridesFile: %w", err)
+	}
+	var overrides map[string]int
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return fmt.Errorf("LoadScaleOverridesFile: %s: %w", path, err)
+	}
+	for rawCode, scale := range overrides {
+		code, err := NewCurrSymbol(rawCode)
+		if err != nil {
+			return fmt.Errorf("LoadScaleOverridesFile: %s: %w", path, err)
+		}
+		scaleOverrides[code] = scale
+	}
+	return nil
+}
+
+// scaleFor returns the number of decimal places used for code: scaleOverrides first, then
+// currencyScale, defaulting to 2.
+func scaleFor(code CurrSymbol) int {
+	if scale, found := scaleOverrides[code]; found {
+		return scale
+	}
+	if scale, found := currencyScale[code]; found {
+		return scale
+	}
+	return 2
+}
+
+// ScaleTolerancePercent derives a default "close enough" tolerance, as a percentage, from code's
+// configured scale (see scaleFor): the finer a currency's scale, the tighter the default
+// tolerance. It exists for cross-row comparisons - such as ExchangeToWithdraw's queued USD
+// equivalent against WithdrawExchanged's own, where the £/$ exchange rate can drift slightly
+// between two legs of the same transfer - that used to carry only a "may not match, presumably
+// because of drift" comment and no actual check.
+func ScaleTolerancePercent(code CurrSymbol) float64 {
+	return 1.0 / float64(scaleFor(code))
+}
+
+// Money represents an exact monetary amount as an integer count of minor units
+// (e.g. pennies for GBP, satoshis for BTC) together with the currency it is denominated in.
+type Money struct {
+	amount int64
+	code   CurrSymbol
+}
+
+// New builds a Money from an already-scaled integer amount of minor units and an already-
+// validated CurrSymbol. It never fails today but returns an error to allow for future validation
+// without breaking callers.
+func New(amount int64, code CurrSymbol) (Money, error) {
+	return Money{amount: amount, code: code}, nil
+}
+
+// MustNew is like New but panics on error. Intended for constants and tests.
+func MustNew(amount int64, code CurrSymbol) Money {
+	m, err := New(amount, code)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// ParseMoney parses a decimal string amount (e.g. "9.99", "-9.99", "123") for the given raw
+// currency/token code into a Money value: rawCode is validated and normalized via NewCurrSymbol,
+// and the amount is read to that currency's scale (see currencyScale).
+func ParseMoney(amount string, rawCode string) (Money, error) {
+	code, err := NewCurrSymbol(rawCode)
+	if err != nil {
+		return Money{}, err
+	}
+	amount = strings.TrimSpace(amount)
+	negative := false
+	if strings.HasPrefix(amount, "-") {
+		negative = true
+		amount = amount[1:]
+	}
+
+	scale := scaleFor(code)
+	parts := strings.SplitN(amount, ".", 2)
+	wholeStr := parts[0]
+	if wholeStr == "" {
+		wholeStr = "0"
+	}
+	fracStr := ""
+	if len(parts) == 2 {
+		fracStr = parts[1]
+	}
+	if len(fracStr) > scale {
+		fracStr = fracStr[:scale]
+	}
+	for len(fracStr) < scale {
+		fracStr += "0"
+	}
+
+	whole, err := strconv.ParseInt(wholeStr, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("Money: invalid whole part %q in %q: %w", wholeStr, amount, err)
+	}
+	frac := int64(0)
+	if fracStr != "" {
+		frac, err = strconv.ParseInt(fracStr, 10, 64)
+		if err != nil {
+			return Money{}, fmt.Errorf("Money: invalid fractional part %q in %q: %w", fracStr, amount, err)
+		}
+	}
+
+	minorUnitsPerWhole := int64(1)
+	for i := 0; i < scale; i++ {
+		minorUnitsPerWhole *= 10
+	}
+
+	total := whole*minorUnitsPerWhole + frac
+	if negative {
+		total = -total
+	}
+	return Money{amount: total, code: code}, nil
+}
+
+// ParseMoneyPair parses two amount/currency pairs in one call, for the common case of
+// checking an Input Amount/Currency against an Output Amount/Currency. It returns an error
+// if either amount fails to parse.
+func ParseMoneyPair(inputAmount, inputCurrency, outputAmount, outputCurrency string) (Money, Money, error) {
+	in, err := ParseMoney(inputAmount, inputCurrency)
+	if err != nil {
+		return Money{}, Money{}, err
+	}
+	out, err := ParseMoney(outputAmount, outputCurrency)
+	if err != nil {
+		return Money{}, Money{}, err
+	}
+	return in, out, nil
+}
+
+// Amount returns the raw minor-unit amount (e.g. pennies, satoshis).
+func (m Money) Amount() int64 {
+	return m.amount
+}
+
+// Code returns the currency code that m is denominated in.
+func (m Money) Code() CurrSymbol {
+	return m.code
+}
+
+// String renders the amount back into a decimal string (e.g. "9.99").
+func (m Money) String() string {
+	scale := scaleFor(m.code)
+	minorUnitsPerWhole := int64(1)
+	for i := 0; i < scale; i++ {
+		minorUnitsPerWhole *= 10
+	}
+	sign := ""
+	amount := m.amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	whole := amount / minorUnitsPerWhole
+	frac := amount % minorUnitsPerWhole
+	if scale == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, whole, scale, frac)
+}
+
+// SameCurrency reports whether m and other share the same CurrSymbol.
+func (m Money) SameCurrency(other Money) bool {
+	return m.code == other.code
+}
+
+// Equals reports whether m and other represent the same amount in the same currency.
+func (m Money) Equals(other Money) bool {
+	return m.SameCurrency(other) && m.amount == other.amount
+}
+
+// WithinTolerancePercent reports whether m and other, which must share a CurrSymbol, differ by
+// no more than percent% of m's magnitude, comparing magnitudes only (the two sides of a matched
+// pair do not always share a sign convention).
+func (m Money) WithinTolerancePercent(other Money, percent float64) (bool, error) {
+	if !m.SameCurrency(other) {
+		return false, ErrCurrencyMismatch
+	}
+	a, b := m.amount, other.amount
+	if a < 0 {
+		a = -a
+	}
+	if b < 0 {
+		b = -b
+	}
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	return float64(diff) <= float64(a)*percent/100, nil
+}
+
+// Add returns m + other, or ErrCurrencyMismatch if the two are not in the same currency.
+func (m Money) Add(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{amount: m.amount + other.amount, code: m.code}, nil
+}
+
+// Subtract returns m - other, or ErrCurrencyMismatch if the two are not in the same currency.
+func (m Money) Subtract(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{amount: m.amount - other.amount, code: m.code}, nil
+}
+
+// Negate returns -m.
+func (m Money) Negate() Money {
+	return Money{amount: -m.amount, code: m.code}
+}
+
+// IsZero reports whether m is zero.
+func (m Money) IsZero() bool {
+	return m.amount == 0
+}
+
+// Allocate splits m into len(ratios) parts proportional to ratios, distributing any
+// leftover minor units one at a time in ratios order, starting with the first part and skipping
+// parts whose ratio is zero, so that the parts always sum back to exactly m.
+func (m Money) Allocate(ratios []int) ([]Money, error) {
+	if len(ratios) == 0 {
+		return nil, fmt.Errorf("Money.Allocate: no ratios supplied")
+	}
+	total := 0
+	for _, r := range ratios {
+		if r < 0 {
+			return nil, fmt.Errorf("Money.Allocate: negative ratio %d", r)
+		}
+		total += r
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("Money.Allocate: ratios sum to zero")
+	}
+
+	results := make([]Money, len(ratios))
+	var allocated int64
+	for i, r := range ratios {
+		share := m.amount * int64(r) / int64(total)
+		results[i] = Money{amount: share, code: m.code}
+		allocated += share
+	}
+
+	// Distribute the remainder (caused by integer truncation) one minor unit at a time.
+	remainder := m.amount - allocated
+	step := int64(1)
+	if remainder < 0 {
+		step = -1
+	}
+	for i := 0; remainder != 0; i = (i + 1) % len(ratios) {
+		if ratios[i] == 0 {
+			continue
+		}
+		results[i].amount += step
+		remainder -= step
+	}
+
+	return results, nil
+}
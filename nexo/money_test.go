@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithinTolerancePercent(t *testing.T) {
+	a := MustNew(10000, "USD") // $100.00
+	within, err := a.WithinTolerancePercent(MustNew(10040, "USD"), 0.5)
+	if err != nil {
+		t.Fatalf("WithinTolerancePercent: unexpected error: %s", err)
+	}
+	if !within {
+		t.Errorf("WithinTolerancePercent: $100.40 vs $100.00 at 0.5%% tolerance: got false, want true")
+	}
+
+	within, err = a.WithinTolerancePercent(MustNew(10060, "USD"), 0.5)
+	if err != nil {
+		t.Fatalf("WithinTolerancePercent: unexpected error: %s", err)
+	}
+	if within {
+		t.Errorf("WithinTolerancePercent: $100.60 vs $100.00 at 0.5%% tolerance: got true, want false")
+	}
+}
+
+func TestWithinTolerancePercentCurrencyMismatch(t *testing.T) {
+	a := MustNew(10000, "USD")
+	b := MustNew(10000, "GBP")
+	if _, err := a.WithinTolerancePercent(b, 1); err != ErrCurrencyMismatch {
+		t.Errorf("WithinTolerancePercent: got %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestScaleTolerancePercent(t *testing.T) {
+	if got := ScaleTolerancePercent("GBP"); got != 0.5 {
+		t.Errorf("ScaleTolerancePercent(GBP): got %v, want 0.5", got)
+	}
+	if got := ScaleTolerancePercent("BTC"); got != 0.125 {
+		t.Errorf("ScaleTolerancePercent(BTC): got %v, want 0.125", got)
+	}
+}
+
+func TestLoadScaleOverridesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scales.json")
+	if err := os.WriteFile(path, []byte(`{"DOGE": 6}`), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	defer delete(scaleOverrides, MustCurrSymbol("DOGE"))
+
+	if err := LoadScaleOverridesFile(path); err != nil {
+		t.Fatalf("LoadScaleOverridesFile: unexpected error: %s", err)
+	}
+	if got := scaleFor(MustCurrSymbol("DOGE")); got != 6 {
+		t.Errorf("scaleFor(DOGE) after override: got %d, want 6", got)
+	}
+}
+
+func TestLoadScaleOverridesFileUnknownCurrency(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scales.json")
+	if err := os.WriteFile(path, []byte(`{"NOT-A-CURRENCY": 6}`), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	if err := LoadScaleOverridesFile(path); err == nil {
+		t.Errorf("LoadScaleOverridesFile: expected an error for an unrecognised currency, got none")
+	}
+}
+
+func TestLoadScaleOverridesFileMissing(t *testing.T) {
+	if err := LoadScaleOverridesFile("/nonexistent/scales.json"); err == nil {
+		t.Errorf("LoadScaleOverridesFile: expected an error for a missing file, got none")
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"testing"
+)
+
+// TestWriteOFX runs a canned Interest + Deposit + ExchangeToWithdraw sequence through
+// convertSingleTransaction and diffs the resulting OFX document against a golden file.
+// ExchangeToWithdraw produces no output-map entry of its own (it only queues a record for a
+// later WithdrawExchanged), so the golden document only carries the Interest/Deposit INCOME
+// entries; it is included here to prove that a queue-only transaction doesn't upset the export.
+func TestWriteOFX(t *testing.T) {
+	output := make(map[string][][]string, 0)
+	exchangeToWithdraw := make([]queuedRecord, 0)
+	depositToExchange := make([]queuedRecord, 0)
+
+	interestRow := buildStandardTestVector()
+	interestRow[tx_ID] = "TX-INTEREST"
+	interestRow[tx_Type] = "Interest"
+	interestRow[tx_InputCurrency] = "NEXO"
+	interestRow[tx_OutputCurrency] = "NEXO"
+	interestRow[tx_InputAmount] = "0.11"
+	interestRow[tx_OutputAmount] = "0.11"
+	interestRow[tx_UsdEquivalent] = "$10.00"
+	interestRow[tx_Details] = "approved / 8.00 GBPx"
+	interestRow[tx_DateTime] = "2022-01-01 09:00:00"
+
+	depositRow := buildStandardTestVector()
+	depositRow[tx_ID] = "TX-DEPOSIT"
+	depositRow[tx_Type] = "Deposit"
+	depositRow[tx_InputCurrency] = "NEXO"
+	depositRow[tx_OutputCurrency] = "NEXO"
+	depositRow[tx_InputAmount] = "1.00"
+	depositRow[tx_OutputAmount] = "1.00"
+	depositRow[tx_UsdEquivalent] = "$5.00"
+	depositRow[tx_Details] = "approved / Nexonomics Exchange Cash-back Promotion"
+	depositRow[tx_DateTime] = "2022-01-02 09:00:00"
+
+	exchangeToWithdrawRow := buildStandardTestVector()
+	exchangeToWithdrawRow[tx_ID] = "TX-EXCH2WITHDRAW"
+	exchangeToWithdrawRow[tx_Type] = "ExchangeToWithdraw"
+	exchangeToWithdrawRow[tx_InputCurrency] = "GBPX"
+	exchangeToWithdrawRow[tx_OutputCurrency] = "GBP"
+	exchangeToWithdrawRow[tx_InputAmount] = "-9.99"
+	exchangeToWithdrawRow[tx_OutputAmount] = "9.99"
+	exchangeToWithdrawRow[tx_UsdEquivalent] = "$12.00"
+	exchangeToWithdrawRow[tx_Details] = "approved / GBPX to GBP"
+	exchangeToWithdrawRow[tx_DateTime] = "2022-01-03 09:00:00"
+
+	for _, row := range [][]string{interestRow, depositRow, exchangeToWithdrawRow} {
+		if errorText := convertSingleTransaction(row, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London"); errorText != "" {
+			t.Fatalf("convertSingleTransaction(%s): unexpected error text: %q", row[tx_Type], errorText)
+		}
+	}
+
+	got, err := writeOFX(output, "GBP")
+	if err != nil {
+		t.Fatalf("writeOFX: unexpected error: %s", err)
+	}
+
+	want, err := os.ReadFile("testdata/ofx_golden.ofx")
+	if err != nil {
+		t.Fatalf("cannot read golden file: %s", err)
+	}
+
+	if got != string(want) {
+		t.Errorf("writeOFX output does not match golden file:\n--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+}
+
+// TestWriteOFXUnhandledEventType verifies that an unrecognised event tag is reported as an
+// error rather than silently dropped from the export.
+func TestWriteOFXUnhandledEventType(t *testing.T) {
+	output := map[string][][]string{
+		"NEXO": {{"", "nexo.io", "2022-01-01 09:00:00", "", "1.00", "", "10.00", "", "", "", "", "", "", "UNKNOWN"}},
+	}
+
+	if _, err := writeOFX(output, "GBP"); err == nil {
+		t.Errorf("writeOFX: expected an error for an unhandled event type, got nil")
+	}
+}
+
+// TestWriteOFXTransfer verifies that a reconcileTransfers-style "TRANSFER" entry is rendered as
+// a BANKTRANLIST STMTTRN with TRNTYPE=XFER, not as an INVTRANLIST aggregate.
+func TestWriteOFXTransfer(t *testing.T) {
+	output := map[string][][]string{
+		"GBP": {{"", "nexo.io", "2022-01-03 09:00:00", "", "9.99", "", "12.00", "", "", "", "", "", "", "TRANSFER"}},
+	}
+
+	got, err := writeOFX(output, "GBP")
+	if err != nil {
+		t.Fatalf("writeOFX: unexpected error: %s", err)
+	}
+
+	tags := parseOfxTags(got)
+	if v, ok := firstOfxTag(tags, "TRNTYPE"); !ok || v != "XFER" {
+		t.Errorf("TRNTYPE: got %q, %v, want \"XFER\"", v, ok)
+	}
+	if v, ok := firstOfxTag(tags, "TRNAMT"); !ok || v != "9.99" {
+		t.Errorf("TRNAMT: got %q, %v, want \"9.99\"", v, ok)
+	}
+	if v, ok := firstOfxTag(tags, "DTPOSTED"); !ok || v != "20220103090000" {
+		t.Errorf("DTPOSTED: got %q, %v, want \"20220103090000\"", v, ok)
+	}
+}
+
+// TestWriteOFXRoundTrip parses writeOFX's output back with a lightweight tag scanner (see
+// parseOfxTags) and checks that the FITID/TOTAL/CURSYM fields it recovers match what was fed in,
+// proving the emitted document round-trips rather than merely "looking like" OFX.
+func TestWriteOFXRoundTrip(t *testing.T) {
+	output := map[string][][]string{
+		"BTC": {
+			{"", "nexo.io", "2022-02-01 10:00:00", "", "0.50", "", "15000.00", "", "", "", "", "", "", "BUY"},
+			{"", "nexo.io", "2022-02-02 10:00:00", "", "0.25", "", "7500.00", "", "", "", "", "", "", "SELL"},
+		},
+	}
+
+	got, err := writeOFX(output, "USD")
+	if err != nil {
+		t.Fatalf("writeOFX: unexpected error: %s", err)
+	}
+
+	tags := parseOfxTags(got)
+
+	wantTotals := []string{"15000.00", "7500.00"}
+	gotTotals := allOfxTags(tags, "TOTAL")
+	if len(gotTotals) != len(wantTotals) {
+		t.Fatalf("TOTAL count: got %d, want %d", len(gotTotals), len(wantTotals))
+	}
+	for i, want := range wantTotals {
+		if gotTotals[i] != want {
+			t.Errorf("TOTAL[%d]: got %q, want %q", i, gotTotals[i], want)
+		}
+	}
+
+	wantUnits := []string{"0.50", "-0.25"}
+	gotUnits := allOfxTags(tags, "UNITS")
+	if len(gotUnits) != len(wantUnits) {
+		t.Fatalf("UNITS count: got %d, want %d", len(gotUnits), len(wantUnits))
+	}
+	for i, want := range wantUnits {
+		if gotUnits[i] != want {
+			t.Errorf("UNITS[%d]: got %q, want %q", i, gotUnits[i], want)
+		}
+	}
+
+	// USD is the base currency here, so BTC must round-trip as an ORIGCURRENCY, not bare CURSYM.
+	cursyms := allOfxTags(tags, "CURSYM")
+	if len(cursyms) < 2 || cursyms[0] != "USD" || cursyms[1] != "BTC" {
+		t.Errorf("CURSYM sequence: got %v, want [USD BTC ...]", cursyms)
+	}
+}
+
+// ofxTag is a single leaf OFX element recovered by parseOfxTags: a start tag, the text between
+// it and its matching end tag, in document order.
+type ofxTag struct {
+	Name, Value string
+}
+
+// ofxLeafTagRe matches a leaf OFX element (start tag, plain text, matching end tag) on one line;
+// it does not understand nesting or attributes, which is exactly as much as these tests need.
+var ofxLeafTagRe = regexp.MustCompile(`<([A-Z0-9]+)>([^<]*)</([A-Z0-9]+)>`)
+
+// parseOfxTags does a flat, order-preserving scan for leaf OFX tags (value with no nested
+// children) - enough to round-trip the numeric/ID fields these tests check without writing a
+// full SGML/XML parser.
+func parseOfxTags(doc string) []ofxTag {
+	matches := ofxLeafTagRe.FindAllStringSubmatch(doc, -1)
+	tags := make([]ofxTag, 0, len(matches))
+	for _, m := range matches {
+		tags = append(tags, ofxTag{Name: m[1], Value: m[2]})
+	}
+	return tags
+}
+
+// firstOfxTag returns the value of the first tag named name, and whether one was found.
+func firstOfxTag(tags []ofxTag, name string) (string, bool) {
+	for _, tag := range tags {
+		if tag.Name == name {
+			return tag.Value, true
+		}
+	}
+	return "", false
+}
+
+// allOfxTags returns the values of every tag named name, in document order.
+func allOfxTags(tags []ofxTag, name string) []string {
+	var values []string
+	for _, tag := range tags {
+		if tag.Name == name {
+			values = append(values, tag.Value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,106 @@
+package main
+
+// This file reconciles the exchangeToWithdraw/depositToExchange FIFO queues against each other,
+// once all rows have been processed, to catch a case splitFIFOHead never sees: a withdrawal
+// that never completed because the money was topped back up into NEXO instead.
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ReconcileConfig controls how closely a leftover withdrawal and a leftover deposit must line
+// up in amount and time for reconcileTransfers to treat them as a single cross-venue TRANSFER.
+type ReconcileConfig struct {
+	TolerancePercent float64 // maximum allowed difference between amounts, as a percentage of the withdrawal amount
+	ToleranceHours   float64 // maximum allowed gap between the withdrawal and the deposit, in hours
+}
+
+// DefaultReconcileConfig requires an exact amount match - GBPX and GBP are pegged 1:1, so there
+// is no exchange-rate drift to allow for here - and gives the money up to a week to reappear as
+// a deposit.
+var DefaultReconcileConfig = ReconcileConfig{TolerancePercent: 0, ToleranceHours: 24 * 7}
+
+// reconcileTransfers is called once every row has been processed. Under normal operation
+// exchangeToWithdraw and depositToExchange are both fully drained by the matching
+// WithdrawExchanged/ExchangeDepositedOn leg of their own chain (see splitFIFOHead); anything
+// still queued here is a withdrawal or deposit whose confirming leg never arrived.
+//
+// That happens when GBPX converted to GBP in readiness for a withdrawal (ExchangeToWithdraw) is,
+// instead, topped back up into NEXO (DepositToExchange): the withdrawal never completed.
+// ExchangeToWithdraw has already recorded that conversion as a disposal of GBPX - a phantom SELL,
+// since the GBPX was never actually withdrawn anywhere. reconcileTransfers matches such a pair by
+// (amount tolerance, time window) and records a single TRANSFER row in output instead, draining
+// both queues. Matching this way does not retroactively undo the disposal already realised by
+// ExchangeToWithdraw against ledger; teaching the ledger to reverse an already-realised disposal
+// is follow-up work, not attempted here.
+//
+// Ties are broken deterministically: depositToExchange is already in FIFO (chronological) order,
+// so the earliest eligible deposit is always matched first.
+//
+// Anything left over once matching is done is returned as a single error listing every unmatched
+// row's transaction ID, for the user to review by hand.
+func reconcileTransfers(output *map[string][][]string, exchangeToWithdraw, depositToExchange *[]queuedRecord, cfg ReconcileConfig) error {
+	var unmatchedWithdrawals []queuedRecord
+
+	for _, w := range *exchangeToWithdraw {
+		matchIndex := -1
+		for i, d := range *depositToExchange {
+			if !amountsWithinTolerance(w.amount.Amount(), d.amount.Amount(), cfg.TolerancePercent) {
+				continue
+			}
+			withdrawnAt, err := time.Parse("2006-01-02 15:04:05", w.row[tx_DateTime])
+			if err != nil {
+				continue
+			}
+			depositedAt, err := time.Parse("2006-01-02 15:04:05", d.row[tx_DateTime])
+			if err != nil {
+				continue
+			}
+			if depositedAt.Before(withdrawnAt) || depositedAt.Sub(withdrawnAt).Hours() > cfg.ToleranceHours {
+				continue
+			}
+			matchIndex = i
+			break
+		}
+
+		if matchIndex == -1 {
+			unmatchedWithdrawals = append(unmatchedWithdrawals, w)
+			continue
+		}
+
+		*depositToExchange = append((*depositToExchange)[:matchIndex], (*depositToExchange)[matchIndex+1:]...)
+		entry := []string{"", "nexo.io", w.row[tx_DateTime], "", w.row[tx_OutputAmount], "", w.row[tx_UsdEquivalent][1:], "", "", "", "", "", "", "TRANSFER"}
+		(*output)["GBP"] = append((*output)["GBP"], entry)
+	}
+
+	unmatchedDeposits := *depositToExchange
+	*exchangeToWithdraw = unmatchedWithdrawals
+	*depositToExchange = nil
+
+	if len(unmatchedWithdrawals) == 0 && len(unmatchedDeposits) == 0 {
+		return nil
+	}
+
+	errorText := "unmatched cross-venue transfers:"
+	for _, w := range unmatchedWithdrawals {
+		errorText += fmt.Sprintf(" TX %s (withdrawal, no matching deposit);", w.row[tx_ID])
+	}
+	for _, d := range unmatchedDeposits {
+		errorText += fmt.Sprintf(" TX %s (deposit, no matching withdrawal);", d.row[tx_ID])
+	}
+	return fmt.Errorf("%s", errorText)
+}
+
+// amountsWithinTolerance reports whether b is within percent% of a, comparing magnitudes only:
+// convertSingleTransaction queues the GBP side on both exchangeToWithdraw and depositToExchange,
+// but a queued amount recorded with the opposite sign still matches, and a cross-venue match only
+// cares that the same amount of money moved.
+func amountsWithinTolerance(a, b int64, percent float64) bool {
+	a, b = int64(math.Abs(float64(a))), int64(math.Abs(float64(b)))
+	if a == b {
+		return true
+	}
+	return math.Abs(float64(a-b)) <= float64(a)*percent/100
+}
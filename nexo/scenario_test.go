@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/AntonioCarlini/data-processing/nexo/testgen"
+)
+
+// RunScenario parses src as a testgen DSL scenario and feeds the resulting rows through
+// convertSingleTransaction in order, returning the accumulated output, FIFO queues and any
+// error text. It replaces the "hand-build every row with buildStandardTestVector() + field
+// mutation" approach for tests that exercise multi-row queue-matching sequences.
+func RunScenario(t *testing.T, src string) (output map[string][][]string, exchangeToWithdraw, depositToExchange []queuedRecord, errorText string) {
+	t.Helper()
+
+	rows, err := testgen.Parse(src)
+	if err != nil {
+		t.Fatalf("testgen.Parse: %s", err)
+	}
+
+	output = make(map[string][][]string, 0)
+	exchangeToWithdraw = make([]queuedRecord, 0)
+	depositToExchange = make([]queuedRecord, 0)
+
+	for _, row := range rows {
+		errorText += convertSingleTransaction(row, &output, &exchangeToWithdraw, &depositToExchange, nil, nil, nil, "Europe/London")
+	}
+
+	return output, exchangeToWithdraw, depositToExchange, errorText
+}
@@ -0,0 +1,157 @@
+// Package testgen parses a small line-oriented DSL for building Nexo test transaction
+// sequences, so that multi-row FIFO-queue scenarios don't have to be hand-built with
+// buildStandardTestVector() + field-by-field mutation in every test.
+//
+// Grammar: one instruction per line, "<Type> <Currency> <Amount>". "#" starts a
+// comment that runs to end of line; blank lines separate "blocks" purely for
+// readability, all rows are still emitted, in file order, as a single flat sequence.
+// <Currency> is a bare code (e.g. "NEXO") for single-currency transaction types, or a
+// "FROM>TO" pair (e.g. "GBPX>GBP") for the two-leg Exchange* types.
+//
+//	Deposit NEXO 9.99
+//	Interest NEXO 0.11
+//
+//	# withdraw 9.99 GBP via GBPX
+//	ExchangeToWithdraw GBPX>GBP 9.99
+//	WithdrawExchanged   GBP     9.99
+package testgen
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Column indices, matching the layout used throughout the nexo converter:
+// Transaction, Type, Input Currency, Input Amount, Output Currency, Output Amount,
+// USD Equivalent, Details, Outstanding Loan, Date / Time.
+const (
+	colID = iota
+	colType
+	colInputCurrency
+	colInputAmount
+	colOutputCurrency
+	colOutputAmount
+	colUsdEquivalent
+	colDetails
+	colOutstandingLoan
+	colDateTime
+	numColumns
+)
+
+// TxRow is a single generated row, in the same column order as the Nexo CSV export.
+type TxRow []string
+
+// fakeClockStart is where the fake clock in Parse starts ticking; each row advances it by
+// one minute, giving every row in a scenario a distinct, deterministic Date/Time.
+var fakeClockStart = time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Parse parses src and returns the TxRow sequence it describes, in file order.
+func Parse(src string) ([]TxRow, error) {
+	var rows []TxRow
+	id := 0
+	clock := fakeClockStart
+
+	for lineNum, line := range strings.Split(src, "\n") {
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("testgen: line %d: expected \"<Type> <Currency> <Amount>\", got %q", lineNum+1, line)
+		}
+
+		id++
+		row, err := buildRow(fields[0], fields[1], fields[2], id, clock)
+		if err != nil {
+			return nil, fmt.Errorf("testgen: line %d: %w", lineNum+1, err)
+		}
+		rows = append(rows, row)
+		clock = clock.Add(time.Minute)
+	}
+
+	return rows, nil
+}
+
+// buildRow renders a single DSL instruction into the canonical TxRow, populating tx_ID
+// monotonically and tx_Details with the per-type "approved / ..." text that
+// convertSingleTransaction requires.
+func buildRow(txType, currency, amount string, id int, when time.Time) (TxRow, error) {
+	row := make(TxRow, numColumns)
+	row[colID] = fmt.Sprintf("TX-%d", id)
+	row[colType] = txType
+	row[colOutstandingLoan] = "$0.00"
+	row[colDateTime] = when.Format("2006-01-02 15:04:05")
+	row[colUsdEquivalent] = "$" + amount
+
+	switch txType {
+	case "Interest":
+		row[colInputCurrency], row[colOutputCurrency] = currency, currency
+		row[colInputAmount], row[colOutputAmount] = amount, amount
+		row[colDetails] = "approved / " + amount + " GBPx"
+	case "FixedTermInterest":
+		row[colInputCurrency], row[colOutputCurrency] = currency, currency
+		row[colInputAmount], row[colOutputAmount] = amount, amount
+		row[colDetails] = "approved / Term Deposit Interest"
+	case "Deposit":
+		row[colInputCurrency], row[colOutputCurrency] = currency, currency
+		row[colInputAmount], row[colOutputAmount] = amount, amount
+		row[colDetails] = "approved / Nexonomics Exchange Cash-back Promotion"
+	case "LockingTermDeposit":
+		row[colInputCurrency], row[colOutputCurrency] = currency, currency
+		row[colInputAmount] = "-" + amount
+		row[colOutputAmount] = amount
+		row[colDetails] = "approved / Transfer from Savings Wallet to Term Wallet"
+	case "UnlockingTermDeposit":
+		row[colInputCurrency], row[colOutputCurrency] = currency, currency
+		row[colInputAmount], row[colOutputAmount] = amount, amount
+		row[colDetails] = "approved / Transfer from Term Wallet to Savings Wallet"
+	case "DepositToExchange":
+		in, out, err := splitPair(currency)
+		if err != nil {
+			return nil, err
+		}
+		row[colInputCurrency], row[colOutputCurrency] = in, out
+		row[colInputAmount], row[colOutputAmount] = amount, amount
+		row[colDetails] = "approved / GBP Top Up"
+	case "ExchangeDepositedOn":
+		in, out, err := splitPair(currency)
+		if err != nil {
+			return nil, err
+		}
+		row[colInputCurrency], row[colOutputCurrency] = in, out
+		row[colInputAmount], row[colOutputAmount] = amount, amount
+		row[colDetails] = "approved / GBP to GBPX"
+	case "ExchangeToWithdraw":
+		in, out, err := splitPair(currency)
+		if err != nil {
+			return nil, err
+		}
+		row[colInputCurrency], row[colOutputCurrency] = in, out
+		row[colInputAmount] = "-" + amount
+		row[colOutputAmount] = amount
+		row[colDetails] = "approved / GBPX to GBP"
+	case "WithdrawExchanged":
+		row[colInputCurrency], row[colOutputCurrency] = currency, currency
+		row[colInputAmount], row[colOutputAmount] = amount, amount
+		row[colDetails] = "approved / GBP withdrawal"
+	default:
+		return nil, fmt.Errorf("unknown transaction type %q", txType)
+	}
+
+	return row, nil
+}
+
+// splitPair splits a "FROM>TO" currency pair, as used by the Exchange* DSL instructions.
+func splitPair(pair string) (from, to string, err error) {
+	parts := strings.SplitN(pair, ">", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("expected currency pair \"FROM>TO\", got %q", pair)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AntonioCarlini/data-processing/nexo/costbasis"
+)
+
+// This file introduces a pluggable alternative to convertSingleTransaction's single monolithic
+// switch statement: each Nexo transaction Type can instead be handled by a LegValidator,
+// registered into legValidators by its own init(), and looked up by Kind() at dispatch time. A
+// user running a non-GBP Nexo account variant (EUR/USD) can add a validator for a Type this
+// codebase has never seen, in its own file, without touching convert-nexo.go at all.
+//
+// Only the four simplest, already self-contained kinds - LockingTermDeposit, UnlockingTermDeposit,
+// Rejected, Refunded - have been migrated so far (see validator_lockingtermdeposit.go,
+// validator_unlockingtermdeposit.go, validator_rejected.go, validator_refunded.go). The rest
+// (Interest, Deposit, Withdrawal, Exchange and its variants, the ExchangeToWithdraw/
+// WithdrawExchanged/DepositToExchange/ExchangeDepositedOn FIFO pairs) remain in
+// convertSingleTransaction's switch: each of those also threads cost-basis lots, FIFO queue
+// state, or fee recording through recordFee/acquireLot/disposeLot/matchOrSplitPendingLeg in ways
+// that don't yet have an agreed MatchState shape, and migrating them without a compiler to catch
+// a dropped side effect is a correctness risk this change does not take on. Issue.String and
+// issuesToErrorOutput keep both the migrated and not-yet-migrated halves producing the exact same
+// errorOutput string shape in the meantime, so existing callers and golden files keep passing.
+
+// IssueSeverity classifies an Issue. Every Issue a LegValidator returns today is IssueError -
+// convertSingleTransaction's original errorOutput string never distinguished severities - but the
+// type exists so a validator added later (e.g. a drift warning) has somewhere to say so.
+type IssueSeverity int
+
+const (
+	IssueError IssueSeverity = iota
+	IssueWarning
+)
+
+// Issue is a structured validation finding: which transaction, which field, and what went wrong.
+// It is the typed alternative to building up errorOutput by ad-hoc string concatenation.
+type Issue struct {
+	Severity IssueSeverity
+	TxID     string
+	Field    string
+	Message  string
+}
+
+// String renders an Issue in convertSingleTransaction's historical "TX <id>: <message>\n" shape.
+func (i Issue) String() string {
+	return fmt.Sprintf("TX %s: %s\n", i.TxID, i.Message)
+}
+
+// issuesToErrorOutput joins issues back into the errorOutput string format convertSingleTransaction
+// has always returned, so a caller doesn't need to know whether a given row went through a
+// LegValidator or the legacy switch.
+func issuesToErrorOutput(issues []Issue) string {
+	var sb strings.Builder
+	for _, issue := range issues {
+		sb.WriteString(issue.String())
+	}
+	return sb.String()
+}
+
+// MatchState carries the per-run state a LegValidator needs, mirroring the parameters
+// convertSingleTransaction itself already threads through the legacy switch: the output map, the
+// two FIFO queues, the cost-basis ledger and its realised gains, the per-currency Account
+// balances, and the two columns (USD Equivalent, "uk date/time") every Type shares and that
+// convertSingleTransaction parses once up front.
+type MatchState struct {
+	Output             *map[string][][]string
+	ExchangeToWithdraw *[]queuedRecord
+	DepositToExchange  *[]queuedRecord
+	Ledger             *costbasis.Ledger
+	Gains              *[][]string
+	Accounts           map[string]*Account
+	UsdEquivalent      Money
+	UsdEquivalentErr   error
+	UkDateTime         string
+}
+
+// LegValidator is a pluggable check-and-record step for one Nexo transaction Type ("Kind").
+type LegValidator interface {
+	// Kind returns the exact row[tx_Type] string this validator handles.
+	Kind() string
+	// Validate checks row and, where the Type calls for it, records state against state (e.g.
+	// appending to a FIFO queue or state.Output). It returns one Issue per problem found; a nil
+	// or empty result means the row validated cleanly.
+	Validate(row []string, state *MatchState) []Issue
+}
+
+// legValidators holds every LegValidator registered via RegisterLegValidator, keyed by Kind().
+var legValidators = map[string]LegValidator{}
+
+// RegisterLegValidator adds validator to legValidators under its own Kind(), for
+// convertSingleTransaction's dispatcher to find. Intended to be called only from a package-level
+// init() - such as each validator_*.go file's own - so the only way to trigger its panic on a
+// duplicate Kind is a programming mistake caught the first time the program runs, not a
+// request-time code path.
+func RegisterLegValidator(validator LegValidator) {
+	kind := validator.Kind()
+	if _, exists := legValidators[kind]; exists {
+		panic(fmt.Sprintf("RegisterLegValidator: duplicate Kind %q", kind))
+	}
+	legValidators[kind] = validator
+}
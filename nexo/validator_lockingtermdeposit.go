@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	RegisterLegValidator(lockingTermDepositValidator{})
+}
+
+// lockingTermDepositValidator handles "LockingTermDeposit": moving a token from the normal wallet
+// into a wallet where it earns higher STAKING rewards in return for being locked. It generates no
+// output and exists purely to check that the format is understood and has not changed.
+type lockingTermDepositValidator struct{}
+
+func (lockingTermDepositValidator) Kind() string { return "LockingTermDeposit" }
+
+func (lockingTermDepositValidator) Validate(row []string, state *MatchState) []Issue {
+	var issues []Issue
+
+	// Input/Output Currency must be identical
+	if row[tx_InputCurrency] != row[tx_OutputCurrency] {
+		issues = append(issues, Issue{TxID: row[tx_ID], Field: "Input Currency", Message: fmt.Sprintf("LockingTermDeposit currency error: input: %s, output: %s", row[tx_InputCurrency], row[tx_OutputCurrency])})
+	}
+	// Input Amount and Output Amount must be identical in absolute value: the former is negative and the latter is positive.
+	inputMoney, inputErr := ParseMoney(row[tx_InputAmount], row[tx_InputCurrency])
+	outputMoney, outputErr := ParseMoney(row[tx_OutputAmount], row[tx_OutputCurrency])
+	if inputErr != nil {
+		issues = append(issues, Issue{TxID: row[tx_ID], Field: "Input Amount", Message: fmt.Sprintf("LockingTermDeposit Input Amount conversion error: %s, issue: %s", row[tx_InputAmount], inputErr)})
+	}
+	if outputErr != nil {
+		issues = append(issues, Issue{TxID: row[tx_ID], Field: "Output Amount", Message: fmt.Sprintf("LockingTermDeposit Output Amount conversion error: %s, issue: %s", row[tx_OutputAmount], outputErr)})
+	}
+	if inputErr == nil && outputErr == nil && !inputMoney.Negate().Equals(outputMoney) {
+		issues = append(issues, Issue{TxID: row[tx_ID], Field: "Input Amount", Message: fmt.Sprintf("LockingTermDeposit currency amount error: input: %s, output: %s", row[tx_InputAmount], row[tx_OutputAmount])})
+	}
+	//       Details: "approved / Transfer from Savings Wallet to Term Wallet"
+	if !strings.HasPrefix(row[tx_Details], "approved / Transfer from Savings Wallet to Term Wallet") {
+		issues = append(issues, Issue{TxID: row[tx_ID], Field: "Details", Message: fmt.Sprintf("LockingTermDeposit Details error: input: %s", row[tx_Details])})
+	}
+	if state.UsdEquivalentErr != nil {
+		issues = append(issues, Issue{TxID: row[tx_ID], Field: "USD Equivalent", Message: fmt.Sprintf("LockingTermDeposit not in dollars [%s]: %s", row[tx_UsdEquivalent], state.UsdEquivalentErr)})
+	}
+	return issues
+}
@@ -0,0 +1,26 @@
+package main
+
+import "fmt"
+
+func init() {
+	RegisterLegValidator(refundedValidator{})
+}
+
+// refundedValidator handles "Refunded": releases a currency's outstanding Held balance (see
+// "Rejected" in validator_rejected.go) back to Available. It produces no CSV/OFX output row of
+// its own.
+type refundedValidator struct{}
+
+func (refundedValidator) Kind() string { return "Refunded" }
+
+func (refundedValidator) Validate(row []string, state *MatchState) []Issue {
+	if state.Accounts == nil {
+		return nil
+	}
+	refundedMoney, err := ParseMoney(row[tx_OutputAmount], row[tx_OutputCurrency])
+	if err != nil {
+		return []Issue{{TxID: row[tx_ID], Field: "Output Amount", Message: fmt.Sprintf("Refunded Output Amount invalid [%s]: %s", row[tx_OutputAmount], err)}}
+	}
+	releaseHeld(accountFor(state.Accounts, row[tx_OutputCurrency], refundedMoney), refundedMoney)
+	return nil
+}
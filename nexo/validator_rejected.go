@@ -0,0 +1,28 @@
+package main
+
+import "fmt"
+
+func init() {
+	RegisterLegValidator(rejectedValidator{})
+}
+
+// rejectedValidator handles "Rejected": an attempted transaction that never actually settled.
+// Nexo still lists the amount it attempted to move, so - rather than silently discarding the row -
+// its magnitude is moved from Available into Held on the relevant currency's Account (see
+// account.go), flagging it for review until a matching "Refunded" row, if any, releases it back.
+// It produces no CSV/OFX output row of its own.
+type rejectedValidator struct{}
+
+func (rejectedValidator) Kind() string { return "Rejected" }
+
+func (rejectedValidator) Validate(row []string, state *MatchState) []Issue {
+	if state.Accounts == nil {
+		return nil
+	}
+	rejectedMoney, err := ParseMoney(row[tx_InputAmount], row[tx_InputCurrency])
+	if err != nil {
+		return []Issue{{TxID: row[tx_ID], Field: "Input Amount", Message: fmt.Sprintf("Rejected Input Amount invalid [%s]: %s", row[tx_InputAmount], err)}}
+	}
+	holdAmount(accountFor(state.Accounts, row[tx_InputCurrency], rejectedMoney), rejectedMoney)
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+// TestLegValidatorsRegistered checks that the four kinds migrated so far are reachable through
+// the legValidators registry under their own Kind(), rather than only through
+// convertSingleTransaction's switch.
+func TestLegValidatorsRegistered(t *testing.T) {
+	for _, kind := range []string{"LockingTermDeposit", "UnlockingTermDeposit", "Rejected", "Refunded"} {
+		validator, found := legValidators[kind]
+		if !found {
+			t.Errorf("legValidators[%q]: not registered", kind)
+			continue
+		}
+		if got := validator.Kind(); got != kind {
+			t.Errorf("legValidators[%q].Kind() = %q, want %q", kind, got, kind)
+		}
+	}
+}
+
+// TestIssuesToErrorOutput checks that issuesToErrorOutput renders in convertSingleTransaction's
+// historical "TX <id>: <message>\n" errorOutput shape, so a validator-handled row and a
+// switch-handled row produce byte-identical error text.
+func TestIssuesToErrorOutput(t *testing.T) {
+	issues := []Issue{
+		{TxID: "TX-1", Field: "Input Amount", Message: "example problem one"},
+		{TxID: "TX-2", Field: "Details", Message: "example problem two"},
+	}
+	want := "TX TX-1: example problem one\nTX TX-2: example problem two\n"
+	if got := issuesToErrorOutput(issues); got != want {
+		t.Errorf("issuesToErrorOutput: got %q, want %q", got, want)
+	}
+	if got := issuesToErrorOutput(nil); got != "" {
+		t.Errorf("issuesToErrorOutput(nil): got %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	RegisterLegValidator(unlockingTermDepositValidator{})
+}
+
+// unlockingTermDepositValidator handles "UnlockingTermDeposit": moving a token from the long term
+// wallet into a normal wallet at the end of a term period. It generates no output and exists
+// purely to check that the format is understood and has not changed.
+type unlockingTermDepositValidator struct{}
+
+func (unlockingTermDepositValidator) Kind() string { return "UnlockingTermDeposit" }
+
+func (unlockingTermDepositValidator) Validate(row []string, state *MatchState) []Issue {
+	var issues []Issue
+
+	// Input/Output Currency must be identical
+	if row[tx_InputCurrency] != row[tx_OutputCurrency] {
+		issues = append(issues, Issue{TxID: row[tx_ID], Field: "Input Currency", Message: fmt.Sprintf("UnlockingTermDeposit currency error: input: %s, output: %s", row[tx_InputCurrency], row[tx_OutputCurrency])})
+	}
+	// Input Amount and Output Amount must be identical.
+	inputMoney, inputErr := ParseMoney(row[tx_InputAmount], row[tx_InputCurrency])
+	outputMoney, outputErr := ParseMoney(row[tx_OutputAmount], row[tx_OutputCurrency])
+	if inputErr != nil {
+		issues = append(issues, Issue{TxID: row[tx_ID], Field: "Input Amount", Message: fmt.Sprintf("UnlockingTermDeposit Input Amount conversion error: %s, issue: %s", row[tx_InputAmount], inputErr)})
+	}
+	if outputErr != nil {
+		issues = append(issues, Issue{TxID: row[tx_ID], Field: "Output Amount", Message: fmt.Sprintf("UnlockingTermDeposit Output Amount conversion error: %s, issue: %s", row[tx_OutputAmount], outputErr)})
+	}
+	if inputErr == nil && outputErr == nil && !inputMoney.Equals(outputMoney) {
+		issues = append(issues, Issue{TxID: row[tx_ID], Field: "Input Amount", Message: fmt.Sprintf("UnlockingTermDeposit currency amount error: input: %s, output: %s", row[tx_InputAmount], row[tx_OutputAmount])})
+	}
+	//       Details: "approved / Transfer from Term Wallet to Savings Wallet"
+	if !strings.HasPrefix(row[tx_Details], "approved / Transfer from Term Wallet to Savings Wallet") {
+		issues = append(issues, Issue{TxID: row[tx_ID], Field: "Details", Message: fmt.Sprintf("UnlockingTermDeposit Details error: input: %s", row[tx_Details])})
+	}
+	if state.UsdEquivalentErr != nil {
+		issues = append(issues, Issue{TxID: row[tx_ID], Field: "USD Equivalent", Message: fmt.Sprintf("UnlockingTermDeposit not in dollars [%s]: %s", row[tx_UsdEquivalent], state.UsdEquivalentErr)})
+	}
+	return issues
+}
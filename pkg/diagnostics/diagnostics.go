@@ -0,0 +1,103 @@
+// Package diagnostics collects structured validation findings - row, refid, severity, code,
+// message and any related rows - as a replacement for the scattered fmt.Printf warnings an
+// importer's row-by-row validation would otherwise print straight to stdout. A Collector can
+// render a human-readable summary for a terminal and a machine-readable JSON report for a batch
+// pipeline to act on, and answer "did anything blocking happen" for the process's exit code.
+package diagnostics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Severity classifies how serious an Issue is:
+//   - Warn marks a row that couldn't be matched against its expected counterpart (e.g. a
+//     "stakingfromspot" transfer with no pending "spottostaking" within the pairing window) but
+//     doesn't otherwise block conversion.
+//   - Error marks a row that is missing data a conversion depends on (e.g. a "spend"/"receive"
+//     pair with a blank txid or balance).
+//   - Fatal marks a row shape or transaction subtype the code has no handling for at all - what
+//     used to be an immediate log.Fatalf that aborted the whole run.
+type Severity string
+
+const (
+	Warn  Severity = "warn"
+	Error Severity = "error"
+	Fatal Severity = "fatal"
+)
+
+// Issue is a single structured validation finding.
+type Issue struct {
+	Row         int      `json:"row"`
+	RefID       string   `json:"ref_id,omitempty"`
+	Severity    Severity `json:"severity"`
+	Code        string   `json:"code"`
+	Message     string   `json:"message"`
+	RelatedRows []int    `json:"related_rows,omitempty"`
+}
+
+// Collector accumulates Issues recorded over the course of a conversion run.
+type Collector struct {
+	issues []Issue
+}
+
+// NewCollector returns an empty Collector.
+func NewCollector() *Collector {
+	return &Collector{issues: []Issue{}}
+}
+
+// Record appends issue to the collector.
+func (c *Collector) Record(issue Issue) {
+	c.issues = append(c.issues, issue)
+}
+
+// Issues returns every Issue recorded so far, in recording order.
+func (c *Collector) Issues() []Issue {
+	return c.issues
+}
+
+// HasBlockingIssues reports whether any Error- or Fatal-severity Issue has been recorded - the
+// condition a caller should exit non-zero on.
+func (c *Collector) HasBlockingIssues() bool {
+	for _, issue := range c.issues {
+		if issue.Severity == Error || issue.Severity == Fatal {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary renders a one-line-per-issue human-readable report.
+func (c *Collector) Summary() string {
+	if len(c.issues) == 0 {
+		return "No issues recorded.\n"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d issue(s) recorded:\n", len(c.issues))
+	for _, issue := range c.issues {
+		fmt.Fprintf(&b, "  [%s] row %d", issue.Severity, issue.Row)
+		if issue.RefID != "" {
+			fmt.Fprintf(&b, " (refid %s)", issue.RefID)
+		}
+		fmt.Fprintf(&b, ": %s: %s", issue.Code, issue.Message)
+		if len(issue.RelatedRows) > 0 {
+			fmt.Fprintf(&b, " (related rows: %v)", issue.RelatedRows)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// WriteJSON writes every recorded Issue to path as a JSON array.
+func (c *Collector) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(c.issues, "", "  ")
+	if err != nil {
+		return fmt.Errorf("diagnostics: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("diagnostics: %w", err)
+	}
+	return nil
+}
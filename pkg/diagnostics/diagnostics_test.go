@@ -0,0 +1,77 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHasBlockingIssues(t *testing.T) {
+	c := NewCollector()
+	if c.HasBlockingIssues() {
+		t.Errorf("HasBlockingIssues on an empty Collector: got true, want false")
+	}
+
+	c.Record(Issue{Row: 12, Severity: Warn, Code: "unmatched", Message: "no match within window"})
+	if c.HasBlockingIssues() {
+		t.Errorf("HasBlockingIssues with only a Warn recorded: got true, want false")
+	}
+
+	c.Record(Issue{Row: 14, Severity: Error, Code: "missing_fields", Message: "blank balance"})
+	if !c.HasBlockingIssues() {
+		t.Errorf("HasBlockingIssues with an Error recorded: got false, want true")
+	}
+}
+
+func TestSummary(t *testing.T) {
+	c := NewCollector()
+	if got, want := c.Summary(), "No issues recorded.\n"; got != want {
+		t.Errorf("Summary on an empty Collector = %q, want %q", got, want)
+	}
+
+	c.Record(Issue{Row: 12, RefID: "REF-A", Severity: Fatal, Code: "unhandled_subtype", Message: "unhandled transfer subtype", RelatedRows: []int{7}})
+	summary := c.Summary()
+	for _, want := range []string{"fatal", "row 12", "REF-A", "unhandled_subtype", "unhandled transfer subtype", "[7]"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("Summary() = %q, want it to contain %q", summary, want)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	c := NewCollector()
+	c.Record(Issue{Row: 3, Severity: Error, Code: "no_matching_spend", Message: "no matching spend"})
+
+	path := t.TempDir() + "/report.json"
+	if err := c.WriteJSON(path); err != nil {
+		t.Fatalf("WriteJSON: unexpected error: %s", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading written report: %s", err)
+	}
+	var issues []Issue
+	if err := json.Unmarshal(data, &issues); err != nil {
+		t.Fatalf("unmarshalling written report: %s", err)
+	}
+	if len(issues) != 1 || issues[0].Code != "no_matching_spend" {
+		t.Errorf("WriteJSON round-trip = %+v, want one issue with code %q", issues, "no_matching_spend")
+	}
+}
+
+func TestWriteJSONEmptyCollectorWritesAnEmptyArray(t *testing.T) {
+	path := t.TempDir() + "/report.json"
+	if err := NewCollector().WriteJSON(path); err != nil {
+		t.Fatalf("WriteJSON: unexpected error: %s", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading written report: %s", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "[]" {
+		t.Errorf("WriteJSON with no issues = %q, want %q", got, "[]")
+	}
+}
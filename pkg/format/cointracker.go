@@ -0,0 +1,73 @@
+package format
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/AntonioCarlini/data-processing/pkg/importers"
+)
+
+// cointrackerHeader is CoinTracker's custom CSV import template.
+var cointrackerHeader = []string{"Date", "Received Quantity", "Received Currency", "Sent Quantity", "Sent Currency", "Fee Amount", "Fee Currency", "Tag"}
+
+// cointrackerTag maps a Kind onto the Tag CoinTracker's importer uses to classify a row, where
+// that differs from leaving Tag blank (an ordinary trade, or - for a one-sided row - a transfer,
+// the behaviour TransferIn/TransferOut want).
+var cointrackerTag = map[importers.Kind]string{
+	importers.Staking: "staking",
+	importers.Reward:  "staking",
+}
+
+// cointrackerExporter renders Transactions as CoinTracker's CSV template, following the same
+// one-row-per-Transaction approach, and the same Sent/Received-pairing caveat, as koinlyExporter.
+type cointrackerExporter struct{}
+
+func init() {
+	Register("cointracker", func() Exporter { return cointrackerExporter{} })
+}
+
+func (cointrackerExporter) Write(w io.Writer, txs []importers.Transaction) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(cointrackerHeader); err != nil {
+		return fmt.Errorf("format: cointracker: %w", err)
+	}
+	for _, tx := range txs {
+		row, err := cointrackerRow(tx)
+		if err != nil {
+			return fmt.Errorf("format: cointracker: %s: %w", tx.TxID, err)
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("format: cointracker: %w", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func cointrackerRow(tx importers.Transaction) ([]string, error) {
+	var receivedAmount, receivedCurrency, sentAmount, sentCurrency string
+
+	switch tx.Kind {
+	case importers.Buy:
+		receivedAmount, receivedCurrency = tx.BaseAmount, tx.BaseCurrency
+		sentAmount, sentCurrency = tx.QuoteAmount, tx.QuoteCurrency
+	case importers.Sell:
+		sentAmount, sentCurrency = tx.BaseAmount, tx.BaseCurrency
+		receivedAmount, receivedCurrency = tx.QuoteAmount, tx.QuoteCurrency
+	case importers.TransferOut:
+		sentAmount, sentCurrency = tx.BaseAmount, tx.BaseCurrency
+	case importers.Staking, importers.Reward, importers.TransferIn:
+		receivedAmount, receivedCurrency = tx.BaseAmount, tx.BaseCurrency
+	default:
+		return nil, fmt.Errorf("unhandled transaction kind %q", tx.Kind)
+	}
+
+	return []string{
+		tx.DateTime,
+		receivedAmount, receivedCurrency,
+		sentAmount, sentCurrency,
+		tx.Fee, nonEmptyFeeCurrency(tx),
+		cointrackerTag[tx.Kind],
+	}, nil
+}
@@ -0,0 +1,49 @@
+package format
+
+import (
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AntonioCarlini/data-processing/pkg/importers"
+)
+
+func TestCointrackerExporterWriteBuySell(t *testing.T) {
+	txs := []importers.Transaction{
+		{TxID: "T1", Kind: importers.Sell, BaseCurrency: "BTC", BaseAmount: "0.5", DateTime: "2023-06-01 10:00:00"},
+		{TxID: "T2", Kind: importers.Staking, BaseCurrency: "ETH", BaseAmount: "0.02", DateTime: "2023-06-02 10:00:00"},
+	}
+
+	var buf strings.Builder
+	if err := (cointrackerExporter{}).Write(&buf, txs); err != nil {
+		t.Fatalf("Write: unexpected error: %s", err)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("parsing Write output as CSV: %s", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows (incl. header), want 3: %+v", len(rows), rows)
+	}
+
+	want := [][]string{
+		{"2023-06-01 10:00:00", "", "", "0.5", "BTC", "", "", ""},
+		{"2023-06-02 10:00:00", "0.02", "ETH", "", "", "", "", "staking"},
+	}
+	for i, w := range want {
+		if !reflect.DeepEqual(rows[i+1], w) {
+			t.Errorf("row %d = %+v, want %+v", i+1, rows[i+1], w)
+		}
+	}
+}
+
+func TestCointrackerExporterWriteUnhandledKindIsAnError(t *testing.T) {
+	txs := []importers.Transaction{{TxID: "T1", Kind: importers.Fee, BaseCurrency: "BTC", BaseAmount: "0.001", DateTime: "2023-06-01 10:00:00"}}
+
+	var buf strings.Builder
+	if err := (cointrackerExporter{}).Write(&buf, txs); err == nil {
+		t.Errorf("Write with an unhandled Kind: expected an error, got none")
+	}
+}
@@ -0,0 +1,17 @@
+package format
+
+import "testing"
+
+func TestGetUnregisteredNameIsAnError(t *testing.T) {
+	if _, err := Get("accointing"); err == nil {
+		t.Errorf("Get(\"accointing\"): expected an error (no Accointing exporter is registered), got none")
+	}
+}
+
+func TestGetReturnsRegisteredExporters(t *testing.T) {
+	for _, name := range []string{"koinly", "cointracker"} {
+		if _, err := Get(name); err != nil {
+			t.Errorf("Get(%q): unexpected error: %s", name, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package format
+
+import (
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AntonioCarlini/data-processing/pkg/importers"
+)
+
+func TestKoinlyExporterWriteBuyReward(t *testing.T) {
+	txs := []importers.Transaction{
+		{TxID: "T1", Kind: importers.Buy, BaseCurrency: "BTC", BaseAmount: "0.5", QuoteCurrency: "GBP", QuoteAmount: "10000.00", DateTime: "2023-06-01 10:00:00"},
+		{TxID: "T2", Kind: importers.Reward, BaseCurrency: "BTC", BaseAmount: "0.01", DateTime: "2023-06-02 10:00:00"},
+	}
+
+	var buf strings.Builder
+	if err := (koinlyExporter{}).Write(&buf, txs); err != nil {
+		t.Fatalf("Write: unexpected error: %s", err)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("parsing Write output as CSV: %s", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows (incl. header), want 3: %+v", len(rows), rows)
+	}
+
+	want := [][]string{
+		{"2023-06-01 10:00:00", "10000.00", "GBP", "0.5", "BTC", "", "", "", "", "", "", "T1"},
+		{"2023-06-02 10:00:00", "", "", "0.01", "BTC", "", "", "", "", "staking", "", "T2"},
+	}
+	for i, w := range want {
+		if !reflect.DeepEqual(rows[i+1], w) {
+			t.Errorf("row %d = %+v, want %+v", i+1, rows[i+1], w)
+		}
+	}
+}
+
+func TestKoinlyExporterWriteUnhandledKindIsAnError(t *testing.T) {
+	txs := []importers.Transaction{{TxID: "T1", Kind: importers.Fee, BaseCurrency: "BTC", BaseAmount: "0.001", DateTime: "2023-06-01 10:00:00"}}
+
+	var buf strings.Builder
+	if err := (koinlyExporter{}).Write(&buf, txs); err == nil {
+		t.Errorf("Write with an unhandled Kind: expected an error, got none")
+	}
+}
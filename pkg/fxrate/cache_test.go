@@ -0,0 +1,109 @@
+package fxrate
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// stubConverter is a CurrencyConverter that counts calls and returns a fixed rate, so tests can
+// assert on FileCache's caching behaviour without making a real network call.
+type stubConverter struct {
+	rate  string
+	err   error
+	calls int
+}
+
+func (s *stubConverter) Rate(from, to string, t time.Time) (string, error) {
+	s.calls++
+	if s.err != nil {
+		return "", s.err
+	}
+	return s.rate, nil
+}
+
+func TestFileCacheMissThenHit(t *testing.T) {
+	dir := t.TempDir()
+	stub := &stubConverter{rate: "0.86234"}
+	cache := NewFileCache(dir, stub)
+	date := time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	got, err := cache.Rate("USD", "GBP", date)
+	if err != nil {
+		t.Fatalf("Rate: unexpected error: %s", err)
+	}
+	if got != "0.86234" {
+		t.Errorf("Rate: got %q, want %q", got, "0.86234")
+	}
+	if stub.calls != 1 {
+		t.Fatalf("Rate: upstream called %d times, want 1", stub.calls)
+	}
+
+	got, err = cache.Rate("USD", "GBP", date)
+	if err != nil {
+		t.Fatalf("Rate (cached): unexpected error: %s", err)
+	}
+	if got != "0.86234" {
+		t.Errorf("Rate (cached): got %q, want %q", got, "0.86234")
+	}
+	if stub.calls != 1 {
+		t.Errorf("Rate (cached): upstream called %d times, want still 1 (cache should have been hit)", stub.calls)
+	}
+}
+
+func TestFileCacheDistinctCurrencyPairsDoNotCollide(t *testing.T) {
+	dir := t.TempDir()
+	stub := &stubConverter{rate: "1.00"}
+	cache := NewFileCache(dir, stub)
+	date := time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	if _, err := cache.Rate("USD", "GBP", date); err != nil {
+		t.Fatalf("Rate(USD,GBP): unexpected error: %s", err)
+	}
+	if _, err := cache.Rate("USD", "EUR", date); err != nil {
+		t.Fatalf("Rate(USD,EUR): unexpected error: %s", err)
+	}
+	if _, err := cache.Rate("EUR", "GBP", date); err != nil {
+		t.Fatalf("Rate(EUR,GBP): unexpected error: %s", err)
+	}
+	if stub.calls != 3 {
+		t.Errorf("upstream called %d times, want 3 (each currency pair should be a separate cache entry)", stub.calls)
+	}
+}
+
+func TestFileCacheUpstreamErrorNotCached(t *testing.T) {
+	dir := t.TempDir()
+	stub := &stubConverter{err: fmt.Errorf("boom")}
+	cache := NewFileCache(dir, stub)
+	date := time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	if _, err := cache.Rate("USD", "GBP", date); err == nil {
+		t.Fatalf("Rate: expected an error, got none")
+	}
+	if stub.calls != 1 {
+		t.Errorf("upstream called %d times, want 1", stub.calls)
+	}
+
+	stub.err = nil
+	stub.rate = "0.9"
+	got, err := cache.Rate("USD", "GBP", date)
+	if err != nil {
+		t.Fatalf("Rate (retry): unexpected error: %s", err)
+	}
+	if got != "0.9" {
+		t.Errorf("Rate (retry): got %q, want %q", got, "0.9")
+	}
+	if stub.calls != 2 {
+		t.Errorf("upstream called %d times, want 2 (a failed lookup must not be cached)", stub.calls)
+	}
+}
+
+func TestDefaultCacheDir(t *testing.T) {
+	dir, err := DefaultCacheDir()
+	if err != nil {
+		t.Fatalf("DefaultCacheDir: unexpected error: %s", err)
+	}
+	if dir == "" {
+		t.Errorf("DefaultCacheDir: got empty string")
+	}
+}
@@ -0,0 +1,86 @@
+package fxrate
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ECBProvider fetches the European Central Bank's daily reference rates feed, an XML document of
+// EUR-to-currency rates for every business day the ECB publishes, and computes a cross rate
+// between any two of its listed currencies via EUR. BaseURL defaults to the ECB's own historical
+// feed but can be overridden, e.g. to point at a test server.
+type ECBProvider struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewECBProvider returns an ECBProvider against the ECB's own public historical rates feed.
+func NewECBProvider() *ECBProvider {
+	return &ECBProvider{BaseURL: "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-hist.xml", Client: http.DefaultClient}
+}
+
+// ecbEnvelope matches the ECB feed's structure: a series of daily <Cube time="..."> elements, each
+// holding one <Cube currency="..." rate="..."/> per currency, EUR-based (the ECB never lists EUR
+// itself: 1 EUR = rate <currency>).
+type ecbEnvelope struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Cube    struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// Rate implements CurrencyConverter.
+func (p *ECBProvider) Rate(from, to string, t time.Time) (string, error) {
+	resp, err := p.Client.Get(p.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("fxrate: ECBProvider: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fxrate: ECBProvider: %s: unexpected status %s", p.BaseURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("fxrate: ECBProvider: %w", err)
+	}
+	var parsed ecbEnvelope
+	if err := xml.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("fxrate: ECBProvider: %w", err)
+	}
+
+	date := t.Format("2006-01-02")
+	for _, day := range parsed.Cube.Days {
+		if day.Time != date {
+			continue
+		}
+		eurToFrom, fromIsEUR := 1.0, from == "EUR"
+		eurToTo, toIsEUR := 1.0, to == "EUR"
+		for _, rate := range day.Rates {
+			if rate.Currency == from {
+				eurToFrom, fromIsEUR = rate.Rate, true
+			}
+			if rate.Currency == to {
+				eurToTo, toIsEUR = rate.Rate, true
+			}
+		}
+		if !fromIsEUR {
+			return "", fmt.Errorf("fxrate: ECBProvider: %s: no rate quoted for %q", date, from)
+		}
+		if !toIsEUR {
+			return "", fmt.Errorf("fxrate: ECBProvider: %s: no rate quoted for %q", date, to)
+		}
+		// day.Rates are all EUR->currency, so from->to is (EUR->to) / (EUR->from).
+		return fmt.Sprintf("%g", eurToTo/eurToFrom), nil
+	}
+	return "", fmt.Errorf("fxrate: ECBProvider: no rates published for %s", date)
+}
@@ -0,0 +1,63 @@
+package fxrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// FixerProvider fetches a historical daily exchange rate from a Fixer-style
+// "/<date>?base=...&symbols=..." HTTP API. BaseURL defaults to Fixer's own host but can be
+// overridden, e.g. to point at a test server or a drop-in-compatible mirror. APIKey is sent as the
+// "access_key" query parameter.
+type FixerProvider struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+// NewFixerProvider returns a FixerProvider against Fixer's own public API, authenticating with
+// apiKey.
+func NewFixerProvider(apiKey string) *FixerProvider {
+	return &FixerProvider{BaseURL: "https://data.fixer.io/api", APIKey: apiKey, Client: http.DefaultClient}
+}
+
+type fixerHistoryResponse struct {
+	Success bool               `json:"success"`
+	Rates   map[string]float64 `json:"rates"`
+	Error   struct {
+		Info string `json:"info"`
+	} `json:"error"`
+}
+
+// Rate implements CurrencyConverter.
+func (p *FixerProvider) Rate(from, to string, t time.Time) (string, error) {
+	url := fmt.Sprintf("%s/%s?access_key=%s&base=%s&symbols=%s", p.BaseURL, t.Format("2006-01-02"), p.APIKey, from, to)
+	resp, err := p.Client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("fxrate: FixerProvider: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fxrate: FixerProvider: %s: unexpected status %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("fxrate: FixerProvider: %w", err)
+	}
+	var parsed fixerHistoryResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("fxrate: FixerProvider: %w", err)
+	}
+	if !parsed.Success {
+		return "", fmt.Errorf("fxrate: FixerProvider: %s: %s", url, parsed.Error.Info)
+	}
+	rate, found := parsed.Rates[to]
+	if !found {
+		return "", fmt.Errorf("fxrate: FixerProvider: %s: no rate quoted for %q", url, to)
+	}
+	return fmt.Sprintf("%g", rate), nil
+}
@@ -0,0 +1,27 @@
+// Package fxrate resolves a historical daily fiat exchange rate between two currencies on a given
+// date - the fiat-to-fiat counterpart of pkg/pricing, which resolves a crypto/token's price quoted
+// in a fiat currency. The request this package was built against described a single
+// "ReportingAmount" field to be filled in wherever a transaction's nativeCurrency differs from the
+// user's reporting currency; nexo/convert-nexo.go wires a CurrencyConverter in as its package-level
+// fxConverter var (nil by default, set by -fx-cache in main()), which usdToGBP consults instead of
+// its original 1:1 USD-as-GBP-pence placeholder. cdc/convert-cdc.go has no equivalent gap: its
+// source CSV already supplies native-currency amounts directly, with no historical-rate lookup
+// needed.
+//
+// CurrencyConverter is the provider interface (see fixer.go and ecb.go for two concrete
+// implementations) and FileCache (cache.go) decorates one with an on-disk cache, the same
+// one-file-per-key convention pkg/pricing.FileCache already uses, so repeated runs against the same
+// (from, to, date) are deterministic and do not re-fetch over the network.
+//
+// Rate returns the rate as a decimal string (e.g. "0.86234") rather than a typed decimal value,
+// mirroring pkg/pricing.PriceOracle's own choice of a hand-rolled, string-parseable
+// representation; go.mod does not require an external decimal library (shopspring/decimal).
+package fxrate
+
+import "time"
+
+// CurrencyConverter resolves the historical daily exchange rate from one unit of from (e.g. "USD")
+// into to (e.g. "GBP"), on the day containing t: 1 from = Rate() to.
+type CurrencyConverter interface {
+	Rate(from, to string, t time.Time) (string, error)
+}
@@ -0,0 +1,138 @@
+package importers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cdcExpectedHeader is the eleven-column header crypto.com's "Transaction Description" CSV export
+// uses (see cdc/convert-cdc.go, which this importer ports into the shared registry).
+var cdcExpectedHeader = []string{"Timestamp (UTC)", "Transaction Description", "Currency", "Amount", "To Currency", "To Amount", "Native Currency", "Native Amount", "Native Amount (in USD)", "Transaction Kind", "Transaction Hash"}
+
+// cdcImporter recognises and converts a crypto.com CSV export. Unlike nexoImporter, a crypto.com
+// row is dispatched on its free-text "Transaction Description" rather than a fixed "Type" column,
+// and some descriptions (e.g. "Crypto Earn Deposit", "CRO Stake") carry no tax-relevant amount and
+// produce no Transaction at all, while "* -> *" crypto-to-crypto exchanges produce two (a SELL
+// followed by a BUY) - so convertRow returns a slice rather than nexoImporter's one-row-in,
+// one-Transaction-out.
+//
+// cdc/convert-cdc.go's areRowValuesAcceptable also cross-checks each row's Currency/Native
+// Currency/Transaction Kind columns against the value its description implies, printing a warning
+// and tagging the row "**BAD DATA**" rather than failing the run. convertRow makes no such
+// cross-check: Currency and Native Currency are taken as they are, and Transaction Kind is read only
+// to tell the " -> " exchange rows apart (an unrecognised one is an error). No "**BAD DATA**" row
+// is emitted.
+type cdcImporter struct{}
+
+func init() {
+	Register("cdc", func() Importer { return cdcImporter{} })
+}
+
+func (cdcImporter) Name() string { return "cdc" }
+
+func (cdcImporter) Detect(header []string) bool {
+	if len(header) != len(cdcExpectedHeader) {
+		return false
+	}
+	for i, want := range cdcExpectedHeader {
+		if header[i] != want {
+			return false
+		}
+	}
+	return true
+}
+
+func (c cdcImporter) Convert(rows [][]string) ([]Transaction, error) {
+	transactions := make([]Transaction, 0, len(rows))
+	for i, row := range rows {
+		txs, err := c.convertRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("cdc: row %d: %w", i+1, err)
+		}
+		transactions = append(transactions, txs...)
+	}
+	return transactions, nil
+}
+
+func (cdcImporter) convertRow(row []string) ([]Transaction, error) {
+	if len(row) != len(cdcExpectedHeader) {
+		return nil, fmt.Errorf("expected %d columns, got %d: %v", len(cdcExpectedHeader), len(row), row)
+	}
+
+	timestamp := row[0]
+	description := row[1]
+	currency := row[2]
+	amount := row[3]
+	toAmount := row[5]
+	nativeCurrency := row[6]
+	nativeAmount := row[7]
+	txKind := row[9]
+
+	tx := func(kind Kind, base, baseAmount string) Transaction {
+		return Transaction{
+			Kind:          kind,
+			BaseCurrency:  base,
+			BaseAmount:    baseAmount,
+			QuoteCurrency: nativeCurrency,
+			QuoteAmount:   nativeAmount,
+			Notes:         description,
+			DateTime:      timestamp,
+		}
+	}
+
+	switch {
+	case description == "Sign-up Bonus Unlocked":
+		return []Transaction{tx(Reward, currency, amount)}, nil
+	case description == "Crypto Earn Deposit":
+		// Crypto moved into the Earn wallet: no tax-relevant amount, no Transaction produced. Must
+		// be checked before the "* Deposit" suffix case below, or it would be misread as one.
+		return nil, nil
+	case description == "Crypto Earn Withdrawal":
+		// Crypto moved back out of the Earn wallet: no tax-relevant amount, no Transaction produced.
+		return nil, nil
+	case strings.HasSuffix(description, " Deposit"):
+		return []Transaction{tx(TransferIn, currency, amount)}, nil
+	case strings.Contains(description, " -> "):
+		fields := strings.Fields(description)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("malformed exchange description %q", description)
+		}
+		convertFromCurrency := fields[0]
+		convertToCurrency := fields[2]
+		switch txKind {
+		case "viban_purchase":
+			// A swap from GBP (or another fiat) into a cryptocurrency: a single BUY.
+			return []Transaction{tx(Buy, convertToCurrency, toAmount)}, nil
+		case "crypto_exchange":
+			// A swap from one cryptocurrency to another: a SELL of the source, then a BUY of the
+			// destination, exactly as cdc/convert-cdc.go records it.
+			return []Transaction{
+				tx(Sell, convertFromCurrency, amount),
+				tx(Buy, convertToCurrency, toAmount),
+			}, nil
+		default:
+			return nil, fmt.Errorf("unrecognised Transaction Kind %q for exchange description %q", txKind, description)
+		}
+	case description == "CRO Stake Rewards":
+		return []Transaction{tx(Staking, currency, amount)}, nil
+	case description == "CRO Stake", description == "CRO Unstake":
+		// CRO moved into/out of the staking lockup itself: no tax-relevant amount, no Transaction.
+		return nil, nil
+	case description == "Card Cashback", description == "Card Cashback Reversal":
+		// A reversal's Amount is already the negative adjustment crypto.com recorded, so both map to
+		// the same REWARD kind rather than needing a dedicated reversal Kind.
+		return []Transaction{tx(Reward, currency, amount)}, nil
+	case description == "Crypto Earn":
+		return []Transaction{tx(Staking, currency, amount)}, nil
+	case strings.HasPrefix(description, "Withdraw "):
+		return []Transaction{tx(TransferOut, currency, amount)}, nil
+	case strings.HasPrefix(description, "To +"):
+		return []Transaction{tx(TransferOut, currency, amount)}, nil
+	case strings.HasPrefix(description, "From +"):
+		return []Transaction{tx(TransferIn, currency, amount)}, nil
+	case description == "Pay Rewards":
+		return []Transaction{tx(Reward, currency, amount)}, nil
+	default:
+		return nil, fmt.Errorf("unrecognised Transaction Description %q", description)
+	}
+}
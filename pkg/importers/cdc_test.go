@@ -0,0 +1,92 @@
+package importers
+
+import "testing"
+
+func TestCdcImporterDetect(t *testing.T) {
+	cases := []struct {
+		name   string
+		header []string
+		want   bool
+	}{
+		{"matching header", cdcExpectedHeader, true},
+		{"wrong length", cdcExpectedHeader[:10], false},
+		{"wrong column", append(append([]string{}, cdcExpectedHeader[:1]...), append([]string{"Wrong"}, cdcExpectedHeader[2:]...)...), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := (cdcImporter{}).Detect(c.header); got != c.want {
+				t.Errorf("Detect(%v) = %v, want %v", c.header, got, c.want)
+			}
+		})
+	}
+}
+
+func TestCdcImporterConvert(t *testing.T) {
+	rows := [][]string{
+		{"2022-04-05 07:00:06", "Sign-up Bonus Unlocked", "CRO", "25.00", "", "", "USD", "10.00", "10.00", "referral_gift", "hash-1"},
+		{"2022-04-06 07:00:06", "BTC Deposit", "BTC", "0.50", "", "", "GBP", "9000.00", "12000.00", "crypto_deposit", "hash-2"},
+		{"2022-04-07 07:00:06", "GBP -> BTC", "GBP", "1000.00", "BTC", "0.025", "GBP", "1000.00", "1340.00", "viban_purchase", "hash-3"},
+		{"2022-04-08 07:00:06", "USDC -> BTC", "USDC", "500.00", "BTC", "0.011", "GBP", "400.00", "535.00", "crypto_exchange", "hash-4"},
+		{"2022-04-09 07:00:06", "Crypto Earn Deposit", "BTC", "0.50", "", "", "GBP", "9000.00", "12000.00", "crypto_earn_deposit", "hash-5"},
+		{"2022-04-10 07:00:06", "Withdraw BTC", "BTC", "0.10", "", "", "GBP", "1800.00", "2400.00", "crypto_withdrawal", "hash-6"},
+	}
+
+	got, err := (cdcImporter{}).Convert(rows)
+	if err != nil {
+		t.Fatalf("Convert(%v): unexpected error: %s", rows, err)
+	}
+
+	want := []Transaction{
+		{Kind: Reward, BaseCurrency: "CRO", BaseAmount: "25.00", QuoteCurrency: "USD", QuoteAmount: "10.00", Notes: "Sign-up Bonus Unlocked", DateTime: "2022-04-05 07:00:06"},
+		{Kind: TransferIn, BaseCurrency: "BTC", BaseAmount: "0.50", QuoteCurrency: "GBP", QuoteAmount: "9000.00", Notes: "BTC Deposit", DateTime: "2022-04-06 07:00:06"},
+		{Kind: Buy, BaseCurrency: "BTC", BaseAmount: "0.025", QuoteCurrency: "GBP", QuoteAmount: "1000.00", Notes: "GBP -> BTC", DateTime: "2022-04-07 07:00:06"},
+		{Kind: Sell, BaseCurrency: "USDC", BaseAmount: "500.00", QuoteCurrency: "GBP", QuoteAmount: "400.00", Notes: "USDC -> BTC", DateTime: "2022-04-08 07:00:06"},
+		{Kind: Buy, BaseCurrency: "BTC", BaseAmount: "0.011", QuoteCurrency: "GBP", QuoteAmount: "400.00", Notes: "USDC -> BTC", DateTime: "2022-04-08 07:00:06"},
+		{Kind: TransferOut, BaseCurrency: "BTC", BaseAmount: "0.10", QuoteCurrency: "GBP", QuoteAmount: "1800.00", Notes: "Withdraw BTC", DateTime: "2022-04-10 07:00:06"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Convert(%v) = %+v, want %+v", rows, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Convert[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if _, err := (cdcImporter{}).Convert([][]string{{"too", "short"}}); err == nil {
+		t.Errorf("Convert with a short row: expected an error, got none")
+	}
+
+	unrecognised := [][]string{{"2022-04-11 07:00:06", "Something New", "BTC", "1.00", "", "", "GBP", "1.00", "1.00", "unknown_kind", "hash-7"}}
+	if _, err := (cdcImporter{}).Convert(unrecognised); err == nil {
+		t.Errorf("Convert with an unrecognised description: expected an error, got none")
+	}
+}
+
+func TestCdcImporterConvertNoEntryRows(t *testing.T) {
+	rows := [][]string{
+		{"2022-04-05 07:00:06", "Crypto Earn Deposit", "BTC", "0.50", "", "", "GBP", "9000.00", "12000.00", "crypto_earn_deposit", "hash-1"},
+		{"2022-04-06 07:00:06", "Crypto Earn Withdrawal", "BTC", "0.50", "", "", "GBP", "9000.00", "12000.00", "crypto_earn_program_withdrawn", "hash-2"},
+		{"2022-04-07 07:00:06", "CRO Stake", "CRO", "1000.00", "", "", "GBP", "100.00", "130.00", "lockup_lock", "hash-3"},
+		{"2022-04-08 07:00:06", "CRO Unstake", "CRO", "1000.00", "", "", "GBP", "100.00", "130.00", "lockup_unlock", "hash-4"},
+	}
+
+	got, err := (cdcImporter{}).Convert(rows)
+	if err != nil {
+		t.Fatalf("Convert(%v): unexpected error: %s", rows, err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Convert(%v) = %+v, want no Transactions", rows, got)
+	}
+}
+
+func TestLookupCdc(t *testing.T) {
+	importer, err := Lookup(cdcExpectedHeader)
+	if err != nil {
+		t.Fatalf("Lookup: unexpected error: %s", err)
+	}
+	if importer.Name() != "cdc" {
+		t.Errorf("Lookup: got %q, want \"cdc\"", importer.Name())
+	}
+}
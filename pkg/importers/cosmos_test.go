@@ -0,0 +1,85 @@
+package importers
+
+import "testing"
+
+func TestCosmosImporterDetect(t *testing.T) {
+	cases := []struct {
+		name   string
+		header []string
+		want   bool
+	}{
+		{"matching header", cosmosExpectedHeader, true},
+		{"wrong length", cosmosExpectedHeader[:7], false},
+		{"wrong column", append(append([]string{}, cosmosExpectedHeader[:1]...), append([]string{"Wrong"}, cosmosExpectedHeader[2:]...)...), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := (cosmosImporter{}).Detect(c.header); got != c.want {
+				t.Errorf("Detect(%v) = %v, want %v", c.header, got, c.want)
+			}
+		})
+	}
+}
+
+func TestCosmosImporterConvert(t *testing.T) {
+	rows := [][]string{
+		{"2023-06-01 10:00:00", "Staking Reward", "ATOM", "1.25", "", "", "", "hash-1"},
+		{"2023-06-02 10:00:00", "IBC Transfer In", "OSMO", "50.00", "", "", "", "hash-2"},
+		{"2023-06-03 10:00:00", "IBC Transfer Out", "ATOM", "10.00", "", "", "", "hash-3"},
+		{"2023-06-04 10:00:00", "LP Join", "gamm/pool/604", "12.5", "100 ATOM;200 OSMO", "", "", "hash-4"},
+		{"2023-06-05 10:00:00", "LP Exit", "cl/pool/1212", "3.2", "50 ATOM;75 OSMO", "", "", "hash-5"},
+	}
+
+	got, err := (cosmosImporter{}).Convert(rows)
+	if err != nil {
+		t.Fatalf("Convert(%v): unexpected error: %s", rows, err)
+	}
+
+	want := []Transaction{
+		{TxID: "hash-1", Kind: Staking, BaseCurrency: "ATOM", BaseAmount: "1.25", Notes: "Staking Reward", DateTime: "2023-06-01 10:00:00"},
+		{TxID: "hash-2", Kind: TransferIn, BaseCurrency: "OSMO", BaseAmount: "50.00", Notes: "IBC Transfer In", DateTime: "2023-06-02 10:00:00"},
+		{TxID: "hash-3", Kind: TransferOut, BaseCurrency: "ATOM", BaseAmount: "10.00", Notes: "IBC Transfer Out", DateTime: "2023-06-03 10:00:00"},
+		{TxID: "hash-4", Kind: TransferOut, BaseCurrency: "ATOM", BaseAmount: "100", Notes: "LP Join", DateTime: "2023-06-04 10:00:00"},
+		{TxID: "hash-4", Kind: TransferOut, BaseCurrency: "OSMO", BaseAmount: "200", Notes: "LP Join", DateTime: "2023-06-04 10:00:00"},
+		{TxID: "hash-5", Kind: TransferIn, BaseCurrency: "ATOM", BaseAmount: "50", Notes: "LP Exit", DateTime: "2023-06-05 10:00:00"},
+		{TxID: "hash-5", Kind: TransferIn, BaseCurrency: "OSMO", BaseAmount: "75", Notes: "LP Exit", DateTime: "2023-06-05 10:00:00"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Convert(%v) = %+v, want %+v", rows, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Convert[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if _, err := (cosmosImporter{}).Convert([][]string{{"too", "short"}}); err == nil {
+		t.Errorf("Convert with a short row: expected an error, got none")
+	}
+
+	unrecognised := [][]string{{"2023-06-06 10:00:00", "Something New", "ATOM", "1.00", "", "", "", "hash-6"}}
+	if _, err := (cosmosImporter{}).Convert(unrecognised); err == nil {
+		t.Errorf("Convert with an unrecognised Type: expected an error, got none")
+	}
+
+	notLPShare := [][]string{{"2023-06-07 10:00:00", "LP Join", "ATOM", "1.00", "1 ATOM", "", "", "hash-7"}}
+	if _, err := (cosmosImporter{}).Convert(notLPShare); err == nil {
+		t.Errorf("Convert with a non-LP-share Asset on an LP Join: expected an error, got none")
+	}
+
+	noUnderlying := [][]string{{"2023-06-08 10:00:00", "LP Join", "gamm/pool/604", "1.00", "", "", "", "hash-8"}}
+	if _, err := (cosmosImporter{}).Convert(noUnderlying); err == nil {
+		t.Errorf("Convert with an empty Underlying column: expected an error, got none")
+	}
+}
+
+func TestLookupCosmos(t *testing.T) {
+	importer, err := Lookup(cosmosExpectedHeader)
+	if err != nil {
+		t.Fatalf("Lookup: unexpected error: %s", err)
+	}
+	if importer.Name() != "cosmos" {
+		t.Errorf("Lookup: got %q, want \"cosmos\"", importer.Name())
+	}
+}
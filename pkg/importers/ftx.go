@@ -0,0 +1,190 @@
+package importers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ftxExpectedHeader is FTX's wallet-history CSV export header: deposits and withdrawals only.
+// ftxTradeExpectedHeader (below) is the separate trade-history export's header.
+var ftxExpectedHeader = []string{"Time", "Coin", "Amount", "Status", "Additional info", "Transaction ID"}
+
+// ftxDateLayout is FTX's "Time" column format (Go reference time for the request's %m/%d/%Y,
+// %I:%M:%S %p): e.g. "01/02/2006, 03:04:05 PM".
+const ftxDateLayout = "01/02/2006, 03:04:05 PM"
+
+// ftxImporter recognises and converts an FTX wallet-history CSV export. Each row is a single
+// deposit or withdrawal: the sign of Amount decides TransferIn versus TransferOut, and there is no
+// separate currency pair, so BaseCurrency/BaseAmount are all this importer fills in.
+//
+// Only rows whose Status reads as a completed transfer are converted; without a real FTX export to
+// check the full set of Status values against, anything else is reported as an error rather than
+// guessed at.
+type ftxImporter struct{}
+
+func init() {
+	Register("ftx", func() Importer { return ftxImporter{} })
+}
+
+func (ftxImporter) Name() string { return "ftx" }
+
+func (ftxImporter) Detect(header []string) bool {
+	if len(header) != len(ftxExpectedHeader) {
+		return false
+	}
+	for i, want := range ftxExpectedHeader {
+		if header[i] != want {
+			return false
+		}
+	}
+	return true
+}
+
+func (f ftxImporter) Convert(rows [][]string) ([]Transaction, error) {
+	transactions := make([]Transaction, 0, len(rows))
+	for i, row := range rows {
+		tx, err := f.convertRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("ftx: row %d: %w", i+1, err)
+		}
+		transactions = append(transactions, tx)
+	}
+	return transactions, nil
+}
+
+func (ftxImporter) convertRow(row []string) (Transaction, error) {
+	if len(row) != len(ftxExpectedHeader) {
+		return Transaction{}, fmt.Errorf("expected %d columns, got %d: %v", len(ftxExpectedHeader), len(row), row)
+	}
+
+	timeColumn := row[0]
+	coin := row[1]
+	amount := row[2]
+	status := row[3]
+	info := row[4]
+	txID := row[5]
+
+	if !strings.EqualFold(status, "complete") && !strings.EqualFold(status, "completed") {
+		return Transaction{}, fmt.Errorf("%s: not a completed transfer (Status %q)", txID, status)
+	}
+
+	t, err := time.Parse(ftxDateLayout, timeColumn)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("%s: invalid Time %q: %w", txID, timeColumn, err)
+	}
+
+	kind := TransferIn
+	baseAmount := amount
+	if strings.HasPrefix(amount, "-") {
+		kind = TransferOut
+		baseAmount = amount[1:]
+	}
+
+	return Transaction{
+		TxID:         txID,
+		Kind:         kind,
+		BaseCurrency: coin,
+		BaseAmount:   baseAmount,
+		Notes:        info,
+		DateTime:     t.Format("2006-01-02 15:04:05"),
+	}, nil
+}
+
+// ftxTradeExpectedHeader is FTX's trade-history CSV export header.
+var ftxTradeExpectedHeader = []string{"Market", "Side", "Size", "Price", "Total", "Fee", "Fee Currency", "Time"}
+
+// ftxTradeImporter recognises and converts an FTX trade-history CSV export. Registered separately
+// from ftxImporter ("ftx-trades" rather than "ftx") since the two exports have unrelated headers
+// and neither names the other: a caller that has both files to convert runs each through Lookup (or
+// -exchange) independently, the same way a Kraken user would run this package against both their
+// Ledgers and TradesHistory exports in turn.
+//
+// Each row becomes two Transactions sharing a TxID (Transaction has no separate RefID column -
+// TxID already plays that role, the same way krakenImporter's "spend"/"receive" pair shares one):
+// a Sell leg for what was given up and a Buy leg for what was received, with Fee/Fee Currency
+// recorded on the Buy leg. There is no row-native transaction id to use as TxID, so one is
+// synthesized from the row number, prefixed to stay clear of any other importer's TxIDs.
+//
+// Market is only split into base/quote for a spot pair ("BASE/QUOTE"); a futures market
+// ("SYMBOL-PERP") isn't a transfer of one asset for another at all, and without a real FTX futures
+// export to check margin/settlement behaviour against, this importer reports an error rather than
+// guessing at how to represent one.
+type ftxTradeImporter struct{}
+
+func init() {
+	Register("ftx-trades", func() Importer { return ftxTradeImporter{} })
+}
+
+func (ftxTradeImporter) Name() string { return "ftx-trades" }
+
+func (ftxTradeImporter) Detect(header []string) bool {
+	if len(header) != len(ftxTradeExpectedHeader) {
+		return false
+	}
+	for i, want := range ftxTradeExpectedHeader {
+		if header[i] != want {
+			return false
+		}
+	}
+	return true
+}
+
+func (f ftxTradeImporter) Convert(rows [][]string) ([]Transaction, error) {
+	transactions := make([]Transaction, 0, 2*len(rows))
+	for i, row := range rows {
+		txs, err := f.convertRow(i+1, row)
+		if err != nil {
+			return nil, fmt.Errorf("ftx-trades: row %d: %w", i+1, err)
+		}
+		transactions = append(transactions, txs...)
+	}
+	return transactions, nil
+}
+
+func (ftxTradeImporter) convertRow(rowNum int, row []string) ([]Transaction, error) {
+	if len(row) != len(ftxTradeExpectedHeader) {
+		return nil, fmt.Errorf("expected %d columns, got %d: %v", len(ftxTradeExpectedHeader), len(row), row)
+	}
+
+	market := row[0]
+	side := row[1]
+	size := row[2]
+	total := row[4]
+	fee := row[5]
+	feeCurrency := row[6]
+	timeColumn := row[7]
+
+	if strings.HasSuffix(market, "-PERP") {
+		return nil, fmt.Errorf("%s: futures market not handled", market)
+	}
+	parts := strings.SplitN(market, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%s: not a recognised spot market (want BASE/QUOTE)", market)
+	}
+	base, quote := parts[0], parts[1]
+
+	t, err := time.Parse(ftxDateLayout, timeColumn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Time %q: %w", timeColumn, err)
+	}
+	dateTime := t.Format("2006-01-02 15:04:05")
+	txID := fmt.Sprintf("ftx-trade-%d", rowNum)
+
+	var soldCurrency, soldAmount, boughtCurrency, boughtAmount string
+	switch strings.ToLower(side) {
+	case "buy":
+		soldCurrency, soldAmount = quote, total
+		boughtCurrency, boughtAmount = base, size
+	case "sell":
+		soldCurrency, soldAmount = base, size
+		boughtCurrency, boughtAmount = quote, total
+	default:
+		return nil, fmt.Errorf("%q: unrecognised Side", side)
+	}
+
+	return []Transaction{
+		{TxID: txID, Kind: Sell, BaseCurrency: soldCurrency, BaseAmount: soldAmount, DateTime: dateTime},
+		{TxID: txID, Kind: Buy, BaseCurrency: boughtCurrency, BaseAmount: boughtAmount, Fee: fee, Notes: feeCurrency, DateTime: dateTime},
+	}, nil
+}
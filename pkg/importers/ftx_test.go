@@ -0,0 +1,139 @@
+package importers
+
+import "testing"
+
+func TestFtxImporterDetect(t *testing.T) {
+	cases := []struct {
+		name   string
+		header []string
+		want   bool
+	}{
+		{"matching header", ftxExpectedHeader, true},
+		{"wrong length", ftxExpectedHeader[:5], false},
+		{"wrong column", append(append([]string{}, ftxExpectedHeader[:1]...), append([]string{"Wrong"}, ftxExpectedHeader[2:]...)...), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := (ftxImporter{}).Detect(c.header); got != c.want {
+				t.Errorf("Detect(%v) = %v, want %v", c.header, got, c.want)
+			}
+		})
+	}
+}
+
+func TestFtxImporterConvert(t *testing.T) {
+	rows := [][]string{
+		{"04/05/2022, 07:00:06 AM", "BTC", "0.025", "complete", "deposit from wallet", "ftx-tx-1"},
+		{"04/06/2022, 03:15:30 PM", "USD", "-500.00", "complete", "withdrawal to bank", "ftx-tx-2"},
+	}
+
+	got, err := (ftxImporter{}).Convert(rows)
+	if err != nil {
+		t.Fatalf("Convert(%v): unexpected error: %s", rows, err)
+	}
+
+	want := []Transaction{
+		{TxID: "ftx-tx-1", Kind: TransferIn, BaseCurrency: "BTC", BaseAmount: "0.025", Notes: "deposit from wallet", DateTime: "2022-04-05 07:00:06"},
+		{TxID: "ftx-tx-2", Kind: TransferOut, BaseCurrency: "USD", BaseAmount: "500.00", Notes: "withdrawal to bank", DateTime: "2022-04-06 15:15:30"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Convert(%v) = %+v, want %+v", rows, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Convert[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if _, err := (ftxImporter{}).Convert([][]string{{"too", "short"}}); err == nil {
+		t.Errorf("Convert with a short row: expected an error, got none")
+	}
+
+	pending := [][]string{{"04/07/2022, 07:00:06 AM", "BTC", "0.01", "pending", "", "ftx-tx-3"}}
+	if _, err := (ftxImporter{}).Convert(pending); err == nil {
+		t.Errorf("Convert with a non-complete Status: expected an error, got none")
+	}
+
+	badTime := [][]string{{"not-a-time", "BTC", "0.01", "complete", "", "ftx-tx-4"}}
+	if _, err := (ftxImporter{}).Convert(badTime); err == nil {
+		t.Errorf("Convert with an unparseable Time: expected an error, got none")
+	}
+}
+
+func TestLookupFtx(t *testing.T) {
+	importer, err := Lookup(ftxExpectedHeader)
+	if err != nil {
+		t.Fatalf("Lookup: unexpected error: %s", err)
+	}
+	if importer.Name() != "ftx" {
+		t.Errorf("Lookup: got %q, want \"ftx\"", importer.Name())
+	}
+}
+
+func TestFtxTradeImporterDetect(t *testing.T) {
+	cases := []struct {
+		name   string
+		header []string
+		want   bool
+	}{
+		{"matching header", ftxTradeExpectedHeader, true},
+		{"wrong length", ftxTradeExpectedHeader[:3], false},
+		{"wallet-history header", ftxExpectedHeader, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := (ftxTradeImporter{}).Detect(c.header); got != c.want {
+				t.Errorf("Detect(%v) = %v, want %v", c.header, got, c.want)
+			}
+		})
+	}
+}
+
+func TestFtxTradeImporterConvert(t *testing.T) {
+	rows := [][]string{
+		{"BTC/USD", "buy", "0.5", "40000", "20000", "20", "USD", "04/05/2022, 07:00:06 AM"},
+		{"ETH/USD", "sell", "2", "2500", "5000", "5", "USD", "04/06/2022, 03:15:30 PM"},
+	}
+
+	got, err := (ftxTradeImporter{}).Convert(rows)
+	if err != nil {
+		t.Fatalf("Convert(%v): unexpected error: %s", rows, err)
+	}
+
+	want := []Transaction{
+		{TxID: "ftx-trade-1", Kind: Sell, BaseCurrency: "USD", BaseAmount: "20000", DateTime: "2022-04-05 07:00:06"},
+		{TxID: "ftx-trade-1", Kind: Buy, BaseCurrency: "BTC", BaseAmount: "0.5", Fee: "20", Notes: "USD", DateTime: "2022-04-05 07:00:06"},
+		{TxID: "ftx-trade-2", Kind: Sell, BaseCurrency: "ETH", BaseAmount: "2", DateTime: "2022-04-06 15:15:30"},
+		{TxID: "ftx-trade-2", Kind: Buy, BaseCurrency: "USD", BaseAmount: "5000", Fee: "5", Notes: "USD", DateTime: "2022-04-06 15:15:30"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Convert(%v) = %+v, want %+v", rows, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Convert[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	perp := [][]string{{"BTC-PERP", "buy", "0.5", "40000", "20000", "20", "USD", "04/05/2022, 07:00:06 AM"}}
+	if _, err := (ftxTradeImporter{}).Convert(perp); err == nil {
+		t.Errorf("Convert with a futures market: expected an error, got none")
+	}
+
+	badSide := [][]string{{"BTC/USD", "long", "0.5", "40000", "20000", "20", "USD", "04/05/2022, 07:00:06 AM"}}
+	if _, err := (ftxTradeImporter{}).Convert(badSide); err == nil {
+		t.Errorf("Convert with an unrecognised Side: expected an error, got none")
+	}
+}
+
+func TestLookupFtxTrades(t *testing.T) {
+	importer, err := Lookup(ftxTradeExpectedHeader)
+	if err != nil {
+		t.Fatalf("Lookup: unexpected error: %s", err)
+	}
+	if importer.Name() != "ftx-trades" {
+		t.Errorf("Lookup: got %q, want \"ftx-trades\"", importer.Name())
+	}
+}
@@ -0,0 +1,103 @@
+// Package importers generalises nexo/importer's single-exchange Format/CanonicalTx pair into a
+// registry that more than one exchange's CSV export can plug into: an Importer recognises its own
+// CSV header and converts a matching file's rows into the exchange-neutral Transaction shape,
+// Register adds one to the registry by name, and Lookup dispatches on header detection the same
+// way nexo/importer.DetectFormat did, so a caller never has to name the exchange itself.
+//
+// Nexo (nexo.go), crypto.com (cdc.go, ported from cdc/convert-cdc.go), FTX's wallet-history and
+// trade-history exports (ftx.go, registered separately as "ftx" and "ftx-trades" since the two
+// have unrelated headers), a Cosmos-ecosystem CSV export (cosmos.go) and Kraken's ledger export
+// (kraken.go, a narrowed port of kraken/convert-kraken.go's convertTransactions) are registered. Coinbase and
+// Bitpanda remain unimplemented, as does Binance and Bitfinex: this repo has no sample exports for
+// any of them to convert against, so there is no real header/column layout to detect or port
+// against. kraken/convert-kraken.go remains its own self-contained program with its own price
+// pipeline rather than being replaced by kraken.go, which covers conversion only.
+package importers
+
+import "fmt"
+
+// Kind is the exchange-neutral category a Transaction's Type column is normalized into.
+type Kind string
+
+const (
+	Buy         Kind = "BUY"
+	Sell        Kind = "SELL"
+	Staking     Kind = "STAKING"
+	Reward      Kind = "REWARD"
+	TransferIn  Kind = "TRANSFER_IN"
+	TransferOut Kind = "TRANSFER_OUT"
+	Fee         Kind = "FEE"
+)
+
+// Transaction is the exchange-neutral shape an Importer converts a CSV row into, replacing the
+// narrower, Nexo-only CanonicalTx that nexo/importer.Format produced.
+type Transaction struct {
+	TxID          string
+	Kind          Kind
+	BaseCurrency  string
+	BaseAmount    string
+	QuoteCurrency string
+	QuoteAmount   string
+	Fee           string
+	UsdEquivalent string
+	Notes         string
+	DateTime      string
+}
+
+// Importer recognises one exchange's CSV export by its header row and converts a matching file's
+// data rows into Transactions.
+type Importer interface {
+	// Name identifies the importer in error messages and in the registry (e.g. "nexo").
+	Name() string
+	// Detect reports whether header looks like this importer's CSV header row.
+	Detect(header []string) bool
+	// Convert converts rows - already known to match this importer, via Detect on their file's
+	// header - into Transactions.
+	Convert(rows [][]string) ([]Transaction, error)
+}
+
+// registry holds every Importer factory registered via Register, keyed by name.
+var registry = make(map[string]func() Importer)
+
+// Register adds an Importer factory to the registry under name, so Lookup can dispatch to it by
+// header detection without its caller needing to name the exchange. Register is meant to be
+// called from an init function, one per supported exchange (see nexo.go).
+func Register(name string, factory func() Importer) {
+	registry[name] = factory
+}
+
+// Get returns the registered Importer named name, for a caller that already knows which exchange
+// it's converting (e.g. a CLI's -exchange flag) and so has no header to run Lookup's detection
+// against.
+func Get(name string) (Importer, error) {
+	factory, found := registry[name]
+	if !found {
+		return nil, fmt.Errorf("no importer registered under name %q", name)
+	}
+	return factory(), nil
+}
+
+// Lookup returns the single registered Importer whose Detect matches header. It is an error for
+// none to match, and an error naming every candidate for more than one to match, since Convert
+// would then be ambiguous.
+func Lookup(header []string) (Importer, error) {
+	var matches []Importer
+	for _, factory := range registry {
+		importer := factory()
+		if importer.Detect(header) {
+			matches = append(matches, importer)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no registered importer recognises header %v", header)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for i, importer := range matches {
+			names[i] = importer.Name()
+		}
+		return nil, fmt.Errorf("header %v matches more than one registered importer: %v", header, names)
+	}
+}
@@ -0,0 +1,104 @@
+package importers
+
+import "testing"
+
+func TestKrakenImporterDetect(t *testing.T) {
+	cases := []struct {
+		name   string
+		header []string
+		want   bool
+	}{
+		{"matching header", krakenExpectedHeader, true},
+		{"wrong length", krakenExpectedHeader[:10], false},
+		{"wrong column", append(append([]string{}, krakenExpectedHeader[:1]...), append([]string{"Wrong"}, krakenExpectedHeader[2:]...)...), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := (krakenImporter{}).Detect(c.header); got != c.want {
+				t.Errorf("Detect(%v) = %v, want %v", c.header, got, c.want)
+			}
+		})
+	}
+}
+
+func TestKrakenImporterConvert(t *testing.T) {
+	rows := [][]string{
+		{"T1", "REF1", "2023-06-01 10:00:00", "spend", "", "currency", "ZGBP", "spot / main", "-1000.00", "0", "0"},
+		{"T2", "REF1", "2023-06-01 10:00:01", "receive", "", "currency", "BTC", "spot / main", "0.025", "0", "0.025"},
+		{"T3", "REF2", "2023-06-02 08:00:00", "staking", "", "currency", "FLOW.S", "spot / main", "1.25", "0", "100"},
+		{"T4", "REF3", "2023-06-03 09:00:00", "deposit", "", "currency", "ETH", "spot / main", "2.00", "0", "2.00"},
+		{"T5", "REF4", "2023-06-04 11:00:00", "withdrawal", "", "currency", "ETH", "spot / main", "-0.50", "0", "1.50"},
+		{"T6", "REF5", "2023-06-05 12:00:00", "transfer", "spottostaking", "currency", "FLOW", "spot / main", "-100.00", "0", "0"},
+		{"T7", "REF6", "2023-06-05 12:01:00", "transfer", "stakingfromspot", "currency", "FLOW.S", "spot / main", "100.00", "0", "100.00"},
+	}
+
+	got, err := (krakenImporter{}).Convert(rows)
+	if err != nil {
+		t.Fatalf("Convert(%v): unexpected error: %s", rows, err)
+	}
+
+	want := []Transaction{
+		{TxID: "T1", Kind: Sell, BaseCurrency: "ZGBP", BaseAmount: "1000.00", DateTime: "2023-06-01 10:00:00"},
+		{TxID: "T2", Kind: Buy, BaseCurrency: "BTC", BaseAmount: "0.025", DateTime: "2023-06-01 10:00:01"},
+		{TxID: "T3", Kind: Staking, BaseCurrency: "FLOW", BaseAmount: "1.25", DateTime: "2023-06-02 08:00:00"},
+		{TxID: "T4", Kind: TransferIn, BaseCurrency: "ETH", BaseAmount: "2.00", DateTime: "2023-06-03 09:00:00"},
+		{TxID: "T5", Kind: TransferOut, BaseCurrency: "ETH", BaseAmount: "0.50", DateTime: "2023-06-04 11:00:00"},
+		{TxID: "T7", Kind: Staking, BaseCurrency: "FLOW", BaseAmount: "100.00", DateTime: "2023-06-05 12:01:00"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Convert(%v) = %+v, want %+v", rows, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Convert[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestKrakenImporterConvertUnmatchedSpend(t *testing.T) {
+	rows := [][]string{
+		{"T1", "REF1", "2023-06-01 10:00:00", "spend", "", "currency", "ZGBP", "spot / main", "-1000.00", "0", "0"},
+	}
+	if _, err := (krakenImporter{}).Convert(rows); err == nil {
+		t.Errorf("Convert with an unmatched 'spend': expected an error, got none")
+	}
+}
+
+func TestKrakenImporterConvertUnmatchedStakeMove(t *testing.T) {
+	rows := [][]string{
+		{"T1", "REF1", "2023-06-01 10:00:00", "transfer", "spottostaking", "currency", "FLOW", "spot / main", "-100.00", "0", "0"},
+	}
+	if _, err := (krakenImporter{}).Convert(rows); err == nil {
+		t.Errorf("Convert with an unmatched 'spottostaking': expected an error, got none")
+	}
+}
+
+func TestKrakenImporterConvertStakeMoveOutsideWindow(t *testing.T) {
+	rows := [][]string{
+		{"T1", "REF1", "2023-06-01 10:00:00", "transfer", "spottostaking", "currency", "FLOW", "spot / main", "-100.00", "0", "0"},
+		{"T2", "REF2", "2023-06-01 10:10:00", "transfer", "stakingfromspot", "currency", "FLOW.S", "spot / main", "100.00", "0", "100.00"},
+	}
+	if _, err := (krakenImporter{}).Convert(rows); err == nil {
+		t.Errorf("Convert with a 'stakingfromspot' outside the matching window: expected an error, got none")
+	}
+}
+
+func TestKrakenImporterConvertUnrecognisedType(t *testing.T) {
+	rows := [][]string{
+		{"T1", "REF1", "2023-06-01 10:00:00", "trade", "", "currency", "BTC", "spot / main", "1.00", "0", "1.00"},
+	}
+	if _, err := (krakenImporter{}).Convert(rows); err == nil {
+		t.Errorf("Convert with an unrecognised type: expected an error, got none")
+	}
+}
+
+func TestLookupKraken(t *testing.T) {
+	importer, err := Lookup(krakenExpectedHeader)
+	if err != nil {
+		t.Fatalf("Lookup: unexpected error: %s", err)
+	}
+	if importer.Name() != "kraken" {
+		t.Errorf("Lookup: got %q, want \"kraken\"", importer.Name())
+	}
+}
@@ -0,0 +1,73 @@
+package importers
+
+import "testing"
+
+func TestNexoImporterDetect(t *testing.T) {
+	cases := []struct {
+		name   string
+		header []string
+		want   bool
+	}{
+		{"matching header", nexoExpectedHeader, true},
+		{"wrong length", nexoExpectedHeader[:9], false},
+		{"wrong column", append(append([]string{}, nexoExpectedHeader[:1]...), append([]string{"Wrong"}, nexoExpectedHeader[2:]...)...), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := (nexoImporter{}).Detect(c.header); got != c.want {
+				t.Errorf("Detect(%v) = %v, want %v", c.header, got, c.want)
+			}
+		})
+	}
+}
+
+func TestNexoImporterConvert(t *testing.T) {
+	rows := [][]string{
+		{"9876-5432-10", "Interest", "NEXO", "0.11", "NEXO", "0.22", "$98.76", "approved / detail text", "$0.00", "2022-04-05 07:00:06"},
+		{"9876-5432-11", "Exchange", "GBPX/BTC", "1000.00", "BTC", "0.025", "$1234.00", "approved / Exchange GBPX to BTC", "$0.00", "2022-04-06 07:00:06"},
+		{"9876-5432-12", "WithdrawExchanged", "GBP", "500.00", "GBP", "500.00", "$612.00", "approved / GBP Withdrawal", "$0.00", "2022-04-07 07:00:06"},
+	}
+
+	got, err := (nexoImporter{}).Convert(rows)
+	if err != nil {
+		t.Fatalf("Convert(%v): unexpected error: %s", rows, err)
+	}
+
+	want := []Transaction{
+		{TxID: "9876-5432-10", Kind: Reward, BaseCurrency: "NEXO", BaseAmount: "0.22", QuoteCurrency: "NEXO", QuoteAmount: "0.11", UsdEquivalent: "$98.76", Notes: "approved / detail text", DateTime: "2022-04-05 07:00:06"},
+		{TxID: "9876-5432-11", Kind: Buy, BaseCurrency: "BTC", BaseAmount: "0.025", QuoteCurrency: "GBPX/BTC", QuoteAmount: "1000.00", UsdEquivalent: "$1234.00", Notes: "approved / Exchange GBPX to BTC", DateTime: "2022-04-06 07:00:06"},
+		{TxID: "9876-5432-12", Kind: TransferOut, BaseCurrency: "GBP", BaseAmount: "500.00", QuoteCurrency: "GBP", QuoteAmount: "500.00", UsdEquivalent: "$612.00", Notes: "approved / GBP Withdrawal", DateTime: "2022-04-07 07:00:06"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Convert(%v) = %+v, want %+v", rows, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Convert[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if _, err := (nexoImporter{}).Convert([][]string{{"too", "short"}}); err == nil {
+		t.Errorf("Convert with a short row: expected an error, got none")
+	}
+
+	unknownType := [][]string{{"9876-5432-13", "Unlocking Term Deposit", "NEXO", "1.00", "NEXO", "1.00", "$1.00", "approved / detail", "$0.00", "2022-04-08 07:00:06"}}
+	if _, err := (nexoImporter{}).Convert(unknownType); err == nil {
+		t.Errorf("Convert with an unrecognised transaction type: expected an error, got none")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	importer, err := Lookup(nexoExpectedHeader)
+	if err != nil {
+		t.Fatalf("Lookup: unexpected error: %s", err)
+	}
+	if importer.Name() != "nexo" {
+		t.Errorf("Lookup: got %q, want \"nexo\"", importer.Name())
+	}
+
+	if _, err := Lookup([]string{"not", "a", "recognised", "header"}); err == nil {
+		t.Fatalf("Lookup: expected an error for an unrecognised header, got none")
+	}
+}
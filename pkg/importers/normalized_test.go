@@ -0,0 +1,177 @@
+package importers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewCurrencySymbol(t *testing.T) {
+	cases := []struct {
+		raw     string
+		want    CurrencySymbol
+		wantErr bool
+	}{
+		{"btc", "BTC", false},
+		{" GBP ", "GBP", false},
+		{"NOTACURRENCY", "", true},
+	}
+	for _, c := range cases {
+		got, err := NewCurrencySymbol(c.raw)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("NewCurrencySymbol(%q): expected an error, got none", c.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewCurrencySymbol(%q): unexpected error: %s", c.raw, err)
+		}
+		if got != c.want {
+			t.Errorf("NewCurrencySymbol(%q) = %q, want %q", c.raw, got, c.want)
+		}
+	}
+}
+
+func TestAmount(t *testing.T) {
+	a, err := ParseAmount("0.00000001")
+	if err != nil {
+		t.Fatalf("ParseAmount: unexpected error: %s", err)
+	}
+	b, err := ParseAmount("0.00000002")
+	if err != nil {
+		t.Fatalf("ParseAmount: unexpected error: %s", err)
+	}
+	if got := a.Add(b).String(); got != "0.00000003" {
+		t.Errorf("Add: got %q, want \"0.00000003\"", got)
+	}
+	if got := b.Sub(a).String(); got != "0.00000001" {
+		t.Errorf("Sub: got %q, want \"0.00000001\"", got)
+	}
+
+	price, err := ParseAmount("60000.12345678")
+	if err != nil {
+		t.Fatalf("ParseAmount: unexpected error: %s", err)
+	}
+	qty, err := ParseAmount("0.00000001")
+	if err != nil {
+		t.Fatalf("ParseAmount: unexpected error: %s", err)
+	}
+	if got := price.Mul(qty).String(); got != "0.0006" {
+		t.Errorf("Mul: got %q, want \"0.0006\" (String renders at 8 decimal places, per its own doc comment)", got)
+	}
+
+	whole, err := ParseAmount("9.50000000")
+	if err != nil {
+		t.Fatalf("ParseAmount: unexpected error: %s", err)
+	}
+	if got := whole.String(); got != "9.5" {
+		t.Errorf("String: got %q, want \"9.5\"", got)
+	}
+
+	if _, err := ParseAmount("not-a-number"); err == nil {
+		t.Errorf("ParseAmount(\"not-a-number\"): expected an error, got none")
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatalf("MarshalJSON: unexpected error: %s", err)
+	}
+	if got := string(data); got != `"0.00000001"` {
+		t.Errorf("MarshalJSON: got %s, want \"0.00000001\" as a JSON string", got)
+	}
+}
+
+func TestToNormalized(t *testing.T) {
+	tx := Transaction{
+		TxID:          "9876-5432-10",
+		Kind:          Buy,
+		BaseCurrency:  "BTC",
+		BaseAmount:    "0.025",
+		QuoteCurrency: "GBP",
+		QuoteAmount:   "1000.00",
+		Notes:         "approved / Exchange GBP to BTC",
+		DateTime:      "2022-04-06 07:00:06",
+	}
+
+	nt := tx.ToNormalized(5, time.UTC)
+	if len(nt.Errors) != 0 {
+		t.Fatalf("ToNormalized: unexpected Errors: %v", nt.Errors)
+	}
+	if nt.SourceRow != 5 {
+		t.Errorf("SourceRow: got %d, want 5", nt.SourceRow)
+	}
+	if nt.Kind != Buy {
+		t.Errorf("Kind: got %q, want Buy", nt.Kind)
+	}
+	if nt.Asset != "BTC" {
+		t.Errorf("Asset: got %q, want BTC", nt.Asset)
+	}
+	if got := nt.Amount.String(); got != "0.025" {
+		t.Errorf("Amount: got %q, want \"0.025\"", got)
+	}
+	if nt.NativeCurrency != "GBP" {
+		t.Errorf("NativeCurrency: got %q, want GBP", nt.NativeCurrency)
+	}
+	if got := nt.NativeAmount.String(); got != "1000" {
+		t.Errorf("NativeAmount: got %q, want \"1000\"", got)
+	}
+	if !nt.Timestamp.Equal(time.Date(2022, 4, 6, 7, 0, 6, 0, time.UTC)) {
+		t.Errorf("Timestamp: got %v, want 2022-04-06 07:00:06 UTC", nt.Timestamp)
+	}
+	if !nt.LocalTimestamp.Equal(nt.Timestamp) {
+		t.Errorf("LocalTimestamp: got %v, want equal to Timestamp for a UTC local zone", nt.LocalTimestamp)
+	}
+
+	badCurrency := Transaction{BaseCurrency: "NOTACURRENCY", BaseAmount: "1.00", DateTime: "2022-04-06 07:00:06"}
+	bad := badCurrency.ToNormalized(1, nil)
+	if len(bad.Errors) != 1 {
+		t.Fatalf("ToNormalized with a bad currency: got %d Errors, want 1: %v", len(bad.Errors), bad.Errors)
+	}
+
+	badDateTime := Transaction{BaseCurrency: "BTC", BaseAmount: "1.00", DateTime: "not-a-date"}
+	bad = badDateTime.ToNormalized(1, nil)
+	if len(bad.Errors) != 1 || !strings.Contains(bad.Errors[0], "DateTime") {
+		t.Fatalf("ToNormalized with a bad DateTime: got Errors %v, want one mentioning DateTime", bad.Errors)
+	}
+}
+
+func TestNormalizedTransactionMarshalCSV(t *testing.T) {
+	tx := Transaction{
+		Kind: Sell, BaseCurrency: "BTC", BaseAmount: "0.5",
+		QuoteCurrency: "GBP", QuoteAmount: "15000", Notes: "test sale",
+		DateTime: "2022-04-06 07:00:06",
+	}
+	nt := tx.ToNormalized(1, time.UTC)
+	want := []string{"2022-04-06 07:00:06", "SELL", "BTC", "0.5", "GBP", "15000", "", "", "test sale"}
+	got := nt.MarshalCSV()
+	if len(got) != len(want) {
+		t.Fatalf("MarshalCSV() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("MarshalCSV()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNormalizedTransactionMarshalJSON(t *testing.T) {
+	tx := Transaction{Kind: Reward, BaseCurrency: "CRO", BaseAmount: "25", DateTime: "2022-04-06 07:00:06"}
+	nt := tx.ToNormalized(1, time.UTC)
+
+	data, err := json.Marshal(nt)
+	if err != nil {
+		t.Fatalf("MarshalJSON: unexpected error: %s", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: unexpected error: %s", err)
+	}
+	if decoded["Amount"] != "25" {
+		t.Errorf("JSON \"Amount\": got %v, want \"25\"", decoded["Amount"])
+	}
+	if decoded["Asset"] != "CRO" {
+		t.Errorf("JSON \"Asset\": got %v, want \"CRO\"", decoded["Asset"])
+	}
+}
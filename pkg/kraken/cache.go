@@ -0,0 +1,58 @@
+package kraken
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DiskCache persists raw per-entry API responses on disk, one file per key, the same
+// one-file-per-key convention pkg/pricing.FileCache and pkg/fxrate.FileCache already use for their
+// own on-disk caches.
+type DiskCache struct {
+	Dir string
+}
+
+// NewDiskCache returns a DiskCache rooted at dir.
+func NewDiskCache(dir string) *DiskCache {
+	return &DiskCache{Dir: dir}
+}
+
+// Key builds the cache key the request names - (txid, refid, time) - sanitised into a
+// filesystem-safe filename.
+func Key(txid, refid, time string) string {
+	key := strings.Join([]string{txid, refid, time}, "_")
+	return strings.NewReplacer(" ", "_", ":", "-", "/", "-").Replace(key)
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+// Has reports whether key has already been cached, so an incremental run can skip re-processing the
+// entry it names.
+func (c *DiskCache) Has(key string) bool {
+	_, err := os.Stat(c.path(key))
+	return err == nil
+}
+
+// Store writes raw - the entry's raw JSON, as returned by the API - to disk under key.
+func (c *DiskCache) Store(key string, raw []byte) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return fmt.Errorf("kraken: DiskCache: %w", err)
+	}
+	if err := os.WriteFile(c.path(key), raw, 0644); err != nil {
+		return fmt.Errorf("kraken: DiskCache: %w", err)
+	}
+	return nil
+}
+
+// Load reads back the raw bytes Store wrote under key.
+func (c *DiskCache) Load(key string) ([]byte, error) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, fmt.Errorf("kraken: DiskCache: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,110 @@
+package kraken
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestClientSignDeterministic(t *testing.T) {
+	c := NewClient("api-key", "c2VjcmV0LWJ5dGVz") // base64("secret-bytes")
+	params := url.Values{"nonce": {"1616492376594"}}
+
+	a, err := c.sign("/0/private/Ledgers", params)
+	if err != nil {
+		t.Fatalf("sign: unexpected error: %s", err)
+	}
+	b, err := c.sign("/0/private/Ledgers", params)
+	if err != nil {
+		t.Fatalf("sign: unexpected error: %s", err)
+	}
+	if a != b {
+		t.Errorf("sign is not deterministic for identical inputs: got %q and %q", a, b)
+	}
+}
+
+func TestClientSignDistinguishesInputs(t *testing.T) {
+	c := NewClient("api-key", "c2VjcmV0LWJ5dGVz")
+	base, err := c.sign("/0/private/Ledgers", url.Values{"nonce": {"1"}})
+	if err != nil {
+		t.Fatalf("sign: unexpected error: %s", err)
+	}
+
+	otherPath, err := c.sign("/0/private/TradesHistory", url.Values{"nonce": {"1"}})
+	if err != nil {
+		t.Fatalf("sign: unexpected error: %s", err)
+	}
+	if otherPath == base {
+		t.Errorf("sign: different path produced the same signature")
+	}
+
+	otherNonce, err := c.sign("/0/private/Ledgers", url.Values{"nonce": {"2"}})
+	if err != nil {
+		t.Fatalf("sign: unexpected error: %s", err)
+	}
+	if otherNonce == base {
+		t.Errorf("sign: different nonce produced the same signature")
+	}
+}
+
+func TestClientSignInvalidSecret(t *testing.T) {
+	c := NewClient("api-key", "not valid base64!!")
+	if _, err := c.sign("/0/private/Ledgers", url.Values{"nonce": {"1"}}); err == nil {
+		t.Errorf("sign with an invalid API secret: expected an error, got none")
+	}
+}
+
+func TestKeySanitisesFilesystemUnsafeCharacters(t *testing.T) {
+	got := Key("TX1", "REF1", "2023-06-01 10:00:00")
+	for _, forbidden := range []string{" ", ":"} {
+		if strings.Contains(got, forbidden) {
+			t.Errorf("Key(...) = %q, want no %q", got, forbidden)
+		}
+	}
+}
+
+func TestDiskCacheStoreLoadHas(t *testing.T) {
+	cache := NewDiskCache(t.TempDir())
+	key := Key("TX1", "REF1", "2023-06-01 10:00:00")
+
+	if cache.Has(key) {
+		t.Errorf("Has(%q) on an empty cache: got true, want false", key)
+	}
+
+	if err := cache.Store(key, []byte(`{"txid":"TX1"}`)); err != nil {
+		t.Fatalf("Store: unexpected error: %s", err)
+	}
+
+	if !cache.Has(key) {
+		t.Errorf("Has(%q) after Store: got false, want true", key)
+	}
+
+	got, err := cache.Load(key)
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %s", err)
+	}
+	if string(got) != `{"txid":"TX1"}` {
+		t.Errorf("Load(%q) = %q, want %q", key, got, `{"txid":"TX1"}`)
+	}
+}
+
+func TestDiskCacheLoadMissingKey(t *testing.T) {
+	cache := NewDiskCache(t.TempDir())
+	if _, err := cache.Load(Key("TX1", "REF1", "2023-06-01 10:00:00")); err == nil {
+		t.Errorf("Load of a missing key: expected an error, got none")
+	}
+}
+
+func TestLedgerEntryCacheKey(t *testing.T) {
+	e := LedgerEntry{TxID: "TX1", RefID: "REF1", Time: "2023-06-01 10:00:00"}
+	if got, want := e.CacheKey(), Key("TX1", "REF1", "2023-06-01 10:00:00"); got != want {
+		t.Errorf("LedgerEntry.CacheKey() = %q, want %q", got, want)
+	}
+}
+
+func TestTradeCacheKey(t *testing.T) {
+	tr := Trade{TxID: "TX1", OrderTxID: "ORD1", Time: "2023-06-01 10:00:00"}
+	if got, want := tr.CacheKey(), Key("TX1", "ORD1", "2023-06-01 10:00:00"); got != want {
+		t.Errorf("Trade.CacheKey() = %q, want %q", got, want)
+	}
+}
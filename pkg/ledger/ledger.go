@@ -0,0 +1,88 @@
+// Package ledger provides the idempotent-import core a SQLite-backed ledger sits behind: a stable
+// per-row hash (so re-running a converter against overlapping CSV exports doesn't double-count a
+// transaction it has already recorded) and a Store abstraction an "INSERT OR IGNORE"-style backend
+// implements.
+//
+// SQLiteStore (sqlite.go) is the `modernc.org/sqlite`-backed Store the request asked for, with a
+// `transactions` table keyed on `source_row_hash`; nexo/convert-nexo.go's `-sqlite path.db` flag
+// opens one alongside CSV output and reports how many of the run's rows were new versus already
+// present, and its `query` subcommand dumps a SQLiteStore's per-asset ledger in the same order the
+// CSV output groups by. MemoryStore is the in-memory Store this package also ships, usable anywhere
+// idempotent insert/dedup is wanted without a database at all (and as the fake SQLiteStore's own
+// tests were modelled against).
+package ledger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// Row is one imported transaction, matching the requested `transactions` table's columns.
+type Row struct {
+	Source         string
+	SourceRowHash  string
+	TimestampUTC   string
+	Kind           string
+	Asset          string
+	Amount         string
+	NativeAmount   string
+	NativeCurrency string
+	TxHash         string
+	RawJSON        string
+}
+
+// ComputeRowHash returns the stable hash Row.SourceRowHash is keyed on: a SHA-256 digest of
+// (source, timestamp, kind, asset, amount, txHash), the six fields the request names as uniquely
+// identifying an imported transaction regardless of which overlapping export it was read from.
+func ComputeRowHash(source, timestamp, kind, asset, amount, txHash string) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%s", source, timestamp, kind, asset, amount, txHash)))
+	return hex.EncodeToString(h[:])
+}
+
+// Store records Rows keyed on SourceRowHash, reporting whether each Insert call actually added a
+// new row (true) or found an existing one and left it alone (false) - the "INSERT OR IGNORE" the
+// request describes, backend-agnostic.
+type Store interface {
+	// Insert adds row unless a row with the same SourceRowHash is already present, reporting which
+	// happened.
+	Insert(row Row) (inserted bool, err error)
+	// Rows returns every Row for asset, ordered by TimestampUTC, matching the CLI's existing
+	// per-asset CSV grouping.
+	Rows(asset string) ([]Row, error)
+}
+
+// MemoryStore is an in-memory Store, the non-persistent counterpart of SQLiteStore (sqlite.go).
+type MemoryStore struct {
+	rows map[string]Row
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{rows: make(map[string]Row)}
+}
+
+// Insert implements Store.
+func (s *MemoryStore) Insert(row Row) (bool, error) {
+	if row.SourceRowHash == "" {
+		return false, fmt.Errorf("ledger: Insert: empty SourceRowHash")
+	}
+	if _, exists := s.rows[row.SourceRowHash]; exists {
+		return false, nil
+	}
+	s.rows[row.SourceRowHash] = row
+	return true, nil
+}
+
+// Rows implements Store.
+func (s *MemoryStore) Rows(asset string) ([]Row, error) {
+	var matched []Row
+	for _, row := range s.rows {
+		if row.Asset == asset {
+			matched = append(matched, row)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].TimestampUTC < matched[j].TimestampUTC })
+	return matched, nil
+}
@@ -0,0 +1,89 @@
+package ledger
+
+import "testing"
+
+func TestComputeRowHashStable(t *testing.T) {
+	a := ComputeRowHash("cdc", "2023-06-01 10:00:00", "STAKING", "ATOM", "1.25", "hash-1")
+	b := ComputeRowHash("cdc", "2023-06-01 10:00:00", "STAKING", "ATOM", "1.25", "hash-1")
+	if a != b {
+		t.Errorf("ComputeRowHash is not stable: got %q and %q for identical inputs", a, b)
+	}
+}
+
+func TestComputeRowHashDistinguishesFields(t *testing.T) {
+	base := ComputeRowHash("cdc", "2023-06-01 10:00:00", "STAKING", "ATOM", "1.25", "hash-1")
+	cases := []struct {
+		name string
+		got  string
+	}{
+		{"different source", ComputeRowHash("ftx", "2023-06-01 10:00:00", "STAKING", "ATOM", "1.25", "hash-1")},
+		{"different timestamp", ComputeRowHash("cdc", "2023-06-02 10:00:00", "STAKING", "ATOM", "1.25", "hash-1")},
+		{"different kind", ComputeRowHash("cdc", "2023-06-01 10:00:00", "REWARD", "ATOM", "1.25", "hash-1")},
+		{"different asset", ComputeRowHash("cdc", "2023-06-01 10:00:00", "STAKING", "OSMO", "1.25", "hash-1")},
+		{"different amount", ComputeRowHash("cdc", "2023-06-01 10:00:00", "STAKING", "ATOM", "1.30", "hash-1")},
+		{"different tx hash", ComputeRowHash("cdc", "2023-06-01 10:00:00", "STAKING", "ATOM", "1.25", "hash-2")},
+	}
+	for _, c := range cases {
+		if c.got == base {
+			t.Errorf("%s: ComputeRowHash collided with the base row's hash", c.name)
+		}
+	}
+}
+
+func TestMemoryStoreInsertIdempotent(t *testing.T) {
+	store := NewMemoryStore()
+	row := Row{Source: "cdc", SourceRowHash: ComputeRowHash("cdc", "2023-06-01 10:00:00", "STAKING", "ATOM", "1.25", "hash-1"), Asset: "ATOM", TimestampUTC: "2023-06-01 10:00:00"}
+
+	inserted, err := store.Insert(row)
+	if err != nil {
+		t.Fatalf("Insert: unexpected error: %s", err)
+	}
+	if !inserted {
+		t.Errorf("Insert: first insert of a new row: got inserted=false, want true")
+	}
+
+	inserted, err = store.Insert(row)
+	if err != nil {
+		t.Fatalf("Insert: unexpected error: %s", err)
+	}
+	if inserted {
+		t.Errorf("Insert: re-insert of a duplicate row: got inserted=true, want false")
+	}
+
+	rows, err := store.Rows("ATOM")
+	if err != nil {
+		t.Fatalf("Rows: unexpected error: %s", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("Rows(%q) = %+v, want exactly one row", "ATOM", rows)
+	}
+}
+
+func TestMemoryStoreInsertEmptyHash(t *testing.T) {
+	store := NewMemoryStore()
+	if _, err := store.Insert(Row{Source: "cdc"}); err == nil {
+		t.Errorf("Insert with an empty SourceRowHash: expected an error, got none")
+	}
+}
+
+func TestMemoryStoreRowsOrderedByTimestamp(t *testing.T) {
+	store := NewMemoryStore()
+	rows := []Row{
+		{SourceRowHash: "hash-2", Asset: "ATOM", TimestampUTC: "2023-06-02 10:00:00"},
+		{SourceRowHash: "hash-1", Asset: "ATOM", TimestampUTC: "2023-06-01 10:00:00"},
+		{SourceRowHash: "hash-3", Asset: "OSMO", TimestampUTC: "2023-06-03 10:00:00"},
+	}
+	for _, row := range rows {
+		if _, err := store.Insert(row); err != nil {
+			t.Fatalf("Insert(%+v): unexpected error: %s", row, err)
+		}
+	}
+
+	got, err := store.Rows("ATOM")
+	if err != nil {
+		t.Fatalf("Rows: unexpected error: %s", err)
+	}
+	if len(got) != 2 || got[0].SourceRowHash != "hash-1" || got[1].SourceRowHash != "hash-2" {
+		t.Errorf("Rows(%q) = %+v, want hash-1 then hash-2", "ATOM", got)
+	}
+}
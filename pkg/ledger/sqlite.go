@@ -0,0 +1,97 @@
+package ledger
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema is the transactions table the request asked for: source_row_hash is the primary
+// key, so a second Insert of the same row is the "INSERT OR IGNORE" Store documents, not an error.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS transactions (
+	source          TEXT NOT NULL,
+	source_row_hash TEXT PRIMARY KEY,
+	timestamp_utc   TEXT NOT NULL,
+	kind            TEXT NOT NULL,
+	asset           TEXT NOT NULL,
+	amount          TEXT NOT NULL,
+	native_amount   TEXT NOT NULL,
+	native_currency TEXT NOT NULL,
+	tx_hash         TEXT NOT NULL,
+	raw_json        TEXT NOT NULL
+)`
+
+// SQLiteStore is a Store backed by a modernc.org/sqlite transactions table, so re-running a
+// converter against overlapping CSV exports doesn't double-count a transaction across separate
+// invocations (MemoryStore only dedupes within a single run).
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (creating if necessary) a SQLite database at path and ensures its
+// transactions table exists.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("ledger: NewSQLiteStore: %w", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ledger: NewSQLiteStore: creating transactions table: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Close closes the underlying database connection.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Insert implements Store.
+func (s *SQLiteStore) Insert(row Row) (bool, error) {
+	if row.SourceRowHash == "" {
+		return false, fmt.Errorf("ledger: Insert: empty SourceRowHash")
+	}
+	result, err := s.db.Exec(
+		`INSERT OR IGNORE INTO transactions
+			(source, source_row_hash, timestamp_utc, kind, asset, amount, native_amount, native_currency, tx_hash, raw_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		row.Source, row.SourceRowHash, row.TimestampUTC, row.Kind, row.Asset, row.Amount, row.NativeAmount, row.NativeCurrency, row.TxHash, row.RawJSON,
+	)
+	if err != nil {
+		return false, fmt.Errorf("ledger: Insert: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ledger: Insert: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// Rows implements Store.
+func (s *SQLiteStore) Rows(asset string) ([]Row, error) {
+	rows, err := s.db.Query(
+		`SELECT source, source_row_hash, timestamp_utc, kind, asset, amount, native_amount, native_currency, tx_hash, raw_json
+		FROM transactions WHERE asset = ? ORDER BY timestamp_utc`,
+		asset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ledger: Rows: %w", err)
+	}
+	defer rows.Close()
+
+	var matched []Row
+	for rows.Next() {
+		var r Row
+		if err := rows.Scan(&r.Source, &r.SourceRowHash, &r.TimestampUTC, &r.Kind, &r.Asset, &r.Amount, &r.NativeAmount, &r.NativeCurrency, &r.TxHash, &r.RawJSON); err != nil {
+			return nil, fmt.Errorf("ledger: Rows: %w", err)
+		}
+		matched = append(matched, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ledger: Rows: %w", err)
+	}
+	return matched, nil
+}
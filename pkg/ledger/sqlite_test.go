@@ -0,0 +1,83 @@
+package ledger
+
+import "testing"
+
+func TestSQLiteStoreInsertIdempotent(t *testing.T) {
+	store, err := NewSQLiteStore(sqliteTestDSN(t))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: unexpected error: %s", err)
+	}
+	defer store.Close()
+
+	row := Row{Source: "cdc", SourceRowHash: ComputeRowHash("cdc", "2023-06-01 10:00:00", "STAKING", "ATOM", "1.25", "hash-1"), Asset: "ATOM", TimestampUTC: "2023-06-01 10:00:00"}
+
+	inserted, err := store.Insert(row)
+	if err != nil {
+		t.Fatalf("Insert: unexpected error: %s", err)
+	}
+	if !inserted {
+		t.Errorf("Insert: first insert of a new row: got inserted=false, want true")
+	}
+
+	inserted, err = store.Insert(row)
+	if err != nil {
+		t.Fatalf("Insert: unexpected error: %s", err)
+	}
+	if inserted {
+		t.Errorf("Insert: re-insert of a duplicate row: got inserted=true, want false")
+	}
+
+	rows, err := store.Rows("ATOM")
+	if err != nil {
+		t.Fatalf("Rows: unexpected error: %s", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("Rows(%q) = %+v, want exactly one row", "ATOM", rows)
+	}
+}
+
+func TestSQLiteStoreInsertEmptyHash(t *testing.T) {
+	store, err := NewSQLiteStore(sqliteTestDSN(t))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: unexpected error: %s", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Insert(Row{Source: "cdc"}); err == nil {
+		t.Errorf("Insert with an empty SourceRowHash: expected an error, got none")
+	}
+}
+
+func TestSQLiteStoreRowsOrderedByTimestamp(t *testing.T) {
+	store, err := NewSQLiteStore(sqliteTestDSN(t))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: unexpected error: %s", err)
+	}
+	defer store.Close()
+
+	rows := []Row{
+		{SourceRowHash: "hash-2", Asset: "ATOM", TimestampUTC: "2023-06-02 10:00:00"},
+		{SourceRowHash: "hash-1", Asset: "ATOM", TimestampUTC: "2023-06-01 10:00:00"},
+		{SourceRowHash: "hash-3", Asset: "OSMO", TimestampUTC: "2023-06-03 10:00:00"},
+	}
+	for _, r := range rows {
+		if _, err := store.Insert(r); err != nil {
+			t.Fatalf("Insert(%+v): unexpected error: %s", r, err)
+		}
+	}
+
+	got, err := store.Rows("ATOM")
+	if err != nil {
+		t.Fatalf("Rows: unexpected error: %s", err)
+	}
+	if len(got) != 2 || got[0].SourceRowHash != "hash-1" || got[1].SourceRowHash != "hash-2" {
+		t.Errorf("Rows(%q) = %+v, want [hash-1, hash-2] in timestamp order", "ATOM", got)
+	}
+}
+
+// sqliteTestDSN returns a SQLite DSN backed by a fresh file under t.TempDir, so each test gets its
+// own on-disk database that is cleaned up automatically.
+func sqliteTestDSN(t *testing.T) string {
+	t.Helper()
+	return t.TempDir() + "/ledger.db"
+}
@@ -0,0 +1,252 @@
+// Package matcher generalizes the record-pairing idea nexo/convert-nexo.go already uses twice
+// (ExchangeToWithdraw <-> WithdrawExchanged, DepositToExchange <-> ExchangeDepositedOn) into a
+// reusable, exchange-agnostic engine: pair records by (type-pair, currency, |amount|, a time
+// window), and mark whatever is left unmatched as an error for a human to review, instead of the
+// truncated "There are ..." message the TODO list in nexo/convert-nexo.go complains about today.
+//
+// It also adds a capability that pairing does not have: reversal detection. A later record
+// that exactly negates an earlier one, of a type the caller has declared compatible, within a
+// configurable window, is reported as a single Reversed pair rather than two independent unmatched
+// records - the case nexo/convert-nexo.go's TODO list names "Card Cashback Reversal (look for
+// identical transaction later???)".
+//
+// Every Record moves through an explicit state machine: Pending -> Matched, Pending -> Reversed,
+// or Pending -> Orphan (nothing paired it by the time Resolve is called). The request this package
+// was built against cited "the deposit/dispute/chargeback state machine in jouet-paiement" as
+// precedent for this; no such project exists anywhere in this repository, so this state machine
+// is original to this package rather than a port of existing code.
+//
+// nexo/cashback_reversal.go wires this package in for the Card Cashback Reversal TODO, using its
+// reversal detection alone. Replacing nexo/reconcile.go and nexo/fifo.go's own FIFO pairing with
+// this package's Pairing/Resolve is not attempted: reconcile.go/fifo.go also handle partial
+// splits (one record covered by several on the other side), which this package's pairing model
+// does not; doing that safely would mean reworking fifo.go's splitFIFOHead callers, not just
+// adding a new caller alongside them.
+package matcher
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// State is a Record's position in the Pending -> {Matched, Reversed, Orphan} state machine.
+type State int
+
+const (
+	Pending State = iota
+	Matched
+	Reversed
+	Orphan
+)
+
+// String renders State the way it would appear in a report or error message.
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Matched:
+		return "matched"
+	case Reversed:
+		return "reversed"
+	case Orphan:
+		return "orphan"
+	default:
+		return "unknown"
+	}
+}
+
+// Record is one transaction-like event to be paired or matched against a reversal. Amount is
+// signed minor-units (see nexo/money.go's Money.Amount), since a pairing's two legs routinely
+// carry opposite signs (e.g. the GBPX side of a conversion is negative, the GBP side positive)
+// and reversal detection depends on that sign to find an exact negation.
+type Record struct {
+	ID       string
+	Type     string
+	Currency string
+	Amount   int64
+	Time     time.Time
+}
+
+// Pairing declares that a From-typed record is expected to be completed by a later To-typed
+// record - e.g. {From: "ExchangeToWithdraw", To: "WithdrawExchanged"}.
+type Pairing struct {
+	From string
+	To   string
+}
+
+// Config controls how closely two records must line up to be treated as a pairing or a
+// reversal.
+type Config struct {
+	Pairings         []Pairing
+	TolerancePercent float64       // maximum allowed difference between |amounts|, as a percentage
+	PairingWindow    time.Duration // maximum gap between a pairing's From and To record
+	ReversalTypes    []string      // record Types eligible for reversal detection
+	ReversalWindow   time.Duration // maximum gap between a record and the reversal that negates it
+}
+
+// MatchedPair is a Pairing's From record together with the To record it was resolved against.
+type MatchedPair struct {
+	From Record
+	To   Record
+}
+
+// ReversedPair is a record together with the later, exactly-negating record that reversed it.
+type ReversedPair struct {
+	Original Record
+	Reversal Record
+}
+
+// Report is the outcome of a Matcher's Resolve call.
+type Report struct {
+	Matched  []MatchedPair
+	Reversed []ReversedPair
+	Orphans  []Record
+}
+
+// Err returns an error listing every orphaned record's ID, or nil if there are none. This is the
+// equivalent of nexo/reconcile.go's end-of-run "unmatched cross-venue transfers" error, but
+// covering every Pairing/reversal type the Matcher was configured with, not just one.
+func (r Report) Err() error {
+	if len(r.Orphans) == 0 {
+		return nil
+	}
+	errorText := "unmatched records:"
+	for _, o := range r.Orphans {
+		errorText += fmt.Sprintf(" %s (%s, %s);", o.ID, o.Type, o.Currency)
+	}
+	return fmt.Errorf("%s", errorText)
+}
+
+// Matcher accumulates Records and resolves them against its Config's Pairings and reversal
+// rules.
+type Matcher struct {
+	cfg     Config
+	records []Record
+}
+
+// New returns a Matcher configured with cfg.
+func New(cfg Config) *Matcher {
+	return &Matcher{cfg: cfg}
+}
+
+// Add queues r for matching. Records may be added in any order: Resolve sorts each Type's
+// records by Time before pairing.
+func (m *Matcher) Add(r Record) {
+	m.records = append(m.records, r)
+}
+
+// Resolve pairs and reverses every Record added so far and returns the outcome. It does not
+// mutate the Matcher: calling Resolve twice without further Adds returns an equal Report.
+func (m *Matcher) Resolve() Report {
+	state := make(map[string]State, len(m.records))
+	for _, r := range m.records {
+		state[r.ID] = Pending
+	}
+
+	var report Report
+
+	for _, pairing := range m.cfg.Pairings {
+		froms := recordsOfType(m.records, pairing.From, state)
+		tos := recordsOfType(m.records, pairing.To, state)
+		for _, from := range froms {
+			if state[from.ID] != Pending {
+				continue
+			}
+			matchIndex := -1
+			for i, to := range tos {
+				if state[to.ID] != Pending {
+					continue
+				}
+				if to.Currency != from.Currency {
+					continue
+				}
+				if !amountsWithinTolerance(from.Amount, to.Amount, m.cfg.TolerancePercent) {
+					continue
+				}
+				if to.Time.Before(from.Time) || to.Time.Sub(from.Time) > m.cfg.PairingWindow {
+					continue
+				}
+				matchIndex = i
+				break
+			}
+			if matchIndex == -1 {
+				continue
+			}
+			to := tos[matchIndex]
+			state[from.ID] = Matched
+			state[to.ID] = Matched
+			report.Matched = append(report.Matched, MatchedPair{From: from, To: to})
+		}
+	}
+
+	reversalEligible := make(map[string]bool, len(m.cfg.ReversalTypes))
+	for _, t := range m.cfg.ReversalTypes {
+		reversalEligible[t] = true
+	}
+	byType := make(map[string][]Record)
+	for _, r := range m.records {
+		if state[r.ID] == Pending && reversalEligible[r.Type] {
+			byType[r.Type] = append(byType[r.Type], r)
+		}
+	}
+	for _, candidates := range byType {
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].Time.Before(candidates[j].Time) })
+		for i, original := range candidates {
+			if state[original.ID] != Pending {
+				continue
+			}
+			for j := i + 1; j < len(candidates); j++ {
+				reversal := candidates[j]
+				if state[reversal.ID] != Pending {
+					continue
+				}
+				if reversal.Currency != original.Currency {
+					continue
+				}
+				if reversal.Amount != -original.Amount {
+					continue
+				}
+				if reversal.Time.Sub(original.Time) > m.cfg.ReversalWindow {
+					continue
+				}
+				state[original.ID] = Reversed
+				state[reversal.ID] = Reversed
+				report.Reversed = append(report.Reversed, ReversedPair{Original: original, Reversal: reversal})
+				break
+			}
+		}
+	}
+
+	for _, r := range m.records {
+		if state[r.ID] == Pending {
+			state[r.ID] = Orphan
+			report.Orphans = append(report.Orphans, r)
+		}
+	}
+
+	return report
+}
+
+// recordsOfType returns every still-Pending record of the given Type, in Time order.
+func recordsOfType(records []Record, recordType string, state map[string]State) []Record {
+	var matched []Record
+	for _, r := range records {
+		if r.Type == recordType && state[r.ID] == Pending {
+			matched = append(matched, r)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Time.Before(matched[j].Time) })
+	return matched
+}
+
+// amountsWithinTolerance reports whether b is within percent% of a, comparing magnitudes only:
+// a Pairing's two legs do not share a sign convention, so only the size of the transfer matters.
+func amountsWithinTolerance(a, b int64, percent float64) bool {
+	a, b = int64(math.Abs(float64(a))), int64(math.Abs(float64(b)))
+	if a == b {
+		return true
+	}
+	return math.Abs(float64(a-b)) <= float64(a)*percent/100
+}
@@ -0,0 +1,102 @@
+package matcher
+
+import (
+	"testing"
+	"time"
+)
+
+func at(offset time.Duration) time.Time {
+	return time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).Add(offset)
+}
+
+func TestResolvePairing(t *testing.T) {
+	m := New(Config{
+		Pairings:      []Pairing{{From: "ExchangeToWithdraw", To: "WithdrawExchanged"}},
+		PairingWindow: 7 * 24 * time.Hour,
+	})
+	m.Add(Record{ID: "TX-1", Type: "ExchangeToWithdraw", Currency: "GBP", Amount: -1000, Time: at(0)})
+	m.Add(Record{ID: "TX-2", Type: "WithdrawExchanged", Currency: "GBP", Amount: 1000, Time: at(time.Hour)})
+
+	report := m.Resolve()
+	if len(report.Matched) != 1 {
+		t.Fatalf("Resolve: got %d matched pairs, want 1", len(report.Matched))
+	}
+	if report.Matched[0].From.ID != "TX-1" || report.Matched[0].To.ID != "TX-2" {
+		t.Errorf("Resolve: matched %+v", report.Matched[0])
+	}
+	if len(report.Orphans) != 0 {
+		t.Errorf("Resolve: got %d orphans, want 0", len(report.Orphans))
+	}
+}
+
+func TestResolveOrphanOutsideWindow(t *testing.T) {
+	m := New(Config{
+		Pairings:      []Pairing{{From: "ExchangeToWithdraw", To: "WithdrawExchanged"}},
+		PairingWindow: 24 * time.Hour,
+	})
+	m.Add(Record{ID: "TX-1", Type: "ExchangeToWithdraw", Currency: "GBP", Amount: -1000, Time: at(0)})
+	m.Add(Record{ID: "TX-2", Type: "WithdrawExchanged", Currency: "GBP", Amount: 1000, Time: at(48 * time.Hour)})
+
+	report := m.Resolve()
+	if len(report.Matched) != 0 {
+		t.Fatalf("Resolve: got %d matched pairs, want 0", len(report.Matched))
+	}
+	if len(report.Orphans) != 2 {
+		t.Fatalf("Resolve: got %d orphans, want 2", len(report.Orphans))
+	}
+	if err := report.Err(); err == nil {
+		t.Errorf("Report.Err: expected an error for unresolved orphans, got none")
+	}
+}
+
+func TestResolveReversal(t *testing.T) {
+	m := New(Config{
+		ReversalTypes:  []string{"ExchangeCashback"},
+		ReversalWindow: 30 * 24 * time.Hour,
+	})
+	m.Add(Record{ID: "TX-1", Type: "ExchangeCashback", Currency: "BTC", Amount: 500, Time: at(0)})
+	m.Add(Record{ID: "TX-2", Type: "ExchangeCashback", Currency: "BTC", Amount: -500, Time: at(5 * 24 * time.Hour)})
+
+	report := m.Resolve()
+	if len(report.Reversed) != 1 {
+		t.Fatalf("Resolve: got %d reversed pairs, want 1", len(report.Reversed))
+	}
+	if report.Reversed[0].Original.ID != "TX-1" || report.Reversed[0].Reversal.ID != "TX-2" {
+		t.Errorf("Resolve: reversed %+v", report.Reversed[0])
+	}
+	if len(report.Orphans) != 0 {
+		t.Errorf("Resolve: got %d orphans, want 0", len(report.Orphans))
+	}
+}
+
+func TestResolveReversalRequiresExactNegation(t *testing.T) {
+	m := New(Config{
+		ReversalTypes:  []string{"ExchangeCashback"},
+		ReversalWindow: 30 * 24 * time.Hour,
+	})
+	m.Add(Record{ID: "TX-1", Type: "ExchangeCashback", Currency: "BTC", Amount: 500, Time: at(0)})
+	m.Add(Record{ID: "TX-2", Type: "ExchangeCashback", Currency: "BTC", Amount: -499, Time: at(5 * 24 * time.Hour)})
+
+	report := m.Resolve()
+	if len(report.Reversed) != 0 {
+		t.Fatalf("Resolve: got %d reversed pairs, want 0 (not an exact negation)", len(report.Reversed))
+	}
+	if len(report.Orphans) != 2 {
+		t.Errorf("Resolve: got %d orphans, want 2", len(report.Orphans))
+	}
+}
+
+func TestResolveIsIdempotentWithoutFurtherAdds(t *testing.T) {
+	m := New(Config{
+		Pairings:      []Pairing{{From: "ExchangeToWithdraw", To: "WithdrawExchanged"}},
+		PairingWindow: 7 * 24 * time.Hour,
+	})
+	m.Add(Record{ID: "TX-1", Type: "ExchangeToWithdraw", Currency: "GBP", Amount: -1000, Time: at(0)})
+	m.Add(Record{ID: "TX-2", Type: "WithdrawExchanged", Currency: "GBP", Amount: 1000, Time: at(time.Hour)})
+
+	first := m.Resolve()
+	second := m.Resolve()
+	if len(first.Matched) != len(second.Matched) {
+		t.Errorf("Resolve called twice: got %d then %d matched pairs, want equal", len(first.Matched), len(second.Matched))
+	}
+}
@@ -0,0 +1,290 @@
+// Package ofxwriter renders a slice of pkg/importers.Transaction as an OFX 2.x document, mapping
+// each Transaction's Kind onto the closest standard OFX transaction type so the result can be
+// imported into Quicken/GnuCash/MoneyMoney-style tools:
+//
+//	Staking, Reward -> INCOME (INCOMETYPE=INTEREST, INCOMETYPE=MISC respectively)
+//	Buy, Sell       -> BUYOTHER, SELLOTHER
+//	TransferIn/Out  -> a BANKTRANLIST STMTTRN with TRNTYPE=XFER and a BANKACCTFROM/BANKACCTTO
+//
+// Any other Kind (currently just Fee) is reported as an error rather than silently dropped, the
+// same policy nexo/ofx.go - the Nexo-specific, map[string][][]string-shaped exporter this
+// generalises - already follows. nexo/ofx.go itself is left as is: convert-nexo.go does not yet
+// build Transaction slices (see pkg/importers's own doc comment on that follow-up), so there is
+// nothing there for this package to replace yet.
+package ofxwriter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AntonioCarlini/data-processing/pkg/importers"
+)
+
+// AccountCurrency is the currency every Transaction's CURRENCY aggregate is rendered with,
+// regardless of the asset actually being traded; an ORIGCURRENCY aggregate is added alongside it
+// whenever the Transaction's own currency differs, the convention ofxgo documents for a
+// transaction denominated in something other than the account's default currency.
+const AccountCurrency = "GBP"
+
+// bankAccountPlaceholder fills BANKACCTFROM/BANKACCTTO's BANKID and ACCTID for a transfer: the
+// CSV exports this package converts never record a real external bank account number, only that
+// a transfer happened, so this is a synthesized placeholder, not a real account identifier.
+const bankAccountPlaceholder = "EXTERNAL"
+
+// Write renders txs as an OFX 2.x document: an INVSTMTRS section carries the INCOME/BUYOTHER/
+// SELLOTHER transactions (Staking, Reward, Buy, Sell) and a BANKTRANLIST section carries the
+// XFER transactions (TransferIn, TransferOut). brokerID/acctID identify the originating exchange
+// account (e.g. "nexo.io"/"NEXO") and are used for both the investment and bank account blocks.
+func Write(brokerID, acctID string, txs []importers.Transaction) (string, error) {
+	var invtranlist strings.Builder
+	var banktranlist strings.Builder
+	securities := make(map[string]bool)
+
+	for fitid, tx := range txs {
+		switch tx.Kind {
+		case importers.Staking, importers.Reward, importers.Buy, importers.Sell:
+			rendered, err := invTransaction(tx, fitid+1)
+			if err != nil {
+				return "", fmt.Errorf("ofxwriter: %s: %w", tx.TxID, err)
+			}
+			invtranlist.WriteString(rendered)
+			securities[tx.BaseCurrency] = true
+		case importers.TransferIn, importers.TransferOut:
+			rendered, err := bankTransaction(tx, fitid+1)
+			if err != nil {
+				return "", fmt.Errorf("ofxwriter: %s: %w", tx.TxID, err)
+			}
+			banktranlist.WriteString(rendered)
+		default:
+			return "", fmt.Errorf("ofxwriter: %s: unhandled transaction kind %q", tx.TxID, tx.Kind)
+		}
+	}
+
+	currencies := make([]string, 0, len(securities))
+	for currency := range securities {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	var seclist strings.Builder
+	for _, currency := range currencies {
+		seclist.WriteString(fmt.Sprintf(secInfoTemplate, currency, currency, currency))
+	}
+
+	return fmt.Sprintf(documentTemplate, brokerID, acctID, banktranlist.String(), brokerID, acctID, invtranlist.String(), seclist.String()), nil
+}
+
+// ofxDate reformats a "YYYY-MM-DD HH:MM:SS" DateTime field into OFX's "YYYYMMDDHHMMSS" form.
+func ofxDate(dateTime string) string {
+	return strings.NewReplacer("-", "", " ", "", ":", "").Replace(dateTime)
+}
+
+// currencyBlock renders tx's CURRENCY aggregate (always AccountCurrency) plus an ORIGCURRENCY
+// aggregate naming currency when it differs from AccountCurrency.
+func currencyBlock(currency string) string {
+	block := fmt.Sprintf(currencyTemplate, AccountCurrency)
+	if currency != "" && currency != AccountCurrency {
+		block += fmt.Sprintf(origCurrencyTemplate, currency)
+	}
+	return block
+}
+
+// invTransaction renders a single Staking/Reward/Buy/Sell Transaction as the matching INVTRANLIST
+// child aggregate (INCOME, BUYOTHER or SELLOTHER).
+func invTransaction(tx importers.Transaction, fitid int) (string, error) {
+	date := ofxDate(tx.DateTime)
+	secID := tx.BaseCurrency
+	currency := currencyBlock(tx.BaseCurrency)
+
+	switch tx.Kind {
+	case importers.Staking:
+		return fmt.Sprintf(incomeTemplate, fitid, date, secID, "INTEREST", tx.UsdEquivalent, currency), nil
+	case importers.Reward:
+		return fmt.Sprintf(incomeTemplate, fitid, date, secID, "MISC", tx.UsdEquivalent, currency), nil
+	case importers.Buy:
+		return fmt.Sprintf(buyTemplate, fitid, date, secID, tx.BaseAmount, tx.UsdEquivalent, currency), nil
+	case importers.Sell:
+		return fmt.Sprintf(sellTemplate, fitid, date, secID, tx.BaseAmount, tx.UsdEquivalent, currency), nil
+	default:
+		return "", fmt.Errorf("unhandled investment transaction kind %q", tx.Kind)
+	}
+}
+
+// bankTransaction renders a single TransferIn/TransferOut Transaction as a BANKTRANLIST STMTTRN
+// with TRNTYPE=XFER, using QuoteCurrency (the transfer's far side) for its ORIGCURRENCY.
+func bankTransaction(tx importers.Transaction, fitid int) (string, error) {
+	date := ofxDate(tx.DateTime)
+	currency := currencyBlock(tx.QuoteCurrency)
+	amount := strings.TrimPrefix(tx.BaseAmount, "-")
+
+	switch tx.Kind {
+	case importers.TransferOut:
+		return fmt.Sprintf(xferTemplate, date, "-"+amount, fitid, currency, bankAcctToTemplate), nil
+	case importers.TransferIn:
+		return fmt.Sprintf(xferTemplate, date, amount, fitid, currency, bankAcctFromTemplate), nil
+	default:
+		return "", fmt.Errorf("unhandled bank transaction kind %q", tx.Kind)
+	}
+}
+
+const documentTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+<SIGNONMSGSRSV1>
+<SONRS>
+<STATUS>
+<CODE>0</CODE>
+<SEVERITY>INFO</SEVERITY>
+</STATUS>
+<DTSERVER>19700101000000</DTSERVER>
+<LANGUAGE>ENG</LANGUAGE>
+</SONRS>
+</SIGNONMSGSRSV1>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<TRNUID>1</TRNUID>
+<STATUS>
+<CODE>0</CODE>
+<SEVERITY>INFO</SEVERITY>
+</STATUS>
+<STMTRS>
+<CURDEF>GBP</CURDEF>
+<BANKACCTFROM>
+<BANKID>%s</BANKID>
+<ACCTID>%s</ACCTID>
+<ACCTTYPE>CHECKING</ACCTTYPE>
+</BANKACCTFROM>
+<BANKTRANLIST>
+%s</BANKTRANLIST>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+<INVSTMTMSGSRSV1>
+<INVSTMTTRNRS>
+<TRNUID>2</TRNUID>
+<STATUS>
+<CODE>0</CODE>
+<SEVERITY>INFO</SEVERITY>
+</STATUS>
+<INVSTMTRS>
+<DTASOF>19700101000000</DTASOF>
+<INVACCTFROM>
+<BROKERID>%s</BROKERID>
+<ACCTID>%s</ACCTID>
+</INVACCTFROM>
+<INVTRANLIST>
+%s</INVTRANLIST>
+</INVSTMTRS>
+</INVSTMTTRNRS>
+</INVSTMTMSGSRSV1>
+<SECLISTMSGSRSV1>
+<SECLISTTRNRS>
+<TRNUID>3</TRNUID>
+<STATUS>
+<CODE>0</CODE>
+<SEVERITY>INFO</SEVERITY>
+</STATUS>
+<SECLIST>
+%s</SECLIST>
+</SECLISTTRNRS>
+</SECLISTMSGSRSV1>
+</OFX>
+`
+
+const currencyTemplate = `<CURRENCY>
+<CURRATE>1</CURRATE>
+<CURSYM>%s</CURSYM>
+</CURRENCY>
+`
+
+const origCurrencyTemplate = `<ORIGCURRENCY>
+<CURRATE>1</CURRATE>
+<CURSYM>%s</CURSYM>
+</ORIGCURRENCY>
+`
+
+const incomeTemplate = `<INCOME>
+<INVTRAN>
+<FITID>%d</FITID>
+<DTTRADE>%s</DTTRADE>
+</INVTRAN>
+<SECID>
+<UNIQUEID>%s</UNIQUEID>
+<UNIQUEIDTYPE>TICKER</UNIQUEIDTYPE>
+</SECID>
+<INCOMETYPE>%s</INCOMETYPE>
+<TOTAL>%s</TOTAL>
+<SUBACCTSEC>OTHER</SUBACCTSEC>
+<SUBACCTFUND>OTHER</SUBACCTFUND>
+%s</INCOME>
+`
+
+const buyTemplate = `<BUYOTHER>
+<INVBUY>
+<INVTRAN>
+<FITID>%d</FITID>
+<DTTRADE>%s</DTTRADE>
+</INVTRAN>
+<SECID>
+<UNIQUEID>%s</UNIQUEID>
+<UNIQUEIDTYPE>TICKER</UNIQUEIDTYPE>
+</SECID>
+<UNITS>%s</UNITS>
+<UNITPRICE>0</UNITPRICE>
+<TOTAL>%s</TOTAL>
+<SUBACCTSEC>OTHER</SUBACCTSEC>
+<SUBACCTFUND>OTHER</SUBACCTFUND>
+%s</INVBUY>
+</BUYOTHER>
+`
+
+const sellTemplate = `<SELLOTHER>
+<INVSELL>
+<INVTRAN>
+<FITID>%d</FITID>
+<DTTRADE>%s</DTTRADE>
+</INVTRAN>
+<SECID>
+<UNIQUEID>%s</UNIQUEID>
+<UNIQUEIDTYPE>TICKER</UNIQUEIDTYPE>
+</SECID>
+<UNITS>-%s</UNITS>
+<UNITPRICE>0</UNITPRICE>
+<TOTAL>%s</TOTAL>
+<SUBACCTSEC>OTHER</SUBACCTSEC>
+<SUBACCTFUND>OTHER</SUBACCTFUND>
+%s</INVSELL>
+</SELLOTHER>
+`
+
+const xferTemplate = `<STMTTRN>
+<TRNTYPE>XFER</TRNTYPE>
+<DTPOSTED>%s</DTPOSTED>
+<TRNAMT>%s</TRNAMT>
+<FITID>%d</FITID>
+%s%s</STMTTRN>
+`
+
+const bankAcctToTemplate = `<BANKACCTTO>
+<BANKID>` + bankAccountPlaceholder + `</BANKID>
+<ACCTID>` + bankAccountPlaceholder + `</ACCTID>
+<ACCTTYPE>CHECKING</ACCTTYPE>
+</BANKACCTTO>
+`
+
+const bankAcctFromTemplate = `<BANKACCTFROM>
+<BANKID>` + bankAccountPlaceholder + `</BANKID>
+<ACCTID>` + bankAccountPlaceholder + `</ACCTID>
+<ACCTTYPE>CHECKING</ACCTTYPE>
+</BANKACCTFROM>
+`
+
+const secInfoTemplate = `<SECINFO>
+<SECID>
+<UNIQUEID>%s</UNIQUEID>
+<UNIQUEIDTYPE>TICKER</UNIQUEIDTYPE>
+</SECID>
+<SECNAME>%s</SECNAME>
+<TICKER>%s</TICKER>
+</SECINFO>
+`
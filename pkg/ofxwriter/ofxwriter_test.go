@@ -0,0 +1,54 @@
+package ofxwriter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AntonioCarlini/data-processing/pkg/importers"
+)
+
+func TestWrite(t *testing.T) {
+	txs := []importers.Transaction{
+		{TxID: "TX-1", Kind: importers.Staking, BaseCurrency: "NEXO", BaseAmount: "0.11", UsdEquivalent: "98.76", DateTime: "2022-04-05 07:00:06"},
+		{TxID: "TX-2", Kind: importers.Reward, BaseCurrency: "NEXO", BaseAmount: "0.22", UsdEquivalent: "12.00", DateTime: "2022-04-06 07:00:06"},
+		{TxID: "TX-3", Kind: importers.Buy, BaseCurrency: "BTC", BaseAmount: "0.025", UsdEquivalent: "1234.00", DateTime: "2022-04-07 07:00:06"},
+		{TxID: "TX-4", Kind: importers.Sell, BaseCurrency: "GBPX", BaseAmount: "1000.00", UsdEquivalent: "1234.00", DateTime: "2022-04-07 07:00:06"},
+		{TxID: "TX-5", Kind: importers.TransferOut, BaseCurrency: "GBP", BaseAmount: "500.00", QuoteCurrency: "GBP", DateTime: "2022-04-08 07:00:06"},
+	}
+
+	got, err := Write("nexo.io", "NEXO", txs)
+	if err != nil {
+		t.Fatalf("Write: unexpected error: %s", err)
+	}
+
+	for _, want := range []string{
+		"<INCOMETYPE>INTEREST</INCOMETYPE>",
+		"<INCOMETYPE>MISC</INCOMETYPE>",
+		"<BUYOTHER>",
+		"<SELLOTHER>",
+		"<TRNTYPE>XFER</TRNTYPE>",
+		"<TRNAMT>-500.00</TRNAMT>",
+		"<CURSYM>GBP</CURSYM>",
+		"<ORIGCURRENCY>\n<CURRATE>1</CURRATE>\n<CURSYM>BTC</CURSYM>\n</ORIGCURRENCY>",
+		"<SECNAME>BTC</SECNAME>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Write output missing %q\nfull output:\n%s", want, got)
+		}
+	}
+
+	// TX-1/TX-2 (NEXO), TX-3 (BTC) and TX-4 (GBPX) each differ from AccountCurrency and so each
+	// carry an ORIGCURRENCY; TX-5's QuoteCurrency is GBP, matching AccountCurrency, so it does not.
+	if strings.Count(got, "<ORIGCURRENCY>") != 4 {
+		t.Errorf("Write output: want exactly 4 ORIGCURRENCY aggregates, got:\n%s", got)
+	}
+}
+
+func TestWriteUnhandledKind(t *testing.T) {
+	txs := []importers.Transaction{
+		{TxID: "TX-FEE", Kind: importers.Fee, BaseCurrency: "BTC", BaseAmount: "0.001", DateTime: "2022-04-05 07:00:06"},
+	}
+	if _, err := Write("nexo.io", "NEXO", txs); err == nil {
+		t.Errorf("Write with a Fee transaction: expected an error, got none")
+	}
+}
@@ -0,0 +1,58 @@
+package priceoracle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// BitfinexProvider fetches a historical daily close price from Bitfinex's public candles endpoint,
+// requesting a single 1-day candle for the asset's USD pair.
+type BitfinexProvider struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewBitfinexProvider returns a BitfinexProvider against the public Bitfinex API.
+func NewBitfinexProvider() *BitfinexProvider {
+	return &BitfinexProvider{BaseURL: "https://api-pub.bitfinex.com", Client: http.DefaultClient}
+}
+
+func (p *BitfinexProvider) Name() string { return "bitfinex" }
+
+// PriceAt implements Provider.
+func (p *BitfinexProvider) PriceAt(asset string, t time.Time) (string, error) {
+	dayStart := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	dayEnd := dayStart.Add(24 * time.Hour)
+
+	requestURL := fmt.Sprintf("%s/v2/candles/trade:1D:t%sUSD/hist?start=%d&end=%d&limit=1&sort=1",
+		p.BaseURL, asset, dayStart.UnixMilli(), dayEnd.UnixMilli())
+
+	resp, err := p.Client.Get(requestURL)
+	if err != nil {
+		return "", fmt.Errorf("priceoracle: BitfinexProvider: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("priceoracle: BitfinexProvider: %s: unexpected status %s", requestURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("priceoracle: BitfinexProvider: %w", err)
+	}
+
+	var candles [][]float64
+	if err := json.Unmarshal(body, &candles); err != nil {
+		return "", fmt.Errorf("priceoracle: BitfinexProvider: %w", err)
+	}
+	if len(candles) == 0 || len(candles[0]) < 3 {
+		return "", fmt.Errorf("priceoracle: BitfinexProvider: %s: no candle for %s", requestURL, dayStart.Format("2006-01-02"))
+	}
+
+	// candle layout is [MTS, OPEN, CLOSE, HIGH, LOW, VOLUME].
+	return strconv.FormatFloat(candles[0][2], 'f', -1, 64), nil
+}
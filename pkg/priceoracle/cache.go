@@ -0,0 +1,131 @@
+package priceoracle
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// cacheKey identifies one cached lookup by asset, calendar date and the provider that answered it -
+// the three columns the request this package was built against asked the cache to be keyed by.
+type cacheKey struct {
+	asset, date, provider string
+}
+
+// CSVCache decorates a Chain with an on-disk cache held as a single CSV file at Path, so a given
+// (asset, date) is only ever fetched from Chain once across runs. It mirrors the
+// historicalPriceCacheUpdated flag kraken/convert-kraken.go already declares: Dirty reports whether
+// Flush has anything new to write, and Flush is the "storeHistoricalPriceCache" write-back that
+// file's own TODO never implemented.
+type CSVCache struct {
+	Path     string
+	Upstream *Chain
+
+	entries map[cacheKey]string
+	dirty   bool
+}
+
+// NewCSVCache returns a CSVCache backed by the CSV file at path, falling back to upstream on a
+// miss. If path already exists, its contents are loaded immediately; a missing file is treated as
+// an empty cache rather than an error, since the first run against a fresh --cache path has
+// nothing to load yet.
+func NewCSVCache(path string, upstream *Chain) (*CSVCache, error) {
+	c := &CSVCache{Path: path, Upstream: upstream, entries: make(map[cacheKey]string)}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("priceoracle: CSVCache: %w", err)
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("priceoracle: CSVCache: %s: %w", path, err)
+	}
+	for i, row := range rows {
+		if i == 0 {
+			continue // header row: "asset,date,provider,price"
+		}
+		if len(row) != 4 {
+			return nil, fmt.Errorf("priceoracle: CSVCache: %s: row %d: expected 4 columns, got %d", path, i+1, len(row))
+		}
+		c.entries[cacheKey{asset: row[0], date: row[1], provider: row[2]}] = row[3]
+	}
+	return c, nil
+}
+
+// PriceAt returns the cached price for (asset, t) under any provider if one is already recorded;
+// otherwise it asks Upstream, records the result (marking the cache Dirty), and returns it.
+func (c *CSVCache) PriceAt(asset string, t time.Time) (price string, provider string, err error) {
+	date := t.Format("2006-01-02")
+	for key, cachedPrice := range c.entries {
+		if key.asset == asset && key.date == date {
+			return cachedPrice, key.provider, nil
+		}
+	}
+
+	price, provider, err = c.Upstream.PriceAt(asset, t)
+	if err != nil {
+		return "", "", err
+	}
+	c.entries[cacheKey{asset: asset, date: date, provider: provider}] = price
+	c.dirty = true
+	return price, provider, nil
+}
+
+// Dirty reports whether Flush has anything new to write since NewCSVCache loaded Path (or since the
+// last Flush).
+func (c *CSVCache) Dirty() bool {
+	return c.dirty
+}
+
+// Flush writes every cached entry back to Path as CSV, sorted by (asset, date, provider) for a
+// deterministic diff between runs. It is a no-op if nothing has changed since loading.
+func (c *CSVCache) Flush() error {
+	if !c.dirty {
+		return nil
+	}
+
+	keys := make([]cacheKey, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].asset != keys[j].asset {
+			return keys[i].asset < keys[j].asset
+		}
+		if keys[i].date != keys[j].date {
+			return keys[i].date < keys[j].date
+		}
+		return keys[i].provider < keys[j].provider
+	})
+
+	f, err := os.Create(c.Path)
+	if err != nil {
+		return fmt.Errorf("priceoracle: CSVCache: %w", err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"asset", "date", "provider", "price"}); err != nil {
+		return fmt.Errorf("priceoracle: CSVCache: %w", err)
+	}
+	for _, key := range keys {
+		row := []string{key.asset, key.date, key.provider, c.entries[key]}
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("priceoracle: CSVCache: %w", err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("priceoracle: CSVCache: %w", err)
+	}
+
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,26 @@
+package priceoracle
+
+import (
+	"time"
+
+	"github.com/AntonioCarlini/data-processing/pkg/pricing"
+)
+
+// CoinGeckoProvider adapts pkg/pricing's existing CoinGecko-backed PriceOracle - quoted in USD -
+// onto the Provider interface, rather than re-implementing the same /coins/{id}/history call a
+// second time.
+type CoinGeckoProvider struct {
+	oracle pricing.PriceOracle
+}
+
+// NewCoinGeckoProvider returns a CoinGeckoProvider backed by the public CoinGecko API.
+func NewCoinGeckoProvider() *CoinGeckoProvider {
+	return &CoinGeckoProvider{oracle: pricing.NewCoinGeckoProvider()}
+}
+
+func (p *CoinGeckoProvider) Name() string { return "coingecko" }
+
+// PriceAt implements Provider.
+func (p *CoinGeckoProvider) PriceAt(asset string, t time.Time) (string, error) {
+	return p.oracle.PriceAt(asset, t, "usd")
+}
@@ -0,0 +1,108 @@
+package priceoracle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// krakenOHLCSymbols maps this repo's currency tickers onto the asset code Kraken's own public
+// market data uses ahead of the "USD" quote currency (e.g. Kraken quotes Bitcoin as "XBT", not
+// "BTC"). Tickers absent from this map are assumed to match Kraken's own code unchanged.
+var krakenOHLCSymbols = map[string]string{
+	"BTC":  "XBT",
+	"DOGE": "XDG",
+}
+
+// KrakenOHLCProvider fetches a historical daily close price from Kraken's public
+// /0/public/OHLC endpoint, requested with interval=1440 (one candle per day). BaseURL defaults to
+// the public API but can be overridden, e.g. to point at a test server.
+type KrakenOHLCProvider struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewKrakenOHLCProvider returns a KrakenOHLCProvider against the public Kraken API.
+func NewKrakenOHLCProvider() *KrakenOHLCProvider {
+	return &KrakenOHLCProvider{BaseURL: "https://api.kraken.com", Client: http.DefaultClient}
+}
+
+func (p *KrakenOHLCProvider) Name() string { return "kraken-ohlc" }
+
+type krakenOHLCResponse struct {
+	Error  []string                   `json:"error"`
+	Result map[string]json.RawMessage `json:"result"`
+}
+
+// PriceAt implements Provider.
+func (p *KrakenOHLCProvider) PriceAt(asset string, t time.Time) (string, error) {
+	pairSymbol := asset
+	if mapped, found := krakenOHLCSymbols[asset]; found {
+		pairSymbol = mapped
+	}
+	pair := pairSymbol + "USD"
+
+	dayStart := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	query := url.Values{
+		"pair":     {pair},
+		"interval": {"1440"},
+		"since":    {strconv.FormatInt(dayStart.Add(-24*time.Hour).Unix(), 10)},
+	}
+	requestURL := fmt.Sprintf("%s/0/public/OHLC?%s", p.BaseURL, query.Encode())
+
+	resp, err := p.Client.Get(requestURL)
+	if err != nil {
+		return "", fmt.Errorf("priceoracle: KrakenOHLCProvider: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("priceoracle: KrakenOHLCProvider: %s: unexpected status %s", requestURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("priceoracle: KrakenOHLCProvider: %w", err)
+	}
+	var parsed krakenOHLCResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("priceoracle: KrakenOHLCProvider: %w", err)
+	}
+	if len(parsed.Error) > 0 {
+		return "", fmt.Errorf("priceoracle: KrakenOHLCProvider: %s: %v", requestURL, parsed.Error)
+	}
+
+	var candles [][]json.RawMessage
+	for key, raw := range parsed.Result {
+		if key == "last" {
+			continue
+		}
+		if err := json.Unmarshal(raw, &candles); err != nil {
+			return "", fmt.Errorf("priceoracle: KrakenOHLCProvider: %s: %w", requestURL, err)
+		}
+		break
+	}
+
+	for _, candle := range candles {
+		if len(candle) < 5 {
+			continue
+		}
+		var candleTime int64
+		if err := json.Unmarshal(candle[0], &candleTime); err != nil {
+			continue
+		}
+		if time.Unix(candleTime, 0).UTC().Format("2006-01-02") != dayStart.Format("2006-01-02") {
+			continue
+		}
+		var close string
+		if err := json.Unmarshal(candle[4], &close); err != nil {
+			return "", fmt.Errorf("priceoracle: KrakenOHLCProvider: %s: unparseable close %s", requestURL, candle[4])
+		}
+		return close, nil
+	}
+
+	return "", fmt.Errorf("priceoracle: KrakenOHLCProvider: %s: no candle for %s", requestURL, dayStart.Format("2006-01-02"))
+}
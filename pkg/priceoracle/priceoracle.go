@@ -0,0 +1,66 @@
+// Package priceoracle resolves a historical daily USD price for a token from more than one
+// upstream source, falling back from one to the next when a source has no data for the requested
+// date, and recording which source answered so a caller can surface that for audit - the
+// multi-provider counterpart to pkg/pricing.PriceOracle, which talks to CoinGecko alone.
+//
+// Provider is the per-source interface; Chain combines several Providers into the configurable
+// fallback order the request this package was built against asked for. CSVCache (cache.go) decorates
+// a Chain with an on-disk cache keyed by (asset, date, provider), so a provider's answer for a given
+// day is only ever fetched once.
+//
+// kraken/convert-kraken.go's own static, per-coin CSV price files and LookupHistoricalTokenValue
+// remain unchanged: wiring this package into that ~800-line stateful convertTransactions - which
+// would mean touching every call site that builds an output row, to add the new provider column -
+// is left as follow-up, for the same reason pkg/kraken's REST client was kept out of main() in an
+// earlier change: no compiler in this sandbox to catch a mis-wired call site in a function with no
+// test coverage of its own.
+package priceoracle
+
+import "time"
+
+// Provider resolves the historical daily USD price of asset (e.g. "BTC") on the day containing t.
+// A Provider with no data for that day returns an error, so Chain can fall back to the next one.
+type Provider interface {
+	// Name identifies the provider in Chain's and CSVCache's output (e.g. "coingecko").
+	Name() string
+	PriceAt(asset string, t time.Time) (string, error)
+}
+
+// Chain tries each Provider in order, returning the first one's price along with its Name, or an
+// error naming every provider that was tried if none of them has data for the requested day.
+type Chain struct {
+	Providers []Provider
+}
+
+// NewChain returns a Chain that tries providers in the order given.
+func NewChain(providers ...Provider) *Chain {
+	return &Chain{Providers: providers}
+}
+
+// PriceAt implements fallback lookup: the first Provider to return a price (not an error) wins.
+func (c *Chain) PriceAt(asset string, t time.Time) (price string, provider string, err error) {
+	var tried []string
+	for _, p := range c.Providers {
+		price, err := p.PriceAt(asset, t)
+		if err == nil {
+			return price, p.Name(), nil
+		}
+		tried = append(tried, p.Name()+": "+err.Error())
+	}
+	return "", "", &NoProviderError{Asset: asset, Time: t, Attempts: tried}
+}
+
+// NoProviderError reports that every Provider in a Chain failed to price Asset on Time.
+type NoProviderError struct {
+	Asset    string
+	Time     time.Time
+	Attempts []string
+}
+
+func (e *NoProviderError) Error() string {
+	msg := "priceoracle: no provider has a price for " + e.Asset + " on " + e.Time.Format("2006-01-02")
+	for _, attempt := range e.Attempts {
+		msg += "\n  " + attempt
+	}
+	return msg
+}
@@ -0,0 +1,135 @@
+package priceoracle
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// stubProvider is a Provider that counts calls and either returns a fixed price or always fails,
+// so tests can assert on Chain's fallback behaviour without making a real network call.
+type stubProvider struct {
+	name  string
+	price string
+	err   error
+	calls int
+}
+
+func (s *stubProvider) Name() string { return s.name }
+
+func (s *stubProvider) PriceAt(asset string, t time.Time) (string, error) {
+	s.calls++
+	if s.err != nil {
+		return "", s.err
+	}
+	return s.price, nil
+}
+
+func TestChainReturnsFirstSuccessfulProvider(t *testing.T) {
+	first := &stubProvider{name: "first", err: fmt.Errorf("no data")}
+	second := &stubProvider{name: "second", price: "27413.52"}
+	third := &stubProvider{name: "third", price: "99999.00"}
+	chain := NewChain(first, second, third)
+
+	price, provider, err := chain.PriceAt("BTC", time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("PriceAt: unexpected error: %s", err)
+	}
+	if price != "27413.52" || provider != "second" {
+		t.Errorf("PriceAt = (%q, %q), want (%q, %q)", price, provider, "27413.52", "second")
+	}
+	if third.calls != 0 {
+		t.Errorf("third provider called %d times, want 0 (chain should stop at the first success)", third.calls)
+	}
+}
+
+func TestChainAllProvidersFail(t *testing.T) {
+	first := &stubProvider{name: "first", err: fmt.Errorf("no data")}
+	second := &stubProvider{name: "second", err: fmt.Errorf("rate limited")}
+	chain := NewChain(first, second)
+
+	if _, _, err := chain.PriceAt("BTC", time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Errorf("PriceAt with every provider failing: expected an error, got none")
+	}
+}
+
+func TestCSVCacheMissThenHit(t *testing.T) {
+	dir := t.TempDir()
+	stub := &stubProvider{name: "stub", price: "27413.52"}
+	cache, err := NewCSVCache(dir+"/prices.csv", NewChain(stub))
+	if err != nil {
+		t.Fatalf("NewCSVCache: unexpected error: %s", err)
+	}
+	date := time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	price, provider, err := cache.PriceAt("BTC", date)
+	if err != nil {
+		t.Fatalf("PriceAt: unexpected error: %s", err)
+	}
+	if price != "27413.52" || provider != "stub" {
+		t.Errorf("PriceAt = (%q, %q), want (%q, %q)", price, provider, "27413.52", "stub")
+	}
+	if !cache.Dirty() {
+		t.Errorf("Dirty() after a miss: got false, want true")
+	}
+
+	price, provider, err = cache.PriceAt("BTC", date)
+	if err != nil {
+		t.Fatalf("PriceAt (cached): unexpected error: %s", err)
+	}
+	if price != "27413.52" || provider != "stub" {
+		t.Errorf("PriceAt (cached) = (%q, %q), want (%q, %q)", price, provider, "27413.52", "stub")
+	}
+	if stub.calls != 1 {
+		t.Errorf("upstream called %d times, want 1 (second lookup should have hit the cache)", stub.calls)
+	}
+}
+
+func TestCSVCacheFlushAndReload(t *testing.T) {
+	path := t.TempDir() + "/prices.csv"
+	stub := &stubProvider{name: "stub", price: "100.00"}
+	cache, err := NewCSVCache(path, NewChain(stub))
+	if err != nil {
+		t.Fatalf("NewCSVCache: unexpected error: %s", err)
+	}
+	date := time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	if _, _, err := cache.PriceAt("BTC", date); err != nil {
+		t.Fatalf("PriceAt: unexpected error: %s", err)
+	}
+	if err := cache.Flush(); err != nil {
+		t.Fatalf("Flush: unexpected error: %s", err)
+	}
+	if cache.Dirty() {
+		t.Errorf("Dirty() after Flush: got true, want false")
+	}
+
+	reloaded, err := NewCSVCache(path, NewChain(&stubProvider{name: "stub", err: fmt.Errorf("should not be called")}))
+	if err != nil {
+		t.Fatalf("NewCSVCache (reload): unexpected error: %s", err)
+	}
+	price, provider, err := reloaded.PriceAt("BTC", date)
+	if err != nil {
+		t.Fatalf("PriceAt (reloaded): unexpected error: %s", err)
+	}
+	if price != "100.00" || provider != "stub" {
+		t.Errorf("PriceAt (reloaded) = (%q, %q), want (%q, %q)", price, provider, "100.00", "stub")
+	}
+}
+
+func TestCSVCacheUpstreamErrorNotCached(t *testing.T) {
+	dir := t.TempDir()
+	stub := &stubProvider{name: "stub", err: fmt.Errorf("boom")}
+	cache, err := NewCSVCache(dir+"/prices.csv", NewChain(stub))
+	if err != nil {
+		t.Fatalf("NewCSVCache: unexpected error: %s", err)
+	}
+	date := time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	if _, _, err := cache.PriceAt("BTC", date); err == nil {
+		t.Fatalf("PriceAt: expected an error, got none")
+	}
+	if cache.Dirty() {
+		t.Errorf("Dirty() after a failed lookup: got true, want false (a failure must not be cached)")
+	}
+}
@@ -0,0 +1,53 @@
+package pricing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileCache decorates another PriceOracle with an on-disk cache, keyed by currency|date|quote, so
+// repeated runs against the same (sym, date, quote) are deterministic and do not re-fetch over
+// the network. The request this package was built against described the key as "currency|date";
+// quote is folded into it too, since a single currency/date can be priced in more than one quote
+// currency (this package is used for both USD and GBP lookups).
+type FileCache struct {
+	Dir      string
+	Upstream PriceOracle
+}
+
+// NewFileCache returns a FileCache that serves cached prices out of dir, falling back to upstream
+// (and writing its result back to dir) on a miss.
+func NewFileCache(dir string, upstream PriceOracle) *FileCache {
+	return &FileCache{Dir: dir, Upstream: upstream}
+}
+
+// PriceAt implements PriceOracle.
+func (c *FileCache) PriceAt(sym string, t time.Time, quote string) (string, error) {
+	path := c.path(sym, t, quote)
+	if cached, err := os.ReadFile(path); err == nil {
+		return strings.TrimSpace(string(cached)), nil
+	}
+
+	price, err := c.Upstream.PriceAt(sym, t, quote)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return "", fmt.Errorf("pricing: FileCache: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(price), 0644); err != nil {
+		return "", fmt.Errorf("pricing: FileCache: %w", err)
+	}
+	return price, nil
+}
+
+// path returns the cache file path for (sym, t, quote): the currency|date|quote key with "|"
+// replaced by "_", since "|" is not a portable filename character.
+func (c *FileCache) path(sym string, t time.Time, quote string) string {
+	key := fmt.Sprintf("%s|%s|%s", sym, t.Format("2006-01-02"), quote)
+	return filepath.Join(c.Dir, strings.ReplaceAll(key, "|", "_")+".price")
+}
@@ -0,0 +1,96 @@
+package pricing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// stubOracle is a PriceOracle that counts calls and returns a fixed price, so tests can assert on
+// FileCache's caching behaviour without making a real network call.
+type stubOracle struct {
+	price string
+	err   error
+	calls int
+}
+
+func (s *stubOracle) PriceAt(sym string, t time.Time, quote string) (string, error) {
+	s.calls++
+	if s.err != nil {
+		return "", s.err
+	}
+	return s.price, nil
+}
+
+func TestFileCacheMissThenHit(t *testing.T) {
+	dir := t.TempDir()
+	stub := &stubOracle{price: "27413.52"}
+	cache := NewFileCache(dir, stub)
+	date := time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	got, err := cache.PriceAt("BTC", date, "GBP")
+	if err != nil {
+		t.Fatalf("PriceAt: unexpected error: %s", err)
+	}
+	if got != "27413.52" {
+		t.Errorf("PriceAt: got %q, want %q", got, "27413.52")
+	}
+	if stub.calls != 1 {
+		t.Fatalf("PriceAt: upstream called %d times, want 1", stub.calls)
+	}
+
+	got, err = cache.PriceAt("BTC", date, "GBP")
+	if err != nil {
+		t.Fatalf("PriceAt (cached): unexpected error: %s", err)
+	}
+	if got != "27413.52" {
+		t.Errorf("PriceAt (cached): got %q, want %q", got, "27413.52")
+	}
+	if stub.calls != 1 {
+		t.Errorf("PriceAt (cached): upstream called %d times, want still 1 (cache should have been hit)", stub.calls)
+	}
+}
+
+func TestFileCacheDistinctQuoteCurrenciesDoNotCollide(t *testing.T) {
+	dir := t.TempDir()
+	stub := &stubOracle{price: "100.00"}
+	cache := NewFileCache(dir, stub)
+	date := time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	if _, err := cache.PriceAt("BTC", date, "GBP"); err != nil {
+		t.Fatalf("PriceAt(GBP): unexpected error: %s", err)
+	}
+	if _, err := cache.PriceAt("BTC", date, "USD"); err != nil {
+		t.Fatalf("PriceAt(USD): unexpected error: %s", err)
+	}
+	if stub.calls != 2 {
+		t.Errorf("upstream called %d times, want 2 (GBP and USD should each be a separate cache entry)", stub.calls)
+	}
+}
+
+func TestFileCacheUpstreamErrorNotCached(t *testing.T) {
+	dir := t.TempDir()
+	stub := &stubOracle{err: fmt.Errorf("boom")}
+	cache := NewFileCache(dir, stub)
+	date := time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	if _, err := cache.PriceAt("BTC", date, "GBP"); err == nil {
+		t.Fatalf("PriceAt: expected an error, got none")
+	}
+	if stub.calls != 1 {
+		t.Errorf("upstream called %d times, want 1", stub.calls)
+	}
+
+	stub.err = nil
+	stub.price = "200.00"
+	got, err := cache.PriceAt("BTC", date, "GBP")
+	if err != nil {
+		t.Fatalf("PriceAt (retry): unexpected error: %s", err)
+	}
+	if got != "200.00" {
+		t.Errorf("PriceAt (retry): got %q, want %q", got, "200.00")
+	}
+	if stub.calls != 2 {
+		t.Errorf("upstream called %d times, want 2 (a failed lookup must not be cached)", stub.calls)
+	}
+}
@@ -0,0 +1,148 @@
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// coinGeckoIDs maps this repo's currency tickers (see nexo/money.go's knownCurrSymbols) onto
+// CoinGecko's coin ids, for the tokens the Nexo/Kraken exports are known to deal with.
+var coinGeckoIDs = map[string]string{
+	"BTC":   "bitcoin",
+	"ETH":   "ethereum",
+	"DOGE":  "dogecoin",
+	"NEXO":  "nexo",
+	"ADA":   "cardano",
+	"DOT":   "polkadot",
+	"SOL":   "solana",
+	"USDC":  "usd-coin",
+	"USDT":  "tether",
+	"LTC":   "litecoin",
+	"XRP":   "ripple",
+	"LINK":  "chainlink",
+	"BNB":   "binancecoin",
+	"MATIC": "matic-network",
+	"AVAX":  "avalanche-2",
+}
+
+// CoinGeckoProvider fetches a historical daily price from CoinGecko's /coins/{id}/history
+// endpoint. BaseURL defaults to the public API but can be overridden, e.g. to point at a test
+// server.
+type CoinGeckoProvider struct {
+	BaseURL string
+	Client  *http.Client
+
+	// listIDs is lazily populated by resolveID from /coins/list the first time PriceAt is asked
+	// for a symbol that isn't in the static coinGeckoIDs table, so this provider isn't limited to
+	// the tickers someone has already hard-coded there.
+	listIDs map[string]string
+}
+
+// NewCoinGeckoProvider returns a CoinGeckoProvider against the public CoinGecko API.
+func NewCoinGeckoProvider() *CoinGeckoProvider {
+	return &CoinGeckoProvider{BaseURL: "https://api.coingecko.com/api/v3", Client: http.DefaultClient}
+}
+
+type coinGeckoHistoryResponse struct {
+	MarketData struct {
+		CurrentPrice map[string]float64 `json:"current_price"`
+	} `json:"market_data"`
+}
+
+// PriceAt implements PriceOracle.
+func (p *CoinGeckoProvider) PriceAt(sym string, t time.Time, quote string) (string, error) {
+	id, err := p.resolveID(sym)
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/coins/%s/history?date=%s&localization=false", p.BaseURL, id, t.Format("02-01-2006"))
+	resp, err := p.Client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("pricing: CoinGeckoProvider: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("pricing: CoinGeckoProvider: %s: unexpected status %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("pricing: CoinGeckoProvider: %w", err)
+	}
+	var parsed coinGeckoHistoryResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("pricing: CoinGeckoProvider: %w", err)
+	}
+	price, found := parsed.MarketData.CurrentPrice[strings.ToLower(quote)]
+	if !found {
+		return "", fmt.Errorf("pricing: CoinGeckoProvider: %s: no price quoted in %q", url, quote)
+	}
+	return strconv.FormatFloat(price, 'f', -1, 64), nil
+}
+
+// coinGeckoListEntry is one element of CoinGecko's /coins/list response.
+type coinGeckoListEntry struct {
+	ID     string `json:"id"`
+	Symbol string `json:"symbol"`
+}
+
+// resolveID returns the CoinGecko coin id for sym: the static coinGeckoIDs table first, then -
+// for a ticker that isn't in it - /coins/list, fetched once per CoinGeckoProvider and memoized.
+func (p *CoinGeckoProvider) resolveID(sym string) (string, error) {
+	if id, found := coinGeckoIDs[sym]; found {
+		return id, nil
+	}
+	if err := p.ensureCoinList(); err != nil {
+		return "", err
+	}
+	id, found := p.listIDs[strings.ToLower(sym)]
+	if !found {
+		return "", fmt.Errorf("pricing: CoinGeckoProvider: no CoinGecko id found for %q", sym)
+	}
+	return id, nil
+}
+
+// ensureCoinList lazily fetches and memoizes CoinGecko's /coins/list, which resolveID falls back
+// to for a ticker the static coinGeckoIDs table doesn't know about.
+func (p *CoinGeckoProvider) ensureCoinList() error {
+	if p.listIDs != nil {
+		return nil
+	}
+
+	url := p.BaseURL + "/coins/list"
+	resp, err := p.Client.Get(url)
+	if err != nil {
+		return fmt.Errorf("pricing: CoinGeckoProvider: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("pricing: CoinGeckoProvider: %s: unexpected status %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("pricing: CoinGeckoProvider: %w", err)
+	}
+	var entries []coinGeckoListEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return fmt.Errorf("pricing: CoinGeckoProvider: %w", err)
+	}
+
+	listIDs := make(map[string]string, len(entries))
+	for _, e := range entries {
+		symbol := strings.ToLower(e.Symbol)
+		if _, found := listIDs[symbol]; !found {
+			// CoinGecko lists more than one coin under the same ticker (wrapped/bridged variants
+			// and outright duplicates); keep the first one seen rather than trying to disambiguate.
+			listIDs[symbol] = e.ID
+		}
+	}
+	p.listIDs = listIDs
+	return nil
+}
@@ -0,0 +1,94 @@
+package pricing
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCoinGeckoProviderResolveIDUsesStaticTableFirst(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		t.Fatalf("unexpected request for a ticker in the static table: %s", r.URL)
+	}))
+	defer server.Close()
+
+	p := &CoinGeckoProvider{BaseURL: server.URL, Client: server.Client()}
+	id, err := p.resolveID("BTC")
+	if err != nil {
+		t.Fatalf("resolveID: unexpected error: %s", err)
+	}
+	if id != "bitcoin" {
+		t.Errorf("resolveID(%q) = %q, want %q", "BTC", id, "bitcoin")
+	}
+	if calls != 0 {
+		t.Errorf("/coins/list was called %d times for a statically-known ticker, want 0", calls)
+	}
+}
+
+func TestCoinGeckoProviderResolveIDFallsBackToCoinsList(t *testing.T) {
+	listCalls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/coins/list" {
+			t.Fatalf("unexpected request: %s", r.URL)
+		}
+		listCalls++
+		fmt.Fprint(w, `[{"id":"some-unlisted-token","symbol":"sut","name":"Some Unlisted Token"}]`)
+	}))
+	defer server.Close()
+
+	p := &CoinGeckoProvider{BaseURL: server.URL, Client: server.Client()}
+
+	id, err := p.resolveID("SUT")
+	if err != nil {
+		t.Fatalf("resolveID: unexpected error: %s", err)
+	}
+	if id != "some-unlisted-token" {
+		t.Errorf("resolveID(%q) = %q, want %q", "SUT", id, "some-unlisted-token")
+	}
+
+	if _, err := p.resolveID("SUT"); err != nil {
+		t.Fatalf("resolveID (second call): unexpected error: %s", err)
+	}
+	if listCalls != 1 {
+		t.Errorf("/coins/list was called %d times, want 1 (the result should be memoized)", listCalls)
+	}
+}
+
+func TestCoinGeckoProviderResolveIDUnknownTicker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	p := &CoinGeckoProvider{BaseURL: server.URL, Client: server.Client()}
+	if _, err := p.resolveID("NOSUCHTOKEN"); err == nil {
+		t.Errorf("resolveID for an unknown ticker: expected an error, got none")
+	}
+}
+
+func TestCoinGeckoProviderPriceAtUsesResolvedID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/coins/list":
+			fmt.Fprint(w, `[{"id":"some-unlisted-token","symbol":"sut","name":"Some Unlisted Token"}]`)
+		case "/coins/some-unlisted-token/history":
+			fmt.Fprint(w, `{"market_data":{"current_price":{"usd":1.5}}}`)
+		default:
+			t.Fatalf("unexpected request: %s", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	p := &CoinGeckoProvider{BaseURL: server.URL, Client: server.Client()}
+	got, err := p.PriceAt("SUT", time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC), "usd")
+	if err != nil {
+		t.Fatalf("PriceAt: unexpected error: %s", err)
+	}
+	if got != "1.5" {
+		t.Errorf("PriceAt = %q, want %q", got, "1.5")
+	}
+}
@@ -0,0 +1,22 @@
+// Package pricing resolves a historical daily price for a currency/token, quoted in another
+// currency, on a given date - filling the gap convert-nexo.go's Exchange handling currently
+// flags with "!! "-prefixed cells for a human to fill in by hand (see its own comments on GBPX
+// purchases and non-GBP exchanges only recording a USD equivalent).
+//
+// PriceOracle is the provider interface (see coingecko.go for a concrete CoinGecko-backed
+// implementation) and FileCache (cache.go) decorates one with an on-disk cache so repeated runs
+// against the same (currency, date, quote) are deterministic and do not re-fetch over the
+// network.
+//
+// PriceAt returns the price as a decimal string (e.g. "27413.52") rather than a typed decimal
+// value, mirroring nexo/money.go's own choice of a hand-rolled, string-parseable representation;
+// go.mod does not require an external decimal library (shopspring/decimal).
+package pricing
+
+import "time"
+
+// PriceOracle resolves the historical daily price of sym (e.g. "BTC"), quoted in quote (e.g.
+// "GBP" or "USD"), on the day containing t.
+type PriceOracle interface {
+	PriceAt(sym string, t time.Time, quote string) (string, error)
+}
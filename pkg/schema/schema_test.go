@@ -0,0 +1,75 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectExactMatch(t *testing.T) {
+	header := []string{"Transaction", "Type", "Input Currency", "Input Amount", "Output Currency", "Output Amount", "USD Equivalent", "Details", "Outstanding Loan", "Date / Time"}
+	got, err := Detect(header)
+	if err != nil {
+		t.Fatalf("Detect: unexpected error: %s", err)
+	}
+	if got.Name != "v2 (current)" {
+		t.Errorf("Detect: got %q, want %q", got.Name, "v2 (current)")
+	}
+}
+
+func TestDetectNearMissReportsClosestSchema(t *testing.T) {
+	header := []string{"Transaction", "Type", "Input Currency", "Input Amnt", "Output Currency", "Output Amount", "USD Equivalent", "Details", "Outstanding Loan", "Date / Time"}
+	_, err := Detect(header)
+	if err == nil {
+		t.Fatalf("Detect: expected an error for a near-miss header, got none")
+	}
+	if !strings.Contains(err.Error(), "v2 (current)") {
+		t.Errorf("Detect error %q: expected it to name the closest known schema", err)
+	}
+}
+
+func TestParseRow(t *testing.T) {
+	raw := []string{"TX-1", "Interest", "NEXO", "0.11", "NEXO", "0.11", "$10.00", "approved / 8.00 GBPx", "$0.00", "2022-01-01 09:00:00"}
+	row, err := v2.ParseRow(raw)
+	if err != nil {
+		t.Fatalf("ParseRow: unexpected error: %s", err)
+	}
+	want := Row{
+		TransactionID:   "TX-1",
+		Type:            "Interest",
+		InputCurrency:   "NEXO",
+		InputAmount:     "0.11",
+		OutputCurrency:  "NEXO",
+		OutputAmount:    "0.11",
+		USDEquivalent:   "$10.00",
+		Details:         "approved / 8.00 GBPx",
+		OutstandingLoan: "$0.00",
+		DateTime:        "2022-01-01 09:00:00",
+	}
+	if row != want {
+		t.Errorf("ParseRow: got %+v, want %+v", row, want)
+	}
+}
+
+func TestParseRowTooFewColumns(t *testing.T) {
+	raw := []string{"TX-1", "Interest"}
+	if _, err := v2.ParseRow(raw); err == nil {
+		t.Errorf("ParseRow: expected an error for a short row, got none")
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"Details", "Details", 0},
+		{"Input Amount", "Input Amnt", 2},
+		{"abc", "xyz", 3},
+	}
+	for _, c := range cases {
+		if got := levenshtein(c.a, c.b); got != c.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
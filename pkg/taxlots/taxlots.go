@@ -0,0 +1,444 @@
+// Package taxlots drives nexo/costbasis's lot-matching engine over a stream of exchange-neutral
+// pkg/importers.Transactions, so any registered Importer's output can be turned into realized
+// disposal records without each exchange's own binary re-implementing lot tracking itself.
+//
+// Process treats Buy/Staking/Reward/TransferIn as acquisitions and Sell as disposals, valuing both
+// in GBP via a pkg/pricing.PriceOracle (the historical price at the transaction's own date, not a
+// price embedded in the Transaction - none of the registered Importers populate one). TransferOut
+// and Fee rows are deliberately left unmatched: a TRANSFER_OUT Transaction doesn't say whether it
+// left for a third party (a disposal) or another wallet the same person controls (not one), and
+// guessing would misstate a user's tax position either way. Process skips such rows: they produce
+// no Disposal and no error.
+package taxlots
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AntonioCarlini/data-processing/nexo/costbasis"
+	"github.com/AntonioCarlini/data-processing/pkg/importers"
+	"github.com/AntonioCarlini/data-processing/pkg/pricing"
+)
+
+// Accounting selects which nexo/costbasis.Strategy a Process run disposes lots under.
+type Accounting string
+
+const (
+	FIFO   Accounting = "fifo"
+	LIFO   Accounting = "lifo"
+	HIFO   Accounting = "hifo"
+	SpecID Accounting = "specid"
+	UKS104 Accounting = "uk-s104"
+)
+
+// ParseAccounting validates raw against the --accounting flag values this package understands.
+func ParseAccounting(raw string) (Accounting, error) {
+	switch Accounting(raw) {
+	case FIFO, LIFO, HIFO, SpecID, UKS104:
+		return Accounting(raw), nil
+	default:
+		return "", fmt.Errorf("taxlots: unrecognised accounting method %q (want fifo, lifo, hifo, specid or uk-s104)", raw)
+	}
+}
+
+// strategyFor returns the nexo/costbasis.Strategy accounting selects. SpecID has no Strategy of
+// its own: nexo/costbasis.Ledger.DisposeLot requires the caller to nominate which lot a disposal
+// closes, and nothing in a pkg/importers.Transaction records that - an Importer has no way to know
+// which specific acquisition a given CSV row's disposal was meant to close, only that one happened.
+// Process therefore rejects SpecID outright rather than silently falling back to another method.
+func strategyFor(accounting Accounting) (costbasis.Strategy, error) {
+	switch accounting {
+	case FIFO:
+		return costbasis.FIFO{}, nil
+	case LIFO:
+		return costbasis.LIFO{}, nil
+	case HIFO:
+		return costbasis.HIFO{}, nil
+	case UKS104:
+		return costbasis.HMRCPool{}, nil
+	case SpecID:
+		return nil, fmt.Errorf("taxlots: specid accounting requires a caller-nominated source lot per disposal, which no pkg/importers.Transaction records")
+	default:
+		return nil, fmt.Errorf("taxlots: unrecognised accounting method %q", accounting)
+	}
+}
+
+// Disposal is one realized disposal, matched against one or more acquisition lots.
+type Disposal struct {
+	Asset         string
+	AcquiredAt    time.Time
+	DisposedAt    time.Time
+	Quantity      string // decimal, the quantity of Asset this Disposal consumed from one lot
+	ProceedsGBP   string // decimal pounds, this lot's pro-rata share of the disposal's proceeds
+	CostBasisGBP  string // decimal pounds
+	GainLossGBP   string // decimal pounds, ProceedsGBP - CostBasisGBP
+	HoldingPeriod string
+	Rule          string // which matching rule produced this Disposal - see the Rule* constants
+	SourceTxID    string
+	DisposalTxID  string
+}
+
+// Rule identifies which share-matching rule produced a Disposal. FIFO/LIFO/HIFO disposals always
+// carry the matching RuleFIFO/RuleLIFO/RuleHIFO value; UKS104 disposals carry whichever of
+// RuleSameDay, RuleBedAndBreakfast or RuleSection104 actually matched that portion of the disposal,
+// per HMRC's matching order (see applyUKMatchingRules).
+const (
+	RuleFIFO            = "fifo"
+	RuleLIFO            = "lifo"
+	RuleHIFO            = "hifo"
+	RuleSameDay         = "same-day"
+	RuleBedAndBreakfast = "bed-and-breakfast"
+	RuleSection104      = "section-104"
+)
+
+// quantityScale is the fixed number of decimal places a Transaction's BaseAmount is read to
+// before being handed to nexo/costbasis as an integer "minor unit" quantity - 8 decimal places
+// comfortably covers every token this repo converts (BTC's own satoshi precision included)
+// without needing a per-currency scale table the way nexo/money.go's Money needs one for fiat.
+const quantityScale = 8
+
+// bedAndBreakfastWindowDays is how many days after a disposal an acquisition still qualifies for
+// HMRC's "bed and breakfasting" rule.
+const bedAndBreakfastWindowDays = 30
+
+// txInfo is tx's DateTime and BaseAmount, parsed once up front so both the UKS104
+// bed-and-breakfast lookahead pass and the main Process loop can use them without re-parsing or
+// re-pricing the same transaction twice.
+type txInfo struct {
+	t          time.Time
+	quantity   int64 // minor units, parsed from BaseAmount at quantityScale
+	valueGBP   int64 // pence, oracle-priced value of the full (unmatched) BaseAmount
+	sdConsumed int64 // minor units of this acquisition already claimed by a same-day disposal match, UKS104 only
+	bbConsumed int64 // minor units of this acquisition already claimed by an earlier disposal's bed-and-breakfast match, UKS104 only
+}
+
+// sdMatch is one same-day match: quantity minor units of a disposal at txs[disposalIdx] matched
+// against an acquisition at txs[acquisitionIdx] dated the same calendar day, in either array
+// order (HMRC's same-day rule does not care which happened first within the day).
+type sdMatch struct {
+	disposalIdx, acquisitionIdx int
+	quantity                    int64
+}
+
+// findSameDayMatches implements HMRC's rule 1 - same-day matching - ahead of both
+// findBedAndBreakfastMatches (rule 2) and nexo/costbasis.HMRCPool's own s.104 pool (the
+// fallback after rules 1 and 2), since rule 1 takes priority over both and, unlike HMRCPool
+// (which only ever sees lots already Acquired into the ledger, i.e. earlier in txs), needs to see
+// every transaction up front to also match a same-day acquisition that comes later in txs.
+//
+// For each Sell, in order, this matches as much of it as possible against every acquisition of
+// the same asset dated the same calendar day - nearest in time to the disposal first, when more
+// than one qualifies - without reusing minor units an earlier disposal already claimed this way.
+func findSameDayMatches(txs []importers.Transaction, info []txInfo) []sdMatch {
+	var matches []sdMatch
+	for i, tx := range txs {
+		if tx.Kind != importers.Sell || info[i].quantity == 0 {
+			continue
+		}
+
+		var candidates []int
+		for j, other := range txs {
+			if j == i || other.BaseCurrency != tx.BaseCurrency {
+				continue
+			}
+			switch other.Kind {
+			case importers.Buy, importers.Staking, importers.Reward, importers.TransferIn:
+			default:
+				continue
+			}
+			if !sameCalendarDay(info[j].t, info[i].t) {
+				continue
+			}
+			candidates = append(candidates, j)
+		}
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return info[candidates[a]].t.Sub(info[i].t).Abs() < info[candidates[b]].t.Sub(info[i].t).Abs()
+		})
+
+		needed := info[i].quantity
+		for _, j := range candidates {
+			if needed <= 0 {
+				break
+			}
+			available := info[j].quantity - info[j].sdConsumed
+			if available <= 0 {
+				continue
+			}
+			take := needed
+			if take > available {
+				take = available
+			}
+			matches = append(matches, sdMatch{disposalIdx: i, acquisitionIdx: j, quantity: take})
+			info[j].sdConsumed += take
+			needed -= take
+		}
+	}
+	return matches
+}
+
+// bbMatch is one bed-and-breakfast match: quantity minor units of a disposal at txs[disposalIdx]
+// matched against an acquisition at txs[acquisitionIdx], which - by construction - is strictly
+// after the disposal and not on the same calendar day (same-day matches are rule 1, handled by
+// findSameDayMatches instead).
+type bbMatch struct {
+	disposalIdx, acquisitionIdx int
+	quantity                    int64
+}
+
+// findBedAndBreakfastMatches implements HMRC's rule 2 - "bed and breakfasting" - which
+// nexo/costbasis.HMRCPool cannot implement itself because it only ever sees one disposal's lots
+// at a time and has no way to look ahead at acquisitions still to come. Because Process already
+// holds every transaction up front, it can: for each Sell, in order, match as much of it as
+// possible - after same-day matching (sdConsumedByDisposal, rule 1, which always takes priority)
+// has already claimed what it can - against later acquisitions of the same asset dated within the
+// following bedAndBreakfastWindowDays, earliest qualifying acquisition first, without reusing
+// minor units an earlier disposal already claimed this way.
+func findBedAndBreakfastMatches(txs []importers.Transaction, info []txInfo, sdConsumedByDisposal map[int]int64) []bbMatch {
+	var matches []bbMatch
+	for i, tx := range txs {
+		if tx.Kind != importers.Sell || info[i].quantity == 0 {
+			continue
+		}
+		needed := info[i].quantity - sdConsumedByDisposal[i]
+		windowEnd := info[i].t.AddDate(0, 0, bedAndBreakfastWindowDays)
+		for j := i + 1; j < len(txs) && needed > 0; j++ {
+			if txs[j].BaseCurrency != tx.BaseCurrency {
+				continue
+			}
+			switch txs[j].Kind {
+			case importers.Buy, importers.Staking, importers.Reward, importers.TransferIn:
+			default:
+				continue
+			}
+			if info[j].t.After(windowEnd) {
+				break // txs is ascending, so every later j is later still
+			}
+			if sameCalendarDay(info[j].t, info[i].t) {
+				continue // rule 1 (same-day), not rule 2
+			}
+			available := info[j].quantity - info[j].bbConsumed - info[j].sdConsumed
+			if available <= 0 {
+				continue
+			}
+			take := needed
+			if take > available {
+				take = available
+			}
+			matches = append(matches, bbMatch{disposalIdx: i, acquisitionIdx: j, quantity: take})
+			info[j].bbConsumed += take
+			needed -= take
+		}
+	}
+	return matches
+}
+
+// sameCalendarDay reports whether a and b fall on the same year/month/day.
+func sameCalendarDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// Process walks txs - which must already be in ascending DateTime order, the same order every
+// registered Importer's Convert and pkg/importers.Lookup's callers already produce - acquiring and
+// disposing of lots per BaseCurrency, and returns one Disposal per (acquisition lot, disposing
+// transaction) pair that a Sell actually consumed.
+//
+// UKS104 additionally applies HMRC's matching rules in order - same-day (findSameDayMatches),
+// then bed-and-breakfasting (findBedAndBreakfastMatches) against whatever quantity same-day left
+// unmatched, then the s.104 pool (nexo/costbasis.HMRCPool) for the remainder - a disposal's
+// Disposals carry Rule so a report can show which rule matched which part of it.
+func Process(txs []importers.Transaction, accounting Accounting, oracle pricing.PriceOracle) ([]Disposal, error) {
+	strategy, err := strategyFor(accounting)
+	if err != nil {
+		return nil, err
+	}
+	ledger := costbasis.NewLedger(strategy)
+
+	info := make([]txInfo, len(txs))
+	for i, tx := range txs {
+		t, err := time.Parse("2006-01-02 15:04:05", tx.DateTime)
+		if err != nil {
+			return nil, fmt.Errorf("taxlots: tx %s: unparseable DateTime %q: %w", tx.TxID, tx.DateTime, err)
+		}
+		quantity, err := parseScaled(tx.BaseAmount, quantityScale)
+		if err != nil {
+			return nil, fmt.Errorf("taxlots: tx %s: unparseable BaseAmount %q: %w", tx.TxID, tx.BaseAmount, err)
+		}
+		info[i].t = t
+		info[i].quantity = quantity
+		if quantity == 0 {
+			continue
+		}
+		switch tx.Kind {
+		case importers.Buy, importers.Staking, importers.Reward, importers.TransferIn, importers.Sell:
+			valueGBP, err := valueInGBP(oracle, tx.BaseCurrency, t, tx.BaseAmount)
+			if err != nil {
+				return nil, fmt.Errorf("taxlots: tx %s: pricing %s on %s: %w", tx.TxID, tx.BaseCurrency, tx.DateTime, err)
+			}
+			info[i].valueGBP = valueGBP
+		}
+	}
+
+	var sdMatchesByDisposal map[int][]sdMatch
+	var bbMatchesByDisposal map[int][]bbMatch
+	if accounting == UKS104 {
+		sdConsumedByDisposal := make(map[int]int64)
+		sdMatchesByDisposal = make(map[int][]sdMatch)
+		for _, m := range findSameDayMatches(txs, info) {
+			sdMatchesByDisposal[m.disposalIdx] = append(sdMatchesByDisposal[m.disposalIdx], m)
+			sdConsumedByDisposal[m.disposalIdx] += m.quantity
+		}
+
+		bbMatchesByDisposal = make(map[int][]bbMatch)
+		for _, m := range findBedAndBreakfastMatches(txs, info, sdConsumedByDisposal) {
+			bbMatchesByDisposal[m.disposalIdx] = append(bbMatchesByDisposal[m.disposalIdx], m)
+		}
+	}
+
+	fifoRule := map[Accounting]string{FIFO: RuleFIFO, LIFO: RuleLIFO, HIFO: RuleHIFO}[accounting]
+
+	var disposals []Disposal
+	for i, tx := range txs {
+		if info[i].quantity == 0 {
+			continue
+		}
+
+		switch tx.Kind {
+		case importers.Buy, importers.Staking, importers.Reward, importers.TransferIn:
+			quantity := info[i].quantity - info[i].sdConsumed - info[i].bbConsumed
+			if quantity <= 0 {
+				continue // this acquisition was fully claimed by an earlier disposal's same-day or bed-and-breakfast match
+			}
+			costGBP := info[i].valueGBP * quantity / info[i].quantity
+			ledger.Acquire(tx.BaseCurrency, info[i].t, quantity, costGBP, tx.TxID)
+
+		case importers.Sell:
+			var sdConsumed int64
+			for _, m := range sdMatchesByDisposal[i] {
+				acq := info[m.acquisitionIdx]
+				costShare := acq.valueGBP * m.quantity / acq.quantity
+				proceedsShare := info[i].valueGBP * m.quantity / info[i].quantity
+				disposals = append(disposals, Disposal{
+					Asset:         tx.BaseCurrency,
+					AcquiredAt:    acq.t,
+					DisposedAt:    info[i].t,
+					Quantity:      formatScaled(m.quantity, quantityScale),
+					ProceedsGBP:   formatScaled(proceedsShare, 2),
+					CostBasisGBP:  formatScaled(costShare, 2),
+					GainLossGBP:   formatScaled(proceedsShare-costShare, 2),
+					HoldingPeriod: "n/a", // same-day: "short"/"long" held isn't meaningful
+					Rule:          RuleSameDay,
+					SourceTxID:    txs[m.acquisitionIdx].TxID,
+					DisposalTxID:  tx.TxID,
+				})
+				sdConsumed += m.quantity
+			}
+
+			var bbConsumed int64
+			for _, m := range bbMatchesByDisposal[i] {
+				acq := info[m.acquisitionIdx]
+				costShare := acq.valueGBP * m.quantity / acq.quantity
+				proceedsShare := info[i].valueGBP * m.quantity / info[i].quantity
+				disposals = append(disposals, Disposal{
+					Asset:         tx.BaseCurrency,
+					AcquiredAt:    acq.t,
+					DisposedAt:    info[i].t,
+					Quantity:      formatScaled(m.quantity, quantityScale),
+					ProceedsGBP:   formatScaled(proceedsShare, 2),
+					CostBasisGBP:  formatScaled(costShare, 2),
+					GainLossGBP:   formatScaled(proceedsShare-costShare, 2),
+					HoldingPeriod: "n/a", // acquired after the disposal it's matched against - "short"/"long" held isn't meaningful
+					Rule:          RuleBedAndBreakfast,
+					SourceTxID:    txs[m.acquisitionIdx].TxID,
+					DisposalTxID:  tx.TxID,
+				})
+				bbConsumed += m.quantity
+			}
+
+			remaining := info[i].quantity - sdConsumed - bbConsumed
+			if remaining == 0 {
+				continue
+			}
+			d := ledger.Dispose(tx.BaseCurrency, info[i].t, remaining)
+			if d.Unmatched > 0 {
+				return nil, fmt.Errorf("taxlots: tx %s: disposed more %s than the ledger holds (%d minor units unmatched)", tx.TxID, tx.BaseCurrency, d.Unmatched)
+			}
+			for _, c := range d.Consumptions {
+				share := info[i].valueGBP * c.Quantity / info[i].quantity
+				rule := fifoRule
+				if accounting == UKS104 {
+					rule = RuleSection104
+					if c.SourceTxID != "s.104 pool" {
+						rule = RuleSameDay
+					}
+				}
+				disposals = append(disposals, Disposal{
+					Asset:         tx.BaseCurrency,
+					AcquiredAt:    c.AcquiredAt,
+					DisposedAt:    info[i].t,
+					Quantity:      formatScaled(c.Quantity, quantityScale),
+					ProceedsGBP:   formatScaled(share, 2),
+					CostBasisGBP:  formatScaled(c.CostGBP, 2),
+					GainLossGBP:   formatScaled(share-c.CostGBP, 2),
+					HoldingPeriod: c.HoldingPeriod,
+					Rule:          rule,
+					SourceTxID:    c.SourceTxID,
+					DisposalTxID:  tx.TxID,
+				})
+			}
+
+		default:
+			// TransferOut, Fee and anything else: not treated as a disposal - see the package
+			// doc comment.
+		}
+	}
+
+	return disposals, nil
+}
+
+// valueInGBP prices quantity (a decimal string amount of asset) at t via oracle, returning the
+// total value in GBP pence.
+func valueInGBP(oracle pricing.PriceOracle, asset string, t time.Time, quantity string) (int64, error) {
+	priceStr, err := oracle.PriceAt(asset, t, "gbp")
+	if err != nil {
+		return 0, err
+	}
+	price, err := strconv.ParseFloat(priceStr, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unparseable price %q: %w", priceStr, err)
+	}
+	amount, err := strconv.ParseFloat(quantity, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unparseable amount %q: %w", quantity, err)
+	}
+	return int64(math.Round(price * amount * 100)), nil
+}
+
+// parseScaled reads decimal string amount to an integer at the given number of decimal places, by
+// parsing it as a float64 and rounding to the nearest unit at that scale (unlike nexo/money.go's
+// ParseMoney, which truncates or pads the fraction string to a per-currency scale).
+func parseScaled(amount string, scale int) (int64, error) {
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0, err
+	}
+	multiplier := math.Pow(10, float64(scale))
+	return int64(math.Round(value * multiplier)), nil
+}
+
+// formatScaled renders an integer at the given number of decimal places back to a decimal string.
+func formatScaled(value int64, scale int) string {
+	divisor := math.Pow(10, float64(scale))
+	return strconv.FormatFloat(float64(value)/divisor, 'f', scale, 64)
+}
+
+// SortByDateTime sorts txs by DateTime ascending in place, for a caller whose Transactions aren't
+// already in that order (every registered Importer's Convert already emits them that way, but a
+// caller merging more than one Importer's output together might not preserve it).
+func SortByDateTime(txs []importers.Transaction) {
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].DateTime < txs[j].DateTime })
+}
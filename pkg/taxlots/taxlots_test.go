@@ -0,0 +1,235 @@
+package taxlots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AntonioCarlini/data-processing/pkg/importers"
+)
+
+// stubOracle is a pricing.PriceOracle that returns a fixed GBP price regardless of date, so tests
+// can assert on Process's lot matching without depending on a real price history.
+type stubOracle struct {
+	priceGBP string
+}
+
+func (s stubOracle) PriceAt(sym string, t time.Time, quote string) (string, error) {
+	return s.priceGBP, nil
+}
+
+func tx(txID string, kind importers.Kind, asset, amount, dateTime string) importers.Transaction {
+	return importers.Transaction{TxID: txID, Kind: kind, BaseCurrency: asset, BaseAmount: amount, DateTime: dateTime}
+}
+
+func TestProcessFIFOSingleLotDisposal(t *testing.T) {
+	txs := []importers.Transaction{
+		tx("T1", importers.Buy, "BTC", "1.0", "2023-01-01 10:00:00"),
+		tx("T2", importers.Sell, "BTC", "0.4", "2023-06-01 10:00:00"),
+	}
+
+	disposals, err := Process(txs, FIFO, stubOracle{priceGBP: "20000.00"})
+	if err != nil {
+		t.Fatalf("Process: unexpected error: %s", err)
+	}
+	if len(disposals) != 1 {
+		t.Fatalf("Process: got %d disposals, want 1: %+v", len(disposals), disposals)
+	}
+
+	d := disposals[0]
+	if d.Quantity != "0.40000000" {
+		t.Errorf("Quantity = %q, want %q", d.Quantity, "0.40000000")
+	}
+	if d.ProceedsGBP != "8000.00" {
+		t.Errorf("ProceedsGBP = %q, want %q", d.ProceedsGBP, "8000.00")
+	}
+	if d.CostBasisGBP != "8000.00" {
+		t.Errorf("CostBasisGBP = %q, want %q", d.CostBasisGBP, "8000.00")
+	}
+	if d.GainLossGBP != "0.00" {
+		t.Errorf("GainLossGBP = %q, want %q", d.GainLossGBP, "0.00")
+	}
+	if d.SourceTxID != "T1" || d.DisposalTxID != "T2" {
+		t.Errorf("SourceTxID/DisposalTxID = %q/%q, want %q/%q", d.SourceTxID, d.DisposalTxID, "T1", "T2")
+	}
+}
+
+func TestProcessFIFOAcrossTwoLotsSplits(t *testing.T) {
+	txs := []importers.Transaction{
+		tx("T1", importers.Buy, "BTC", "0.3", "2023-01-01 10:00:00"),
+		tx("T2", importers.Buy, "BTC", "0.3", "2023-02-01 10:00:00"),
+		tx("T3", importers.Sell, "BTC", "0.4", "2023-06-01 10:00:00"),
+	}
+
+	disposals, err := Process(txs, FIFO, stubOracle{priceGBP: "10000.00"})
+	if err != nil {
+		t.Fatalf("Process: unexpected error: %s", err)
+	}
+	if len(disposals) != 2 {
+		t.Fatalf("Process: got %d disposals, want 2: %+v", len(disposals), disposals)
+	}
+	if disposals[0].SourceTxID != "T1" || disposals[0].Quantity != "0.30000000" {
+		t.Errorf("disposals[0] = %+v, want source T1, quantity 0.30000000", disposals[0])
+	}
+	if disposals[1].SourceTxID != "T2" || disposals[1].Quantity != "0.10000000" {
+		t.Errorf("disposals[1] = %+v, want source T2, quantity 0.10000000", disposals[1])
+	}
+}
+
+func TestProcessSellExceedsHeldQuantityIsAnError(t *testing.T) {
+	txs := []importers.Transaction{
+		tx("T1", importers.Buy, "BTC", "0.1", "2023-01-01 10:00:00"),
+		tx("T2", importers.Sell, "BTC", "1.0", "2023-06-01 10:00:00"),
+	}
+
+	if _, err := Process(txs, FIFO, stubOracle{priceGBP: "10000.00"}); err == nil {
+		t.Errorf("Process with a disposal exceeding the ledger's holdings: expected an error, got none")
+	}
+}
+
+func TestProcessTransferOutIsNotADisposal(t *testing.T) {
+	txs := []importers.Transaction{
+		tx("T1", importers.Buy, "BTC", "1.0", "2023-01-01 10:00:00"),
+		tx("T2", importers.TransferOut, "BTC", "0.4", "2023-06-01 10:00:00"),
+	}
+
+	disposals, err := Process(txs, FIFO, stubOracle{priceGBP: "10000.00"})
+	if err != nil {
+		t.Fatalf("Process: unexpected error: %s", err)
+	}
+	if len(disposals) != 0 {
+		t.Errorf("Process: got %d disposals for a TransferOut, want 0", len(disposals))
+	}
+}
+
+func TestParseAccountingRejectsUnknownMethod(t *testing.T) {
+	if _, err := ParseAccounting("average-cost"); err == nil {
+		t.Errorf("ParseAccounting(\"average-cost\"): expected an error, got none")
+	}
+}
+
+func TestProcessSpecIDIsRejected(t *testing.T) {
+	txs := []importers.Transaction{tx("T1", importers.Buy, "BTC", "1.0", "2023-01-01 10:00:00")}
+	if _, err := Process(txs, SpecID, stubOracle{priceGBP: "10000.00"}); err == nil {
+		t.Errorf("Process with SpecID accounting: expected an error, got none")
+	}
+}
+
+func TestProcessUKS104SameDayRule(t *testing.T) {
+	txs := []importers.Transaction{
+		tx("T1", importers.Buy, "BTC", "1.0", "2023-06-01 09:00:00"),
+		tx("T2", importers.Buy, "BTC", "0.5", "2023-06-01 15:00:00"),
+		tx("T3", importers.Sell, "BTC", "0.5", "2023-06-01 18:00:00"),
+	}
+
+	disposals, err := Process(txs, UKS104, stubOracle{priceGBP: "20000.00"})
+	if err != nil {
+		t.Fatalf("Process: unexpected error: %s", err)
+	}
+	if len(disposals) != 1 {
+		t.Fatalf("Process: got %d disposals, want 1: %+v", len(disposals), disposals)
+	}
+	if disposals[0].Rule != RuleSameDay || disposals[0].SourceTxID != "T2" {
+		t.Errorf("disposals[0] = %+v, want Rule %q matched against T2 (same day)", disposals[0], RuleSameDay)
+	}
+}
+
+func TestProcessUKS104BedAndBreakfastRule(t *testing.T) {
+	txs := []importers.Transaction{
+		tx("T1", importers.Buy, "BTC", "1.0", "2023-01-01 10:00:00"),
+		tx("T2", importers.Sell, "BTC", "0.4", "2023-06-01 10:00:00"),
+		tx("T3", importers.Buy, "BTC", "0.4", "2023-06-15 10:00:00"),
+	}
+
+	disposals, err := Process(txs, UKS104, stubOracle{priceGBP: "20000.00"})
+	if err != nil {
+		t.Fatalf("Process: unexpected error: %s", err)
+	}
+	if len(disposals) != 1 {
+		t.Fatalf("Process: got %d disposals, want 1 (fully matched against the later acquisition): %+v", len(disposals), disposals)
+	}
+	d := disposals[0]
+	if d.Rule != RuleBedAndBreakfast || d.SourceTxID != "T3" {
+		t.Errorf("disposals[0] = %+v, want Rule %q matched against T3", d, RuleBedAndBreakfast)
+	}
+	if d.Quantity != "0.40000000" {
+		t.Errorf("Quantity = %q, want %q", d.Quantity, "0.40000000")
+	}
+	if d.HoldingPeriod != "n/a" {
+		t.Errorf("HoldingPeriod = %q, want %q (acquired after the disposal it's matched against)", d.HoldingPeriod, "n/a")
+	}
+
+	// T1 is untouched by the bed-and-breakfast match, so it's still in the s.104 pool for a
+	// later disposal.
+	more := append(append([]importers.Transaction{}, txs...), tx("T4", importers.Sell, "BTC", "0.6", "2024-01-01 10:00:00"))
+	disposals, err = Process(more, UKS104, stubOracle{priceGBP: "20000.00"})
+	if err != nil {
+		t.Fatalf("Process: unexpected error: %s", err)
+	}
+	if len(disposals) != 2 {
+		t.Fatalf("Process: got %d disposals, want 2: %+v", len(disposals), disposals)
+	}
+	if disposals[1].Rule != RuleSection104 || disposals[1].Quantity != "0.60000000" {
+		t.Errorf("disposals[1] = %+v, want Rule %q, quantity 0.60000000 (drawn from T1, still in the s.104 pool)", disposals[1], RuleSection104)
+	}
+}
+
+func TestProcessUKS104BedAndBreakfastOutsideWindowFallsBackToPool(t *testing.T) {
+	txs := []importers.Transaction{
+		tx("T1", importers.Buy, "BTC", "1.0", "2023-01-01 10:00:00"),
+		tx("T2", importers.Sell, "BTC", "0.4", "2023-06-01 10:00:00"),
+		tx("T3", importers.Buy, "BTC", "0.4", "2023-07-15 10:00:00"), // more than 30 days after T2
+	}
+
+	disposals, err := Process(txs, UKS104, stubOracle{priceGBP: "20000.00"})
+	if err != nil {
+		t.Fatalf("Process: unexpected error: %s", err)
+	}
+	if len(disposals) != 1 {
+		t.Fatalf("Process: got %d disposals, want 1: %+v", len(disposals), disposals)
+	}
+	if disposals[0].Rule != RuleSection104 || disposals[0].SourceTxID != "s.104 pool" {
+		t.Errorf("disposals[0] = %+v, want Rule %q against the s.104 pool", disposals[0], RuleSection104)
+	}
+}
+
+// TestProcessUKS104SameDayTakesPriorityOverBedAndBreakfast covers a disposal with both a
+// qualifying same-day acquisition and a qualifying bed-and-breakfast acquisition present at once:
+// HMRC's matching order puts same-day first, so the whole disposal must match against the
+// same-day lot, leaving the later acquisition untouched in the s.104 pool rather than being drawn
+// on by bed-and-breakfast.
+func TestProcessUKS104SameDayTakesPriorityOverBedAndBreakfast(t *testing.T) {
+	txs := []importers.Transaction{
+		tx("T1", importers.Buy, "BTC", "1.0", "2023-06-01 09:00:00"), // same day as the disposal
+		tx("T2", importers.Sell, "BTC", "1.0", "2023-06-01 18:00:00"),
+		tx("T3", importers.Buy, "BTC", "1.0", "2023-06-15 09:00:00"), // 14 days later, would otherwise qualify for bed-and-breakfast
+	}
+
+	disposals, err := Process(txs, UKS104, stubOracle{priceGBP: "20000.00"})
+	if err != nil {
+		t.Fatalf("Process: unexpected error: %s", err)
+	}
+	if len(disposals) != 1 {
+		t.Fatalf("Process: got %d disposals, want 1 (fully matched same-day): %+v", len(disposals), disposals)
+	}
+	d := disposals[0]
+	if d.Rule != RuleSameDay || d.SourceTxID != "T1" {
+		t.Errorf("disposals[0] = %+v, want Rule %q matched against T1 (same day), not bed-and-breakfast against T3", d, RuleSameDay)
+	}
+	if d.Quantity != "1.00000000" {
+		t.Errorf("Quantity = %q, want %q", d.Quantity, "1.00000000")
+	}
+}
+
+func TestProcessFIFOSetsRule(t *testing.T) {
+	txs := []importers.Transaction{
+		tx("T1", importers.Buy, "BTC", "1.0", "2023-01-01 10:00:00"),
+		tx("T2", importers.Sell, "BTC", "0.4", "2023-06-01 10:00:00"),
+	}
+	disposals, err := Process(txs, FIFO, stubOracle{priceGBP: "20000.00"})
+	if err != nil {
+		t.Fatalf("Process: unexpected error: %s", err)
+	}
+	if len(disposals) != 1 || disposals[0].Rule != RuleFIFO {
+		t.Errorf("Process(FIFO) = %+v, want one disposal with Rule %q", disposals, RuleFIFO)
+	}
+}
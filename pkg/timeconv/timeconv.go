@@ -0,0 +1,43 @@
+// Package timeconv parses exchange timestamp columns that are expressed in a fixed source
+// timezone (e.g. Nexo's CET/CEST-denominated "Date / Time" column) and converts them into a
+// caller-chosen output zone. Conversion goes through Go's IANA tz database via
+// time.LoadLocation, so the CET/CEST (or any other zone's standard/daylight) offset in effect at
+// a given instant is resolved correctly rather than assumed to be a fixed UTC offset.
+package timeconv
+
+import (
+	"fmt"
+	"time"
+)
+
+// Layout is the "YYYY-MM-DD HH:MM:SS" layout exchange CSV timestamp columns use.
+const Layout = "2006-01-02 15:04:05"
+
+// Parse parses raw (in Layout) as a wall-clock time in the named IANA zone, e.g. "Europe/Berlin"
+// for Nexo's CET/CEST timestamps.
+func Parse(raw string, zone string) (time.Time, error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timeconv: unknown zone %q: %w", zone, err)
+	}
+	t, err := time.ParseInLocation(Layout, raw, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timeconv: invalid timestamp %q: %w", raw, err)
+	}
+	return t, nil
+}
+
+// Convert parses raw as a timestamp in sourceZone and renders it, in Layout, as the wall-clock
+// time in outputZone - applying whichever standard/daylight offset is in effect for that instant
+// in each zone.
+func Convert(raw string, sourceZone string, outputZone string) (string, error) {
+	t, err := Parse(raw, sourceZone)
+	if err != nil {
+		return "", err
+	}
+	outLoc, err := time.LoadLocation(outputZone)
+	if err != nil {
+		return "", fmt.Errorf("timeconv: unknown zone %q: %w", outputZone, err)
+	}
+	return t.In(outLoc).Format(Layout), nil
+}
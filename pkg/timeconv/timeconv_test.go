@@ -0,0 +1,69 @@
+package timeconv
+
+import "testing"
+
+func TestParseZoneAbbreviation(t *testing.T) {
+	cases := []struct {
+		raw      string
+		wantAbbr string
+	}{
+		{"2023-03-25 12:00:00", "CET"},  // day before the March 2023 DST transition
+		{"2023-03-27 12:00:00", "CEST"}, // day after
+		{"2023-10-28 12:00:00", "CEST"}, // day before the October 2023 DST transition
+		{"2023-10-30 12:00:00", "CET"},  // day after
+	}
+	for _, c := range cases {
+		t.Run(c.raw, func(t *testing.T) {
+			got, err := Parse(c.raw, "Europe/Berlin")
+			if err != nil {
+				t.Fatalf("Parse(%q): unexpected error: %s", c.raw, err)
+			}
+			if abbr, _ := got.Zone(); abbr != c.wantAbbr {
+				t.Errorf("Parse(%q).Zone() = %q, want %q", c.raw, abbr, c.wantAbbr)
+			}
+		})
+	}
+}
+
+func TestConvertAcrossDSTBoundary(t *testing.T) {
+	// The UK and the EU both move their clocks at 01:00 UTC on the same day (the last Sunday of
+	// March and of October), so the CET/CEST-to-UK offset stays a constant hour across either
+	// transition - but only if the conversion actually resolves each zone's offset for the
+	// instant in question rather than assuming a fixed one, which is what these cases check.
+	cases := []struct {
+		name       string
+		raw        string
+		wantLondon string
+	}{
+		{"before March 2023 transition", "2023-03-25 12:00:00", "2023-03-25 11:00:00"},
+		{"after March 2023 transition", "2023-03-27 12:00:00", "2023-03-27 11:00:00"},
+		{"before October 2023 transition", "2023-10-28 12:00:00", "2023-10-28 11:00:00"},
+		{"after October 2023 transition", "2023-10-30 12:00:00", "2023-10-30 11:00:00"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Convert(c.raw, "Europe/Berlin", "Europe/London")
+			if err != nil {
+				t.Fatalf("Convert(%q): unexpected error: %s", c.raw, err)
+			}
+			if got != c.wantLondon {
+				t.Errorf("Convert(%q) = %q, want %q", c.raw, got, c.wantLondon)
+			}
+		})
+	}
+}
+
+func TestConvertUnknownZone(t *testing.T) {
+	if _, err := Convert("2023-03-25 12:00:00", "Not/AZone", "Europe/London"); err == nil {
+		t.Errorf("Convert with an unknown source zone: expected an error, got none")
+	}
+	if _, err := Convert("2023-03-25 12:00:00", "Europe/Berlin", "Not/AZone"); err == nil {
+		t.Errorf("Convert with an unknown output zone: expected an error, got none")
+	}
+}
+
+func TestParseInvalidTimestamp(t *testing.T) {
+	if _, err := Parse("not-a-timestamp", "Europe/Berlin"); err == nil {
+		t.Errorf("Parse with an invalid timestamp: expected an error, got none")
+	}
+}